@@ -0,0 +1,291 @@
+// Copyright The OpenTelemetry Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package humioexporter
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"sync"
+	"time"
+)
+
+// A client which accumulates the events of sends within the accumulation window,
+// and sends them to Humio in a single request. Each send only returns once the
+// request holding its events has completed, such that failed events can still
+// be retried by the exporter helper
+type accumulatingClient struct {
+	next         exporterClient
+	structured   *accumulator
+	unstructured *accumulator
+}
+
+// Wraps the client such that sends are accumulated for up to the window
+func newAccumulatingClient(cfg *Config, next exporterClient) *accumulatingClient {
+	var budget *retryBudget
+	if cfg.MaxTotalRetryDuration > 0 {
+		budget = newRetryBudget(cfg)
+	}
+
+	return &accumulatingClient{
+		next: next,
+		structured: newAccumulator(cfg.AccumulationWindow, budget, func(ctx context.Context, groups []eventGroup) ([]int, error) {
+			evts := make([]*HumioStructuredEvents, len(groups))
+			for i, group := range groups {
+				evts[i] = group.(*HumioStructuredEvents)
+			}
+
+			// Events of different sends may share the same data source
+			evts, order := arrangeStructuredEvents(cfg, evts)
+			return order, next.sendStructuredEvents(ctx, evts)
+		}),
+		unstructured: newAccumulator(cfg.AccumulationWindow, budget, func(ctx context.Context, groups []eventGroup) ([]int, error) {
+			evts := make([]*HumioUnstructuredEvents, len(groups))
+			for i, group := range groups {
+				evts[i] = group.(*HumioUnstructuredEvents)
+			}
+			return nil, next.sendUnstructuredEvents(ctx, evts)
+		}),
+	}
+}
+
+func (a *accumulatingClient) sendUnstructuredEvents(ctx context.Context, evts []*HumioUnstructuredEvents) error {
+	return a.unstructured.send(ctx, asEventGroups(evts))
+}
+
+func (a *accumulatingClient) sendStructuredEvents(ctx context.Context, evts []*HumioStructuredEvents) error {
+	return a.structured.send(ctx, asEventGroups(evts))
+}
+
+func (a *accumulatingClient) checkEndpoint(ctx context.Context) error {
+	return a.next.checkEndpoint(ctx)
+}
+
+func (a *accumulatingClient) start(ctx context.Context) error {
+	return a.next.start(ctx)
+}
+
+// Sends the accumulated events right away, and sends any further events without
+// accumulating them, which is called as soon as shutdown begins
+func (a *accumulatingClient) drain() {
+	a.structured.close()
+	a.unstructured.close()
+}
+
+func (a *accumulatingClient) shutdown(ctx context.Context) error {
+	a.drain()
+	return a.next.shutdown(ctx)
+}
+
+// Sends the merged event groups, and returns the position each event had in the
+// groups in the order they were sent, or nil if their order is unchanged
+type accumulatedSend func(ctx context.Context, groups []eventGroup) ([]int, error)
+
+// A send waiting for the accumulated request holding its events
+type pendingSend struct {
+	ctx    context.Context
+	groups []eventGroup
+	done   chan error
+}
+
+// Accumulates the event groups of sends of a single kind of events
+type accumulator struct {
+	window     time.Duration
+	sendGroups accumulatedSend
+
+	// The budget of the sends, or nil when their retries are not limited
+	budget *retryBudget
+
+	mu      sync.Mutex
+	pending []*pendingSend
+	timer   *time.Timer
+	closed  bool
+}
+
+func newAccumulator(window time.Duration, budget *retryBudget, send accumulatedSend) *accumulator {
+	return &accumulator{window: window, sendGroups: send, budget: budget}
+}
+
+// Add the groups to the accumulated request, and wait for it to complete
+func (a *accumulator) send(ctx context.Context, groups []eventGroup) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	p := &pendingSend{ctx: ctx, groups: groups, done: make(chan error, 1)}
+
+	a.mu.Lock()
+	if a.closed {
+		a.mu.Unlock()
+		a.flushPending([]*pendingSend{p})
+		return <-p.done
+	}
+	a.pending = append(a.pending, p)
+	if a.timer == nil {
+		a.timer = time.AfterFunc(a.window, a.flush)
+	}
+	a.mu.Unlock()
+
+	select {
+	case err := <-p.done:
+		return err
+	case <-ctx.Done():
+		// Events which have not been sent yet are left out of the request,
+		// while a request which is already being sent cannot be canceled
+		a.mu.Lock()
+		for i, other := range a.pending {
+			if other == p {
+				a.pending = append(a.pending[:i], a.pending[i+1:]...)
+				break
+			}
+		}
+		a.mu.Unlock()
+		return ctx.Err()
+	}
+}
+
+// Send the accumulated events of the current window
+func (a *accumulator) flush() {
+	a.mu.Lock()
+	pending := a.pending
+	a.pending = nil
+	if a.timer != nil {
+		a.timer.Stop()
+		a.timer = nil
+	}
+	a.mu.Unlock()
+
+	if len(pending) > 0 {
+		a.flushPending(pending)
+	}
+}
+
+// Send the accumulated events right away, after which events are no longer accumulated
+func (a *accumulator) close() {
+	a.mu.Lock()
+	a.closed = true
+	a.mu.Unlock()
+	a.flush()
+}
+
+// Send the events of the pending sends in a single request, and report the
+// outcome to each of them. Sends which exhausted their retry budget are sent
+// on their own, such that the budget only fails their own events
+func (a *accumulator) flushPending(pending []*pendingSend) {
+	if a.budget != nil {
+		var fresh []*pendingSend
+		for _, p := range pending {
+			if remaining, ok := a.budget.remaining(p.ctx); ok && remaining <= 0 {
+				a.sendPending([]*pendingSend{p}, p.ctx)
+			} else {
+				fresh = append(fresh, p)
+			}
+		}
+		pending = fresh
+	}
+	if len(pending) == 0 {
+		return
+	}
+
+	// The merged request holds the events of sends which started at different
+	// times, so it is sent without the budget of any single one of them
+	values := pending[0].ctx
+	if len(pending) > 1 {
+		values = withoutRetryStart(values)
+	}
+	a.sendPending(pending, values)
+}
+
+// Send the events of the pending sends in a single request, which carries the
+// values of the specified context
+func (a *accumulator) sendPending(pending []*pendingSend, values context.Context) {
+	var groups []eventGroup
+	var owners []int
+	offsets := make([]int, len(pending))
+	for i, p := range pending {
+		offsets[i] = len(owners)
+		groups = append(groups, p.groups...)
+		for _, group := range p.groups {
+			for j := 0; j < group.count(); j++ {
+				owners = append(owners, i)
+			}
+		}
+	}
+
+	// The request must not be canceled when only one of the sends is canceled,
+	// but only once all of them are
+	ctx, cancel := context.WithCancel(detachedContext{parent: values})
+	defer cancel()
+	go func() {
+		for _, p := range pending {
+			select {
+			case <-p.ctx.Done():
+			case <-ctx.Done():
+				return
+			}
+		}
+		cancel()
+	}()
+
+	order, err := a.sendGroups(ctx, groups)
+
+	var partial *partialFailureError
+	if !errors.As(err, &partial) {
+		for _, p := range pending {
+			p.done <- err
+		}
+		return
+	}
+
+	// Only the sends with failed events need to retry them, using the
+	// positions of the events within their own groups
+	failed := make([][]int, len(pending))
+	for _, pos := range partial.failed {
+		if order != nil {
+			pos = order[pos]
+		}
+		owner := owners[pos]
+		failed[owner] = append(failed[owner], pos-offsets[owner])
+	}
+	for i, p := range pending {
+		if len(failed[i]) == 0 {
+			p.done <- nil
+			continue
+		}
+		sort.Ints(failed[i])
+		p.done <- &partialFailureError{err: partial.err, failed: failed[i]}
+	}
+}
+
+// A context which carries the values of its parent without its cancellation
+type detachedContext struct {
+	parent context.Context
+}
+
+func (c detachedContext) Deadline() (time.Time, bool) {
+	return time.Time{}, false
+}
+
+func (c detachedContext) Done() <-chan struct{} {
+	return nil
+}
+
+func (c detachedContext) Err() error {
+	return nil
+}
+
+func (c detachedContext) Value(key interface{}) interface{} {
+	return c.parent.Value(key)
+}
@@ -0,0 +1,401 @@
+// Copyright The OpenTelemetry Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package humioexporter
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/collector/consumer/consumererror"
+)
+
+// A client recording the events of every request, which is safe for concurrent use
+type recordingClient struct {
+	mu           sync.Mutex
+	structured   [][]*HumioStructuredEvents
+	unstructured [][]*HumioUnstructuredEvents
+	ctxs         []context.Context
+	err          error
+	closed       bool
+}
+
+func (r *recordingClient) sendUnstructuredEvents(ctx context.Context, evts []*HumioUnstructuredEvents) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.unstructured = append(r.unstructured, evts)
+	r.ctxs = append(r.ctxs, ctx)
+	return r.err
+}
+
+func (r *recordingClient) sendStructuredEvents(ctx context.Context, evts []*HumioStructuredEvents) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.structured = append(r.structured, evts)
+	r.ctxs = append(r.ctxs, ctx)
+	return r.err
+}
+
+func (r *recordingClient) checkEndpoint(context.Context) error {
+	return nil
+}
+
+func (r *recordingClient) start(context.Context) error {
+	return nil
+}
+
+func (r *recordingClient) shutdown(context.Context) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.closed = true
+	return nil
+}
+
+func (r *recordingClient) requests() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return len(r.structured) + len(r.unstructured)
+}
+
+// Creates a payload holding the specified number of events under a single tag
+func makeAccumulatedEvents(tag string, count int) []*HumioStructuredEvents {
+	evts := make([]*HumioStructuredEvent, count)
+	for i := range evts {
+		evts[i] = &HumioStructuredEvent{
+			Timestamp:  time.Date(2021, 3, 28, 12, 30, 15, 0, time.UTC),
+			Attributes: map[string]interface{}{"id": tag + strconv.Itoa(i)},
+		}
+	}
+	return []*HumioStructuredEvents{
+		{
+			Tags:   map[string]string{"tag": tag},
+			Events: evts,
+		},
+	}
+}
+
+// Sends each payload concurrently, and returns the error of every send
+func sendConcurrently(client exporterClient, payloads ...[]*HumioStructuredEvents) []error {
+	errs := make([]error, len(payloads))
+	var wg sync.WaitGroup
+	for i, payload := range payloads {
+		wg.Add(1)
+		go func(i int, payload []*HumioStructuredEvents) {
+			defer wg.Done()
+			errs[i] = client.sendStructuredEvents(context.Background(), payload)
+		}(i, payload)
+	}
+	wg.Wait()
+	return errs
+}
+
+func TestAccumulatingClientMergesSends(t *testing.T) {
+	// Arrange
+	next := &recordingClient{}
+	client := newAccumulatingClient(&Config{AccumulationWindow: 100 * time.Millisecond}, next)
+
+	// Act
+	errs := sendConcurrently(client,
+		makeAccumulatedEvents("a", 2),
+		makeAccumulatedEvents("b", 1),
+		makeAccumulatedEvents("a", 3),
+	)
+
+	// Assert
+	assert.Equal(t, []error{nil, nil, nil}, errs)
+	require.Len(t, next.structured, 1)
+
+	// Sends sharing the same tags are merged into a single data source
+	groups := next.structured[0]
+	require.Len(t, groups, 2)
+	counts := map[string]int{}
+	for _, group := range groups {
+		counts[group.Tags["tag"]] = len(group.Events)
+	}
+	assert.Equal(t, map[string]int{"a": 5, "b": 1}, counts)
+}
+
+func TestAccumulatingClientSeparateWindows(t *testing.T) {
+	// Arrange
+	next := &recordingClient{}
+	client := newAccumulatingClient(&Config{AccumulationWindow: 10 * time.Millisecond}, next)
+
+	// Act
+	err1 := client.sendStructuredEvents(context.Background(), makeAccumulatedEvents("a", 1))
+	err2 := client.sendStructuredEvents(context.Background(), makeAccumulatedEvents("a", 1))
+
+	// Assert
+	require.NoError(t, err1)
+	require.NoError(t, err2)
+	assert.Equal(t, 2, next.requests())
+}
+
+func TestAccumulatingClientUnstructured(t *testing.T) {
+	// Arrange
+	next := &recordingClient{}
+	client := newAccumulatingClient(&Config{AccumulationWindow: 100 * time.Millisecond}, next)
+
+	// Act
+	var wg sync.WaitGroup
+	errs := make([]error, 2)
+	for i := range errs {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			errs[i] = client.sendUnstructuredEvents(context.Background(), []*HumioUnstructuredEvents{
+				{Messages: []string{"msg" + strconv.Itoa(i)}},
+			})
+		}(i)
+	}
+	wg.Wait()
+
+	// Assert
+	assert.Equal(t, []error{nil, nil}, errs)
+	require.Len(t, next.unstructured, 1)
+	assert.Len(t, next.unstructured[0], 2)
+	assert.Empty(t, next.structured)
+}
+
+func TestAccumulatingClientError(t *testing.T) {
+	// Arrange
+	expected := errors.New("unavailable")
+	next := &recordingClient{err: expected}
+	client := newAccumulatingClient(&Config{AccumulationWindow: 100 * time.Millisecond}, next)
+
+	// Act
+	errs := sendConcurrently(client, makeAccumulatedEvents("a", 1), makeAccumulatedEvents("b", 1))
+
+	// Assert
+	assert.Equal(t, []error{expected, expected}, errs)
+	assert.Equal(t, 1, next.requests())
+}
+
+func TestAccumulatingClientPartialFailure(t *testing.T) {
+	// Arrange
+	// Events of the same data source are sent together, such that the events of
+	// the first and third send precede those of the second send
+	next := &recordingClient{err: &partialFailureError{err: errors.New("rejected"), failed: []int{3, 4}}}
+	client := newAccumulatingClient(&Config{AccumulationWindow: time.Hour}, next)
+	first := makeAccumulatedEvents("a", 2)
+	second := makeAccumulatedEvents("b", 1)
+	third := makeAccumulatedEvents("a", 2)
+
+	// Act
+	errs := make([]error, 3)
+	var wg sync.WaitGroup
+	for i, payload := range [][]*HumioStructuredEvents{first, second, third} {
+		wg.Add(1)
+		go func(i int, payload []*HumioStructuredEvents) {
+			defer wg.Done()
+			errs[i] = client.sendStructuredEvents(context.Background(), payload)
+		}(i, payload)
+
+		// The order of the sends determines the order of the merged events
+		require.Eventually(t, func() bool {
+			client.structured.mu.Lock()
+			defer client.structured.mu.Unlock()
+			return len(client.structured.pending) == i+1
+		}, time.Second, time.Millisecond)
+	}
+	client.structured.flush()
+	wg.Wait()
+
+	// Assert
+	require.Len(t, next.structured, 1)
+	assert.NoError(t, errs[0])
+
+	var partial *partialFailureError
+	require.True(t, errors.As(errs[1], &partial))
+	assert.Equal(t, []int{0}, partial.failed)
+	require.True(t, errors.As(errs[2], &partial))
+	assert.Equal(t, []int{1}, partial.failed)
+}
+
+func TestAccumulatingClientCanceledSend(t *testing.T) {
+	// Arrange
+	next := &recordingClient{}
+	client := newAccumulatingClient(&Config{AccumulationWindow: 100 * time.Millisecond}, next)
+	ctx, cancel := context.WithCancel(context.Background())
+
+	// Act
+	done := make(chan error, 1)
+	go func() {
+		done <- client.sendStructuredEvents(ctx, makeAccumulatedEvents("canceled", 1))
+	}()
+	require.Eventually(t, func() bool {
+		client.structured.mu.Lock()
+		defer client.structured.mu.Unlock()
+		return len(client.structured.pending) == 1
+	}, time.Second, time.Millisecond)
+	cancel()
+	canceledErr := <-done
+	err := client.sendStructuredEvents(context.Background(), makeAccumulatedEvents("sent", 1))
+
+	// Assert
+	assert.Equal(t, context.Canceled, canceledErr)
+	require.NoError(t, err)
+	require.Len(t, next.structured, 1)
+	require.Len(t, next.structured[0], 1)
+	assert.Equal(t, "sent", next.structured[0][0].Tags["tag"])
+}
+
+func TestAccumulatingClientDetachedContext(t *testing.T) {
+	// Arrange
+	type key struct{}
+	next := &recordingClient{}
+	client := newAccumulatingClient(&Config{AccumulationWindow: 10 * time.Millisecond}, next)
+	ctx, cancel := context.WithTimeout(context.WithValue(context.Background(), key{}, "value"), time.Hour)
+	defer cancel()
+
+	// Act
+	err := client.sendStructuredEvents(ctx, makeAccumulatedEvents("a", 1))
+
+	// Assert
+	require.NoError(t, err)
+	require.Len(t, next.ctxs, 1)
+	assert.Equal(t, "value", next.ctxs[0].Value(key{}))
+	_, ok := next.ctxs[0].Deadline()
+	assert.False(t, ok)
+}
+
+func TestAccumulatingClientShutdown(t *testing.T) {
+	// Arrange
+	next := &recordingClient{}
+	client := newAccumulatingClient(&Config{AccumulationWindow: time.Hour}, next)
+
+	done := make(chan error, 1)
+	go func() {
+		done <- client.sendStructuredEvents(context.Background(), makeAccumulatedEvents("a", 1))
+	}()
+	require.Eventually(t, func() bool {
+		client.structured.mu.Lock()
+		defer client.structured.mu.Unlock()
+		return len(client.structured.pending) == 1
+	}, time.Second, time.Millisecond)
+
+	// Act
+	err := client.shutdown(context.Background())
+
+	// Assert
+	require.NoError(t, err)
+	require.NoError(t, <-done)
+	assert.Equal(t, 1, next.requests())
+	assert.True(t, next.closed)
+
+	// Events are no longer accumulated once shut down
+	require.NoError(t, client.sendStructuredEvents(context.Background(), makeAccumulatedEvents("b", 1)))
+	assert.Equal(t, 2, next.requests())
+}
+
+func TestAccumulatorCancelsRequestOnceAllSendsCanceled(t *testing.T) {
+	// Arrange
+	sent := make(chan context.Context, 1)
+	acc := newAccumulator(time.Hour, nil, func(ctx context.Context, groups []eventGroup) ([]int, error) {
+		sent <- ctx
+		<-ctx.Done()
+		return nil, ctx.Err()
+	})
+	ctx1, cancel1 := context.WithCancel(context.Background())
+	ctx2, cancel2 := context.WithCancel(context.Background())
+	defer cancel2()
+
+	errs := make(chan error, 2)
+	for _, ctx := range []context.Context{ctx1, ctx2} {
+		go func(ctx context.Context) {
+			errs <- acc.send(ctx, asEventGroups(makeAccumulatedEvents("a", 1)))
+		}(ctx)
+	}
+	require.Eventually(t, func() bool {
+		acc.mu.Lock()
+		defer acc.mu.Unlock()
+		return len(acc.pending) == 2
+	}, time.Second, time.Millisecond)
+	go acc.flush()
+	reqCtx := <-sent
+
+	// Act / Assert
+	cancel1()
+	assert.Equal(t, context.Canceled, <-errs)
+	assert.NoError(t, reqCtx.Err())
+
+	cancel2()
+	assert.Equal(t, context.Canceled, <-errs)
+	select {
+	case <-reqCtx.Done():
+	case <-time.After(time.Second):
+		assert.Fail(t, "the request was not canceled")
+	}
+}
+
+func TestAccumulatorRetryBudgetPerSend(t *testing.T) {
+	// Arrange
+	budget, clock := makeRetryBudget(time.Minute)
+	var mu sync.Mutex
+	sent := map[string]bool{}
+	acc := newAccumulator(time.Hour, budget, func(ctx context.Context, groups []eventGroup) ([]int, error) {
+		total := 0
+		for _, group := range groups {
+			total += group.count()
+		}
+		return nil, budget.send(ctx, total, func(ctx context.Context) error {
+			mu.Lock()
+			defer mu.Unlock()
+			for _, group := range groups {
+				sent[group.(*HumioStructuredEvents).Tags["tag"]] = true
+			}
+			return nil
+		})
+	})
+
+	// The budget of the first send started before the others and has run out
+	exhaustedCtx := withRetryStart(context.Background())
+	budget.remaining(exhaustedCtx)
+	clock.Advance(2 * time.Minute)
+
+	errs := make(map[string]chan error)
+	ctxs := map[string]context.Context{
+		"exhausted": exhaustedCtx,
+		"fresh1":    withRetryStart(context.Background()),
+		"fresh2":    withRetryStart(context.Background()),
+	}
+	for tag, ctx := range ctxs {
+		done := make(chan error, 1)
+		errs[tag] = done
+		go func(tag string, ctx context.Context) {
+			done <- acc.send(ctx, asEventGroups(makeAccumulatedEvents(tag, 1)))
+		}(tag, ctx)
+	}
+	require.Eventually(t, func() bool {
+		acc.mu.Lock()
+		defer acc.mu.Unlock()
+		return len(acc.pending) == 3
+	}, time.Second, time.Millisecond)
+
+	// Act
+	acc.flush()
+
+	// Assert
+	err := <-errs["exhausted"]
+	require.Error(t, err)
+	assert.True(t, consumererror.IsPermanent(err))
+	assert.NoError(t, <-errs["fresh1"])
+	assert.NoError(t, <-errs["fresh2"])
+	assert.Equal(t, map[string]bool{"fresh1": true, "fresh2": true}, sent)
+}
@@ -0,0 +1,526 @@
+// Copyright The OpenTelemetry Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package humioexporter
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"go.opentelemetry.io/collector/consumer/pdata"
+	"go.uber.org/zap"
+)
+
+const (
+	// The default replacement for characters which are not allowed in field names
+	defaultFieldKeyReplacement = "_"
+
+	// The default fields holding the name and version of the instrumentation scope
+	defaultScopeNameKey    = "scope.name"
+	defaultScopeVersionKey = "scope.version"
+
+	// The marker appended to string values which have been truncated
+	truncationMarker = "..."
+
+	// The field in which Humio holds the time at which an event was ingested
+	ingestTimestampField = "@ingesttimestamp"
+
+	// The field holding the number of attributes dropped by the SDK that produced an event
+	droppedAttributesCountField = "dropped_attributes_count"
+)
+
+// Limits the length of string attribute values to the configured maximum,
+// including values nested within maps and arrays. Values exceeding the limit
+// are either truncated and marked as such, or dropped entirely. Values of
+// other types are kept as they are
+func limitAttributeValues(cfg *Config, attrs map[string]interface{}) {
+	if cfg.MaxAttributeValueLength > 0 {
+		limitMapValues(attrs, cfg.MaxAttributeValueLength, cfg.DropLongAttributeValues)
+	}
+}
+
+func limitMapValues(attrs map[string]interface{}, maxLength int, drop bool) {
+	for k, v := range attrs {
+		if limited, ok := limitAttributeValue(v, maxLength, drop); ok {
+			attrs[k] = limited
+		} else {
+			delete(attrs, k)
+		}
+	}
+}
+
+// Limits the length of the values of metric labels to the configured maximum,
+// in the same way as for attribute values
+func limitLabelValues(cfg *Config, labels map[string]string) {
+	if cfg.MaxAttributeValueLength > 0 {
+		limitStringMapValues(labels, cfg.MaxAttributeValueLength, cfg.DropLongAttributeValues)
+	}
+}
+
+func limitStringMapValues(values map[string]string, maxLength int, drop bool) {
+	for k, v := range values {
+		switch {
+		case len(v) <= maxLength:
+		case drop:
+			delete(values, k)
+		default:
+			values[k] = truncateValue(v, maxLength)
+		}
+	}
+}
+
+// Limits the length of a single value, returning false if it should be dropped
+func limitAttributeValue(value interface{}, maxLength int, drop bool) (interface{}, bool) {
+	switch v := value.(type) {
+	case string:
+		if len(v) <= maxLength {
+			return v, true
+		}
+		if drop {
+			return nil, false
+		}
+		return truncateValue(v, maxLength), true
+	case map[string]interface{}:
+		limitMapValues(v, maxLength, drop)
+		return v, true
+	case map[string]string:
+		limitStringMapValues(v, maxLength, drop)
+		return v, true
+	case []interface{}:
+		result := make([]interface{}, 0, len(v))
+		for _, nested := range v {
+			if limited, ok := limitAttributeValue(nested, maxLength, drop); ok {
+				result = append(result, limited)
+			}
+		}
+		return result, true
+	default:
+		return value, true
+	}
+}
+
+// Truncates a value to at most maxLength bytes including the truncation marker,
+// which is left out when the limit is too short to hold it
+func truncateValue(v string, maxLength int) string {
+	if maxLength < len(truncationMarker) {
+		return truncateString(v, maxLength)
+	}
+	return truncateString(v, maxLength-len(truncationMarker)) + truncationMarker
+}
+
+// Truncates a string to at most maxLength bytes, without splitting a character
+func truncateString(s string, maxLength int) string {
+	if len(s) <= maxLength {
+		return s
+	}
+
+	end := maxLength
+	for end > 0 && !utf8.RuneStart(s[end]) {
+		end--
+	}
+	return s[:end]
+}
+
+// Adds the configured static fields to the attributes of an event, without
+// overriding any of its existing attributes
+func addStaticFields(attrs map[string]interface{}, fields map[string]string) {
+	for k, v := range fields {
+		if _, ok := attrs[k]; !ok {
+			attrs[k] = v
+		}
+	}
+}
+
+// Adds the number of attributes that were dropped before the event reached the
+// collector, which is left out when nothing was dropped
+func addDroppedAttributesCount(attrs map[string]interface{}, count uint32) {
+	if count > 0 {
+		attrs[droppedAttributesCountField] = count
+	}
+}
+
+// Adds the name and version of the instrumentation scope that produced an event
+// to its attributes. Nothing is added for a scope without a name
+func addScopeFields(cfg *Config, attrs map[string]interface{}, lib pdata.InstrumentationLibrary) {
+	if lib.Name() == "" {
+		return
+	}
+
+	attrs[cfg.getScopeNameKey()] = lib.Name()
+	if lib.Version() != "" {
+		attrs[cfg.getScopeVersionKey()] = lib.Version()
+	}
+}
+
+// Converts an attribute value into its native Go representation, such that
+// nested maps and arrays are serialized as JSON objects and arrays
+func attributeValueToInterface(v pdata.AttributeValue) interface{} {
+	switch v.Type() {
+	case pdata.AttributeValueSTRING:
+		return v.StringVal()
+	case pdata.AttributeValueINT:
+		return v.IntVal()
+	case pdata.AttributeValueDOUBLE:
+		return v.DoubleVal()
+	case pdata.AttributeValueBOOL:
+		return v.BoolVal()
+	case pdata.AttributeValueMAP:
+		return attributeMapToMap(v.MapVal())
+	case pdata.AttributeValueARRAY:
+		arr := v.ArrayVal()
+		result := make([]interface{}, arr.Len())
+		for i := 0; i < arr.Len(); i++ {
+			result[i] = attributeValueToInterface(arr.At(i))
+		}
+		return result
+	default:
+		return nil
+	}
+}
+
+// Whether a resource attribute should be left out of the fields of events. Tags
+// are built from the resource itself, so dropped attributes can still be tags
+func isDroppedResourceAttribute(cfg *Config, name string) bool {
+	for _, pattern := range cfg.DropResourceAttributes {
+		if prefix := strings.TrimSuffix(pattern, "*"); prefix != pattern {
+			if strings.HasPrefix(name, prefix) {
+				return true
+			}
+		} else if name == pattern {
+			return true
+		}
+	}
+	return false
+}
+
+// Removes the resource attributes configured to be dropped from the converted attributes
+func dropResourceAttributes(cfg *Config, attrs map[string]interface{}) {
+	if len(cfg.DropResourceAttributes) == 0 {
+		return
+	}
+	for k := range attrs {
+		if isDroppedResourceAttribute(cfg, k) {
+			delete(attrs, k)
+		}
+	}
+}
+
+// Removes the attributes holding empty maps or arrays, including those nested
+// within other maps, if configured
+func omitEmptyAttributes(cfg *Config, attrs map[string]interface{}) {
+	if cfg.OmitEmptyAttributes {
+		omitEmptyValues(attrs)
+	}
+}
+
+func omitEmptyValues(attrs map[string]interface{}) {
+	for k, v := range attrs {
+		if isEmptyValue(v) {
+			delete(attrs, k)
+		}
+	}
+}
+
+// Whether a value is an empty map or array once its own empty values have been
+// removed. Elements of arrays are only cleaned up, since they are positional
+func isEmptyValue(value interface{}) bool {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		omitEmptyValues(v)
+		return len(v) == 0
+	case map[string]string:
+		return len(v) == 0
+	case []interface{}:
+		for _, elem := range v {
+			if m, ok := elem.(map[string]interface{}); ok {
+				omitEmptyValues(m)
+			}
+		}
+		return len(v) == 0
+	case []map[string]interface{}:
+		for _, m := range v {
+			omitEmptyValues(m)
+		}
+		return len(v) == 0
+	default:
+		return false
+	}
+}
+
+// Adds the timestamp of the event as its ingest timestamp in milliseconds since
+// the epoch, if configured. This is added after sanitizing field keys, since
+// the field name is reserved by Humio rather than chosen by the user
+func addIngestTimestamp(cfg *Config, attrs map[string]interface{}, timestamp time.Time) {
+	if cfg.IngestTimestampFromEvent {
+		attrs[ingestTimestampField] = timestamp.UnixNano() / int64(time.Millisecond)
+	}
+}
+
+// The names of the scopes that attributes originate from
+const (
+	resourceScope = "resource"
+	recordScope   = "record"
+	spanScope     = "span"
+)
+
+// The prefixes identifying the scope that attributes originate from, when
+// attributes are namespaced by their scope
+const (
+	resourceNamespace = resourceScope + "."
+	recordNamespace   = recordScope + "."
+	spanNamespace     = spanScope + "."
+)
+
+// Get the prefix to prepend to the keys of attributes from the scope with the
+// specified namespace, which is empty unless attributes are namespaced by scope
+func scopeNamespace(cfg *Config, namespace string) string {
+	if !cfg.NamespaceByScope {
+		return ""
+	}
+	return namespace
+}
+
+// Prepends the namespace of their scope to the keys of the attributes, if configured
+func namespaceAttributes(cfg *Config, attrs map[string]interface{}, namespace string) map[string]interface{} {
+	prefix := scopeNamespace(cfg, namespace)
+	if prefix == "" {
+		return attrs
+	}
+
+	result := make(map[string]interface{}, len(attrs))
+	for k, v := range attrs {
+		result[prefix+k] = v
+	}
+	return result
+}
+
+// Merges the attributes of a log record or span from the specified scope into
+// the attributes of its resource, resolving keys present in both according to
+// the duplicate key strategy
+func mergeAttributes(cfg *Config, logger *zap.Logger, attrs map[string]interface{}, scoped map[string]interface{}, scope string) {
+	strategy := cfg.getDuplicateKeyStrategy()
+	for k, v := range scoped {
+		existing, ok := attrs[k]
+		if !ok {
+			attrs[k] = v
+			continue
+		}
+
+		switch strategy {
+		case duplicateKeyResourceWins:
+			// The resource attribute is kept as it is
+		case duplicateKeySuffix:
+			delete(attrs, k)
+			attrs[k+"."+resourceScope] = existing
+			attrs[k+"."+scope] = v
+		default:
+			attrs[k] = v
+		}
+		logger.Debug("Resolved a duplicate attribute key",
+			zap.String("key", k),
+			zap.String("scope", scope),
+			zap.String("duplicate_key_strategy", strategy))
+	}
+}
+
+// Converts an attribute map into a map of native Go values
+func attributeMapToMap(attrs pdata.AttributeMap) map[string]interface{} {
+	result := make(map[string]interface{}, attrs.Len())
+	attrs.Range(func(k string, v pdata.AttributeValue) bool {
+		result[k] = attributeValueToInterface(v)
+		return true
+	})
+	return result
+}
+
+// Flattens nested maps and arrays into a single level, using dotted keys for
+// map entries and bracketed indices for array elements. Values nested deeper
+// than maxDepth levels are kept as they are
+func flattenAttributes(attrs map[string]interface{}, maxDepth int) map[string]interface{} {
+	result := make(map[string]interface{}, len(attrs))
+	for k, v := range attrs {
+		flattenValue(result, k, v, 0, maxDepth)
+	}
+	return result
+}
+
+func flattenValue(result map[string]interface{}, key string, value interface{}, depth int, maxDepth int) {
+	if depth >= maxDepth {
+		result[key] = value
+		return
+	}
+
+	switch v := value.(type) {
+	case map[string]interface{}:
+		if len(v) == 0 {
+			result[key] = v
+			return
+		}
+		for k, nested := range v {
+			flattenValue(result, key+"."+k, nested, depth+1, maxDepth)
+		}
+	case []interface{}:
+		if len(v) == 0 {
+			result[key] = v
+			return
+		}
+		for i, nested := range v {
+			flattenValue(result, key+"["+strconv.Itoa(i)+"]", nested, depth+1, maxDepth)
+		}
+	default:
+		result[key] = value
+	}
+}
+
+// Removes the first matching configured prefix from the keys of the attributes.
+// A key is kept as it is if removing the prefix would leave it empty, or if the
+// stripped key is already taken by another attribute
+func stripAttributeKeyPrefixes(cfg *Config, logger *zap.Logger, attrs map[string]interface{}) {
+	if len(cfg.StripAttributeKeyPrefix) == 0 {
+		return
+	}
+
+	// Sorted, such that the same key wins a collision for every event
+	keys := make([]string, 0, len(attrs))
+	for k := range attrs {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		for _, prefix := range cfg.StripAttributeKeyPrefix {
+			if !strings.HasPrefix(k, prefix) || len(k) == len(prefix) {
+				continue
+			}
+
+			stripped := k[len(prefix):]
+			if _, ok := attrs[stripped]; ok {
+				logger.Warn("Keeping the prefix of an attribute key, since the stripped key is already in use",
+					zap.String("key", k),
+					zap.String("stripped", stripped))
+			} else {
+				attrs[stripped] = attrs[k]
+				delete(attrs, k)
+			}
+			break
+		}
+	}
+}
+
+// Whether the character is allowed in the name of a Humio field
+func isValidFieldKeyChar(r rune) bool {
+	return (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9') ||
+		r == '_' || r == '.' || r == '-' || r == '[' || r == ']'
+}
+
+// Replaces characters which Humio does not allow in field names, such as '@'
+// or spaces, in the keys of the attributes and any nested maps. Keys which are
+// already valid are left untouched, and keys which collide after replacement
+// are made unique by appending an index, in sorted order of the original keys
+func sanitizeFieldKeys(attrs map[string]interface{}, replacement string) map[string]interface{} {
+	keys := make([]string, 0, len(attrs))
+	for k := range attrs {
+		keys = append(keys, k)
+	}
+
+	result := make(map[string]interface{}, len(attrs))
+	for original, sanitized := range sanitizeKeys(keys, replacement) {
+		result[sanitized] = sanitizeNestedFieldKeys(attrs[original], replacement)
+	}
+	return result
+}
+
+func sanitizeNestedFieldKeys(value interface{}, replacement string) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		return sanitizeFieldKeys(v, replacement)
+	case map[string]string:
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+
+		result := make(map[string]string, len(v))
+		for original, sanitized := range sanitizeKeys(keys, replacement) {
+			result[sanitized] = v[original]
+		}
+		return result
+	case []interface{}:
+		result := make([]interface{}, len(v))
+		for i, nested := range v {
+			result[i] = sanitizeNestedFieldKeys(nested, replacement)
+		}
+		return result
+	default:
+		return value
+	}
+}
+
+// Maps each key onto a unique, sanitized key
+func sanitizeKeys(keys []string, replacement string) map[string]string {
+	sort.Strings(keys)
+
+	result := make(map[string]string, len(keys))
+	used := make(map[string]bool, len(keys))
+
+	// Valid keys are reserved first, so they never need to be renamed
+	var invalid []string
+	for _, k := range keys {
+		if isValidFieldKey(k) {
+			result[k] = k
+			used[k] = true
+		} else {
+			invalid = append(invalid, k)
+		}
+	}
+
+	for _, k := range invalid {
+		base := replaceInvalidFieldKeyChars(k, replacement)
+
+		sanitized := base
+		for i := 1; used[sanitized]; i++ {
+			sanitized = base + "_" + strconv.Itoa(i)
+		}
+		result[k] = sanitized
+		used[sanitized] = true
+	}
+
+	return result
+}
+
+// Whether the key consists only of characters allowed in a field name
+func isValidFieldKey(key string) bool {
+	for _, r := range key {
+		if !isValidFieldKeyChar(r) {
+			return false
+		}
+	}
+	return true
+}
+
+// Replaces every character which is not allowed in a field name
+func replaceInvalidFieldKeyChars(key string, replacement string) string {
+	var b strings.Builder
+	for _, r := range key {
+		if isValidFieldKeyChar(r) {
+			b.WriteRune(r)
+		} else {
+			b.WriteString(replacement)
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,551 @@
+// Copyright The OpenTelemetry Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package humioexporter
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/collector/consumer/pdata"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+func TestAttributeMapToMap(t *testing.T) {
+	// Arrange
+	nested := pdata.NewAttributeMap()
+	nested.InsertString("method", "GET")
+	arr := pdata.NewAttributeValueArray()
+	arr.ArrayVal().Append(pdata.NewAttributeValueInt(1))
+	arr.ArrayVal().Append(pdata.NewAttributeValueBool(true))
+
+	attrs := pdata.NewAttributeMap()
+	attrs.InsertString("string", "value")
+	attrs.InsertInt("int", 42)
+	attrs.InsertDouble("double", 1.5)
+	attrs.InsertBool("bool", true)
+	attrs.InsertNull("null")
+	attrs.Insert("map", pdata.NewAttributeValueMap())
+	m, _ := attrs.Get("map")
+	nested.CopyTo(m.MapVal())
+	attrs.Insert("array", arr)
+
+	// Act
+	actual := attributeMapToMap(attrs)
+
+	// Assert
+	assert.Equal(t, map[string]interface{}{
+		"string": "value",
+		"int":    int64(42),
+		"double": 1.5,
+		"bool":   true,
+		"null":   nil,
+		"map":    map[string]interface{}{"method": "GET"},
+		"array":  []interface{}{int64(1), true},
+	}, actual)
+}
+
+func TestFlattenAttributes(t *testing.T) {
+	// Arrange
+	attrs := map[string]interface{}{
+		"plain": "value",
+		"http": map[string]interface{}{
+			"method": "GET",
+			"headers": map[string]interface{}{
+				"accept": []interface{}{"text/html", "application/json"},
+			},
+		},
+		"ids":   []interface{}{int64(1), map[string]interface{}{"id": int64(2)}},
+		"empty": map[string]interface{}{},
+	}
+
+	testCases := []struct {
+		desc     string
+		maxDepth int
+		expected map[string]interface{}
+	}{
+		{
+			desc:     "Unlimited depth",
+			maxDepth: 10,
+			expected: map[string]interface{}{
+				"plain":                  "value",
+				"http.method":            "GET",
+				"http.headers.accept[0]": "text/html",
+				"http.headers.accept[1]": "application/json",
+				"ids[0]":                 int64(1),
+				"ids[1].id":              int64(2),
+				"empty":                  map[string]interface{}{},
+			},
+		},
+		{
+			desc:     "Limited depth",
+			maxDepth: 1,
+			expected: map[string]interface{}{
+				"plain":        "value",
+				"http.method":  "GET",
+				"http.headers": map[string]interface{}{"accept": []interface{}{"text/html", "application/json"}},
+				"ids[0]":       int64(1),
+				"ids[1]":       map[string]interface{}{"id": int64(2)},
+				"empty":        map[string]interface{}{},
+			},
+		},
+	}
+
+	// Act / Assert
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			assert.Equal(t, tC.expected, flattenAttributes(attrs, tC.maxDepth))
+		})
+	}
+}
+
+func TestSanitizeFieldKeys(t *testing.T) {
+	// Arrange
+	testCases := []struct {
+		desc        string
+		attrs       map[string]interface{}
+		replacement string
+		expected    map[string]interface{}
+	}{
+		{
+			desc: "Valid keys are untouched",
+			attrs: map[string]interface{}{
+				"http.method":  "GET",
+				"ids[0]":       int64(1),
+				"user-agent_1": "curl",
+			},
+			replacement: "_",
+			expected: map[string]interface{}{
+				"http.method":  "GET",
+				"ids[0]":       int64(1),
+				"user-agent_1": "curl",
+			},
+		},
+		{
+			desc:        "Invalid characters are replaced",
+			attrs:       map[string]interface{}{"user name": "alice", "cost($)": 5.0},
+			replacement: "_",
+			expected:    map[string]interface{}{"user_name": "alice", "cost___": 5.0},
+		},
+		{
+			desc:        "Custom replacement",
+			attrs:       map[string]interface{}{"user name": "alice"},
+			replacement: "-",
+			expected:    map[string]interface{}{"user-name": "alice"},
+		},
+		{
+			desc: "Collisions are resolved deterministically",
+			attrs: map[string]interface{}{
+				"a b": "space",
+				"a@b": "at",
+				"a_b": "valid",
+			},
+			replacement: "_",
+			expected: map[string]interface{}{
+				"a_b":   "valid",
+				"a_b_1": "space",
+				"a_b_2": "at",
+			},
+		},
+		{
+			desc: "Nested keys are sanitized",
+			attrs: map[string]interface{}{
+				"outer key": map[string]interface{}{"inner key": "value"},
+				"list": []interface{}{
+					map[string]interface{}{"item key": "value"},
+				},
+				"labels": map[string]string{"label key": "value"},
+			},
+			replacement: "_",
+			expected: map[string]interface{}{
+				"outer_key": map[string]interface{}{"inner_key": "value"},
+				"list": []interface{}{
+					map[string]interface{}{"item_key": "value"},
+				},
+				"labels": map[string]string{"label_key": "value"},
+			},
+		},
+	}
+
+	// Act / Assert
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			assert.Equal(t, tC.expected, sanitizeFieldKeys(tC.attrs, tC.replacement))
+		})
+	}
+}
+
+func TestStripAttributeKeyPrefixes(t *testing.T) {
+	// Arrange
+	testCases := []struct {
+		desc         string
+		prefixes     []string
+		attrs        map[string]interface{}
+		expected     map[string]interface{}
+		wantWarnings int
+	}{
+		{
+			desc:     "Matching prefixes are stripped",
+			prefixes: []string{"com.ourcompany.", "org.other."},
+			attrs: map[string]interface{}{
+				"com.ourcompany.team": "payments",
+				"org.other.region":    "eu",
+			},
+			expected: map[string]interface{}{
+				"team":   "payments",
+				"region": "eu",
+			},
+		},
+		{
+			desc:     "Non-matching keys are untouched",
+			prefixes: []string{"com.ourcompany."},
+			attrs: map[string]interface{}{
+				"http.method":     "GET",
+				"com.ourcompany":  "exact",
+				"com.ourcompany.": "only prefix",
+			},
+			expected: map[string]interface{}{
+				"http.method":     "GET",
+				"com.ourcompany":  "exact",
+				"com.ourcompany.": "only prefix",
+			},
+		},
+		{
+			desc:     "Only the first matching prefix is stripped",
+			prefixes: []string{"com.", "com.ourcompany."},
+			attrs:    map[string]interface{}{"com.ourcompany.team": "payments"},
+			expected: map[string]interface{}{"ourcompany.team": "payments"},
+		},
+		{
+			desc:     "Collision with an existing key keeps the original",
+			prefixes: []string{"com.ourcompany."},
+			attrs: map[string]interface{}{
+				"com.ourcompany.team": "payments",
+				"team":                "checkout",
+			},
+			expected: map[string]interface{}{
+				"com.ourcompany.team": "payments",
+				"team":                "checkout",
+			},
+			wantWarnings: 1,
+		},
+		{
+			desc:     "Collision between stripped keys keeps the later original",
+			prefixes: []string{"com.ourcompany.", "com.partner."},
+			attrs: map[string]interface{}{
+				"com.ourcompany.team": "payments",
+				"com.partner.team":    "checkout",
+			},
+			expected: map[string]interface{}{
+				"team":             "payments",
+				"com.partner.team": "checkout",
+			},
+			wantWarnings: 1,
+		},
+		{
+			desc:     "Disabled",
+			attrs:    map[string]interface{}{"com.ourcompany.team": "payments"},
+			expected: map[string]interface{}{"com.ourcompany.team": "payments"},
+		},
+	}
+
+	// Act / Assert
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			core, logs := observer.New(zap.WarnLevel)
+			cfg := &Config{StripAttributeKeyPrefix: tC.prefixes}
+
+			stripAttributeKeyPrefixes(cfg, zap.New(core), tC.attrs)
+
+			assert.Equal(t, tC.expected, tC.attrs)
+			assert.Equal(t, tC.wantWarnings, logs.Len())
+		})
+	}
+}
+
+func TestLimitAttributeValues(t *testing.T) {
+	// Arrange
+	testCases := []struct {
+		desc      string
+		attrs     map[string]interface{}
+		maxLength int
+		drop      bool
+		expected  map[string]interface{}
+	}{
+		{
+			desc: "Values within limit",
+			attrs: map[string]interface{}{
+				"short": "abc",
+				"exact": "abcde",
+			},
+			expected: map[string]interface{}{
+				"short": "abc",
+				"exact": "abcde",
+			},
+		},
+		{
+			desc:     "Value beyond limit is truncated",
+			attrs:    map[string]interface{}{"long": "abcdef"},
+			expected: map[string]interface{}{"long": "ab..."},
+		},
+		{
+			desc:     "Truncation does not split characters",
+			attrs:    map[string]interface{}{"long": "aébcdef"},
+			expected: map[string]interface{}{"long": "a..."},
+		},
+		{
+			desc:      "Limit shorter than the marker",
+			attrs:     map[string]interface{}{"long": "abcdef"},
+			maxLength: 2,
+			expected:  map[string]interface{}{"long": "ab"},
+		},
+		{
+			desc: "Non-string values are kept",
+			attrs: map[string]interface{}{
+				"int":    int64(12345678),
+				"double": 1234.5678,
+				"bool":   true,
+			},
+			expected: map[string]interface{}{
+				"int":    int64(12345678),
+				"double": 1234.5678,
+				"bool":   true,
+			},
+		},
+		{
+			desc: "Nested values are truncated",
+			attrs: map[string]interface{}{
+				"map":    map[string]interface{}{"long": "abcdef"},
+				"labels": map[string]string{"long": "abcdef"},
+				"array":  []interface{}{"abcdef", int64(1)},
+			},
+			expected: map[string]interface{}{
+				"map":    map[string]interface{}{"long": "ab..."},
+				"labels": map[string]string{"long": "ab..."},
+				"array":  []interface{}{"ab...", int64(1)},
+			},
+		},
+		{
+			desc: "Values beyond limit are dropped",
+			attrs: map[string]interface{}{
+				"exact": "abcde",
+				"long":  "abcdef",
+				"int":   int64(12345678),
+			},
+			drop: true,
+			expected: map[string]interface{}{
+				"exact": "abcde",
+				"int":   int64(12345678),
+			},
+		},
+		{
+			desc: "Nested values beyond limit are dropped",
+			attrs: map[string]interface{}{
+				"map":    map[string]interface{}{"long": "abcdef", "short": "abc"},
+				"labels": map[string]string{"long": "abcdef"},
+				"array":  []interface{}{"abcdef", "abc"},
+			},
+			drop: true,
+			expected: map[string]interface{}{
+				"map":    map[string]interface{}{"short": "abc"},
+				"labels": map[string]string{},
+				"array":  []interface{}{"abc"},
+			},
+		},
+	}
+
+	// Act / Assert
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			maxLength := tC.maxLength
+			if maxLength == 0 {
+				maxLength = 5
+			}
+			cfg := &Config{MaxAttributeValueLength: maxLength, DropLongAttributeValues: tC.drop}
+			limitAttributeValues(cfg, tC.attrs)
+			assert.Equal(t, tC.expected, tC.attrs)
+			assertMaxValueLength(t, tC.attrs, maxLength)
+		})
+	}
+}
+
+// Asserts that no string value, including nested ones, is longer than maxLength
+func assertMaxValueLength(t *testing.T, value interface{}, maxLength int) {
+	switch v := value.(type) {
+	case string:
+		assert.LessOrEqual(t, len(v), maxLength)
+	case map[string]interface{}:
+		for _, nested := range v {
+			assertMaxValueLength(t, nested, maxLength)
+		}
+	case map[string]string:
+		for _, nested := range v {
+			assertMaxValueLength(t, nested, maxLength)
+		}
+	case []interface{}:
+		for _, nested := range v {
+			assertMaxValueLength(t, nested, maxLength)
+		}
+	}
+}
+
+func TestLimitAttributeValuesDisabled(t *testing.T) {
+	// Arrange
+	attrs := map[string]interface{}{"long": "abcdef"}
+
+	// Act
+	limitAttributeValues(&Config{}, attrs)
+
+	// Assert
+	assert.Equal(t, map[string]interface{}{"long": "abcdef"}, attrs)
+}
+
+func TestIsDroppedResourceAttribute(t *testing.T) {
+	// Arrange
+	cfg := &Config{DropResourceAttributes: []string{"cloud.*", "host.id"}}
+	testCases := []struct {
+		desc     string
+		name     string
+		expected bool
+	}{
+		{
+			desc:     "Exact match",
+			name:     "host.id",
+			expected: true,
+		},
+		{
+			desc:     "Prefix match",
+			name:     "cloud.account.id",
+			expected: true,
+		},
+		{
+			desc:     "Similar name without match",
+			name:     "host.id.extra",
+			expected: false,
+		},
+		{
+			desc:     "Prefix without separator",
+			name:     "cloudy",
+			expected: false,
+		},
+		{
+			desc:     "Unrelated attribute",
+			name:     "service.name",
+			expected: false,
+		},
+	}
+
+	// Act / Assert
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			assert.Equal(t, tC.expected, isDroppedResourceAttribute(cfg, tC.name))
+		})
+	}
+}
+
+func TestOmitEmptyAttributes(t *testing.T) {
+	// Arrange
+	attrs := map[string]interface{}{
+		"string":       "",
+		"empty_map":    map[string]interface{}{},
+		"empty_labels": map[string]string{},
+		"empty_array":  []interface{}{},
+		"empty_events": []map[string]interface{}{},
+		"nested": map[string]interface{}{
+			"empty": map[string]interface{}{},
+		},
+		"array": []interface{}{
+			map[string]interface{}{"empty": []interface{}{}},
+		},
+		"events": []map[string]interface{}{
+			{"name": "retry", "attributes": map[string]interface{}{}},
+		},
+	}
+
+	// Act
+	omitEmptyAttributes(&Config{OmitEmptyAttributes: true}, attrs)
+
+	// Assert
+	assert.Equal(t, map[string]interface{}{
+		"string": "",
+		"array":  []interface{}{map[string]interface{}{}},
+		"events": []map[string]interface{}{
+			{"name": "retry"},
+		},
+	}, attrs)
+}
+
+func TestOmitEmptyAttributesDisabled(t *testing.T) {
+	// Arrange
+	attrs := map[string]interface{}{"empty": map[string]interface{}{}}
+
+	// Act
+	omitEmptyAttributes(&Config{}, attrs)
+
+	// Assert
+	assert.Equal(t, map[string]interface{}{"empty": map[string]interface{}{}}, attrs)
+}
+
+func TestAddIngestTimestamp(t *testing.T) {
+	// Arrange
+	timestamp := time.Date(2015, 6, 1, 8, 0, 0, 500*int(time.Millisecond), time.UTC)
+	testCases := []struct {
+		desc     string
+		cfg      *Config
+		expected map[string]interface{}
+	}{
+		{
+			desc:     "Disabled by default",
+			cfg:      &Config{},
+			expected: map[string]interface{}{"@ingesttimestamp": "kept"},
+		},
+		{
+			desc:     "Overrides existing field",
+			cfg:      &Config{IngestTimestampFromEvent: true},
+			expected: map[string]interface{}{"@ingesttimestamp": int64(1433145600500)},
+		},
+	}
+
+	// Act / Assert
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			attrs := map[string]interface{}{"@ingesttimestamp": "kept"}
+			addIngestTimestamp(tC.cfg, attrs, timestamp)
+			assert.Equal(t, tC.expected, attrs)
+		})
+	}
+}
+
+func TestAddStaticFields(t *testing.T) {
+	// Arrange
+	attrs := map[string]interface{}{
+		"region": "us-east-1",
+		"count":  int64(5),
+	}
+
+	// Act
+	addStaticFields(attrs, map[string]string{
+		"region":  "eu-west-1",
+		"version": "1.2.0",
+	})
+
+	// Assert
+	assert.Equal(t, map[string]interface{}{
+		"region":  "us-east-1",
+		"count":   int64(5),
+		"version": "1.2.0",
+	}, attrs)
+}
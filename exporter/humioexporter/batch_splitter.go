@@ -0,0 +1,216 @@
+// Copyright The OpenTelemetry Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package humioexporter
+
+import (
+	"encoding/json"
+)
+
+// eventGroup describes a single element in a payload to Humio, consisting of a
+// series of events that share the same metadata
+type eventGroup interface {
+	// Get the serialized size of the group when it contains no events
+	baseSize() (int, error)
+
+	// Get the serialized size of each individual event in the group
+	eventSizes() ([]int, error)
+
+	// Create a copy of the group containing only the events at the specified indices
+	subset(indices []int) eventGroup
+
+	// Get the number of events in the group
+	count() int
+}
+
+func (e *HumioStructuredEvents) baseSize() (int, error) {
+	b, err := json.Marshal(&HumioStructuredEvents{Tags: e.Tags, Events: []*HumioStructuredEvent{}})
+	return len(b), err
+}
+
+func (e *HumioStructuredEvents) eventSizes() ([]int, error) {
+	sizes := make([]int, len(e.Events))
+	for i, evt := range e.Events {
+		b, err := json.Marshal(evt)
+		if err != nil {
+			return nil, err
+		}
+		sizes[i] = len(b)
+	}
+	return sizes, nil
+}
+
+func (e *HumioStructuredEvents) subset(indices []int) eventGroup {
+	evts := make([]*HumioStructuredEvent, len(indices))
+	for i, idx := range indices {
+		evts[i] = e.Events[idx]
+	}
+	return &HumioStructuredEvents{Tags: e.Tags, Events: evts}
+}
+
+func (e *HumioStructuredEvents) count() int {
+	return len(e.Events)
+}
+
+func (e *HumioUnstructuredEvents) baseSize() (int, error) {
+	b, err := json.Marshal(&HumioUnstructuredEvents{
+		Fields:   e.Fields,
+		Tags:     e.Tags,
+		Type:     e.Type,
+		Messages: []string{},
+	})
+	return len(b), err
+}
+
+func (e *HumioUnstructuredEvents) eventSizes() ([]int, error) {
+	sizes := make([]int, len(e.Messages))
+	for i, msg := range e.Messages {
+		b, err := json.Marshal(msg)
+		if err != nil {
+			return nil, err
+		}
+		sizes[i] = len(b)
+	}
+	return sizes, nil
+}
+
+func (e *HumioUnstructuredEvents) subset(indices []int) eventGroup {
+	msgs := make([]string, len(indices))
+	for i, idx := range indices {
+		msgs[i] = e.Messages[idx]
+	}
+	return &HumioUnstructuredEvents{
+		Fields:   e.Fields,
+		Tags:     e.Tags,
+		Type:     e.Type,
+		Messages: msgs,
+	}
+}
+
+func (e *HumioUnstructuredEvents) count() int {
+	return len(e.Messages)
+}
+
+// The result of splitting a payload into batches that each fit within a single request
+type splitResult struct {
+	// The batches, each of which should be sent as a separate request
+	batches [][]eventGroup
+
+	// The positions of the events in each batch across all events in the original groups
+	positions [][]int
+
+	// The number of events that were too large to fit within a request on their own
+	dropped int
+}
+
+// Splits the event groups into batches whose uncompressed JSON representation
+// does not exceed maxSize bytes, and which contain at most maxEvents events. A
+// limit of zero disables it. The relative order of events is preserved, and
+// events which exceed the size limit on their own are dropped
+func splitEventGroups(groups []eventGroup, maxSize int, maxEvents int) (*splitResult, error) {
+	result := &splitResult{}
+
+	var batch []eventGroup
+	var positions []int
+	batchSize := 0
+
+	// Position of the first event of the current group across all groups
+	offset := 0
+
+	flush := func() {
+		if len(batch) > 0 {
+			result.batches = append(result.batches, batch)
+			result.positions = append(result.positions, positions)
+		}
+		batch = nil
+		positions = nil
+		batchSize = 0
+	}
+
+	for _, group := range groups {
+		// Sizes are only required when limiting the size of requests, which
+		// saves encoding every event an additional time otherwise
+		var base int
+		var sizes []int
+		if maxSize > 0 {
+			var err error
+			if base, err = group.baseSize(); err != nil {
+				return nil, err
+			}
+			if sizes, err = group.eventSizes(); err != nil {
+				return nil, err
+			}
+		}
+
+		// Indices of the events from this group that belong to the current batch
+		var indices []int
+		closeGroup := func() {
+			if len(indices) > 0 {
+				batch = append(batch, group.subset(indices))
+			}
+			indices = nil
+		}
+
+		count := group.count()
+		for i := 0; i < count; i++ {
+			full := maxEvents > 0 && len(positions) >= maxEvents
+
+			var added int
+			if maxSize > 0 {
+				size := sizes[i]
+
+				// Size of a request containing nothing but this event: [{...,"events":[evt]}]
+				if 2+base+size > maxSize {
+					result.dropped++
+					continue
+				}
+
+				switch {
+				case full:
+					// The event starts a new batch regardless
+					added = 2 + base + size
+				case len(indices) > 0:
+					// Appending to the current group requires a separating comma
+					added = size + 1
+				case len(batch) > 0:
+					// A new group must be separated from the previous groups in the batch
+					added = base + size + 1
+				default:
+					// The first group in the batch also requires the surrounding brackets
+					added = 2 + base + size
+				}
+
+				if batchSize+added > maxSize {
+					full = true
+					added = 2 + base + size
+				}
+			}
+
+			if full {
+				closeGroup()
+				flush()
+			}
+
+			indices = append(indices, i)
+			positions = append(positions, offset+i)
+			batchSize += added
+		}
+
+		closeGroup()
+		offset += count
+	}
+
+	flush()
+	return result, nil
+}
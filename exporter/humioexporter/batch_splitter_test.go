@@ -0,0 +1,281 @@
+// Copyright The OpenTelemetry Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package humioexporter
+
+import (
+	"encoding/json"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func makeSizedStructuredEvents(groups, perGroup, valueLen int) []eventGroup {
+	timestamp := time.Date(2021, 3, 28, 12, 30, 15, 0, time.UTC)
+
+	result := make([]eventGroup, groups)
+	for i := 0; i < groups; i++ {
+		evts := make([]*HumioStructuredEvent, perGroup)
+		for j := 0; j < perGroup; j++ {
+			evts[j] = &HumioStructuredEvent{
+				Timestamp: timestamp,
+				Attributes: map[string]string{
+					"id":    strconv.Itoa(i*perGroup + j),
+					"value": strings.Repeat("x", valueLen),
+				},
+			}
+		}
+		result[i] = &HumioStructuredEvents{
+			Tags:   map[string]string{"group": strconv.Itoa(i)},
+			Events: evts,
+		}
+	}
+	return result
+}
+
+// Collects the ids of all structured events across batches, in order
+func collectIds(t *testing.T, batches [][]eventGroup) []string {
+	var ids []string
+	for _, batch := range batches {
+		for _, group := range batch {
+			for _, evt := range group.(*HumioStructuredEvents).Events {
+				ids = append(ids, evt.Attributes.(map[string]string)["id"])
+			}
+		}
+	}
+	return ids
+}
+
+func TestSplitEventGroupsWithinLimit(t *testing.T) {
+	// Arrange
+	groups := makeSizedStructuredEvents(2, 3, 10)
+	b, err := json.Marshal(groups)
+	require.NoError(t, err)
+
+	// Act
+	result, err := splitEventGroups(groups, len(b), 0)
+
+	// Assert
+	require.NoError(t, err)
+	assert.Equal(t, 0, result.dropped)
+	require.Len(t, result.batches, 1)
+	assert.Equal(t, groups, result.batches[0])
+}
+
+func TestSplitEventGroupsBoundaries(t *testing.T) {
+	// Arrange
+	groups := makeSizedStructuredEvents(3, 5, 100)
+	maxSize := 500
+
+	// Act
+	result, err := splitEventGroups(groups, maxSize, 0)
+
+	// Assert
+	require.NoError(t, err)
+	assert.Equal(t, 0, result.dropped)
+	assert.Greater(t, len(result.batches), 1)
+
+	for _, batch := range result.batches {
+		b, err := json.Marshal(batch)
+		require.NoError(t, err)
+		assert.LessOrEqual(t, len(b), maxSize)
+	}
+
+	// All events must be preserved in their original order
+	ids := collectIds(t, result.batches)
+	require.Len(t, ids, 15)
+	for i, id := range ids {
+		assert.Equal(t, strconv.Itoa(i), id)
+	}
+
+	// Positions must refer to the same events as the ids
+	var positions []string
+	for _, batch := range result.positions {
+		for _, pos := range batch {
+			positions = append(positions, strconv.Itoa(pos))
+		}
+	}
+	assert.Equal(t, ids, positions)
+}
+
+func TestSplitEventGroupsExactFit(t *testing.T) {
+	// Arrange
+	groups := makeSizedStructuredEvents(1, 4, 10)
+	single, err := json.Marshal(groups[0].subset([]int{0, 1}))
+	require.NoError(t, err)
+
+	// Act
+	result, err := splitEventGroups(groups, len(single)+2, 0)
+
+	// Assert
+	require.NoError(t, err)
+	require.Len(t, result.batches, 2)
+	for _, batch := range result.batches {
+		b, err := json.Marshal(batch)
+		require.NoError(t, err)
+		assert.Equal(t, len(single)+2, len(b))
+	}
+}
+
+func TestSplitEventGroupsDropsOversized(t *testing.T) {
+	// Arrange
+	groups := makeSizedStructuredEvents(1, 3, 10)
+	large := groups[0].(*HumioStructuredEvents).Events[1]
+	large.Attributes.(map[string]string)["value"] = strings.Repeat("x", 1000)
+
+	// Act
+	result, err := splitEventGroups(groups, 500, 0)
+
+	// Assert
+	require.NoError(t, err)
+	assert.Equal(t, 1, result.dropped)
+	assert.Equal(t, []string{"0", "2"}, collectIds(t, result.batches))
+	assert.Equal(t, [][]int{{0, 2}}, result.positions)
+}
+
+// Counts the events in each batch
+func countBatchEvents(batches [][]eventGroup) []int {
+	counts := make([]int, len(batches))
+	for i, batch := range batches {
+		for _, group := range batch {
+			counts[i] += group.count()
+		}
+	}
+	return counts
+}
+
+func TestSplitEventGroupsMaxEvents(t *testing.T) {
+	// Arrange
+	groups := makeSizedStructuredEvents(3, 5, 10)
+
+	// Act
+	result, err := splitEventGroups(groups, 0, 4)
+
+	// Assert
+	require.NoError(t, err)
+	assert.Equal(t, 0, result.dropped)
+	assert.Equal(t, []int{4, 4, 4, 3}, countBatchEvents(result.batches))
+
+	// Groups are split across batches without losing their tags
+	require.Len(t, result.batches[1], 2)
+	assert.Equal(t, map[string]string{"group": "0"}, result.batches[1][0].(*HumioStructuredEvents).Tags)
+	assert.Equal(t, map[string]string{"group": "1"}, result.batches[1][1].(*HumioStructuredEvents).Tags)
+
+	ids := collectIds(t, result.batches)
+	require.Len(t, ids, 15)
+	for i, id := range ids {
+		assert.Equal(t, strconv.Itoa(i), id)
+	}
+	assert.Equal(t, [][]int{{0, 1, 2, 3}, {4, 5, 6, 7}, {8, 9, 10, 11}, {12, 13, 14}}, result.positions)
+}
+
+func TestSplitEventGroupsMaxEventsAndSize(t *testing.T) {
+	// Arrange
+	groups := makeSizedStructuredEvents(1, 6, 10)
+	three, err := json.Marshal([]eventGroup{groups[0].subset([]int{0, 1, 2})})
+	require.NoError(t, err)
+
+	testCases := []struct {
+		desc      string
+		maxSize   int
+		maxEvents int
+		expected  []int
+	}{
+		{
+			desc:      "Event count reached first",
+			maxSize:   len(three),
+			maxEvents: 2,
+			expected:  []int{2, 2, 2},
+		},
+		{
+			desc:      "Body size reached first",
+			maxSize:   len(three),
+			maxEvents: 5,
+			expected:  []int{3, 3},
+		},
+		{
+			desc:      "Both limits reached together",
+			maxSize:   len(three),
+			maxEvents: 3,
+			expected:  []int{3, 3},
+		},
+	}
+
+	// Act / Assert
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			result, err := splitEventGroups(groups, tC.maxSize, tC.maxEvents)
+
+			require.NoError(t, err)
+			assert.Equal(t, 0, result.dropped)
+			assert.Equal(t, tC.expected, countBatchEvents(result.batches))
+			assert.Len(t, collectIds(t, result.batches), 6)
+			for _, batch := range result.batches {
+				b, err := json.Marshal(batch)
+				require.NoError(t, err)
+				assert.LessOrEqual(t, len(b), tC.maxSize)
+			}
+		})
+	}
+}
+
+func TestSplitEventGroupsUnstructured(t *testing.T) {
+	// Arrange
+	groups := []eventGroup{
+		&HumioUnstructuredEvents{
+			Tags:     map[string]string{"tag": "val"},
+			Type:     "parser",
+			Messages: []string{"msg1", "msg2", "msg3", "msg4"},
+		},
+	}
+	single, err := json.Marshal([]eventGroup{groups[0].subset([]int{0})})
+	require.NoError(t, err)
+
+	// Act
+	result, err := splitEventGroups(groups, len(single), 0)
+
+	// Assert
+	require.NoError(t, err)
+	require.Len(t, result.batches, 4)
+	for i, batch := range result.batches {
+		require.Len(t, batch, 1)
+		evts := batch[0].(*HumioUnstructuredEvents)
+		assert.Equal(t, "parser", evts.Type)
+		assert.Equal(t, []string{"msg" + strconv.Itoa(i+1)}, evts.Messages)
+	}
+}
+
+func TestSplitEventGroupsMarshalError(t *testing.T) {
+	// Arrange
+	groups := []eventGroup{
+		&HumioStructuredEvents{
+			Events: []*HumioStructuredEvent{
+				{
+					Timestamp:  time.Now(),
+					Attributes: problematicStruct{},
+				},
+			},
+		},
+	}
+
+	// Act
+	_, err := splitEventGroups(groups, 1000, 0)
+
+	// Assert
+	require.Error(t, err)
+}
@@ -0,0 +1,142 @@
+// Copyright The OpenTelemetry Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package humioexporter
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// The error returned for requests which are not sent while the breaker is open
+var errCircuitOpen = errors.New("not sending events to Humio, since the circuit breaker is open after consecutive failures")
+
+// The states of a circuit breaker
+type breakerState int
+
+const (
+	// Requests are sent as usual, while consecutive failures are counted
+	breakerClosed breakerState = iota
+
+	// Requests fail immediately until the cooldown has passed
+	breakerOpen
+
+	// A single request is sent to probe whether Humio has recovered
+	breakerHalfOpen
+)
+
+// Stops sending requests to Humio for a while after a number of consecutive
+// failures, rather than having every worker keep attempting doomed requests
+type circuitBreaker struct {
+	threshold int
+	cooldown  time.Duration
+	logger    *zap.Logger
+
+	// The current time, replaceable for testing
+	now func() time.Time
+
+	mu          sync.Mutex
+	state       breakerState
+	failures    int
+	lastFailure time.Time
+	openedAt    time.Time
+	probing     bool
+}
+
+// Creates a closed circuit breaker, which opens after threshold consecutive
+// failures and stays open for the cooldown
+func newCircuitBreaker(threshold int, cooldown time.Duration, logger *zap.Logger) *circuitBreaker {
+	return &circuitBreaker{
+		threshold: threshold,
+		cooldown:  cooldown,
+		logger:    logger,
+		now:       time.Now,
+	}
+}
+
+// Determine whether a request may be sent. If not, the time remaining until
+// the breaker half-opens is returned
+func (b *circuitBreaker) allow() (bool, time.Duration) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case breakerOpen:
+		elapsed := b.now().Sub(b.openedAt)
+		if elapsed < b.cooldown {
+			return false, b.cooldown - elapsed
+		}
+
+		b.state = breakerHalfOpen
+		b.probing = true
+		return true, 0
+	case breakerHalfOpen:
+		// Only a single probe may be in flight, and others must wait for its outcome
+		if b.probing {
+			return false, b.cooldown
+		}
+		b.probing = true
+		return true, 0
+	default:
+		return true, 0
+	}
+}
+
+// Record the outcome of a request which was allowed by the breaker. Only
+// failures which indicate that Humio is unavailable should be recorded as such
+func (b *circuitBreaker) record(failed bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := b.now()
+	if b.state == breakerHalfOpen {
+		b.probing = false
+		if failed {
+			b.open(now)
+		} else {
+			b.logger.Info("Humio has recovered, closing the circuit breaker")
+			b.state = breakerClosed
+			b.failures = 0
+		}
+		return
+	}
+
+	if !failed {
+		b.failures = 0
+		return
+	}
+
+	// Failures only count as consecutive when they occur within a cooldown of each other
+	if now.Sub(b.lastFailure) > b.cooldown {
+		b.failures = 0
+	}
+	b.failures++
+	b.lastFailure = now
+
+	if b.state == breakerClosed && b.failures >= b.threshold {
+		b.logger.Warn("Opening the circuit breaker after consecutive failures to send to Humio",
+			zap.Int("failures", b.failures),
+			zap.Duration("cooldown", b.cooldown))
+		b.open(now)
+	}
+}
+
+func (b *circuitBreaker) open(now time.Time) {
+	b.state = breakerOpen
+	b.openedAt = now
+	b.failures = 0
+}
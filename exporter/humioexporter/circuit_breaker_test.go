@@ -0,0 +1,189 @@
+// Copyright The OpenTelemetry Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package humioexporter
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+// A clock which only moves when told to
+type fakeClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+}
+
+func makeBreaker(threshold int, cooldown time.Duration) (*circuitBreaker, *fakeClock) {
+	clock := &fakeClock{now: time.Date(2021, 3, 28, 12, 30, 15, 0, time.UTC)}
+	breaker := newCircuitBreaker(threshold, cooldown, zap.NewNop())
+	breaker.now = clock.Now
+	return breaker, clock
+}
+
+func TestCircuitBreakerOpensAfterThreshold(t *testing.T) {
+	// Arrange
+	breaker, clock := makeBreaker(3, time.Minute)
+
+	// Act
+	for i := 0; i < 2; i++ {
+		breaker.record(true)
+	}
+	closedAllowed, _ := breaker.allow()
+
+	breaker.record(true)
+	clock.Advance(10 * time.Second)
+	openAllowed, wait := breaker.allow()
+
+	// Assert
+	assert.True(t, closedAllowed)
+	assert.False(t, openAllowed)
+	assert.Equal(t, 50*time.Second, wait)
+	assert.Equal(t, breakerOpen, breaker.state)
+}
+
+func TestCircuitBreakerSuccessResetsFailures(t *testing.T) {
+	// Arrange
+	breaker, _ := makeBreaker(2, time.Minute)
+
+	// Act
+	breaker.record(true)
+	breaker.record(false)
+	breaker.record(true)
+	allowed, _ := breaker.allow()
+
+	// Assert
+	assert.True(t, allowed)
+	assert.Equal(t, breakerClosed, breaker.state)
+}
+
+func TestCircuitBreakerFailuresOutsideCooldown(t *testing.T) {
+	// Arrange
+	breaker, clock := makeBreaker(2, time.Minute)
+
+	// Act
+	breaker.record(true)
+	clock.Advance(2 * time.Minute)
+	breaker.record(true)
+
+	// Assert
+	// The failures are too far apart to count as consecutive
+	assert.Equal(t, breakerClosed, breaker.state)
+	assert.Equal(t, 1, breaker.failures)
+}
+
+func TestCircuitBreakerHalfOpen(t *testing.T) {
+	// Arrange
+	testCases := []struct {
+		desc     string
+		failed   bool
+		expected breakerState
+	}{
+		{
+			desc:     "Successful probe closes",
+			failed:   false,
+			expected: breakerClosed,
+		},
+		{
+			desc:     "Failed probe reopens",
+			failed:   true,
+			expected: breakerOpen,
+		},
+	}
+
+	// Act / Assert
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			breaker, clock := makeBreaker(1, time.Minute)
+			breaker.record(true)
+			clock.Advance(time.Minute)
+
+			probe, _ := breaker.allow()
+			assert.True(t, probe)
+			assert.Equal(t, breakerHalfOpen, breaker.state)
+
+			// Other requests must wait for the outcome of the probe
+			other, _ := breaker.allow()
+			assert.False(t, other)
+
+			breaker.record(tC.failed)
+			assert.Equal(t, tC.expected, breaker.state)
+
+			allowed, _ := breaker.allow()
+			assert.Equal(t, !tC.failed, allowed)
+		})
+	}
+}
+
+func TestCircuitBreakerConcurrentProbe(t *testing.T) {
+	// Arrange
+	breaker, clock := makeBreaker(1, time.Minute)
+	breaker.record(true)
+	clock.Advance(time.Minute)
+
+	// Act
+	var allowed int32
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if ok, _ := breaker.allow(); ok {
+				atomic.AddInt32(&allowed, 1)
+			}
+		}()
+	}
+	wg.Wait()
+
+	// Assert
+	assert.Equal(t, int32(1), allowed)
+}
+
+func TestCircuitBreakerConcurrentFailures(t *testing.T) {
+	// Arrange
+	breaker, _ := makeBreaker(10, time.Minute)
+
+	// Act
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			breaker.record(true)
+		}()
+	}
+	wg.Wait()
+	allowed, _ := breaker.allow()
+
+	// Assert
+	assert.False(t, allowed)
+	assert.Equal(t, breakerOpen, breaker.state)
+}
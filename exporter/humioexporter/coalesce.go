@@ -0,0 +1,114 @@
+// Copyright The OpenTelemetry Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package humioexporter
+
+import (
+	"encoding/json"
+	"sort"
+)
+
+// Merges structured event groups that share the exact same tags and routing
+// value, such that each data source only occurs once in a payload. Groups are
+// kept in the order their tags are first encountered. Since merging reorders
+// the events, the original position of each event across all groups is also
+// returned, in the new order
+func coalesceStructuredEvents(groups []*HumioStructuredEvents) ([]*HumioStructuredEvents, []int) {
+	var results []*HumioStructuredEvents
+	byKey := make(map[string]int, len(groups))
+	positions := make([][]int, 0, len(groups))
+
+	pos := 0
+	for _, group := range groups {
+		key := coalesceKey(group)
+		idx, ok := byKey[key]
+		if !ok {
+			idx = len(results)
+			byKey[key] = idx
+			results = append(results, &HumioStructuredEvents{
+				Tags:         group.Tags,
+				routingValue: group.routingValue,
+			})
+			positions = append(positions, nil)
+		}
+
+		results[idx].Events = append(results[idx].Events, group.Events...)
+		for range group.Events {
+			positions[idx] = append(positions[idx], pos)
+			pos++
+		}
+	}
+
+	order := make([]int, 0, pos)
+	for _, p := range positions {
+		order = append(order, p...)
+	}
+	return results, order
+}
+
+// Sorts the events of every group by their timestamp, where events with equal
+// timestamps keep their relative order. The original position of each event
+// across all groups is returned, in the new order
+func sortEventsByTimestamp(groups []*HumioStructuredEvents) []int {
+	var order []int
+	offset := 0
+	for _, group := range groups {
+		indices := make([]int, len(group.Events))
+		for i := range indices {
+			indices[i] = i
+		}
+		sort.SliceStable(indices, func(i, j int) bool {
+			return group.Events[indices[i]].Timestamp.Before(group.Events[indices[j]].Timestamp)
+		})
+
+		evts := make([]*HumioStructuredEvent, len(indices))
+		for i, idx := range indices {
+			evts[i] = group.Events[idx]
+			order = append(order, offset+idx)
+		}
+		group.Events = evts
+		offset += len(indices)
+	}
+	return order
+}
+
+// Merges the structured event groups by their tags, and sorts the events of
+// each group by timestamp if configured. Within a data source, events are
+// otherwise kept in the order they were converted. The original position of
+// each event is returned, in the new order
+func arrangeStructuredEvents(cfg *Config, groups []*HumioStructuredEvents) ([]*HumioStructuredEvents, []int) {
+	results, order := coalesceStructuredEvents(groups)
+	if cfg.SortEventsByTimestamp {
+		order = reorderPositions(order, sortEventsByTimestamp(results))
+	}
+	return results, order
+}
+
+// Builds a key which is equal for groups that may be merged. Maps are encoded
+// with sorted keys, so equal tags always result in the same encoding
+func coalesceKey(group *HumioStructuredEvents) string {
+	// Encoding a map of strings never fails
+	tags, _ := json.Marshal(group.Tags)
+	return group.routingValue + "\x00" + string(tags)
+}
+
+// Translates the positions of events before coalescing into positions
+// matching the order of the coalesced events
+func reorderPositions(positions []int, order []int) []int {
+	result := make([]int, len(order))
+	for i, pos := range order {
+		result[i] = positions[pos]
+	}
+	return result
+}
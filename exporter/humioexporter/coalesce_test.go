@@ -0,0 +1,217 @@
+// Copyright The OpenTelemetry Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package humioexporter
+
+import (
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// Creates an event group with the specified tags, whose events carry their position
+func makeTaggedEvents(tags map[string]string, routingValue string, ids ...int) *HumioStructuredEvents {
+	evts := make([]*HumioStructuredEvent, len(ids))
+	for i, id := range ids {
+		evts[i] = &HumioStructuredEvent{
+			Timestamp:  time.Date(2021, 3, 28, 12, 30, 15, 0, time.UTC),
+			Attributes: map[string]string{"id": strconv.Itoa(id)},
+		}
+	}
+	return &HumioStructuredEvents{Tags: tags, Events: evts, routingValue: routingValue}
+}
+
+func TestCoalesceStructuredEvents(t *testing.T) {
+	// Arrange
+	a := map[string]string{"service": "a", "host": "h"}
+	b := map[string]string{"service": "b", "host": "h"}
+	testCases := []struct {
+		desc          string
+		groups        []*HumioStructuredEvents
+		expected      []*HumioStructuredEvents
+		expectedOrder []int
+	}{
+		{
+			desc:          "No groups",
+			groups:        nil,
+			expected:      nil,
+			expectedOrder: []int{},
+		},
+		{
+			desc:          "Distinct tags",
+			groups:        []*HumioStructuredEvents{makeTaggedEvents(a, "", 0, 1), makeTaggedEvents(b, "", 2)},
+			expected:      []*HumioStructuredEvents{makeTaggedEvents(a, "", 0, 1), makeTaggedEvents(b, "", 2)},
+			expectedOrder: []int{0, 1, 2},
+		},
+		{
+			desc: "Equal tags across resources",
+			groups: []*HumioStructuredEvents{
+				makeTaggedEvents(a, "", 0),
+				makeTaggedEvents(map[string]string{"host": "h", "service": "a"}, "", 1, 2),
+			},
+			expected:      []*HumioStructuredEvents{makeTaggedEvents(a, "", 0, 1, 2)},
+			expectedOrder: []int{0, 1, 2},
+		},
+		{
+			desc: "Interleaved tags",
+			groups: []*HumioStructuredEvents{
+				makeTaggedEvents(a, "", 0),
+				makeTaggedEvents(b, "", 1, 2),
+				makeTaggedEvents(a, "", 3),
+			},
+			expected:      []*HumioStructuredEvents{makeTaggedEvents(a, "", 0, 3), makeTaggedEvents(b, "", 1, 2)},
+			expectedOrder: []int{0, 3, 1, 2},
+		},
+		{
+			desc: "Subset of tags",
+			groups: []*HumioStructuredEvents{
+				makeTaggedEvents(a, "", 0),
+				makeTaggedEvents(map[string]string{"service": "a"}, "", 1),
+			},
+			expected: []*HumioStructuredEvents{
+				makeTaggedEvents(a, "", 0),
+				makeTaggedEvents(map[string]string{"service": "a"}, "", 1),
+			},
+			expectedOrder: []int{0, 1},
+		},
+		{
+			desc: "Different routing values",
+			groups: []*HumioStructuredEvents{
+				makeTaggedEvents(a, "tenant-a", 0),
+				makeTaggedEvents(a, "tenant-b", 1),
+				makeTaggedEvents(a, "tenant-a", 2),
+			},
+			expected: []*HumioStructuredEvents{
+				makeTaggedEvents(a, "tenant-a", 0, 2),
+				makeTaggedEvents(a, "tenant-b", 1),
+			},
+			expectedOrder: []int{0, 2, 1},
+		},
+	}
+
+	// Act / Assert
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			result, order := coalesceStructuredEvents(tC.groups)
+
+			assert.Equal(t, tC.expected, result)
+			assert.Equal(t, tC.expectedOrder, order)
+		})
+	}
+}
+
+func TestReorderPositions(t *testing.T) {
+	// Arrange
+	positions := []int{10, 11, 12, 13}
+	order := []int{0, 3, 1, 2}
+
+	// Act
+	result := reorderPositions(positions, order)
+
+	// Assert
+	assert.Equal(t, []int{10, 13, 11, 12}, result)
+}
+
+// Sets the timestamps of the events in a group, offset in seconds from a fixed time
+func withOffsets(group *HumioStructuredEvents, offsets ...int) *HumioStructuredEvents {
+	for i, offset := range offsets {
+		group.Events[i].Timestamp = time.Date(2021, 3, 28, 12, 30, 15, 0, time.UTC).Add(time.Duration(offset) * time.Second)
+	}
+	return group
+}
+
+func TestSortEventsByTimestamp(t *testing.T) {
+	// Arrange
+	a := map[string]string{"service": "a"}
+	b := map[string]string{"service": "b"}
+	groups := []*HumioStructuredEvents{
+		withOffsets(makeTaggedEvents(a, "", 0, 1, 2, 3), 3, 1, 2, 1),
+		withOffsets(makeTaggedEvents(b, "", 4, 5), 1, 0),
+	}
+
+	// Act
+	order := sortEventsByTimestamp(groups)
+
+	// Assert
+	assert.Equal(t, withOffsets(makeTaggedEvents(a, "", 1, 3, 2, 0), 1, 1, 2, 3), groups[0])
+	assert.Equal(t, withOffsets(makeTaggedEvents(b, "", 5, 4), 0, 1), groups[1])
+	assert.Equal(t, []int{1, 3, 2, 0, 5, 4}, order)
+}
+
+func TestArrangeStructuredEvents(t *testing.T) {
+	// Arrange
+	a := map[string]string{"service": "a"}
+	b := map[string]string{"service": "b"}
+	makeGroups := func() []*HumioStructuredEvents {
+		return []*HumioStructuredEvents{
+			withOffsets(makeTaggedEvents(a, "", 0, 1), 2, 0),
+			withOffsets(makeTaggedEvents(b, "", 2), 0),
+			withOffsets(makeTaggedEvents(a, "", 3, 4), 1, 0),
+		}
+	}
+	testCases := []struct {
+		desc          string
+		cfg           *Config
+		expected      []*HumioStructuredEvents
+		expectedOrder []int
+	}{
+		{
+			desc: "Original order",
+			cfg:  &Config{},
+			expected: []*HumioStructuredEvents{
+				withOffsets(makeTaggedEvents(a, "", 0, 1, 3, 4), 2, 0, 1, 0),
+				withOffsets(makeTaggedEvents(b, "", 2), 0),
+			},
+			expectedOrder: []int{0, 1, 3, 4, 2},
+		},
+		{
+			desc: "Sorted by timestamp",
+			cfg:  &Config{SortEventsByTimestamp: true},
+			expected: []*HumioStructuredEvents{
+				withOffsets(makeTaggedEvents(a, "", 1, 4, 3, 0), 0, 0, 1, 2),
+				withOffsets(makeTaggedEvents(b, "", 2), 0),
+			},
+			expectedOrder: []int{1, 4, 3, 0, 2},
+		},
+	}
+
+	// Act / Assert
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			result, order := arrangeStructuredEvents(tC.cfg, makeGroups())
+
+			assert.Equal(t, tC.expected, result)
+			assert.Equal(t, tC.expectedOrder, order)
+		})
+	}
+}
+
+func BenchmarkCoalesceStructuredEvents(b *testing.B) {
+	// A payload from many resources, where only a few tag sets are distinct
+	groups := make([]*HumioStructuredEvents, 100)
+	for i := range groups {
+		tags := map[string]string{
+			"service": "service-" + strconv.Itoa(i%5),
+			"host":    "collector-1",
+		}
+		groups[i] = makeTaggedEvents(tags, "", i*10, i*10+1, i*10+2, i*10+3)
+	}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		coalesceStructuredEvents(groups)
+	}
+}
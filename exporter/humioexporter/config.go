@@ -15,32 +15,282 @@
 package humioexporter
 
 import (
+	"compress/gzip"
+	"crypto/tls"
 	"errors"
 	"fmt"
+	"io/ioutil"
 	"net/url"
+	"os"
 	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
 
+	"github.com/klauspost/compress/zstd"
 	"go.opentelemetry.io/collector/config"
 	"go.opentelemetry.io/collector/config/confighttp"
 	"go.opentelemetry.io/collector/exporter/exporterhelper"
+	"go.opentelemetry.io/collector/translator/conventions"
 )
 
 const (
 	basePath         = "api/v1/ingest/"
 	unstructuredPath = basePath + "humio-unstructured"
 	structuredPath   = basePath + "humio-structured"
+
+	// The base path of the ingest APIs of a specific repository, which is
+	// followed by the name of the repository and the ingest path
+	repositoriesPath = "api/v1/repositories/"
+)
+
+// Supported precisions for Unix timestamps
+const (
+	precisionMilliseconds = "milliseconds"
+	precisionNanoseconds  = "nanoseconds"
+)
+
+// Supported units of timestamps, either as Unix time or as ISO 8601 formatted strings
+const (
+	timestampUnitSeconds      = "seconds"
+	timestampUnitMilliseconds = "milliseconds"
+	timestampUnitNanoseconds  = "nanoseconds"
+	timestampUnitISO8601      = "iso8601"
+)
+
+// Supported encodings for trace and span ids
+const (
+	idFormatHex    = "hex"
+	idFormatBase64 = "base64"
+)
+
+// Supported representations of the trace state of spans and links
+const (
+	traceStateFormatRaw    = "raw"
+	traceStateFormatFields = "fields"
+	traceStateFormatBoth   = "both"
+)
+
+// Supported strategies for attributes of a log record or span sharing their key
+// with an attribute of its resource
+const (
+	duplicateKeyRecordWins   = "record_wins"
+	duplicateKeyResourceWins = "resource_wins"
+	duplicateKeySuffix       = "suffix"
+)
+
+// Supported policies for requests which would exceed the max in-flight bytes
+const (
+	inflightBytesPolicyBlock = "block"
+	inflightBytesPolicyShed  = "shed"
 )
 
+// Supported compression algorithms for request bodies
+const (
+	compressionGzip = "gzip"
+	compressionZstd = "zstd"
+	compressionNone = "none"
+)
+
+// Encodings of the list of events in a request body
+const (
+	ingestEncodingJSONArray = "json_array"
+	ingestEncodingNDJSON    = "ndjson"
+)
+
+// Named gzip compression levels, as an alternative to a level between 1 and 9
+const (
+	compressionLevelBestSpeed       = "best_speed"
+	compressionLevelBestCompression = "best_compression"
+	compressionLevelDefault         = "default"
+)
+
+// Resolves the hostname of the collector, replaceable for testing
+var getHostname = os.Hostname
+
 // LogsConfig represents the Humio configuration settings specific to logs
 type LogsConfig struct {
 	// The name of a custom log parser to use, if no parser is associated with the ingest token
 	LogParser string `mapstructure:"log_parser"`
+
+	// The name of a log or resource attribute whose value overrides the parser for each log record
+	LogParserAttribute string `mapstructure:"log_parser_attribute"`
+
+	// Endpoint to use for logs instead of the top-level endpoint, if specified
+	Endpoint string `mapstructure:"endpoint"`
+
+	// The API to send logs to, either structured or unstructured, where the
+	// unstructured API sends the body of each log record as a message
+	IngestFormat string `mapstructure:"ingest_format"`
+
+	// Whether nested map and array attributes should be flattened into dotted field names
+	FlattenAttributes bool `mapstructure:"flatten_attributes"`
+
+	// The maximum number of nesting levels to flatten, beyond which values are kept as they are
+	MaxFlattenDepth int `mapstructure:"max_flatten_depth"`
+
+	// The name of the field holding the body of each log record
+	BodyField string `mapstructure:"body_field"`
+
+	// Whether map and array bodies should be encoded as a JSON string, rather than nested
+	RawStringBody bool `mapstructure:"raw_string_body"`
+
+	// The name of the field holding the normalized severity of each log record
+	SeverityField string `mapstructure:"severity_field"`
+
+	// The name of the field holding the event name of each log record
+	EventNameField string `mapstructure:"event_name_field"`
+
+	// The name of a field to also hold the timestamp of each log record, if specified
+	TimestampField string `mapstructure:"timestamp_field"`
+
+	// The unit of timestamps, either seconds, milliseconds, or nanoseconds
+	// since the Unix epoch, or iso8601 for formatted strings
+	TimestampUnit string `mapstructure:"timestamp_unit"`
+
+	// The names of the fields holding the trace and span id of each log record
+	TraceIDField string `mapstructure:"trace_id_field"`
+	SpanIDField  string `mapstructure:"span_id_field"`
+
+	// How to handle log records without a timestamp, either by using the current
+	// time or by rejecting the record
+	TimestampFallback string `mapstructure:"timestamp_fallback"`
+
+	// The names of attributes to keep as top-level fields of each log record,
+	// while all other attributes are nested under a single field when specified
+	PromoteAttributes []string `mapstructure:"promote_attributes"`
+
+	// Whether to disable the service tag for logs, overriding the top-level setting if specified
+	DisableServiceTag *bool `mapstructure:"disable_service_tag"`
+
+	// How newlines in string bodies are handled, either kept, escaped as \n, or
+	// replaced with the body_newline_replacement
+	BodyNewlines           string `mapstructure:"body_newlines"`
+	BodyNewlineReplacement string `mapstructure:"body_newline_replacement"`
+
+	// Whether to also escape the control characters other than newlines in string bodies
+	EscapeControlCharacters bool `mapstructure:"escape_control_characters"`
+
+	// Whether bodies sent to the structured API are escaped as well, rather
+	// than only the messages sent to the unstructured API
+	EscapeStructuredBodies bool `mapstructure:"escape_structured_bodies"`
+
+	// The maximum size in bytes of a single serialized structured event, beyond
+	// which the event is handled by the oversized_event_strategy. Zero disables the limit
+	MaxEventSize int `mapstructure:"max_event_size"`
+
+	// How events beyond the max_event_size are handled, either dropped or
+	// truncated by shortening their largest string attributes
+	OversizedEventStrategy string `mapstructure:"oversized_event_strategy"`
+
+	// Whether structured events carry the formatted body as their rawstring,
+	// either none, alongside the attributes, or only the rawstring
+	RawStringMode string `mapstructure:"rawstring_mode"`
+
+	// Whether the log records of each resource are sent unchanged as a single
+	// OTLP JSON message to the unstructured API, parsed by the passthrough_parser
+	PassthroughOTLPJSON bool   `mapstructure:"passthrough_otlp_json"`
+	PassthroughParser   string `mapstructure:"passthrough_parser"`
+
+	// Endpoints for the ingest APIs used by logs, created internally
+	unstructuredEndpoint *url.URL
+	structuredEndpoint   *url.URL
 }
 
 // TracesConfig represents the Humio configuration settings specific to traces
 type TracesConfig struct {
 	// Whether to use Unix timestamps, or to fall back to ISO 8601 formatted strings
 	UnixTimestamps bool `mapstructure:"unix_timestamps"`
+
+	// The precision of Unix timestamps, either milliseconds or nanoseconds
+	TimestampPrecision string `mapstructure:"timestamp_precision"`
+
+	// The unit of timestamps, which takes precedence over unix_timestamps and
+	// timestamp_precision when specified
+	TimestampUnit string `mapstructure:"timestamp_unit"`
+
+	// The encoding of trace and span ids, either hex or base64
+	IDFormat string `mapstructure:"id_format"`
+
+	// The name of a field to also hold the timestamp of each span and separate span event, if specified
+	TimestampField string `mapstructure:"timestamp_field"`
+
+	// The name of the field holding the duration of each span in milliseconds
+	DurationField string `mapstructure:"duration_field"`
+
+	// Whether to also include the duration of each span in nanoseconds
+	IncludeDurationNanos bool `mapstructure:"include_duration_ns"`
+
+	// The name of the field holding the status code of each span
+	StatusCodeField string `mapstructure:"status_code_field"`
+
+	// The name of the field holding the status message of each span
+	StatusMessageField string `mapstructure:"status_message_field"`
+
+	// The name of a field to also hold the kind of each span as a readable string, if specified
+	SpanKindField string `mapstructure:"span_kind_field"`
+
+	// The representation of the trace state of spans and links, either the raw
+	// string, a field for each of its list members, or both
+	TraceStateFormat string `mapstructure:"trace_state_format"`
+
+	// Whether span events should be exported as separate events, rather than nested within the span
+	SeparateSpanEvents bool `mapstructure:"separate_span_events"`
+
+	// Whether the links of each span should be included in the exported span
+	IncludeLinks bool `mapstructure:"include_links"`
+
+	// Prefix to prepend to the keys of span attributes
+	SpanAttributePrefix string `mapstructure:"span_attribute_prefix"`
+
+	// Prefix to prepend to the keys of resource attributes
+	ResourceAttributePrefix string `mapstructure:"resource_attribute_prefix"`
+
+	// Whether to disable the service tag for traces, overriding the top-level setting if specified
+	DisableServiceTag *bool `mapstructure:"disable_service_tag"`
+
+	// A preset for renaming the fields of spans, such as cim for Humio's
+	// Common Information Model, along with custom renames of individual fields
+	// which take precedence over the preset
+	FieldMappingPreset string            `mapstructure:"field_mapping_preset"`
+	FieldMapping       map[string]string `mapstructure:"field_mapping"`
+
+	// Whether spans carry their fields encoded as JSON in the rawstring, either
+	// none, alongside the attributes, or only the rawstring
+	RawStringMode string `mapstructure:"rawstring_mode"`
+
+	// Whether the spans of each resource are sent unchanged as a single OTLP
+	// JSON message to the unstructured API, parsed by the passthrough_parser
+	PassthroughOTLPJSON bool   `mapstructure:"passthrough_otlp_json"`
+	PassthroughParser   string `mapstructure:"passthrough_parser"`
+
+	// Endpoint to use for traces instead of the top-level endpoint, if specified
+	Endpoint string `mapstructure:"endpoint"`
+
+	// Endpoints for the ingest APIs used by traces, created internally
+	unstructuredEndpoint *url.URL
+	structuredEndpoint   *url.URL
+}
+
+// MetricsConfig represents the Humio configuration settings specific to metrics
+type MetricsConfig struct {
+	// The name of a custom parser to associate with metrics, if no parser is associated with the ingest token
+	MetricParser string `mapstructure:"metric_parser"`
+
+	// Whether to use Unix timestamps, or to fall back to ISO 8601 formatted strings
+	UnixTimestamps bool `mapstructure:"unix_timestamps"`
+
+	// Whether to include the exemplars of each data point, which are left out by default
+	IncludeExemplars bool `mapstructure:"include_exemplars"`
+
+	// Endpoint to use for metrics instead of the top-level endpoint, if specified
+	Endpoint string `mapstructure:"endpoint"`
+
+	// Endpoints for the ingest APIs used by metrics, created internally
+	unstructuredEndpoint *url.URL
+	structuredEndpoint   *url.URL
 }
 
 // Config represents the Humio configuration settings
@@ -54,58 +304,969 @@ type Config struct {
 	//Ingest token for identifying and authorizing with a Humio repository
 	IngestToken string `mapstructure:"ingest_token"`
 
+	// Path to a file containing the ingest token, as an alternative to specifying it inline
+	IngestTokenFile string `mapstructure:"ingest_token_file"`
+
+	// How often to re-read the ingest token file, allowing the token to be rotated. Zero disables reloading
+	IngestTokenReloadInterval time.Duration `mapstructure:"ingest_token_reload_interval"`
+
+	// Name of the repository to include in the path of the ingest APIs, for
+	// deployments where the repository is not implied by the ingest token
+	Repository string `mapstructure:"repository"`
+
+	// Name of the resource attribute whose value determines the repository to send events to
+	RoutingAttribute string `mapstructure:"routing_attribute"`
+
+	// Ingest tokens for the repositories to route events to, keyed by the value of the routing attribute
+	RoutingTokens map[string]string `mapstructure:"routing_tokens"`
+
+	// Whether endpoints may use plaintext http rather than https
+	AllowInsecure bool `mapstructure:"allow_insecure"`
+
+	// URL of the proxy to send requests through, regardless of the proxy environment variables
+	ProxyURL string `mapstructure:"proxy_url"`
+
+	// The lowest and highest TLS versions to negotiate with Humio, such as 1.2 or 1.3
+	TLSMinVersion string `mapstructure:"tls_min_version"`
+	TLSMaxVersion string `mapstructure:"tls_max_version"`
+
+	// The names of the cipher suites to offer for TLS 1.2 and below, such as
+	// TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256
+	TLSCipherSuites []string `mapstructure:"tls_cipher_suites"`
+
+	// The maximum number of idle connections kept open across all hosts
+	MaxIdleConns int `mapstructure:"max_idle_conns"`
+
+	// The maximum number of idle connections kept open to each host
+	MaxIdleConnsPerHost int `mapstructure:"max_idle_conns_per_host"`
+
+	// How long an idle connection is kept open before it is closed
+	IdleConnTimeout time.Duration `mapstructure:"idle_conn_timeout"`
+
+	// Whether every request should open a new connection, rather than reusing one
+	DisableKeepAlives bool `mapstructure:"disable_keep_alives"`
+
+	// How often idle connections are closed, such that they are reopened
+	// before a load balancer closes them, if specified
+	MaxConnLifetime time.Duration `mapstructure:"max_conn_lifetime"`
+
 	// Endpoint for the unstructured ingest API, created internally
 	unstructuredEndpoint *url.URL
 
 	// Endpoint for the structured ingest API, created internally
 	structuredEndpoint *url.URL
 
-	// Whether gzip compression should be disabled when sending data to Humio
+	// Whether gzip compression should be disabled when sending data to Humio.
+	// Deprecated in favor of setting Compression to "none"
 	DisableCompression bool `mapstructure:"disable_compression"`
 
+	// The compression algorithm to use when sending data to Humio, either gzip, zstd, or none
+	Compression string `mapstructure:"compression"`
+
+	// The gzip compression level, either between 1 and 9 or one of best_speed,
+	// best_compression, or default
+	CompressionLevel string `mapstructure:"compression_level"`
+
+	// The window size of the zstd encoder in bytes, which must be a power of two.
+	// Zero keeps the default of the library
+	CompressionWindowSize int `mapstructure:"compression_window_size"`
+
+	// Whether compressed request bodies are streamed to Humio using chunked
+	// transfer encoding, rather than compressed in memory up front
+	StreamBody bool `mapstructure:"stream_body"`
+
+	// Whether the exporter compresses payloads and sets the Content-Encoding
+	// header, which is left to a sidecar handling compression when disabled.
+	// Defaults to true
+	ManageContentEncoding *bool `mapstructure:"manage_content_encoding"`
+
+	// The encoding of the list of events in a request body, either a json_array or ndjson
+	IngestEncoding string `mapstructure:"ingest_encoding"`
+
+	// Whether the Content-Type header may be overridden, such as for proxies in
+	// front of Humio that expect a vendor-specific content type
+	AllowCustomContentType bool `mapstructure:"allow_custom_content_type"`
+
+	// The User-Agent header to send with requests to Humio, overriding the default
+	UserAgent string `mapstructure:"user_agent"`
+
+	// Whether the trace context of the export is sent along with requests to
+	// Humio as a traceparent header, when the export is traced
+	PropagateTraceContext bool `mapstructure:"propagate_trace_context"`
+
+	// The deadline for each individual request to Humio, separate from the
+	// timeout of the HTTP client. Zero means no per-request deadline
+	RequestTimeout time.Duration `mapstructure:"request_timeout"`
+
+	// The number of consecutive failures to send to Humio after which requests
+	// fail immediately for the cooldown. Zero disables the circuit breaker
+	CircuitBreakerThreshold int `mapstructure:"circuit_breaker_threshold"`
+
+	// How long requests fail immediately once the circuit breaker has opened
+	CircuitBreakerCooldown time.Duration `mapstructure:"circuit_breaker_cooldown"`
+
+	// How long requests that are in flight when the exporter shuts down are given
+	// to complete before being canceled. Zero cancels them immediately
+	ShutdownFlushTimeout time.Duration `mapstructure:"shutdown_flush_timeout"`
+
+	// How long the events of consecutive pushes are accumulated and merged into
+	// a single request before sending them. Zero sends every push right away
+	AccumulationWindow time.Duration `mapstructure:"accumulation_window"`
+
+	// The maximum fraction of the retry delay to add at random, between 0 and 1,
+	// for both delays requested by Humio and the backoff of retry_on_failure.
+	// Zero disables the jitter
+	RetryJitter float64 `mapstructure:"retry_jitter"`
+
+	// The HTTP status codes of failed requests which should be retried, where
+	// any other status code fails permanently
+	RetryOnStatusCodes []int `mapstructure:"retry_on_status_codes"`
+
+	// Whether requests interrupted by an established connection, such as a
+	// connection reset by a load balancer, should be retried. Failures to
+	// connect at all are always retried. Defaults to true
+	RetryOnConnectionErrors *bool `mapstructure:"retry_on_connection_errors"`
+
+	// The maximum time from the first attempt to send a request until it is
+	// dropped, including retries and the backoffs between them. Zero means no limit
+	MaxTotalRetryDuration time.Duration `mapstructure:"max_total_retry_duration"`
+
+	// Whether to skip sending requests to Humio, and instead log the payloads at debug level
+	DryRun bool `mapstructure:"dry_run"`
+
+	// Whether to verify that Humio accepts the ingest token when the exporter starts
+	CheckEndpointOnStart bool `mapstructure:"check_endpoint_on_start"`
+
+	// Whether to stop sending requests once Humio has rejected the ingest token,
+	// until the collector is restarted
+	FailOnAuthError bool `mapstructure:"fail_on_auth_error"`
+
+	// The maximum size in bytes of an uncompressed request body, above which
+	// payloads are split into multiple requests. Zero means no limit
+	MaxRequestBodySize int `mapstructure:"max_request_body_size"`
+
+	// The maximum number of events in a single request, above which payloads
+	// are split into multiple requests. Zero means no limit
+	MaxEventsPerRequest int `mapstructure:"max_events_per_request"`
+
+	// The maximum total size in bytes of the uncompressed bodies of requests in
+	// flight at the same time. Zero means no limit
+	MaxInFlightBytes int64 `mapstructure:"max_in_flight_bytes"`
+
+	// What to do with requests which would exceed the max in-flight bytes, either
+	// block until enough bytes are released or shed them to be retried later
+	InFlightBytesPolicy string `mapstructure:"in_flight_bytes_policy"`
+
+	// The limiter for the in-flight bytes, shared by all clients using this configuration
+	inflightBytes *inflightBytesLimiter
+
+	// Path to a file to which the bodies of permanently failed requests are appended
+	DeadLetterFile string `mapstructure:"dead_letter_file"`
+
+	// The maximum size in bytes of the dead letter file before it is rotated
+	DeadLetterMaxSize int64 `mapstructure:"dead_letter_max_size"`
+
+	// The writer for the dead letter file, shared by all clients using this configuration
+	deadLetter *deadLetterWriter
+
 	// Key-value pairs used to target specific data sources for storage inside Humio
 	Tags map[string]string `mapstructure:"tags,omitempty"`
 
 	// Whether this exporter should automatically add the service name as a tag
 	DisableServiceTag bool `mapstructure:"disable_service_tag"`
 
+	// The key under which the service name is added as a tag
+	ServiceTagKey string `mapstructure:"service_tag_key"`
+
+	// Whether this exporter should automatically add the hostname of the collector as a tag
+	AddHostTag bool `mapstructure:"add_host_tag"`
+
+	// The key under which the hostname of the collector is added as a tag
+	HostTagKey string `mapstructure:"host_tag_key"`
+
+	// The hostname of the collector, resolved internally when the host tag is enabled
+	hostname string
+
+	// The transform registered with the factory, if any
+	transform EventTransform
+
+	// The signer registered with the factory, if any
+	signer RequestSigner
+
+	// Whether characters which Humio does not allow in field names should be replaced
+	SanitizeFieldKeys bool `mapstructure:"sanitize_field_keys"`
+
+	// The string to replace disallowed characters in field names with
+	FieldKeyReplacement string `mapstructure:"field_key_replacement"`
+
+	// Prefixes to remove from the keys of attributes, such as a company-wide namespace
+	StripAttributeKeyPrefix []string `mapstructure:"strip_attribute_key_prefix"`
+
+	// The field under which the name of the instrumentation scope is added to events
+	ScopeNameKey string `mapstructure:"scope_name_key"`
+
+	// The field under which the version of the instrumentation scope is added to events
+	ScopeVersionKey string `mapstructure:"scope_version_key"`
+
+	// Whether to prefix the keys of attributes with the scope they originate
+	// from, rather than merging the attributes of all scopes into the same fields
+	NamespaceByScope bool `mapstructure:"namespace_by_scope"`
+
+	// How to merge attributes of a log record or span sharing their key with an
+	// attribute of its resource, either keeping the record attribute, keeping
+	// the resource attribute, or keeping both with the scope appended to their keys
+	DuplicateKeyStrategy string `mapstructure:"duplicate_key_strategy"`
+
+	// The maximum length in bytes of string attribute values, beyond which they are truncated. Zero disables the limit
+	MaxAttributeValueLength int `mapstructure:"max_attribute_value_length"`
+
+	// Whether attributes with values beyond the maximum length should be dropped rather than truncated
+	DropLongAttributeValues bool `mapstructure:"drop_long_attribute_values"`
+
+	// Whether to send the timestamp of each structured event as its ingest
+	// timestamp as well, such that replayed events keep their original time
+	IngestTimestampFromEvent bool `mapstructure:"ingest_timestamp_from_event"`
+
+	// Whether to leave empty maps and arrays out of the attributes of structured
+	// events, which saves bytes for events with empty attributes
+	OmitEmptyAttributes bool `mapstructure:"omit_empty_attributes"`
+
+	// Whether to sort the structured events of each data source by their
+	// timestamp, rather than keeping the order in which they were received
+	SortEventsByTimestamp bool `mapstructure:"sort_events_by_timestamp"`
+
+	// Fields added to every structured event, unless the event has a field with the same name
+	StaticFields map[string]string `mapstructure:"static_fields"`
+
+	// The maximum number of distinct tag combinations within the window, beyond
+	// which high-cardinality tags are dropped from events. Zero means no limit
+	MaxTagCardinality int `mapstructure:"max_tag_cardinality"`
+
+	// The window of time over which distinct tag combinations are counted
+	TagCardinalityWindow time.Duration `mapstructure:"tag_cardinality_window"`
+
+	// Names of resource attributes which should be promoted to tags when present
+	TagFromResourceAttributes []string `mapstructure:"tag_from_resource_attributes"`
+
+	// Names of resource attributes which should not be sent as fields, where a
+	// trailing asterisk matches any attribute with the preceding prefix
+	DropResourceAttributes []string `mapstructure:"drop_resource_attributes"`
+
 	// Configuration options specific to logs
 	Logs LogsConfig `mapstructure:"logs"`
 
 	// Configuration options specific to traces
 	Traces TracesConfig `mapstructure:"traces"`
+
+	// Configuration options specific to metrics
+	Metrics MetricsConfig `mapstructure:"metrics"`
 }
 
 // Validate ensures that a valid configuration has been provided, such that we can fail early
 func (c *Config) Validate() error {
-	if c.IngestToken == "" {
-		return errors.New("requires an ingest_token")
+	// When routing, the ingest token is only used for events without a matching route
+	if c.IngestToken == "" && c.IngestTokenFile == "" && c.RoutingAttribute == "" {
+		return errors.New("requires an ingest_token or an ingest_token_file")
+	}
+
+	if c.IngestToken != "" && c.IngestTokenFile != "" {
+		return errors.New("only one of ingest_token and ingest_token_file may be specified")
 	}
 
-	if c.Endpoint == "" {
+	if c.IngestTokenFile != "" {
+		if _, err := readIngestToken(c.IngestTokenFile); err != nil {
+			return err
+		}
+	}
+
+	if c.IngestTokenReloadInterval < 0 {
+		return errors.New("the ingest_token_reload_interval must not be negative")
+	}
+	if c.IngestTokenReloadInterval > 0 && c.IngestTokenFile == "" {
+		return errors.New("the ingest_token_reload_interval requires an ingest_token_file")
+	}
+
+	if strings.Contains(c.Repository, "/") {
+		return fmt.Errorf("invalid repository %s, must not contain slashes", c.Repository)
+	}
+	if c.Repository != "" && c.RoutingAttribute != "" {
+		return errors.New("the repository cannot be combined with a routing_attribute, which sends events to the repositories of the routing_tokens")
+	}
+
+	if err := c.validateRouting(); err != nil {
+		return err
+	}
+
+	// The top-level endpoint may be omitted when signals override it, in which
+	// case the endpoint of each signal is checked once its exporter is created
+	if c.Endpoint == "" && c.Logs.Endpoint == "" && c.Traces.Endpoint == "" && c.Metrics.Endpoint == "" {
 		return errors.New("requires an endpoint")
 	}
 
-	if c.DisableServiceTag && len(c.Tags) == 0 {
-		return errors.New("requires at least one custom tag when disabling service tag")
+	// Each signal may disable the service tag on its own
+	for _, dataType := range []config.DataType{config.LogsDataType, config.TracesDataType, config.MetricsDataType} {
+		disabled := c.serviceTagDisabled(dataType)
+		if disabled && !c.AddHostTag && len(c.Tags) == 0 && len(c.TagFromResourceAttributes) == 0 {
+			return fmt.Errorf("requires at least one custom tag when disabling service tag for %s", dataType)
+		}
+
+		if !disabled && c.ServiceTagKey == "" {
+			return fmt.Errorf("requires a service_tag_key when the service tag is enabled for %s", dataType)
+		}
+	}
+
+	if c.AddHostTag && c.HostTagKey == "" {
+		return errors.New("requires a host_tag_key when the host tag is enabled")
+	}
+
+	for _, attr := range c.TagFromResourceAttributes {
+		if attr == "" {
+			return errors.New("the tag_from_resource_attributes must not contain empty attribute names")
+		}
+	}
+
+	if c.MaxTagCardinality < 0 {
+		return errors.New("the max_tag_cardinality must not be negative")
+	}
+	if c.MaxTagCardinality > 0 && c.TagCardinalityWindow <= 0 {
+		return errors.New("the tag_cardinality_window must be positive when max_tag_cardinality is specified")
+	}
+
+	for _, pattern := range c.DropResourceAttributes {
+		if pattern == "" {
+			return errors.New("the drop_resource_attributes must not contain empty attribute names")
+		}
+		if strings.Contains(strings.TrimSuffix(pattern, "*"), "*") {
+			return fmt.Errorf("unsupported pattern %s in drop_resource_attributes, an asterisk is only allowed at the end", pattern)
+		}
 	}
 
 	// Ensure that it is possible to construct URLs to access the ingest API
-	if _, err := c.getEndpoint(unstructuredPath); err != nil {
-		return fmt.Errorf("unable to create URL for unstructured ingest API, endpoint %s is invalid", c.Endpoint)
+	for _, endpoint := range []string{c.Endpoint, c.Logs.Endpoint, c.Traces.Endpoint, c.Metrics.Endpoint} {
+		if _, err := joinEndpoint(endpoint, c.getUnstructuredPath()); err != nil {
+			return fmt.Errorf("unable to create URL for unstructured ingest API, endpoint %s is invalid", endpoint)
+		}
+		if err := c.validateScheme(endpoint); err != nil {
+			return err
+		}
+	}
+
+	if c.MaxIdleConns < 0 || c.MaxIdleConnsPerHost < 0 || c.IdleConnTimeout < 0 {
+		return errors.New("the max_idle_conns, max_idle_conns_per_host, and idle_conn_timeout must not be negative")
+	}
+
+	if c.MaxConnLifetime < 0 {
+		return errors.New("the max_conn_lifetime must not be negative")
+	}
+
+	if err := validateProxyURL(c.ProxyURL); err != nil {
+		return err
+	}
+
+	if err := c.validateTLS(); err != nil {
+		return err
+	}
+
+	for k := range c.StaticFields {
+		if k == "" {
+			return errors.New("the static_fields must not contain empty field names")
+		}
+	}
+
+	for _, prefix := range c.StripAttributeKeyPrefix {
+		if prefix == "" {
+			return errors.New("the strip_attribute_key_prefix must not contain empty prefixes")
+		}
+	}
+
+	if !isValidFieldKey(c.FieldKeyReplacement) {
+		return errors.New("the field_key_replacement must only contain characters allowed in field names")
+	}
+
+	switch c.DuplicateKeyStrategy {
+	case "", duplicateKeyRecordWins, duplicateKeyResourceWins, duplicateKeySuffix:
+	default:
+		return fmt.Errorf("unsupported duplicate_key_strategy %s, must be either record_wins, resource_wins, or suffix", c.DuplicateKeyStrategy)
+	}
+
+	if c.MaxAttributeValueLength < 0 {
+		return errors.New("the max_attribute_value_length must not be negative")
+	}
+	if c.DropLongAttributeValues && c.MaxAttributeValueLength == 0 {
+		return errors.New("drop_long_attribute_values requires a max_attribute_value_length")
+	}
+
+	if c.CircuitBreakerThreshold < 0 {
+		return errors.New("the circuit_breaker_threshold must not be negative")
+	}
+	if c.CircuitBreakerThreshold > 0 && c.CircuitBreakerCooldown <= 0 {
+		return errors.New("the circuit_breaker_cooldown must be positive when the circuit breaker is enabled")
+	}
+
+	if c.ShutdownFlushTimeout < 0 {
+		return errors.New("the shutdown_flush_timeout must not be negative")
+	}
+	if c.AccumulationWindow < 0 {
+		return errors.New("the accumulation_window must not be negative")
+	}
+
+	if c.RetryJitter < 0 || c.RetryJitter > 1 {
+		return errors.New("the retry_jitter must be between 0 and 1")
+	}
+
+	for _, code := range c.RetryOnStatusCodes {
+		if code < 400 || code > 599 {
+			return fmt.Errorf("unsupported status code %d in retry_on_status_codes, must be between 400 and 599", code)
+		}
+		if c.FailOnAuthError && (code == 401 || code == 403) {
+			return fmt.Errorf("the status code %d in retry_on_status_codes cannot be retried with fail_on_auth_error", code)
+		}
+	}
+
+	if c.RequestTimeout < 0 {
+		return errors.New("the request_timeout must not be negative")
+	}
+	if c.MaxTotalRetryDuration < 0 {
+		return errors.New("the max_total_retry_duration must not be negative")
+	}
+	if c.Timeout > 0 && c.RequestTimeout > c.Timeout {
+		return errors.New("the request_timeout must not be larger than the client timeout")
+	}
+
+	if c.MaxInFlightBytes < 0 {
+		return errors.New("the max_in_flight_bytes must not be negative")
+	}
+	switch c.InFlightBytesPolicy {
+	case "", inflightBytesPolicyBlock, inflightBytesPolicyShed:
+	default:
+		return fmt.Errorf("unsupported in_flight_bytes_policy %s, must be either block or shed", c.InFlightBytesPolicy)
+	}
+
+	if c.DeadLetterFile != "" && c.DeadLetterMaxSize <= 0 {
+		return errors.New("the dead_letter_max_size must be positive when dead_letter_file is specified")
+	}
+
+	if c.MaxRequestBodySize < 0 {
+		return errors.New("the max_request_body_size must not be negative")
+	}
+
+	if c.MaxEventsPerRequest < 0 {
+		return errors.New("the max_events_per_request must not be negative")
+	}
+
+	// The queue is only drained by its consumers, so it would otherwise fill up and reject everything
+	if c.QueueSettings.Enabled && c.QueueSettings.NumConsumers <= 0 {
+		return errors.New("the sending_queue num_consumers must be positive when the queue is enabled")
+	}
+
+	if err := c.Logs.validate(); err != nil {
+		return err
+	}
+
+	// Unstructured logs are sent to a different API than any other events
+	if c.Logs.IngestFormat == ingestFormatUnstructured || c.Logs.PassthroughOTLPJSON {
+		endpoint := c.Logs.Endpoint
+		if endpoint == "" {
+			endpoint = c.Endpoint
+		}
+		if u, err := joinEndpoint(endpoint, c.getUnstructuredPath()); err != nil || u.Host == "" {
+			return fmt.Errorf("the unstructured ingest API for logs cannot be reached through endpoint %s", endpoint)
+		}
+	}
+
+	if err := c.Traces.validate(); err != nil {
+		return err
+	}
+
+	if c.Traces.PassthroughOTLPJSON {
+		endpoint := c.Traces.Endpoint
+		if endpoint == "" {
+			endpoint = c.Endpoint
+		}
+		if u, err := joinEndpoint(endpoint, c.getUnstructuredPath()); err != nil || u.Host == "" {
+			return fmt.Errorf("the unstructured ingest API for traces cannot be reached through endpoint %s", endpoint)
+		}
+	}
+
+	// Fields renamed onto the same name would overwrite each other at random.
+	// Sorted, such that the same collision is reported every time
+	mapping := c.getSpanFieldMapping()
+	mapped := make([]string, 0, len(mapping))
+	for field := range mapping {
+		mapped = append(mapped, field)
+	}
+	sort.Strings(mapped)
+
+	fields := make(map[string]string, len(mapping))
+	for _, field := range mapped {
+		name := mapping[field]
+		if other, ok := fields[name]; ok {
+			return fmt.Errorf("the field_mapping for traces renames both %s and %s to %s", other, field, name)
+		}
+		fields[name] = field
+	}
+
+	if err := c.Metrics.validate(); err != nil {
+		return err
+	}
+
+	switch c.IngestEncoding {
+	case "", ingestEncodingJSONArray, ingestEncodingNDJSON:
+	default:
+		return fmt.Errorf("unsupported ingest_encoding %s, must be either json_array or ndjson", c.IngestEncoding)
 	}
 
 	// We require these headers, which should not be overwritten by the user
-	if contentType, ok := c.Headers["content-type"]; ok && contentType != "application/json" {
-		return errors.New("the Content-Type must be application/json, which is also the default for this header")
+	// unless explicitly permitted
+	if contentType, ok := c.Headers["content-type"]; ok && contentType != c.getContentType() && !c.AllowCustomContentType {
+		return fmt.Errorf("the Content-Type must be %s, which is also the default for this header", c.getContentType())
 	}
 
 	if _, ok := c.Headers["authorization"]; ok {
 		return errors.New("the Authorization header must not be overwritten, since it is automatically generated from the ingest token")
 	}
 
-	if enc, ok := c.Headers["content-encoding"]; ok && (c.DisableCompression || enc != "gzip") {
-		return errors.New("the Content-Encoding header must be gzip when using compression, and empty when compression is disabled")
+	if _, ok := c.Headers["user-agent"]; ok && c.UserAgent != "" {
+		return errors.New("the User-Agent header must not be specified when user_agent is also set")
+	}
+
+	switch c.Compression {
+	case "", compressionGzip, compressionZstd, compressionNone:
+	default:
+		return fmt.Errorf("unsupported compression %s, must be one of gzip, zstd, or none", c.Compression)
+	}
+
+	if c.DisableCompression && c.Compression != "" && c.Compression != compressionNone {
+		return errors.New("disable_compression cannot be combined with compression other than none")
+	}
+
+	if !c.manageContentEncoding() && c.Compression != "" && c.Compression != compressionNone {
+		return errors.New("the compression must be none when the content encoding is not managed by the exporter")
+	}
+
+	// The header is left untouched when the content encoding is not managed
+	compression := c.getCompression()
+	if enc, ok := c.Headers["content-encoding"]; ok && c.manageContentEncoding() && (compression == compressionNone || enc != compression) {
+		return errors.New("the Content-Encoding header must match the compression algorithm, and be empty when compression is disabled")
+	}
+
+	if c.CompressionLevel != "" {
+		if compression != compressionGzip {
+			return errors.New("the compression_level is only supported with gzip compression")
+		}
+		if _, err := c.getCompressionLevel(); err != nil {
+			return err
+		}
+	}
+
+	if c.CompressionWindowSize != 0 {
+		if compression != compressionZstd {
+			return errors.New("the compression_window_size is only supported with zstd compression")
+		}
+		size := c.CompressionWindowSize
+		if size < zstd.MinWindowSize || size > zstd.MaxWindowSize || size&(size-1) != 0 {
+			return fmt.Errorf("unsupported compression_window_size %d, must be a power of two between %d and %d", size, zstd.MinWindowSize, zstd.MaxWindowSize)
+		}
+	}
+
+	return nil
+}
+
+// Ensures that the settings for routing events to multiple repositories are valid
+func (c *Config) validateRouting() error {
+	if c.RoutingAttribute == "" {
+		if len(c.RoutingTokens) > 0 {
+			return errors.New("the routing_tokens require a routing_attribute")
+		}
+		return nil
+	}
+
+	if len(c.RoutingTokens) == 0 {
+		return errors.New("requires at least one entry in routing_tokens when routing_attribute is specified")
+	}
+
+	for value, token := range c.RoutingTokens {
+		if value == "" || token == "" {
+			return errors.New("the routing_tokens must not contain empty attribute values or ingest tokens")
+		}
+	}
+
+	return nil
+}
+
+// Ensures that an endpoint uses https, or http if explicitly allowed, such
+// that ingest tokens are not sent in the clear by accident
+func (c *Config) validateScheme(endpoint string) error {
+	if endpoint == "" {
+		return nil
+	}
+
+	// The endpoint has already been verified to parse
+	u, _ := url.Parse(endpoint)
+	switch strings.ToLower(u.Scheme) {
+	case "https":
+		return nil
+	case "http":
+		if c.AllowInsecure {
+			return nil
+		}
+		return fmt.Errorf("the endpoint %s uses the scheme http, which sends the ingest token in the clear and requires allow_insecure", endpoint)
+	default:
+		return fmt.Errorf("the endpoint %s uses the unsupported scheme %q, only http and https are supported", endpoint, u.Scheme)
+	}
+}
+
+// Ensures that the proxy URL, if any, can be dialed by the HTTP client. The URL
+// is left out of errors, since it may contain the credentials for the proxy
+func validateProxyURL(proxy string) error {
+	if proxy == "" {
+		return nil
+	}
+
+	u, err := url.Parse(proxy)
+	if err != nil {
+		return errors.New("the proxy_url is not a valid URL")
+	}
+
+	switch strings.ToLower(u.Scheme) {
+	case "http", "https", "socks5":
+	default:
+		return fmt.Errorf("the proxy_url uses the unsupported scheme %q, only http, https, and socks5 are supported", u.Scheme)
+	}
+
+	if u.Host == "" {
+		return errors.New("the proxy_url must specify a host")
+	}
+	return nil
+}
+
+// The TLS versions which may be configured, by their version number
+var tlsVersions = map[string]uint16{
+	"1.0": tls.VersionTLS10,
+	"1.1": tls.VersionTLS11,
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+// Get the cipher suite with the specified name. Only suites without known
+// security issues are supported
+func lookupCipherSuite(name string) (uint16, bool) {
+	for _, suite := range tls.CipherSuites() {
+		if suite.Name == name {
+			return suite.ID, true
+		}
+	}
+	return 0, false
+}
+
+// Ensures that the TLS versions are known and form a valid range, and that
+// the cipher suites are supported
+func (c *Config) validateTLS() error {
+	min, ok := tlsVersions[c.TLSMinVersion]
+	if c.TLSMinVersion != "" && !ok {
+		return fmt.Errorf("the tls_min_version %q is unknown, use one of 1.0, 1.1, 1.2, or 1.3", c.TLSMinVersion)
+	}
+	max, ok := tlsVersions[c.TLSMaxVersion]
+	if c.TLSMaxVersion != "" && !ok {
+		return fmt.Errorf("the tls_max_version %q is unknown, use one of 1.0, 1.1, 1.2, or 1.3", c.TLSMaxVersion)
+	}
+	if min != 0 && max != 0 && max < min {
+		return errors.New("the tls_max_version must not be lower than the tls_min_version")
+	}
+
+	for _, name := range c.TLSCipherSuites {
+		if _, ok := lookupCipherSuite(name); !ok {
+			return fmt.Errorf("the tls_cipher_suites contain the unsupported cipher suite %q", name)
+		}
+	}
+	return nil
+}
+
+// Ensures that the settings specific to logs are valid
+func (l *LogsConfig) validate() error {
+	if l.FlattenAttributes && l.MaxFlattenDepth <= 0 {
+		return errors.New("the max_flatten_depth must be positive when flatten_attributes is enabled")
+	}
+
+	switch l.IngestFormat {
+	case "", ingestFormatStructured, ingestFormatUnstructured:
+	default:
+		return fmt.Errorf("unsupported ingest_format %s, must be either structured or unstructured", l.IngestFormat)
+	}
+
+	for _, name := range l.PromoteAttributes {
+		if name == "" {
+			return errors.New("the promote_attributes must not contain empty attribute names")
+		}
+	}
+
+	switch l.TimestampFallback {
+	case "", timestampFallbackNow, timestampFallbackReject:
+	case timestampFallbackObserved:
+		return errors.New("the timestamp_fallback observed is not supported, since log records do not carry an observed timestamp in this version of the collector")
+	default:
+		return fmt.Errorf("unsupported timestamp_fallback %s, must be either now or reject", l.TimestampFallback)
+	}
+
+	switch l.BodyNewlines {
+	case "", bodyNewlinesKeep, bodyNewlinesEscape, bodyNewlinesReplace:
+	default:
+		return fmt.Errorf("unsupported body_newlines %s, must be either keep, escape, or replace", l.BodyNewlines)
+	}
+
+	if l.MaxEventSize < 0 {
+		return errors.New("the max_event_size must not be negative")
+	}
+
+	switch l.OversizedEventStrategy {
+	case "", oversizedEventDrop, oversizedEventTruncate:
+	default:
+		return fmt.Errorf("unsupported oversized_event_strategy %s, must be either drop or truncate", l.OversizedEventStrategy)
+	}
+
+	if err := validateRawStringMode(l.RawStringMode); err != nil {
+		return err
+	}
+
+	// Unstructured messages are already raw strings, and are parsed by the
+	// parser of the ingest token or the log_parser instead
+	if l.IngestFormat == ingestFormatUnstructured && l.RawStringMode != "" && l.RawStringMode != rawStringModeNone {
+		return errors.New("the rawstring_mode for logs is only supported with the structured ingest_format")
+	}
+
+	if l.PassthroughOTLPJSON && l.PassthroughParser == "" {
+		return errors.New("the passthrough_parser for logs must be specified when passthrough_otlp_json is enabled")
+	}
+
+	return validateTimestampUnit(l.TimestampUnit)
+}
+
+// Ensures that the mode of sending rawstrings is supported
+func validateRawStringMode(mode string) error {
+	switch mode {
+	case "", rawStringModeNone, rawStringModeAlongside, rawStringModeOnly:
+		return nil
+	default:
+		return fmt.Errorf("unsupported rawstring_mode %s, must be either none, alongside, or only", mode)
+	}
+}
+
+// Ensures that the unit of timestamps is supported
+func validateTimestampUnit(unit string) error {
+	switch unit {
+	case "", timestampUnitSeconds, timestampUnitMilliseconds, timestampUnitNanoseconds, timestampUnitISO8601:
+		return nil
+	default:
+		return fmt.Errorf("unsupported timestamp_unit %s, must be either seconds, milliseconds, nanoseconds, or iso8601", unit)
+	}
+}
+
+// Get the precision of Unix timestamps in the specified unit, which is zero
+// for ISO 8601 formatted timestamps
+func timestampUnitPrecision(unit string) time.Duration {
+	switch unit {
+	case timestampUnitSeconds:
+		return time.Second
+	case timestampUnitMilliseconds:
+		return time.Millisecond
+	case timestampUnitNanoseconds:
+		return time.Nanosecond
+	default:
+		return 0
+	}
+}
+
+// Formats a timestamp nested within the attributes of an event, using the
+// representation of the specified unit
+func formatTimestampUnit(t time.Time, unit string) interface{} {
+	if precision := timestampUnitPrecision(unit); precision > 0 {
+		return t.UnixNano() / int64(precision)
+	}
+	return t
+}
+
+// Get the unit of timestamps of log records. Defaults to iso8601
+func (l *LogsConfig) getTimestampUnit() string {
+	if l.TimestampUnit == "" {
+		return timestampUnitISO8601
+	}
+	return l.TimestampUnit
+}
+
+// Get how log records without a timestamp are handled. Defaults to using the current time
+func (l *LogsConfig) getTimestampFallback() string {
+	if l.TimestampFallback == "" {
+		return timestampFallbackNow
+	}
+	return l.TimestampFallback
+}
+
+// Get how events beyond the max_event_size are handled. Defaults to dropping them
+func (l *LogsConfig) getOversizedEventStrategy() string {
+	if l.OversizedEventStrategy == "" {
+		return oversizedEventDrop
+	}
+	return l.OversizedEventStrategy
+}
+
+// Get the name of the field holding the body of log records. Defaults to message
+func (l *LogsConfig) getBodyField() string {
+	if l.BodyField == "" {
+		return defaultBodyField
+	}
+	return l.BodyField
+}
+
+// Get the name of the field holding the normalized severity. Defaults to severity
+func (l *LogsConfig) getSeverityField() string {
+	if l.SeverityField == "" {
+		return defaultSeverityField
+	}
+	return l.SeverityField
+}
+
+// Get the name of the field holding the event name. Defaults to event_name
+func (l *LogsConfig) getEventNameField() string {
+	if l.EventNameField == "" {
+		return defaultEventNameField
+	}
+	return l.EventNameField
+}
+
+// Get the name of the field holding the trace id of log records. Defaults to trace_id
+func (l *LogsConfig) getTraceIDField() string {
+	if l.TraceIDField == "" {
+		return defaultLogTraceIDField
+	}
+	return l.TraceIDField
+}
+
+// Get the name of the field holding the span id of log records. Defaults to span_id
+func (l *LogsConfig) getSpanIDField() string {
+	if l.SpanIDField == "" {
+		return defaultLogSpanIDField
+	}
+	return l.SpanIDField
+}
+
+// Ensures that the settings specific to traces are valid
+func (t *TracesConfig) validate() error {
+	switch t.TimestampPrecision {
+	case "", precisionMilliseconds, precisionNanoseconds:
+	default:
+		return fmt.Errorf("unsupported timestamp_precision %s, must be either milliseconds or nanoseconds", t.TimestampPrecision)
+	}
+
+	switch t.IDFormat {
+	case "", idFormatHex, idFormatBase64:
+	default:
+		return fmt.Errorf("unsupported id_format %s, must be either hex or base64", t.IDFormat)
+	}
+
+	switch t.TraceStateFormat {
+	case "", traceStateFormatRaw, traceStateFormatFields, traceStateFormatBoth:
+	default:
+		return fmt.Errorf("unsupported trace_state_format %s, must be either raw, fields, or both", t.TraceStateFormat)
+	}
+
+	switch t.FieldMappingPreset {
+	case "", fieldMappingPresetNone, fieldMappingPresetCIM:
+	default:
+		return fmt.Errorf("unsupported field_mapping_preset %s, must be either none or cim", t.FieldMappingPreset)
+	}
+
+	for field, name := range t.FieldMapping {
+		if field == "" || name == "" {
+			return errors.New("the field_mapping must not contain empty field names")
+		}
+	}
+
+	if err := validateRawStringMode(t.RawStringMode); err != nil {
+		return err
+	}
+
+	if t.PassthroughOTLPJSON && t.PassthroughParser == "" {
+		return errors.New("the passthrough_parser for traces must be specified when passthrough_otlp_json is enabled")
+	}
+
+	return validateTimestampUnit(t.TimestampUnit)
+}
+
+// Get the unit of timestamps of spans, which falls back to unix_timestamps
+// and timestamp_precision when not specified. Defaults to iso8601
+func (t *TracesConfig) getTimestampUnit() string {
+	switch {
+	case t.TimestampUnit != "":
+		return t.TimestampUnit
+	case !t.UnixTimestamps:
+		return timestampUnitISO8601
+	case t.TimestampPrecision == precisionNanoseconds:
+		return timestampUnitNanoseconds
+	default:
+		return timestampUnitMilliseconds
+	}
+}
+
+// Get the prefixes to prepend to the keys of resource and span attributes, where
+// namespacing attributes by scope takes precedence over the configured prefixes
+func (c *Config) getSpanAttributePrefixes() (string, string) {
+	if c.NamespaceByScope {
+		return resourceNamespace, spanNamespace
+	}
+	return c.Traces.ResourceAttributePrefix, c.Traces.SpanAttributePrefix
+}
+
+// Get the names to rename the fields of spans to, combining the preset with the
+// custom renames. The CIM preset is based on the configured names of the fields
+func (c *Config) getSpanFieldMapping() map[string]string {
+	mapping := make(map[string]string)
+	if c.Traces.FieldMappingPreset == fieldMappingPresetCIM {
+		resPrefix, _ := c.getSpanAttributePrefixes()
+		mapping["trace_id"] = "trace.id"
+		mapping["span_id"] = "span.id"
+		mapping["parent_span_id"] = "parent.id"
+		mapping["name"] = "span.name"
+		mapping["kind"] = "span.kind"
+		mapping[durationNanosField] = "event.duration"
+		mapping[c.Traces.getStatusCodeField()] = "span.status.code"
+		mapping[c.Traces.getStatusMessageField()] = "span.status.message"
+		mapping[resPrefix+conventions.AttributeServiceName] = "source"
+	}
+
+	for field, name := range c.Traces.FieldMapping {
+		mapping[field] = name
+	}
+	return mapping
+}
+
+// Get the name of the field holding the duration of spans. Defaults to duration_ms
+func (t *TracesConfig) getDurationField() string {
+	if t.DurationField == "" {
+		return defaultDurationField
+	}
+	return t.DurationField
+}
+
+// Get the name of the field holding the status code of spans. Defaults to status_code
+func (t *TracesConfig) getStatusCodeField() string {
+	if t.StatusCodeField == "" {
+		return defaultStatusCodeField
+	}
+	return t.StatusCodeField
+}
+
+// Get the name of the field holding the status message of spans. Defaults to status_message
+func (t *TracesConfig) getStatusMessageField() string {
+	if t.StatusMessageField == "" {
+		return defaultStatusMessageField
+	}
+	return t.StatusMessageField
+}
+
+// Ensures that the settings specific to metrics are valid
+func (m *MetricsConfig) validate() error {
+	if m.MetricParser != "" && strings.TrimSpace(m.MetricParser) == "" {
+		return errors.New("the metric_parser must not consist only of whitespace")
 	}
 
 	return nil
@@ -113,8 +1274,8 @@ func (c *Config) Validate() error {
 
 // Sanitize ensures that the correct headers are inserted and that a url for each endpoint is obtainable
 func (c *Config) sanitize() error {
-	structured, errS := c.getEndpoint(structuredPath)
-	unstructured, errU := c.getEndpoint(unstructuredPath)
+	structured, errS := c.getEndpoint(c.getStructuredPath())
+	unstructured, errU := c.getEndpoint(c.getUnstructuredPath())
 
 	if errS != nil || errU != nil {
 		return fmt.Errorf("badly formatted endpoint %s", c.Endpoint)
@@ -122,31 +1283,304 @@ func (c *Config) sanitize() error {
 	c.structuredEndpoint = structured
 	c.unstructuredEndpoint = unstructured
 
+	// Signals without an endpoint override fall back to the top-level endpoint
+	var err error
+	c.Logs.structuredEndpoint, c.Logs.unstructuredEndpoint, err = c.getSignalEndpoints(c.Logs.Endpoint)
+	if err != nil {
+		return err
+	}
+	c.Traces.structuredEndpoint, c.Traces.unstructuredEndpoint, err = c.getSignalEndpoints(c.Traces.Endpoint)
+	if err != nil {
+		return err
+	}
+	c.Metrics.structuredEndpoint, c.Metrics.unstructuredEndpoint, err = c.getSignalEndpoints(c.Metrics.Endpoint)
+	if err != nil {
+		return err
+	}
+
 	if c.Headers == nil {
 		c.Headers = make(map[string]string)
 	}
 
-	c.Headers["content-type"] = "application/json"
-	c.Headers["authorization"] = "Bearer " + c.IngestToken
+	if _, ok := c.Headers["content-type"]; !ok || !c.AllowCustomContentType {
+		c.Headers["content-type"] = c.getContentType()
+	}
+	token := c.IngestToken
+	if c.IngestTokenFile != "" {
+		var err error
+		if token, err = readIngestToken(c.IngestTokenFile); err != nil {
+			return err
+		}
+	}
+	// Without an ingest token, events are only sent to the repositories of the routing_tokens
+	if token != "" {
+		c.Headers["authorization"] = "Bearer " + token
+	}
 
-	if !c.DisableCompression {
-		c.Headers["content-encoding"] = "gzip"
+	c.Compression = c.getCompression()
+	if c.Compression != compressionNone {
+		c.Headers["content-encoding"] = c.Compression
 	}
 
-	if _, ok := c.Headers["user-agent"]; !ok {
+	if c.UserAgent != "" {
+		c.Headers["user-agent"] = c.UserAgent
+	} else if _, ok := c.Headers["user-agent"]; !ok {
 		c.Headers["user-agent"] = "opentelemetry-collector-contrib Humio"
 	}
 
+	// Exporters for different signals share the configuration, and must also
+	// share the writer to avoid interleaving rotations
+	if c.DeadLetterFile != "" && c.deadLetter == nil {
+		c.deadLetter = newDeadLetterWriter(c.DeadLetterFile, c.DeadLetterMaxSize)
+	}
+
+	// The in-flight bytes are limited across all signals, which share the memory
+	if c.MaxInFlightBytes > 0 && c.inflightBytes == nil {
+		c.inflightBytes = newInflightBytesLimiter(c.MaxInFlightBytes, c.InFlightBytesPolicy)
+	}
+
+	// Resolve the hostname once, rather than for every request
+	if c.AddHostTag {
+		hostname, err := getHostname()
+		if err != nil {
+			return fmt.Errorf("unable to resolve hostname for the host tag: %w", err)
+		}
+		c.hostname = hostname
+	}
+
 	return nil
 }
 
+// Reads an ingest token from the specified file, ignoring any trailing whitespace
+// such as the newline frequently appended by secret managers
+func readIngestToken(file string) (string, error) {
+	b, err := ioutil.ReadFile(file)
+	if err != nil {
+		return "", fmt.Errorf("unable to read ingest_token_file %s: %w", file, err)
+	}
+
+	token := strings.TrimRightFunc(string(b), unicode.IsSpace)
+	if token == "" {
+		return "", fmt.Errorf("the ingest_token_file %s is empty", file)
+	}
+	return token, nil
+}
+
+// Get the compression algorithm to use, taking the deprecated DisableCompression
+// setting into account. Defaults to gzip
+func (c *Config) getCompression() string {
+	if c.DisableCompression || !c.manageContentEncoding() {
+		return compressionNone
+	}
+
+	if c.Compression == "" {
+		return compressionGzip
+	}
+	return c.Compression
+}
+
+// Whether the service tag is disabled for the signal, where the settings of logs
+// and traces take precedence over the top-level setting
+func (c *Config) serviceTagDisabled(dataType config.DataType) bool {
+	var override *bool
+	switch dataType {
+	case config.LogsDataType:
+		override = c.Logs.DisableServiceTag
+	case config.TracesDataType:
+		override = c.Traces.DisableServiceTag
+	}
+
+	if override != nil {
+		return *override
+	}
+	return c.DisableServiceTag
+}
+
+// Whether the exporter compresses payloads and sets the Content-Encoding header
+func (c *Config) manageContentEncoding() bool {
+	return c.ManageContentEncoding == nil || *c.ManageContentEncoding
+}
+
+// Get the status codes of failed requests which should be retried. Defaults to
+// throttling and server errors that are usually temporary
+func (c *Config) getRetryOnStatusCodes() []int {
+	if len(c.RetryOnStatusCodes) == 0 {
+		return defaultRetryOnStatusCodes
+	}
+	return c.RetryOnStatusCodes
+}
+
+// Whether requests interrupted by their connection to Humio are retried
+func (c *Config) retryOnConnectionErrors() bool {
+	return c.RetryOnConnectionErrors == nil || *c.RetryOnConnectionErrors
+}
+
+// Get the content type of request bodies, which depends on the ingest encoding
+func (c *Config) getContentType() string {
+	if c.IngestEncoding == ingestEncodingNDJSON {
+		return "application/x-ndjson"
+	}
+	return "application/json"
+}
+
+// Get the gzip compression level to use. Defaults to the default level of gzip
+func (c *Config) getCompressionLevel() (int, error) {
+	switch c.CompressionLevel {
+	case "", compressionLevelDefault:
+		return gzip.DefaultCompression, nil
+	case compressionLevelBestSpeed:
+		return gzip.BestSpeed, nil
+	case compressionLevelBestCompression:
+		return gzip.BestCompression, nil
+	}
+
+	level, err := strconv.Atoi(c.CompressionLevel)
+	if err != nil || level < gzip.BestSpeed || level > gzip.BestCompression {
+		return 0, fmt.Errorf("unsupported compression_level %s, must be between 1 and 9, or one of best_speed, best_compression, or default", c.CompressionLevel)
+	}
+	return level, nil
+}
+
+// Get the options of the zstd encoder, leaving the defaults of the library in
+// place unless configured otherwise
+func (c *Config) getZstdOptions() []zstd.EOption {
+	var opts []zstd.EOption
+	if c.CompressionWindowSize != 0 {
+		opts = append(opts, zstd.WithWindowSize(c.CompressionWindowSize))
+	}
+	return opts
+}
+
+// Get the string to replace disallowed characters in field names with. Defaults to an underscore
+func (c *Config) getFieldKeyReplacement() string {
+	if c.FieldKeyReplacement == "" {
+		return defaultFieldKeyReplacement
+	}
+	return c.FieldKeyReplacement
+}
+
+// Get the name of the field holding the instrumentation scope name. Defaults to scope.name
+func (c *Config) getScopeNameKey() string {
+	if c.ScopeNameKey == "" {
+		return defaultScopeNameKey
+	}
+	return c.ScopeNameKey
+}
+
+// Get the name of the field holding the instrumentation scope version. Defaults to scope.version
+func (c *Config) getScopeVersionKey() string {
+	if c.ScopeVersionKey == "" {
+		return defaultScopeVersionKey
+	}
+	return c.ScopeVersionKey
+}
+
+// Get the strategy for merging attributes sharing the same key. Defaults to record_wins
+func (c *Config) getDuplicateKeyStrategy() string {
+	if c.DuplicateKeyStrategy == "" {
+		return duplicateKeyRecordWins
+	}
+	return c.DuplicateKeyStrategy
+}
+
+// Get the path of the structured ingest API, which includes the repository if configured
+func (c *Config) getStructuredPath() string {
+	if c.Repository == "" {
+		return structuredPath
+	}
+	return repositoriesPath + url.PathEscape(c.Repository) + "/ingest/humio-structured"
+}
+
+// Get the path of the unstructured ingest API, which includes the repository if configured
+func (c *Config) getUnstructuredPath() string {
+	if c.Repository == "" {
+		return unstructuredPath
+	}
+	return repositoriesPath + url.PathEscape(c.Repository) + "/ingest/humio-unstructured"
+}
+
+// Get the URLs for the structured and unstructured ingest APIs on a signal
+// specific endpoint, or on the top-level endpoint if no override is specified
+func (c *Config) getSignalEndpoints(endpoint string) (*url.URL, *url.URL, error) {
+	if endpoint == "" {
+		return c.structuredEndpoint, c.unstructuredEndpoint, nil
+	}
+
+	structured, errS := joinEndpoint(endpoint, c.getStructuredPath())
+	unstructured, errU := joinEndpoint(endpoint, c.getUnstructuredPath())
+	if errS != nil || errU != nil {
+		return nil, nil, fmt.Errorf("badly formatted endpoint %s", endpoint)
+	}
+	return structured, unstructured, nil
+}
+
+// Get the URLs for the structured and unstructured ingest APIs used by the
+// specified signal. Requires that the configuration has been sanitized
+func (c *Config) getEndpoints(dataType config.DataType) (*url.URL, *url.URL) {
+	switch dataType {
+	case config.LogsDataType:
+		return c.Logs.structuredEndpoint, c.Logs.unstructuredEndpoint
+	case config.TracesDataType:
+		return c.Traces.structuredEndpoint, c.Traces.unstructuredEndpoint
+	case config.MetricsDataType:
+		return c.Metrics.structuredEndpoint, c.Metrics.unstructuredEndpoint
+	default:
+		return c.structuredEndpoint, c.unstructuredEndpoint
+	}
+}
+
+// StructuredEndpoint returns the URL of the structured ingest API used by the
+// specified signal, or an empty string before the configuration is sanitized
+func (c *Config) StructuredEndpoint(dataType config.DataType) string {
+	structured, _ := c.getEndpoints(dataType)
+	if structured == nil {
+		return ""
+	}
+	return structured.String()
+}
+
+// UnstructuredEndpoint returns the URL of the unstructured ingest API used by the
+// specified signal, or an empty string before the configuration is sanitized
+func (c *Config) UnstructuredEndpoint(dataType config.DataType) string {
+	_, unstructured := c.getEndpoints(dataType)
+	if unstructured == nil {
+		return ""
+	}
+	return unstructured.String()
+}
+
 // Get a URL for a specific destination path on the Humio endpoint
 func (c *Config) getEndpoint(dest string) (*url.URL, error) {
-	res, err := url.Parse(c.Endpoint)
+	return joinEndpoint(c.Endpoint, dest)
+}
+
+// Get a URL for a specific destination path on the specified endpoint. The path
+// is joined with any base path of the endpoint regardless of trailing slashes,
+// while its query parameters are kept. An endpoint which already includes the
+// ingest path, such as https://host/api/v1/ingest/, does not repeat it
+func joinEndpoint(endpoint string, dest string) (*url.URL, error) {
+	res, err := url.Parse(endpoint)
 	if err != nil {
 		return res, err
 	}
 
-	res.Path = path.Join(res.Path, dest)
+	// Joining the escaped path keeps escaped slashes within the base path intact
+	joined, err := url.Parse(path.Join("/", trimIngestPath(res.EscapedPath()), dest))
+	if err != nil {
+		return nil, err
+	}
+	res.Path = joined.Path
+	res.RawPath = joined.RawPath
 	return res, nil
 }
+
+// Remove the ingest path from the end of the path of an endpoint, if present
+func trimIngestPath(p string) string {
+	p = strings.TrimRight(p, "/")
+	for _, suffix := range []string{structuredPath, unstructuredPath, strings.TrimSuffix(basePath, "/")} {
+		if p == suffix || strings.HasSuffix(p, "/"+suffix) {
+			return strings.TrimSuffix(p, suffix)
+		}
+	}
+	return p
+}
@@ -0,0 +1,71 @@
+// Copyright The OpenTelemetry Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package humioexporter
+
+import (
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Periodically closes the idle connections of a transport, such that
+// connections are reopened before a load balancer in front of Humio closes them.
+// Connections in use are left open, and closed on a later interval once idle
+type connRecycler struct {
+	transport *http.Transport
+	interval  time.Duration
+
+	done     chan struct{}
+	stopOnce sync.Once
+	wg       sync.WaitGroup
+}
+
+// Creates a recycler for the connections of the transport, which does not
+// close any connections until it is started
+func newConnRecycler(transport *http.Transport, interval time.Duration) *connRecycler {
+	return &connRecycler{
+		transport: transport,
+		interval:  interval,
+		done:      make(chan struct{}),
+	}
+}
+
+// Start closing the idle connections in the background on every interval
+func (r *connRecycler) start() {
+	r.wg.Add(1)
+	go func() {
+		defer r.wg.Done()
+
+		ticker := time.NewTicker(r.interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				r.transport.CloseIdleConnections()
+			case <-r.done:
+				return
+			}
+		}
+	}()
+}
+
+// Stop closing idle connections, waiting for the background goroutine to exit
+func (r *connRecycler) stop() {
+	r.stopOnce.Do(func() {
+		close(r.done)
+	})
+	r.wg.Wait()
+}
@@ -0,0 +1,44 @@
+// Copyright The OpenTelemetry Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package humioexporter
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConnRecyclerStop(t *testing.T) {
+	// Arrange
+	recycler := newConnRecycler(&http.Transport{}, time.Millisecond)
+	recycler.start()
+
+	// Act
+	stopped := make(chan struct{})
+	go func() {
+		recycler.stop()
+		recycler.stop()
+		close(stopped)
+	}()
+
+	// Assert
+	select {
+	case <-stopped:
+	case <-time.After(time.Second):
+		assert.Fail(t, "the recycler did not stop")
+	}
+}
@@ -0,0 +1,80 @@
+// Copyright The OpenTelemetry Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package humioexporter
+
+import (
+	"os"
+	"sync"
+)
+
+// Appends the bodies of requests that permanently failed to a local file, one
+// request per line, such that they can be replayed later. When the file would
+// exceed its maximum size, it is rotated by renaming it with a .1 suffix,
+// replacing any previously rotated file
+type deadLetterWriter struct {
+	path    string
+	maxSize int64
+
+	// Guards the file from concurrent writes and rotations
+	mu sync.Mutex
+}
+
+func newDeadLetterWriter(path string, maxSize int64) *deadLetterWriter {
+	return &deadLetterWriter{
+		path:    path,
+		maxSize: maxSize,
+	}
+}
+
+// Append a single request body to the file. The file is only opened while
+// writing, since permanent failures are expected to be rare
+func (w *deadLetterWriter) write(body []byte) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	line := append(append(make([]byte, 0, len(body)+1), body...), '\n')
+	if err := w.rotate(int64(len(line))); err != nil {
+		return err
+	}
+
+	f, err := os.OpenFile(w.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return err
+	}
+
+	if _, err = f.Write(line); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// Rotate the file if appending the specified number of bytes would exceed the
+// maximum size. An empty file is never rotated, so a single oversized request
+// is still written
+func (w *deadLetterWriter) rotate(size int64) error {
+	info, err := os.Stat(w.path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	if info.Size() == 0 || info.Size()+size <= w.maxSize {
+		return nil
+	}
+	return os.Rename(w.path, w.path+".1")
+}
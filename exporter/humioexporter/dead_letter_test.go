@@ -0,0 +1,85 @@
+// Copyright The OpenTelemetry Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package humioexporter
+
+import (
+	"io/ioutil"
+	"path"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDeadLetterWriterAppends(t *testing.T) {
+	// Arrange
+	file := path.Join(t.TempDir(), "dead-letter.jsonl")
+	w := newDeadLetterWriter(file, 1024)
+
+	// Act
+	require.NoError(t, w.write([]byte(`[{"first":true}]`)))
+	require.NoError(t, w.write([]byte(`[{"second":true}]`)))
+
+	// Assert
+	b, err := ioutil.ReadFile(file)
+	require.NoError(t, err)
+	assert.Equal(t, "[{\"first\":true}]\n[{\"second\":true}]\n", string(b))
+}
+
+func TestDeadLetterWriterRotates(t *testing.T) {
+	// Arrange
+	file := path.Join(t.TempDir(), "dead-letter.jsonl")
+	w := newDeadLetterWriter(file, 20)
+
+	// Act
+	require.NoError(t, w.write([]byte(`[{"first":1}]`)))
+	require.NoError(t, w.write([]byte(`[{"second":2}]`)))
+	require.NoError(t, w.write([]byte(`[{"third":3}]`)))
+
+	// Assert
+	current, err := ioutil.ReadFile(file)
+	require.NoError(t, err)
+	assert.Equal(t, "[{\"third\":3}]\n", string(current))
+
+	rotated, err := ioutil.ReadFile(file + ".1")
+	require.NoError(t, err)
+	assert.Equal(t, "[{\"second\":2}]\n", string(rotated))
+}
+
+func TestDeadLetterWriterOversized(t *testing.T) {
+	// Arrange
+	file := path.Join(t.TempDir(), "dead-letter.jsonl")
+	w := newDeadLetterWriter(file, 4)
+
+	// Act
+	err := w.write([]byte(`[{"large":true}]`))
+
+	// Assert
+	require.NoError(t, err)
+	b, err := ioutil.ReadFile(file)
+	require.NoError(t, err)
+	assert.Equal(t, "[{\"large\":true}]\n", string(b))
+}
+
+func TestDeadLetterWriterError(t *testing.T) {
+	// Arrange
+	w := newDeadLetterWriter(path.Join(t.TempDir(), "missing", "dead-letter.jsonl"), 1024)
+
+	// Act
+	err := w.write([]byte(`[]`))
+
+	// Assert
+	require.Error(t, err)
+}
@@ -0,0 +1,141 @@
+// Copyright The OpenTelemetry Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package humioexporter
+
+import (
+	"encoding/json"
+	"sort"
+)
+
+// Supported ways of handling events beyond the max_event_size
+const (
+	oversizedEventDrop     = "drop"
+	oversizedEventTruncate = "truncate"
+)
+
+// The events left after limiting their size, along with the number of events
+// that were dropped or truncated to stay within the limit
+type eventSizeResult struct {
+	groups    []*HumioStructuredEvents
+	positions []int
+	dropped   int
+	truncated int
+}
+
+// Ensures that no single event exceeds maxSize bytes once serialized, since
+// Humio rejects the entire request otherwise. The positions refer to the events
+// across all groups, and are filtered along with the events. Groups left
+// without events are removed
+func limitEventSizes(groups []*HumioStructuredEvents, positions []int, maxSize int, strategy string) *eventSizeResult {
+	result := &eventSizeResult{positions: make([]int, 0, len(positions))}
+	pos := 0
+	for _, group := range groups {
+		kept := make([]*HumioStructuredEvent, 0, len(group.Events))
+		for _, evt := range group.Events {
+			fits, truncated := limitEventSize(evt, maxSize, strategy == oversizedEventTruncate)
+			if truncated {
+				result.truncated++
+			}
+			if fits {
+				kept = append(kept, evt)
+				result.positions = append(result.positions, positions[pos])
+			} else {
+				result.dropped++
+			}
+			pos++
+		}
+
+		if len(kept) > 0 {
+			group.Events = kept
+			result.groups = append(result.groups, group)
+		}
+	}
+	return result
+}
+
+// Reports whether the event fits within maxSize bytes, and whether it was
+// truncated to do so. Truncation repeatedly shortens the largest string
+// attribute or the rawstring, until the event fits or the string attributes cannot be
+// shortened any further. Events which cannot be serialized are left for the client to report
+func limitEventSize(evt *HumioStructuredEvent, maxSize int, truncate bool) (bool, bool) {
+	truncated := false
+	for {
+		b, err := json.Marshal(evt)
+		if err != nil || len(b) <= maxSize {
+			return true, truncated
+		}
+
+		if !truncate {
+			return false, truncated
+		}
+
+		// The rawstring is shortened like any string attribute
+		attrs, _ := evt.Attributes.(map[string]interface{})
+		values, key := largestStringAttribute(attrs)
+		value := evt.RawString
+		if values != nil && len(values[key].(string)) >= len(value) {
+			value = values[key].(string)
+		} else {
+			values = nil
+		}
+
+		// Escaping may make the serialized value longer than the string itself,
+		// which is caught on the next iteration
+		if len(value) <= len(truncationMarker) {
+			return false, truncated
+		}
+		length := len(value) - (len(b) - maxSize + len(truncationMarker))
+		if length < 0 {
+			length = 0
+		}
+		if values != nil {
+			values[key] = truncateString(value, length) + truncationMarker
+		} else {
+			evt.RawString = truncateString(value, length) + truncationMarker
+		}
+		truncated = true
+	}
+}
+
+// Finds the longest string value among the attributes, including those of
+// nested attributes. Returns the map holding the value along with its key, or
+// nil when there are no string values. Keys are visited in sorted order, such
+// that ties are always broken the same way
+func largestStringAttribute(attrs map[string]interface{}) (map[string]interface{}, string) {
+	keys := make([]string, 0, len(attrs))
+	for k := range attrs {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var largest map[string]interface{}
+	var largestKey string
+	length := -1
+	for _, k := range keys {
+		switch v := attrs[k].(type) {
+		case string:
+			if len(v) > length {
+				largest, largestKey, length = attrs, k, len(v)
+			}
+		case map[string]interface{}:
+			if nested, nestedKey := largestStringAttribute(v); nested != nil {
+				if l := len(nested[nestedKey].(string)); l > length {
+					largest, largestKey, length = nested, nestedKey, l
+				}
+			}
+		}
+	}
+	return largest, largestKey
+}
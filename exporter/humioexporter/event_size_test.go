@@ -0,0 +1,148 @@
+// Copyright The OpenTelemetry Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package humioexporter
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func makeSizedEvent(attrs map[string]interface{}) *HumioStructuredEvent {
+	return &HumioStructuredEvent{
+		Timestamp:  time.Date(2021, 3, 28, 12, 30, 15, 0, time.UTC),
+		AsUnix:     true,
+		Attributes: attrs,
+	}
+}
+
+func TestLimitEventSize(t *testing.T) {
+	// Arrange
+	testCases := []struct {
+		desc          string
+		attrs         map[string]interface{}
+		rawString     string
+		truncate      bool
+		wantFits      bool
+		wantTruncated bool
+		expected      map[string]interface{}
+	}{
+		{
+			desc:     "Within limit",
+			attrs:    map[string]interface{}{"message": "short"},
+			wantFits: true,
+			expected: map[string]interface{}{"message": "short"},
+		},
+		{
+			desc:     "Dropped",
+			attrs:    map[string]interface{}{"message": strings.Repeat("x", 200)},
+			expected: map[string]interface{}{"message": strings.Repeat("x", 200)},
+		},
+		{
+			desc:          "Truncates the largest string",
+			attrs:         map[string]interface{}{"message": strings.Repeat("x", 200), "other": strings.Repeat("y", 20)},
+			truncate:      true,
+			wantFits:      true,
+			wantTruncated: true,
+			expected:      map[string]interface{}{"message": strings.Repeat("x", 44) + truncationMarker, "other": strings.Repeat("y", 20)},
+		},
+		{
+			desc:          "Truncates nested strings",
+			attrs:         map[string]interface{}{"attributes": map[string]interface{}{"message": strings.Repeat("x", 200)}, "count": 5},
+			truncate:      true,
+			wantFits:      true,
+			wantTruncated: true,
+			expected:      map[string]interface{}{"attributes": map[string]interface{}{"message": strings.Repeat("x", 50) + truncationMarker}, "count": 5},
+		},
+		{
+			desc:          "Truncates several strings",
+			attrs:         map[string]interface{}{"a": strings.Repeat("x", 100), "b": strings.Repeat("y", 90)},
+			truncate:      true,
+			wantFits:      true,
+			wantTruncated: true,
+			expected:      map[string]interface{}{"a": truncationMarker, "b": strings.Repeat("y", 71) + truncationMarker},
+		},
+		{
+			desc:          "Truncates the rawstring",
+			attrs:         map[string]interface{}{"message": strings.Repeat("x", 20)},
+			rawString:     strings.Repeat("r", 200),
+			truncate:      true,
+			wantFits:      true,
+			wantTruncated: true,
+			expected:      map[string]interface{}{"message": strings.Repeat("x", 20)},
+		},
+		{
+			desc:     "Dropped without string attributes",
+			attrs:    map[string]interface{}{"values": []interface{}{strings.Repeat("x", 200)}},
+			truncate: true,
+			expected: map[string]interface{}{"values": []interface{}{strings.Repeat("x", 200)}},
+		},
+	}
+
+	// Act / Assert
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			evt := makeSizedEvent(tC.attrs)
+			evt.RawString = tC.rawString
+
+			fits, truncated := limitEventSize(evt, 150, tC.truncate)
+
+			assert.Equal(t, tC.wantFits, fits)
+			assert.Equal(t, tC.wantTruncated, truncated)
+			assert.Equal(t, tC.expected, evt.Attributes)
+			if fits {
+				b, err := json.Marshal(evt)
+				require.NoError(t, err)
+				assert.LessOrEqual(t, len(b), 150)
+			}
+		})
+	}
+}
+
+func TestLimitEventSizes(t *testing.T) {
+	// Arrange
+	large := strings.Repeat("x", 200)
+	groups := []*HumioStructuredEvents{
+		{
+			Tags:   map[string]string{"group": "0"},
+			Events: []*HumioStructuredEvent{makeSizedEvent(map[string]interface{}{"message": large})},
+		},
+		{
+			Tags: map[string]string{"group": "1"},
+			Events: []*HumioStructuredEvent{
+				makeSizedEvent(map[string]interface{}{"message": "a"}),
+				makeSizedEvent(map[string]interface{}{"message": large}),
+				makeSizedEvent(map[string]interface{}{"message": "b"}),
+			},
+		},
+	}
+
+	// Act
+	result := limitEventSizes(groups, []int{3, 0, 2, 1}, 150, oversizedEventDrop)
+
+	// Assert
+	assert.Equal(t, 2, result.dropped)
+	assert.Equal(t, 0, result.truncated)
+	assert.Equal(t, []int{0, 1}, result.positions)
+	require.Len(t, result.groups, 1)
+	assert.Equal(t, map[string]string{"group": "1"}, result.groups[0].Tags)
+	require.Len(t, result.groups[0].Events, 2)
+	assert.Equal(t, map[string]interface{}{"message": "a"}, result.groups[0].Events[0].Attributes)
+	assert.Equal(t, map[string]interface{}{"message": "b"}, result.groups[0].Events[1].Attributes)
+}
@@ -17,6 +17,9 @@ package humioexporter
 import (
 	"context"
 	"errors"
+	"fmt"
+	"net/http"
+	"time"
 
 	"go.opentelemetry.io/collector/component"
 	"go.opentelemetry.io/collector/config"
@@ -27,14 +30,48 @@ import (
 const (
 	// The key used to refer to this exporter
 	typeStr = "humio"
+
+	// The default maximum number of nesting levels to flatten in log attributes
+	defaultMaxFlattenDepth = 10
+
+	// The default size of the dead letter file at which it is rotated
+	defaultDeadLetterMaxSize = 100 * 1024 * 1024
+
+	// The default connection pool settings, which match those of the default transport of Go
+	defaultMaxIdleConns    = 100
+	defaultIdleConnTimeout = 90 * time.Second
+
+	// The default time for which requests fail immediately once the circuit breaker has opened
+	defaultCircuitBreakerCooldown = 30 * time.Second
+
+	// The default time given to in-flight requests to complete during shutdown
+	defaultShutdownFlushTimeout = 10 * time.Second
+
+	// The default window over which distinct tag combinations are counted
+	defaultTagCardinalityWindow = time.Hour
 )
 
 // NewFactory creates an exporter factory for Humio
-func NewFactory() component.ExporterFactory {
+func NewFactory(opts ...FactoryOption) component.ExporterFactory {
+	var o factoryOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	// The options are carried by the config, which every exporter is created from
+	defaultConfig := func() config.Exporter {
+		cfg := createDefaultConfig().(*Config)
+		cfg.transform = o.transform
+		cfg.signer = o.signer
+		return cfg
+	}
+
 	return exporterhelper.NewFactory(
 		typeStr,
-		createDefaultConfig,
+		defaultConfig,
 		exporterhelper.WithTraces(createTracesExporter),
+		exporterhelper.WithMetrics(createMetricsExporter),
+		exporterhelper.WithLogs(createLogsExporter),
 	)
 }
 
@@ -52,10 +89,59 @@ func createDefaultConfig() config.Exporter {
 		},
 
 		// Settings specific to the Humio exporter
-		DisableCompression: false,
-		Tags:               map[string]string{},
-		DisableServiceTag:  false,
+		DisableCompression:  false,
+		IngestEncoding:      ingestEncodingJSONArray,
+		DeadLetterMaxSize:   defaultDeadLetterMaxSize,
+		InFlightBytesPolicy: inflightBytesPolicyBlock,
+		MaxIdleConns:        defaultMaxIdleConns,
+		MaxIdleConnsPerHost: http.DefaultMaxIdleConnsPerHost,
+		IdleConnTimeout:     defaultIdleConnTimeout,
+		Tags:                map[string]string{},
+		StaticFields:        map[string]string{},
+		DisableServiceTag:   false,
+		ServiceTagKey:       serviceTagKey,
+		SanitizeFieldKeys:   false,
+		FieldKeyReplacement: defaultFieldKeyReplacement,
+		ScopeNameKey:        defaultScopeNameKey,
+		ScopeVersionKey:     defaultScopeVersionKey,
+		AddHostTag:          false,
+		HostTagKey:          hostTagKey,
+
+		// The circuit breaker is disabled unless a threshold is configured
+		CircuitBreakerThreshold: 0,
+		CircuitBreakerCooldown:  defaultCircuitBreakerCooldown,
+
+		// In-flight requests are given a chance to complete when shutting down
+		ShutdownFlushTimeout: defaultShutdownFlushTimeout,
+
+		// Tag combinations are not limited unless a maximum is configured
+		MaxTagCardinality:    0,
+		TagCardinalityWindow: defaultTagCardinalityWindow,
+
+		Logs: LogsConfig{
+			IngestFormat:      ingestFormatStructured,
+			FlattenAttributes: false,
+			MaxFlattenDepth:   defaultMaxFlattenDepth,
+			BodyField:         defaultBodyField,
+			RawStringBody:     false,
+			SeverityField:     defaultSeverityField,
+			EventNameField:    defaultEventNameField,
+			TraceIDField:      defaultLogTraceIDField,
+			SpanIDField:       defaultLogSpanIDField,
+			TimestampFallback: timestampFallbackNow,
+
+			BodyNewlines:           bodyNewlinesKeep,
+			BodyNewlineReplacement: " ",
+		},
 		Traces: TracesConfig{
+			UnixTimestamps:     false,
+			DurationField:      defaultDurationField,
+			StatusCodeField:    defaultStatusCodeField,
+			StatusMessageField: defaultStatusMessageField,
+			SeparateSpanEvents: false,
+			IncludeLinks:       false,
+		},
+		Metrics: MetricsConfig{
 			UnixTimestamps: false,
 		},
 	}
@@ -65,30 +151,175 @@ func createDefaultConfig() config.Exporter {
 func createTracesExporter(
 	ctx context.Context,
 	params component.ExporterCreateParams,
-	config config.Exporter,
+	exporterConfig config.Exporter,
 ) (component.TracesExporter, error) {
-	if config == nil {
+	if exporterConfig == nil {
 		return nil, errors.New("missing config")
 	}
-	cfg := config.(*Config)
+	cfg := exporterConfig.(*Config)
 
 	if err := cfg.sanitize(); err != nil {
 		return nil, err
 	}
 
-	client, err := newHumioClient(cfg, params.Logger)
+	if err := registerMetricViews(); err != nil {
+		return nil, err
+	}
+
+	if err := requireSignalEndpoint(cfg, config.TracesDataType); err != nil {
+		return nil, err
+	}
+
+	client, err := newHumioClient(cfg, config.TracesDataType, params.Logger)
 	if err != nil {
 		return nil, err
 	}
 
 	exporter := newTracesExporter(cfg, params.Logger, client)
 
-	return exporterhelper.NewTracesExporter(
+	exp, err := exporterhelper.NewTracesExporter(
 		cfg,
 		params.Logger,
 		exporter.pushTraceData,
 		exporterhelper.WithQueue(cfg.QueueSettings),
 		exporterhelper.WithRetry(cfg.RetrySettings),
+		exporterhelper.WithStart(exporter.start),
 		exporterhelper.WithShutdown(exporter.shutdown),
 	)
+	if err != nil {
+		// The exporter is never started or shut down, so its client is released here
+		client.shutdown(ctx)
+		return nil, err
+	}
+
+	return &queuedTracesExporter{
+		TracesExporter: &drainingTracesExporter{
+			TracesExporter: exp,
+			inflight:       exporter.inflight,
+			client:         exporter.client,
+			timeout:        cfg.ShutdownFlushTimeout,
+		},
+		queue: exporter.queue,
+	}, nil
+}
+
+// Creates a new metrics exporter for Humio
+func createMetricsExporter(
+	ctx context.Context,
+	params component.ExporterCreateParams,
+	exporterConfig config.Exporter,
+) (component.MetricsExporter, error) {
+	if exporterConfig == nil {
+		return nil, errors.New("missing config")
+	}
+	cfg := exporterConfig.(*Config)
+
+	if err := cfg.sanitize(); err != nil {
+		return nil, err
+	}
+
+	if err := registerMetricViews(); err != nil {
+		return nil, err
+	}
+
+	if err := requireSignalEndpoint(cfg, config.MetricsDataType); err != nil {
+		return nil, err
+	}
+
+	client, err := newHumioClient(cfg, config.MetricsDataType, params.Logger)
+	if err != nil {
+		return nil, err
+	}
+
+	exporter := newMetricsExporter(cfg, params.Logger, client)
+
+	exp, err := exporterhelper.NewMetricsExporter(
+		cfg,
+		params.Logger,
+		exporter.pushMetricsData,
+		exporterhelper.WithQueue(cfg.QueueSettings),
+		exporterhelper.WithRetry(cfg.RetrySettings),
+		exporterhelper.WithStart(exporter.start),
+		exporterhelper.WithShutdown(exporter.shutdown),
+	)
+	if err != nil {
+		// The exporter is never started or shut down, so its client is released here
+		client.shutdown(ctx)
+		return nil, err
+	}
+
+	return &queuedMetricsExporter{
+		MetricsExporter: &drainingMetricsExporter{
+			MetricsExporter: exp,
+			inflight:        exporter.inflight,
+			client:          exporter.client,
+			timeout:         cfg.ShutdownFlushTimeout,
+		},
+		queue: exporter.queue,
+	}, nil
+}
+
+// Creates a new logs exporter for Humio
+func createLogsExporter(
+	ctx context.Context,
+	params component.ExporterCreateParams,
+	exporterConfig config.Exporter,
+) (component.LogsExporter, error) {
+	if exporterConfig == nil {
+		return nil, errors.New("missing config")
+	}
+	cfg := exporterConfig.(*Config)
+
+	if err := cfg.sanitize(); err != nil {
+		return nil, err
+	}
+
+	if err := registerMetricViews(); err != nil {
+		return nil, err
+	}
+
+	if err := requireSignalEndpoint(cfg, config.LogsDataType); err != nil {
+		return nil, err
+	}
+
+	client, err := newHumioClient(cfg, config.LogsDataType, params.Logger)
+	if err != nil {
+		return nil, err
+	}
+
+	exporter := newLogsExporter(cfg, params.Logger, client)
+
+	exp, err := exporterhelper.NewLogsExporter(
+		cfg,
+		params.Logger,
+		exporter.pushLogsData,
+		exporterhelper.WithQueue(cfg.QueueSettings),
+		exporterhelper.WithRetry(cfg.RetrySettings),
+		exporterhelper.WithStart(exporter.start),
+		exporterhelper.WithShutdown(exporter.shutdown),
+	)
+	if err != nil {
+		// The exporter is never started or shut down, so its client is released here
+		client.shutdown(ctx)
+		return nil, err
+	}
+
+	return &queuedLogsExporter{
+		LogsExporter: &drainingLogsExporter{
+			LogsExporter: exp,
+			inflight:     exporter.inflight,
+			client:       exporter.client,
+			timeout:      cfg.ShutdownFlushTimeout,
+		},
+		queue: exporter.queue,
+	}, nil
+}
+
+// Ensures that an endpoint resolves for the signal, since the top-level
+// endpoint may be omitted when the signals in use override it
+func requireSignalEndpoint(cfg *Config, dataType config.DataType) error {
+	if structured, _ := cfg.getEndpoints(dataType); structured == nil || structured.Host == "" {
+		return fmt.Errorf("requires an endpoint for exporting %s, either the top-level endpoint or %s.endpoint", dataType, dataType)
+	}
+	return nil
 }
@@ -16,7 +16,18 @@ package humioexporter
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -25,6 +36,7 @@ import (
 	"go.opentelemetry.io/collector/config"
 	"go.opentelemetry.io/collector/config/confighttp"
 	"go.opentelemetry.io/collector/config/configtls"
+	"go.opentelemetry.io/collector/consumer/consumererror"
 	"go.uber.org/zap"
 )
 
@@ -57,6 +69,17 @@ func TestCreateTracesExporter(t *testing.T) {
 			},
 			wantErr: false,
 		},
+		{
+			desc: "Missing traces endpoint",
+			cfg: &Config{
+				ExporterSettings: config.NewExporterSettings(typeStr),
+				IngestToken:      "00000000-0000-0000-0000-0000000000000",
+				Logs: LogsConfig{
+					Endpoint: "http://logs:8080",
+				},
+			},
+			wantErr: true,
+		},
 		{
 			desc: "Unsanitizable trace configuration",
 			cfg: &Config{
@@ -112,25 +135,588 @@ func TestCreateTracesExporter(t *testing.T) {
 }
 
 func TestCreateMetricsExporter(t *testing.T) {
+	// Arrange
+	factory := newHumioFactory(t)
+	testCases := []struct {
+		desc    string
+		cfg     config.Exporter
+		wantErr bool
+	}{
+		{
+			desc: "Valid metrics configuration",
+			cfg: &Config{
+				ExporterSettings: config.NewExporterSettings(typeStr),
+				IngestToken:      "00000000-0000-0000-0000-0000000000000",
+				HTTPClientSettings: confighttp.HTTPClientSettings{
+					Endpoint: "http://localhost:8080",
+				},
+			},
+			wantErr: false,
+		},
+		{
+			desc: "Metrics endpoint without top-level endpoint",
+			cfg: &Config{
+				ExporterSettings: config.NewExporterSettings(typeStr),
+				IngestToken:      "00000000-0000-0000-0000-0000000000000",
+				Metrics: MetricsConfig{
+					Endpoint: "http://metrics:8080",
+				},
+			},
+			wantErr: false,
+		},
+		{
+			desc: "Missing metrics endpoint",
+			cfg: &Config{
+				ExporterSettings: config.NewExporterSettings(typeStr),
+				IngestToken:      "00000000-0000-0000-0000-0000000000000",
+				Logs: LogsConfig{
+					Endpoint: "http://logs:8080",
+				},
+				Traces: TracesConfig{
+					Endpoint: "http://traces:8080",
+				},
+			},
+			wantErr: true,
+		},
+		{
+			desc: "Unsanitizable metrics configuration",
+			cfg: &Config{
+				ExporterSettings: config.NewExporterSettings(typeStr),
+				HTTPClientSettings: confighttp.HTTPClientSettings{
+					Endpoint: "\n",
+				},
+			},
+			wantErr: true,
+		},
+		{
+			desc:    "Missing configuration",
+			cfg:     nil,
+			wantErr: true,
+		},
+	}
+
+	// Act / Assert
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			exp, err := factory.CreateMetricsExporter(
+				context.Background(),
+				component.ExporterCreateParams{Logger: zap.NewNop()},
+				tC.cfg,
+			)
+
+			if (err != nil) != tC.wantErr {
+				t.Errorf("CreateMetricsExporter() error = %v, wantErr %v", err, tC.wantErr)
+			}
+
+			if (err == nil) && (exp == nil) {
+				t.Error("No metrics exporter created despite no errors")
+			}
+		})
+	}
+}
+
+func TestCreateExportersWithSignalEndpoints(t *testing.T) {
+	// Arrange
+	factory := newHumioFactory(t)
+	cfg := &Config{
+		ExporterSettings: config.NewExporterSettings(typeStr),
+		IngestToken:      "00000000-0000-0000-0000-0000000000000",
+		ServiceTagKey:    "service",
+		Logs: LogsConfig{
+			Endpoint: "https://logs:8080",
+		},
+		Traces: TracesConfig{
+			Endpoint: "https://traces:8080",
+		},
+	}
+	params := component.ExporterCreateParams{Logger: zap.NewNop()}
+
+	// Act
+	validateErr := cfg.Validate()
+	_, logsErr := factory.CreateLogsExporter(context.Background(), params, cfg)
+	_, tracesErr := factory.CreateTracesExporter(context.Background(), params, cfg)
+	_, metricsErr := factory.CreateMetricsExporter(context.Background(), params, cfg)
+
+	// Assert
+	require.NoError(t, validateErr)
+	assert.NoError(t, logsErr)
+	assert.NoError(t, tracesErr)
+	require.Error(t, metricsErr)
+	assert.Contains(t, metricsErr.Error(), "metrics")
+}
+
+func TestCreateLogsExporter(t *testing.T) {
+	// Arrange
 	factory := newHumioFactory(t)
-	mExp, err := factory.CreateMetricsExporter(
+	testCases := []struct {
+		desc    string
+		cfg     config.Exporter
+		wantErr bool
+	}{
+		{
+			desc: "Valid logs configuration",
+			cfg: &Config{
+				ExporterSettings: config.NewExporterSettings(typeStr),
+				IngestToken:      "00000000-0000-0000-0000-0000000000000",
+				HTTPClientSettings: confighttp.HTTPClientSettings{
+					Endpoint: "http://localhost:8080",
+				},
+			},
+			wantErr: false,
+		},
+		{
+			desc: "Missing logs endpoint",
+			cfg: &Config{
+				ExporterSettings: config.NewExporterSettings(typeStr),
+				IngestToken:      "00000000-0000-0000-0000-0000000000000",
+				Traces: TracesConfig{
+					Endpoint: "http://traces:8080",
+				},
+			},
+			wantErr: true,
+		},
+		{
+			desc: "Unsanitizable logs configuration",
+			cfg: &Config{
+				ExporterSettings: config.NewExporterSettings(typeStr),
+				HTTPClientSettings: confighttp.HTTPClientSettings{
+					Endpoint: "\n",
+				},
+			},
+			wantErr: true,
+		},
+		{
+			desc:    "Missing configuration",
+			cfg:     nil,
+			wantErr: true,
+		},
+	}
+
+	// Act / Assert
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			exp, err := factory.CreateLogsExporter(
+				context.Background(),
+				component.ExporterCreateParams{Logger: zap.NewNop()},
+				tC.cfg,
+			)
+
+			if (err != nil) != tC.wantErr {
+				t.Errorf("CreateLogsExporter() error = %v, wantErr %v", err, tC.wantErr)
+			}
+
+			if (err == nil) && (exp == nil) {
+				t.Error("No logs exporter created despite no errors")
+			}
+		})
+	}
+}
+
+func TestFactoryEventTransform(t *testing.T) {
+	// Arrange
+	var body []byte
+	s := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		var err error
+		body, err = ioutil.ReadAll(r.Body)
+		require.NoError(t, err)
+	}))
+	defer s.Close()
+
+	factory := NewFactory(WithEventTransform(func(evt *HumioStructuredEvent) {
+		attrs := evt.Attributes.(map[string]interface{})
+		attrs["span_name"] = attrs["name"]
+		delete(attrs, "name")
+		attrs["datacenter"] = "eu-west-1a"
+	}))
+
+	cfg := factory.CreateDefaultConfig().(*Config)
+	cfg.Endpoint = s.URL
+	cfg.IngestToken = "token"
+	cfg.DisableCompression = true
+	cfg.QueueSettings.Enabled = false
+
+	exp, err := factory.CreateTracesExporter(
 		context.Background(),
 		component.ExporterCreateParams{Logger: zap.NewNop()},
-		factory.CreateDefaultConfig(),
+		cfg,
 	)
+	require.NoError(t, err)
+	require.NoError(t, exp.Start(context.Background(), componenttest.NewNopHost()))
+	defer exp.Shutdown(context.Background())
 
+	// Act
+	err = exp.ConsumeTraces(context.Background(), makeTraces(time.Now()))
+
+	// Assert
+	require.NoError(t, err)
+	assert.Contains(t, string(body), `"datacenter":"eu-west-1a"`)
+	assert.Contains(t, string(body), `"span_name":`)
+	assert.NotContains(t, string(body), `"name":`)
+}
+
+func TestFactoryRequestSigner(t *testing.T) {
+	// Arrange
+	var body []byte
+	var signature string
+	s := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		body, _ = ioutil.ReadAll(r.Body)
+		signature = r.Header.Get("x-signature")
+	}))
+	defer s.Close()
+
+	factory := NewFactory(WithRequestSigner(func(body []byte) map[string]string {
+		return map[string]string{"x-signature": strconv.Itoa(len(body))}
+	}))
+
+	cfg := factory.CreateDefaultConfig().(*Config)
+	cfg.Endpoint = s.URL
+	cfg.IngestToken = "token"
+	cfg.QueueSettings.Enabled = false
+
+	exp, err := factory.CreateTracesExporter(
+		context.Background(),
+		component.ExporterCreateParams{Logger: zap.NewNop()},
+		cfg,
+	)
+	require.NoError(t, err)
+	require.NoError(t, exp.Start(context.Background(), componenttest.NewNopHost()))
+	defer exp.Shutdown(context.Background())
+
+	// Act
+	err = exp.ConsumeTraces(context.Background(), makeTraces(time.Now()))
+
+	// Assert
+	require.NoError(t, err)
+	require.NotEmpty(t, body)
+	assert.Equal(t, strconv.Itoa(len(body)), signature)
+}
+
+func TestFactoryAccumulationWindow(t *testing.T) {
+	// Arrange
+	var mu sync.Mutex
+	requests, events := 0, 0
+	s := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		var payload []*HumioStructuredEvents
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&payload))
+
+		mu.Lock()
+		defer mu.Unlock()
+		requests++
+		for _, group := range payload {
+			events += len(group.Events)
+		}
+	}))
+	defer s.Close()
+
+	factory := NewFactory()
+	cfg := factory.CreateDefaultConfig().(*Config)
+	cfg.Endpoint = s.URL
+	cfg.IngestToken = "token"
+	cfg.DisableCompression = true
+	cfg.AccumulationWindow = 500 * time.Millisecond
+	cfg.QueueSettings.Enabled = false
+
+	exp, err := factory.CreateTracesExporter(
+		context.Background(),
+		component.ExporterCreateParams{Logger: zap.NewNop()},
+		cfg,
+	)
+	require.NoError(t, err)
+	require.NoError(t, exp.Start(context.Background(), componenttest.NewNopHost()))
+	defer exp.Shutdown(context.Background())
+
+	// Act
+	errs := make([]error, 5)
+	var wg sync.WaitGroup
+	for i := range errs {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			errs[i] = exp.ConsumeTraces(context.Background(), makeTraces(time.Now()))
+		}(i)
+	}
+	wg.Wait()
+
+	// Assert
+	assert.Equal(t, make([]error, 5), errs)
+	mu.Lock()
+	defer mu.Unlock()
+	assert.Equal(t, 1, requests)
+	assert.Equal(t, 5*makeTraces(time.Now()).SpanCount(), events)
+}
+
+func TestExporterCheckEndpointOnStart(t *testing.T) {
+	// Arrange
+	testCases := []struct {
+		desc    string
+		check   bool
+		status  int
+		wantErr bool
+	}{
+		{
+			desc:    "Valid token",
+			check:   true,
+			status:  http.StatusOK,
+			wantErr: false,
+		},
+		{
+			desc:    "Rejected token",
+			check:   true,
+			status:  http.StatusUnauthorized,
+			wantErr: true,
+		},
+		{
+			desc:    "Check disabled",
+			check:   false,
+			status:  http.StatusUnauthorized,
+			wantErr: false,
+		},
+	}
+
+	// Act / Assert
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			var requests int32
+			s := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+				atomic.AddInt32(&requests, 1)
+				rw.WriteHeader(tC.status)
+			}))
+			defer s.Close()
+
+			cfg := createDefaultConfig().(*Config)
+			cfg.Endpoint = s.URL
+			cfg.IngestToken = "token"
+			cfg.CheckEndpointOnStart = tC.check
+
+			exp, err := createLogsExporter(
+				context.Background(),
+				component.ExporterCreateParams{Logger: zap.NewNop()},
+				cfg,
+			)
+			require.NoError(t, err)
+
+			err = exp.Start(context.Background(), componenttest.NewNopHost())
+			defer exp.Shutdown(context.Background())
+
+			if tC.wantErr {
+				require.Error(t, err)
+			} else {
+				require.NoError(t, err)
+			}
+			if tC.check {
+				assert.Equal(t, int32(1), atomic.LoadInt32(&requests))
+			} else {
+				assert.Equal(t, int32(0), atomic.LoadInt32(&requests))
+			}
+		})
+	}
+}
+
+func TestExporterStopsRetryingWhenCancelled(t *testing.T) {
+	// Arrange
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var requests int32
+	s := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		// The first attempt fails, and the caller gives up during the second
+		if atomic.AddInt32(&requests, 1) == 1 {
+			rw.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		cancel()
+		io.Copy(ioutil.Discard, r.Body)
+		<-r.Context().Done()
+	}))
+	defer s.Close()
+
+	cfg := createDefaultConfig().(*Config)
+	cfg.Endpoint = s.URL
+	cfg.IngestToken = "token"
+	cfg.QueueSettings.Enabled = false
+	cfg.RetrySettings.InitialInterval = time.Millisecond
+	cfg.RetrySettings.MaxInterval = time.Millisecond
+	cfg.RetrySettings.MaxElapsedTime = time.Minute
+
+	exp, err := createTracesExporter(
+		context.Background(),
+		component.ExporterCreateParams{Logger: zap.NewNop()},
+		cfg,
+	)
+	require.NoError(t, err)
+	require.NoError(t, exp.Start(context.Background(), componenttest.NewNopHost()))
+	defer exp.Shutdown(context.Background())
+
+	// Act
+	err = exp.ConsumeTraces(ctx, makeTraces(time.Now()))
+
+	// Assert
 	require.Error(t, err)
-	assert.Nil(t, mExp)
+	assert.True(t, errors.Is(err, context.Canceled))
+	assert.Equal(t, int32(2), atomic.LoadInt32(&requests))
 }
 
-func TestCreateLogsExporter(t *testing.T) {
-	factory := newHumioFactory(t)
-	lExp, err := factory.CreateLogsExporter(
+func TestExporterRetryBudget(t *testing.T) {
+	// Arrange
+	var requests int32
+	s := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		rw.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer s.Close()
+
+	cfg := createDefaultConfig().(*Config)
+	cfg.Endpoint = s.URL
+	cfg.IngestToken = "token"
+	cfg.QueueSettings.Enabled = false
+	cfg.RetrySettings.InitialInterval = 10 * time.Millisecond
+	cfg.RetrySettings.MaxInterval = 10 * time.Millisecond
+	cfg.RetrySettings.MaxElapsedTime = time.Minute
+	cfg.MaxTotalRetryDuration = 100 * time.Millisecond
+
+	exp, err := createTracesExporter(
 		context.Background(),
 		component.ExporterCreateParams{Logger: zap.NewNop()},
-		factory.CreateDefaultConfig(),
+		cfg,
 	)
+	require.NoError(t, err)
+	require.NoError(t, exp.Start(context.Background(), componenttest.NewNopHost()))
+	defer exp.Shutdown(context.Background())
+
+	// Act
+	start := time.Now()
+	err = exp.ConsumeTraces(context.Background(), makeTraces(time.Now()))
 
+	// Assert
 	require.Error(t, err)
-	assert.Nil(t, lExp)
+	assert.True(t, consumererror.IsPermanent(err))
+	assert.Contains(t, err.Error(), errRetryBudgetExhausted.Error())
+	assert.Less(t, int64(time.Since(start)), int64(time.Second))
+	assert.Greater(t, atomic.LoadInt32(&requests), int32(1))
+}
+
+func TestExporterRetriesOnStatusCodes(t *testing.T) {
+	// Arrange
+	testCases := []struct {
+		desc      string
+		code      int
+		wantRetry bool
+	}{
+		{
+			desc:      "Bad Request fails immediately",
+			code:      http.StatusBadRequest,
+			wantRetry: false,
+		},
+		{
+			desc:      "Service Unavailable is retried",
+			code:      http.StatusServiceUnavailable,
+			wantRetry: true,
+		},
+	}
+
+	// Act / Assert
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			var requests int32
+			s := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+				atomic.AddInt32(&requests, 1)
+				rw.WriteHeader(tC.code)
+			}))
+			defer s.Close()
+
+			cfg := createDefaultConfig().(*Config)
+			cfg.Endpoint = s.URL
+			cfg.IngestToken = "token"
+			cfg.QueueSettings.Enabled = false
+			cfg.RetrySettings.InitialInterval = time.Millisecond
+			cfg.RetrySettings.MaxInterval = time.Millisecond
+			cfg.RetrySettings.MaxElapsedTime = 100 * time.Millisecond
+
+			exp, err := createTracesExporter(
+				context.Background(),
+				component.ExporterCreateParams{Logger: zap.NewNop()},
+				cfg,
+			)
+			require.NoError(t, err)
+			require.NoError(t, exp.Start(context.Background(), componenttest.NewNopHost()))
+			defer exp.Shutdown(context.Background())
+
+			err = exp.ConsumeTraces(context.Background(), makeTraces(time.Now()))
+
+			require.Error(t, err)
+			if tC.wantRetry {
+				assert.Greater(t, atomic.LoadInt32(&requests), int32(1))
+			} else {
+				assert.Equal(t, int32(1), atomic.LoadInt32(&requests))
+			}
+		})
+	}
+}
+
+func TestExporterRetriesOnConnectionReset(t *testing.T) {
+	// Arrange
+	disabled := false
+	testCases := []struct {
+		desc      string
+		retry     *bool
+		wantRetry bool
+	}{
+		{
+			desc:      "Retried by default",
+			wantRetry: true,
+		},
+		{
+			desc:      "Fails permanently when disabled",
+			retry:     &disabled,
+			wantRetry: false,
+		},
+	}
+
+	// Act / Assert
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			// The first two requests are reset by the server, such as by a load balancer
+			var requests int32
+			s := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+				if atomic.AddInt32(&requests, 1) > 2 {
+					rw.WriteHeader(http.StatusOK)
+					return
+				}
+				conn, _, err := rw.(http.Hijacker).Hijack()
+				require.NoError(t, err)
+				conn.(*net.TCPConn).SetLinger(0)
+				conn.Close()
+			}))
+			defer s.Close()
+
+			cfg := createDefaultConfig().(*Config)
+			cfg.Endpoint = s.URL
+			cfg.IngestToken = "token"
+			cfg.QueueSettings.Enabled = false
+			cfg.RetrySettings.InitialInterval = time.Millisecond
+			cfg.RetrySettings.MaxInterval = time.Millisecond
+			cfg.RetrySettings.MaxElapsedTime = time.Minute
+			cfg.RetryOnConnectionErrors = tC.retry
+
+			exp, err := createTracesExporter(
+				context.Background(),
+				component.ExporterCreateParams{Logger: zap.NewNop()},
+				cfg,
+			)
+			require.NoError(t, err)
+			require.NoError(t, exp.Start(context.Background(), componenttest.NewNopHost()))
+			defer exp.Shutdown(context.Background())
+
+			err = exp.ConsumeTraces(context.Background(), makeTraces(time.Now()))
+
+			if tC.wantRetry {
+				require.NoError(t, err)
+				assert.Equal(t, int32(3), atomic.LoadInt32(&requests))
+			} else {
+				require.Error(t, err)
+				assert.True(t, consumererror.IsPermanent(err))
+				assert.Equal(t, int32(1), atomic.LoadInt32(&requests))
+			}
+		})
+	}
 }
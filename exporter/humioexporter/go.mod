@@ -3,7 +3,11 @@ module github.com/open-telemetry/opentelemetry-collector-contrib/exporter/humioe
 go 1.15
 
 require (
+	github.com/klauspost/compress v1.12.1
 	github.com/stretchr/testify v1.7.0
+	go.opencensus.io v0.23.0
 	go.opentelemetry.io/collector v0.25.0
+	go.opentelemetry.io/proto/otlp v0.7.0
 	go.uber.org/zap v1.16.0
+	google.golang.org/protobuf v1.26.0
 )
@@ -18,15 +18,32 @@ import (
 	"bytes"
 	"compress/gzip"
 	"context"
+	"crypto/tls"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"io"
 	"io/ioutil"
+	"math"
+	"math/rand"
+	"net"
 	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
 	"sync"
+	"sync/atomic"
+	"syscall"
 	"time"
 
+	"github.com/klauspost/compress/zstd"
+	"go.opencensus.io/plugin/ochttp/propagation/tracecontext"
+	"go.opencensus.io/stats"
+	"go.opencensus.io/tag"
+	"go.opencensus.io/trace"
+	"go.opentelemetry.io/collector/config"
 	"go.opentelemetry.io/collector/consumer/consumererror"
+	"go.opentelemetry.io/collector/exporter/exporterhelper"
 	"go.uber.org/zap"
 )
 
@@ -43,6 +60,9 @@ type HumioUnstructuredEvents struct {
 
 	// The series of unstructured messages
 	Messages []string `json:"messages"`
+
+	// The value used to route the messages to a repository, when routing is enabled
+	routingValue string
 }
 
 // HumioStructuredEvents represents a payload of multiple structured events to send to Humio
@@ -52,6 +72,9 @@ type HumioStructuredEvents struct {
 
 	// The series of structured events
 	Events []*HumioStructuredEvent `json:"events"`
+
+	// The value used to route the events to a repository, when routing is enabled
+	routingValue string
 }
 
 // HumioStructuredEvent represents a single structured event to send to Humio
@@ -62,155 +85,1040 @@ type HumioStructuredEvent struct {
 	// Whether to serialize the timestamp as Unix or ISO
 	AsUnix bool
 
+	// The precision of Unix timestamps, which defaults to milliseconds
+	Precision time.Duration
+
 	// The event payload
 	Attributes interface{}
+
+	// The raw string representing the event, which Humio displays and extracts
+	// fields from at query time. Left out when empty
+	RawString string
 }
 
 // MarshalJSON formats the timestamp in a HumioStructuredEvent as either an ISO string or a
-// Unix timestamp in milliseconds with time zone
+// Unix timestamp in milliseconds (or the specified precision) with time zone
 func (e *HumioStructuredEvent) MarshalJSON() ([]byte, error) {
 	if e.AsUnix {
+		precision := e.Precision
+		if precision <= 0 {
+			precision = time.Millisecond
+		}
+
 		return json.Marshal(struct {
 			Timestamp  int64       `json:"timestamp"`
 			TimeZone   string      `json:"timezone"`
 			Attributes interface{} `json:"attributes,omitempty"`
+			RawString  string      `json:"rawstring,omitempty"`
 		}{
-			Timestamp:  e.Timestamp.Local().UnixNano() * int64(time.Nanosecond) / int64(time.Millisecond),
+			Timestamp:  e.Timestamp.UnixNano() / int64(precision),
 			TimeZone:   e.Timestamp.Location().String(),
 			Attributes: e.Attributes,
+			RawString:  e.RawString,
 		})
 	}
 
 	return json.Marshal(struct {
 		Timestamp  time.Time   `json:"timestamp"`
 		Attributes interface{} `json:"attributes,omitempty"`
+		RawString  string      `json:"rawstring,omitempty"`
 	}{
 		Timestamp:  e.Timestamp,
 		Attributes: e.Attributes,
+		RawString:  e.RawString,
 	})
 }
 
+// The maximum number of bytes to read from the body of an error response
+const maxErrorBodySize = 4096
+
+// The status codes of failed requests which are retried by default
+var defaultRetryOnStatusCodes = []int{
+	http.StatusTooManyRequests,
+	http.StatusInternalServerError,
+	http.StatusBadGateway,
+	http.StatusServiceUnavailable,
+	http.StatusGatewayTimeout,
+}
+
+// humioErrorResponse represents the JSON body returned by Humio when an ingest request fails
+type humioErrorResponse struct {
+	Error   string `json:"error"`
+	Message string `json:"message"`
+
+	// The positions of the rejected events across all events in the request,
+	// if Humio reports the status of individual events
+	FailedIndices []int `json:"failedIndices"`
+}
+
+// Get the most descriptive reason for the failure reported by Humio
+func (r *humioErrorResponse) reason() string {
+	if r.Message != "" {
+		return r.Message
+	}
+	return r.Error
+}
+
+// partialFailureError indicates that Humio rejected only some of the events in a
+// payload, such that the remaining events need not be sent again. It does not
+// unwrap to the underlying error, since the failed events should always be retried
+type partialFailureError struct {
+	err error
+
+	// The positions of the failed events across all events in the payload, in order
+	failed []int
+}
+
+func (e *partialFailureError) Error() string {
+	return e.err.Error()
+}
+
 // Abstract interface describing the capabilities of an HTTP client for sending
 // unstructured and structured events
 type exporterClient interface {
 	sendUnstructuredEvents(context.Context, []*HumioUnstructuredEvents) error
 	sendStructuredEvents(context.Context, []*HumioStructuredEvents) error
+	checkEndpoint(context.Context) error
+	start(context.Context) error
+	shutdown(context.Context) error
 }
 
+// The error returned for requests which are not sent since the ingest token was rejected
+var errAuthFailed = errors.New("not sending events to Humio, since the ingest token was rejected")
+
 // A concrete HTTP client for sending unstructured and structured events to Humio
 type humioClient struct {
-	cfg      *Config
-	client   *http.Client
-	gzipPool *sync.Pool
-	logger   *zap.Logger
+	cfg                  *Config
+	dataType             config.DataType
+	headers              map[string]string
+	token                *tokenReloader
+	recycler             *connRecycler
+	breaker              *circuitBreaker
+	budget               *retryBudget
+	retryable            map[int]bool
+	jitterRandom         func() float64
+	client               *http.Client
+	structuredEndpoint   *url.URL
+	unstructuredEndpoint *url.URL
+	gzipPool             *sync.Pool
+	zstdPool             *sync.Pool
+	logger               *zap.Logger
+
+	// The error of the request whose ingest token was rejected by Humio, after
+	// which no more requests are sent when failing on auth errors
+	authErr     atomic.Value
+	authErrOnce sync.Once
 }
 
-// Constructs a new HTTP client for sending payloads to Humio
-func newHumioClient(cfg *Config, logger *zap.Logger) (exporterClient, error) {
-	client, err := cfg.HTTPClientSettings.ToClient()
+// Constructs a new HTTP client for sending payloads of the specified signal to Humio
+func newHumioClient(cfg *Config, dataType config.DataType, logger *zap.Logger) (exporterClient, error) {
+	// Credentials in the endpoint must not end up in the logs
+	structured, unstructured := cfg.getEndpoints(dataType)
+	logger.Debug("Resolved the Humio ingest endpoints",
+		zap.String("data_type", string(dataType)),
+		zap.String("structured_endpoint", structured.Redacted()),
+		zap.String("unstructured_endpoint", unstructured.Redacted()))
+
+	// The signature covers the entire compressed body, which is therefore never
+	// streamed, so this is reported once rather than for every route
+	if cfg.StreamBody && cfg.signer != nil {
+		logger.Warn("The stream_body setting has no effect while a request signer is registered",
+			zap.String("data_type", string(dataType)))
+	}
+
+	// The same reloaded token is used for all events sent with the ingest token
+	var token *tokenReloader
+	if cfg.IngestTokenReloadInterval > 0 {
+		token = newTokenReloader(cfg.IngestTokenFile, cfg.IngestTokenReloadInterval, cfg.Headers["authorization"], logger)
+	}
+
+	var client exporterClient
+	var err error
+	if cfg.RoutingAttribute != "" {
+		client, err = newRoutingClient(cfg, dataType, token, logger)
+	} else {
+		client, err = newRepositoryClient(cfg, dataType, cfg.Headers, token, logger)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// Accumulated events are merged before routing, such that they can still
+	// be sent to different repositories
+	if cfg.AccumulationWindow > 0 {
+		client = newAccumulatingClient(cfg, client)
+	}
+	return client, nil
+}
+
+// Creates a client which sends events to a single Humio repository, using the
+// specified headers for every request. If a token reloader is provided, it
+// takes precedence over the authorization header
+func newRepositoryClient(cfg *Config, dataType config.DataType, headers map[string]string, token *tokenReloader, logger *zap.Logger) (*humioClient, error) {
+	// The headers are applied when sending each request, which allows a reloaded
+	// token to take precedence, so the HTTP client must not apply them as well.
+	// This also leaves the transport unwrapped, such that it can be configured
+	settings := cfg.HTTPClientSettings
+	settings.Headers = nil
+	custom := settings.CustomRoundTripper
+	var transport *http.Transport
+	settings.CustomRoundTripper = func(next http.RoundTripper) (http.RoundTripper, error) {
+		if t, ok := next.(*http.Transport); ok {
+			cfg.configureTransport(t)
+			transport = t
+		}
+		if custom != nil {
+			return custom(next)
+		}
+		return next, nil
+	}
+
+	client, err := settings.ToClient()
 	if err != nil {
 		return nil, err
 	}
 
+	// Every client compresses at a single level, so its pooled writers can all be reused
+	level, err := cfg.getCompressionLevel()
+	if err != nil {
+		return nil, err
+	}
+
+	var breaker *circuitBreaker
+	if cfg.CircuitBreakerThreshold > 0 {
+		breaker = newCircuitBreaker(cfg.CircuitBreakerThreshold, cfg.CircuitBreakerCooldown, logger)
+	}
+
+	var budget *retryBudget
+	if cfg.MaxTotalRetryDuration > 0 {
+		budget = newRetryBudget(cfg)
+	}
+
+	retryable := make(map[int]bool)
+	for _, code := range cfg.getRetryOnStatusCodes() {
+		retryable[code] = true
+	}
+
+	// Connections are not kept open with keep-alives disabled, so there is nothing to recycle
+	var recycler *connRecycler
+	if cfg.MaxConnLifetime > 0 && !cfg.DisableKeepAlives && transport != nil {
+		recycler = newConnRecycler(transport, cfg.MaxConnLifetime)
+	}
+
+	structured, unstructured := cfg.getEndpoints(dataType)
 	return &humioClient{
-		cfg:    cfg,
-		client: client,
+		cfg:                  cfg,
+		dataType:             dataType,
+		headers:              headers,
+		token:                token,
+		recycler:             recycler,
+		breaker:              breaker,
+		budget:               budget,
+		retryable:            retryable,
+		client:               client,
+		structuredEndpoint:   structured,
+		unstructuredEndpoint: unstructured,
 		gzipPool: &sync.Pool{New: func() interface{} {
-			return gzip.NewWriter(nil)
+			// The level is validated up front, so creating the writer never fails
+			gz, _ := gzip.NewWriterLevel(nil, level)
+			return gz
+		}},
+		zstdPool: &sync.Pool{New: func() interface{} {
+			// The window size is validated up front, so creating the encoder never fails
+			enc, _ := zstd.NewWriter(nil, cfg.getZstdOptions()...)
+			return enc
 		}},
-		logger: logger,
+		// Every client is seeded on its own, since collectors sharing a sequence
+		// would retry in lockstep
+		jitterRandom: (&lockedRandom{r: rand.New(rand.NewSource(time.Now().UnixNano()))}).Float64,
+		logger:       logger,
 	}, nil
 }
 
+// Applies the transport settings which are not supported by the HTTP client
+// settings. Connection pool settings left at zero keep the defaults of Go
+func (c *Config) configureTransport(transport *http.Transport) {
+	if c.MaxIdleConns > 0 {
+		transport.MaxIdleConns = c.MaxIdleConns
+	}
+	if c.MaxIdleConnsPerHost > 0 {
+		transport.MaxIdleConnsPerHost = c.MaxIdleConnsPerHost
+	}
+	if c.IdleConnTimeout > 0 {
+		transport.IdleConnTimeout = c.IdleConnTimeout
+	}
+	if c.DisableKeepAlives {
+		transport.DisableKeepAlives = true
+	}
+
+	if c.ProxyURL != "" {
+		// The URL has already been validated
+		proxy, _ := url.Parse(c.ProxyURL)
+		transport.Proxy = http.ProxyURL(proxy)
+	}
+
+	if c.TLSMinVersion == "" && c.TLSMaxVersion == "" && len(c.TLSCipherSuites) == 0 {
+		return
+	}
+
+	// No TLS config is loaded for insecure endpoints without a CA, which is
+	// otherwise the same as the default config
+	if transport.TLSClientConfig == nil {
+		transport.TLSClientConfig = &tls.Config{}
+	}
+
+	// The versions and cipher suites have already been validated
+	tlsCfg := transport.TLSClientConfig
+	tlsCfg.MinVersion = tlsVersions[c.TLSMinVersion]
+	tlsCfg.MaxVersion = tlsVersions[c.TLSMaxVersion]
+	if len(c.TLSCipherSuites) > 0 {
+		tlsCfg.CipherSuites = make([]uint16, len(c.TLSCipherSuites))
+		for i, name := range c.TLSCipherSuites {
+			tlsCfg.CipherSuites[i], _ = lookupCipherSuite(name)
+		}
+	}
+}
+
 // Send a payload of unstructured events to the corresponding Humio API
 func (h *humioClient) sendUnstructuredEvents(ctx context.Context, evts []*HumioUnstructuredEvents) error {
-	return h.sendEvents(ctx, evts, h.cfg.unstructuredEndpoint.String())
+	if h.cfg.MaxRequestBodySize == 0 && h.cfg.MaxEventsPerRequest == 0 {
+		return h.sendEvents(ctx, evts, h.unstructuredEndpoint.String())
+	}
+
+	groups := make([]eventGroup, len(evts))
+	for i, evt := range evts {
+		groups[i] = evt
+	}
+	return h.sendSplitEvents(ctx, groups, h.unstructuredEndpoint.String())
 }
 
 // Send a payload of structured events to the corresponding Humio API
 func (h *humioClient) sendStructuredEvents(ctx context.Context, evts []*HumioStructuredEvents) error {
-	return h.sendEvents(ctx, evts, h.cfg.structuredEndpoint.String())
+	if h.cfg.MaxRequestBodySize == 0 && h.cfg.MaxEventsPerRequest == 0 {
+		return h.sendEvents(ctx, evts, h.structuredEndpoint.String())
+	}
+
+	groups := make([]eventGroup, len(evts))
+	for i, evt := range evts {
+		groups[i] = evt
+	}
+	return h.sendSplitEvents(ctx, groups, h.structuredEndpoint.String())
+}
+
+// Start the background work of the client, which is stopped again on shutdown
+func (h *humioClient) start(context.Context) error {
+	if h.token != nil {
+		h.token.start()
+	}
+	if h.recycler != nil {
+		h.recycler.start()
+	}
+	return nil
+}
+
+// Stop any background work of the client, after which no more events may be sent
+func (h *humioClient) shutdown(context.Context) error {
+	if h.token != nil {
+		h.token.stop()
+	}
+	if h.recycler != nil {
+		h.recycler.stop()
+	}
+	return nil
+}
+
+// Verify that Humio can be reached and accepts the ingest token, by sending a
+// payload without any events. Failures that may resolve themselves, such as
+// Humio being temporarily unavailable, are only logged
+func (h *humioClient) checkEndpoint(ctx context.Context) error {
+	if h.cfg.DryRun {
+		return nil
+	}
+
+	url := h.structuredEndpoint.String()
+
+	payload, err := h.encodeBody([]*HumioStructuredEvents{})
+	if err != nil {
+		return err
+	}
+	body, err := h.compressBody(payload)
+	if err != nil {
+		return err
+	}
+
+	if h.cfg.RequestTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, h.cfg.RequestTimeout)
+		defer cancel()
+	}
+
+	req, err := h.newRequest(ctx, bytes.NewReader(body), signBody(h.cfg, body), url)
+	if err != nil {
+		return err
+	}
+
+	res, err := h.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("unable to reach Humio at %s: %w", url, err)
+	}
+	defer func() {
+		io.Copy(ioutil.Discard, res.Body)
+		res.Body.Close()
+	}()
+
+	switch {
+	case res.StatusCode == http.StatusUnauthorized || res.StatusCode == http.StatusForbidden:
+		return fmt.Errorf("the ingest token was rejected by Humio at %s, got %s", url, res.Status)
+	case res.StatusCode == http.StatusNotFound:
+		return fmt.Errorf("the ingest endpoint was not found at %s, got %s", url, res.Status)
+	case res.StatusCode < http.StatusOK || res.StatusCode >= http.StatusMultipleChoices:
+		h.logger.Warn("Unable to verify the Humio endpoint, continuing regardless",
+			zap.String("url", url),
+			zap.Error(newHumioError(res, 0)))
+	}
+	return nil
+}
+
+// Split a payload into multiple requests that each respect the maximum request
+// body size and number of events, and send them to the specified Humio API
+func (h *humioClient) sendSplitEvents(ctx context.Context, groups []eventGroup, url string) error {
+	split, err := splitEventGroups(groups, h.cfg.MaxRequestBodySize, h.cfg.MaxEventsPerRequest)
+	if err != nil {
+		return consumererror.Permanent(err)
+	}
+
+	if split.dropped > 0 {
+		mCtx, _ := tag.New(ctx, tag.Upsert(tagExporterKey, h.cfg.Name()))
+		stats.Record(mCtx, mEventsDropped.M(int64(split.dropped)))
+		h.logger.Warn("Dropping events that exceed the maximum request body size on their own",
+			zap.Int("dropped", split.dropped),
+			zap.Int("max_request_body_size", h.cfg.MaxRequestBodySize))
+	}
+
+	for i, batch := range split.batches {
+		// The exporter helper does not retry a cancelled request, so there is
+		// no point in sending the remaining batches
+		if i > 0 && ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		err := h.sendEvents(ctx, batch, url)
+		if err == nil {
+			continue
+		}
+
+		// Positions reported by Humio are relative to the batch, and any
+		// subsequent batches have not been sent at all
+		var partial *partialFailureError
+		if !errors.As(err, &partial) {
+			return err
+		}
+
+		var failed []int
+		for _, idx := range partial.failed {
+			failed = append(failed, split.positions[i][idx])
+		}
+		for _, positions := range split.positions[i+1:] {
+			failed = append(failed, positions...)
+		}
+		return &partialFailureError{err: partial.err, failed: failed}
+	}
+
+	return nil
 }
 
 // Send a payload of generic events to the specified Humio API. This method should
 // never be called directly
 func (h *humioClient) sendEvents(ctx context.Context, evts interface{}, url string) error {
-	body, err := h.encodeBody(evts)
-	if err != nil {
-		return consumererror.Permanent(err)
+	if err := ctx.Err(); err != nil {
+		return err
 	}
 
-	req, err := http.NewRequestWithContext(
-		ctx,
-		"POST",
-		url,
-		body,
-	)
+	payload, err := h.encodeBody(evts)
 	if err != nil {
 		return consumererror.Permanent(err)
 	}
 
-	for h, v := range h.cfg.Headers {
-		req.Header.Set(h, v)
+	// The body is reserved before it is compressed, such that requests waiting
+	// for Humio do not also hold on to their compressed bodies
+	if h.cfg.inflightBytes != nil && !h.cfg.DryRun {
+		size := int64(len(payload))
+		if err := h.cfg.inflightBytes.acquire(ctx, size); err != nil {
+			return err
+		}
+		defer h.cfg.inflightBytes.release(size)
+	}
+
+	// A streamed body is compressed while it is sent, so its size is only known
+	// once the request has been written. Signing requires the entire body up front
+	streaming := h.cfg.StreamBody && h.cfg.signer == nil && !h.cfg.DryRun && h.cfg.getCompression() != compressionNone
+	var body []byte
+	if !streaming {
+		if body, err = h.compressBody(payload); err != nil {
+			return consumererror.Permanent(err)
+		}
+	}
+
+	// In dry-run mode, the request is considered successful without being sent
+	if h.cfg.DryRun {
+		h.logger.Debug("Dry run, skipping request to Humio",
+			zap.String("url", url),
+			zap.Int("uncompressed_size", len(payload)),
+			zap.Int("compressed_size", len(body)),
+			zap.ByteString("body", payload))
+		return nil
+	}
+
+	mCtx, _ := tag.New(ctx, tag.Upsert(tagExporterKey, h.cfg.Name()))
+	stats.Record(mCtx, mBytesUncompressed.M(int64(len(payload))))
+	if !streaming {
+		stats.Record(mCtx, mBytesCompressed.M(int64(len(body))))
+	}
+
+	total := countEvents(evts)
+	attempt := func(ctx context.Context) error {
+		// While the breaker is open, the exporter helper is asked to retry once it
+		// half-opens, such that the events are kept without sending any requests
+		if h.breaker != nil {
+			if ok, wait := h.breaker.allow(); !ok {
+				return exporterhelper.NewThrottleRetry(errCircuitOpen, wait)
+			}
+		}
+
+		// Checking the level first avoids building the fields unless debug logging is enabled
+		if ce := h.logger.Check(zap.DebugLevel, "Sending request to Humio"); ce != nil {
+			fields := []zap.Field{
+				zap.String("url", url),
+				zap.Int("events", total),
+				zap.String("compression", h.cfg.getCompression()),
+				zap.Int("uncompressed_size", len(payload)),
+			}
+			if !streaming {
+				fields = append(fields, zap.Int("compressed_size", len(body)))
+			}
+			ce.Write(fields...)
+		}
+
+		var reader io.Reader
+		if streaming {
+			reader = h.streamBody(mCtx, payload)
+		} else {
+			reader = bytes.NewReader(body)
+		}
+
+		start := time.Now()
+		err := h.retryDelay(ctx, h.sendRequest(ctx, reader, signBody(h.cfg, body), url, total))
+		recordOutcome(mCtx, time.Since(start), total, err)
+
+		if h.breaker != nil {
+			h.breaker.record(isUnavailable(err))
+		}
+		return err
+	}
+
+	switch {
+	case h.authError() != nil:
+		// The events are not sent, but may still be kept in the dead letter file
+		err = h.authError()
+		stats.Record(mCtx, mEventsDropped.M(int64(total)))
+	case h.budget != nil:
+		err = h.budget.send(ctx, total, attempt)
+	default:
+		err = attempt(ctx)
+	}
+
+	// The exporter helper never retries permanent failures, so this is the last
+	// chance to keep the events
+	if err != nil && consumererror.IsPermanent(err) && h.cfg.deadLetter != nil {
+		if dlErr := h.writeDeadLetter(evts, payload); dlErr != nil {
+			h.logger.Error("Unable to write permanently failed request to the dead letter file",
+				zap.String("dead_letter_file", h.cfg.DeadLetterFile),
+				zap.Error(dlErr))
+		} else {
+			h.logger.Warn("Wrote permanently failed request to the dead letter file",
+				zap.String("dead_letter_file", h.cfg.DeadLetterFile),
+				zap.Int("events", total),
+				zap.Error(err))
+		}
+	}
+	return err
+}
+
+// Write the payload of a failed request to the dead letter file, which holds
+// one request per line. Payloads encoded as ndjson span multiple lines, and are
+// written as a json array instead
+func (h *humioClient) writeDeadLetter(evts interface{}, payload []byte) error {
+	if h.cfg.IngestEncoding == ingestEncodingNDJSON {
+		var err error
+		if payload, err = json.Marshal(evts); err != nil {
+			return err
+		}
+	}
+	return h.cfg.deadLetter.write(payload)
+}
+
+// Send a compressed request body containing the specified number of events to
+// the Humio API along with any signed headers, and interpret the response
+func (h *humioClient) sendRequest(ctx context.Context, body io.Reader, signed map[string]string, url string, total int) error {
+	parent := ctx
+
+	// Bound each attempt individually, so a stuck connection cannot hold on to
+	// a worker for the entire client timeout
+	if h.cfg.RequestTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, h.cfg.RequestTimeout)
+		defer cancel()
+	}
+
+	req, err := h.newRequest(ctx, body, signed, url)
+	if err != nil {
+		// A streamed body is otherwise closed by the HTTP client, which stops
+		// compressing it
+		if closer, ok := body.(io.Closer); ok {
+			closer.Close()
+		}
+		return consumererror.Permanent(err)
 	}
 
 	res, err := h.client.Do(req)
 	if err != nil {
+		// Report the cancellation of the caller itself rather than the failed
+		// request, while a timed out attempt remains a regular failure
+		if parent.Err() != nil {
+			return parent.Err()
+		}
+		h.recordFailedAttempt(parent, mNetworkErrors)
+		if isConnectionError(err) && !h.cfg.retryOnConnectionErrors() {
+			return consumererror.Permanent(err)
+		}
 		return err
 	}
 	// Response body needs to both be read to EOF and closed to avoid leaks
-	defer res.Body.Close()
-	io.Copy(ioutil.Discard, res.Body)
+	defer func() {
+		io.Copy(ioutil.Discard, res.Body)
+		res.Body.Close()
+	}()
 
 	// If an error has occurred, determine if it would make sense to retry
 	// This check is not exhaustive, but should cover the most common cases
 	if res.StatusCode < http.StatusOK ||
 		res.StatusCode >= http.StatusMultipleChoices {
-		err = errors.New("unable to export events to Humio, got " + res.Status)
+		err = newHumioError(res, total)
+		h.recordFailedAttempt(parent, mFailedAttempts, tag.Upsert(tagStatusCodeKey, strconv.Itoa(res.StatusCode)))
+
+		// Only the rejected events need to be sent again
+		if _, ok := err.(*partialFailureError); ok {
+			return err
+		}
 
-		// These indicate a programming or configuration error
-		if res.StatusCode == http.StatusBadRequest ||
-			res.StatusCode == http.StatusUnauthorized ||
-			res.StatusCode == http.StatusForbidden {
+		if h.cfg.FailOnAuthError &&
+			(res.StatusCode == http.StatusUnauthorized || res.StatusCode == http.StatusForbidden) {
+			return h.failOnAuthError(err)
+		}
+
+		// Other status codes, such as those indicating a programming or
+		// configuration error, would fail in the same way when retried
+		if !h.retryable[res.StatusCode] {
 			return consumererror.Permanent(err)
 		}
 
+		// When throttled, Humio may tell us how long to wait before retrying
+		if res.StatusCode == http.StatusTooManyRequests ||
+			res.StatusCode == http.StatusServiceUnavailable {
+			if delay, ok := parseRetryAfter(res.Header.Get("Retry-After"), time.Now()); ok {
+				return &retryAfterError{err: err, delay: delay}
+			}
+		}
+
 		return err
 	}
 
 	return nil
 }
 
-// Encode the specified payload as json
-func (h *humioClient) encodeBody(body interface{}) (io.Reader, error) {
-	b, err := json.Marshal(body)
+// Create a request to the Humio API with the configured headers and authorization,
+// followed by the signed headers of the body. The Content-Length is only set for
+// bodies held in memory, while other bodies are sent using chunked transfer encoding
+func (h *humioClient) newRequest(ctx context.Context, body io.Reader, signed map[string]string, url string) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(
+		ctx,
+		"POST",
+		url,
+		body,
+	)
 	if err != nil {
 		return nil, err
 	}
 
-	if h.cfg.DisableCompression {
-		return bytes.NewReader(b), nil
+	for h, v := range h.headers {
+		req.Header.Set(h, v)
+	}
+	if h.token != nil {
+		req.Header.Set("authorization", h.token.authorization())
+	}
+	for h, v := range signed {
+		req.Header.Set(h, v)
+	}
+
+	// The collector traces its own pipelines with OpenCensus, which propagates
+	// the W3C trace context format
+	if h.cfg.PropagateTraceContext {
+		if span := trace.FromContext(ctx); span != nil {
+			(&tracecontext.HTTPFormat{}).SpanContextToRequest(span.SpanContext(), req)
+		}
+	}
+	return req, nil
+}
+
+// Stops sending requests to Humio, since the ingest token was rejected and every
+// subsequent request would be rejected in the same way
+func (h *humioClient) failOnAuthError(cause error) error {
+	h.authErrOnce.Do(func() {
+		h.logger.Error("The ingest token was rejected by Humio, no more events are sent until the collector is restarted",
+			zap.String("url", h.structuredEndpoint.String()),
+			zap.Error(cause))
+		h.authErr.Store(consumererror.Permanent(fmt.Errorf("%w: %v", errAuthFailed, cause)))
+	})
+	return h.authError()
+}
+
+// Get the error returned for every request once the ingest token was rejected, if any
+func (h *humioClient) authError() error {
+	if err, ok := h.authErr.Load().(error); ok {
+		return err
+	}
+	return nil
+}
+
+// Whether a request failed in a way which indicates that Humio is unavailable.
+// Requests rejected as invalid or only partially failing were still handled by
+// Humio, and cancelled requests say nothing about its availability
+func isUnavailable(err error) bool {
+	var partial *partialFailureError
+	return err != nil && !consumererror.IsPermanent(err) && !errors.As(err, &partial) &&
+		!errors.Is(err, context.Canceled)
+}
+
+// Whether a request was interrupted by its connection to Humio, such as when the
+// connection is reset or closed before the response is complete. These errors
+// are usually transient, and resolved by retrying over a new connection. Failing
+// to establish a connection, such as a refused connection or a failed DNS
+// lookup, is not an interruption of an established connection
+func isConnectionError(err error) bool {
+	var opErr *net.OpError
+	if errors.As(err, &opErr) && opErr.Op == "dial" {
+		return false
+	}
+	var dnsErr *net.DNSError
+	if errors.As(err, &dnsErr) {
+		return false
+	}
+
+	return errors.Is(err, syscall.ECONNRESET) ||
+		errors.Is(err, syscall.EPIPE) ||
+		errors.Is(err, io.EOF) ||
+		errors.Is(err, io.ErrUnexpectedEOF)
+}
+
+// Records a failed attempt to send a request for the signal of the client
+func (h *humioClient) recordFailedAttempt(ctx context.Context, m *stats.Int64Measure, mutators ...tag.Mutator) {
+	mutators = append(mutators,
+		tag.Upsert(tagExporterKey, h.cfg.Name()),
+		tag.Upsert(tagDataTypeKey, string(h.dataType)))
+	mCtx, _ := tag.New(ctx, mutators...)
+	stats.Record(mCtx, m.M(1))
+}
+
+// Records the outcome of a request to Humio containing the specified number of events
+func recordOutcome(ctx context.Context, duration time.Duration, total int, err error) {
+	var partial *partialFailureError
+	switch {
+	case err == nil:
+		stats.Record(ctx, mEventsSent.M(int64(total)))
+	case consumererror.IsPermanent(err):
+		stats.Record(ctx, mEventsDropped.M(int64(total)))
+	case errors.As(err, &partial):
+		stats.Record(ctx, mEventsSent.M(int64(total-len(partial.failed))), mRetries.M(1))
+	default:
+		stats.Record(ctx, mRetries.M(1))
+	}
+
+	sCtx, _ := tag.New(ctx, tag.Upsert(tagSuccessKey, strconv.FormatBool(err == nil)))
+	stats.Record(sCtx, mRequestLatency.M(duration.Milliseconds()))
+}
+
+// Creates an error describing a failed request to Humio. If the response body
+// contains a JSON error description, the message is included in the error. If
+// Humio also reports which of the total events were rejected, a partial
+// failure is returned instead
+func newHumioError(res *http.Response, total int) error {
+	msg := "unable to export events to Humio, got " + res.Status
+
+	// Bound how much of the body is read, in case we receive a huge error page
+	body, err := ioutil.ReadAll(io.LimitReader(res.Body, maxErrorBodySize))
+	if err != nil || len(body) == 0 {
+		return errors.New(msg)
+	}
+
+	var humioErr humioErrorResponse
+	if err := json.Unmarshal(body, &humioErr); err != nil {
+		return errors.New(msg)
+	}
+
+	if reason := humioErr.reason(); reason != "" {
+		msg += ": " + reason
+	}
+
+	// Ignore positions that do not refer to an event in the request
+	var failed []int
+	seen := make(map[int]bool, len(humioErr.FailedIndices))
+	for _, idx := range humioErr.FailedIndices {
+		if idx >= 0 && idx < total && !seen[idx] {
+			seen[idx] = true
+			failed = append(failed, idx)
+		}
+	}
+	sort.Ints(failed)
+
+	if len(failed) > 0 {
+		return &partialFailureError{err: errors.New(msg), failed: failed}
+	}
+	return errors.New(msg)
+}
+
+// Count the individual events in a payload
+func countEvents(evts interface{}) int {
+	count := 0
+	switch e := evts.(type) {
+	case []*HumioStructuredEvents:
+		for _, group := range e {
+			count += len(group.Events)
+		}
+	case []*HumioUnstructuredEvents:
+		for _, group := range e {
+			count += len(group.Messages)
+		}
+	case []eventGroup:
+		for _, group := range e {
+			count += group.count()
+		}
+	}
+	return count
+}
+
+// A source of random numbers in [0.0, 1.0) which is safe for concurrent use
+type lockedRandom struct {
+	mu sync.Mutex
+	r  *rand.Rand
+}
+
+func (l *lockedRandom) Float64() float64 {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.r.Float64()
+}
+
+// A failed request for which Humio asked to wait before retrying, through a
+// Retry-After header
+type retryAfterError struct {
+	err   error
+	delay time.Duration
+}
+
+func (e *retryAfterError) Error() string {
+	return e.err.Error()
+}
+
+func (e *retryAfterError) Unwrap() error {
+	return e.err
+}
+
+// The multiplier by which the exporter helper grows the backoff of retry_on_failure
+const retryBackoffMultiplier = 1.5
+
+// Tells the exporter helper how long to wait at least before retrying a failed
+// request. This is the delay requested by Humio through Retry-After, or the
+// backoff of retry_on_failure when a retry_jitter is configured, either of which
+// is extended by the jitter
+func (h *humioClient) retryDelay(ctx context.Context, err error) error {
+	if !isUnavailable(err) {
+		return err
+	}
+
+	var retryAfter *retryAfterError
+	if errors.As(err, &retryAfter) {
+		return exporterhelper.NewThrottleRetry(retryAfter.err, h.jitter(retryAfter.delay))
+	}
+	if h.cfg.RetryJitter <= 0 {
+		return err
+	}
+	return exporterhelper.NewThrottleRetry(err, h.jitter(h.retryBackoff(ctx)))
+}
+
+// Get the backoff of retry_on_failure before the next retry of a request,
+// without the randomization of the exporter helper. It grows from the
+// initial_interval with every failed attempt of the request, up to the max_interval
+func (h *humioClient) retryBackoff(ctx context.Context) time.Duration {
+	failed := countFailedAttempt(ctx, h)
+	backoff := float64(h.cfg.RetrySettings.InitialInterval) * math.Pow(retryBackoffMultiplier, float64(failed))
+	if max := float64(h.cfg.RetrySettings.MaxInterval); max > 0 && backoff > max {
+		backoff = max
+	}
+	return time.Duration(backoff)
+}
+
+// Extend a retry delay by a random fraction of up to retry_jitter of the delay,
+// such that clients failing at the same time do not retry at once
+func (h *humioClient) jitter(delay time.Duration) time.Duration {
+	if h.cfg.RetryJitter <= 0 {
+		return delay
+	}
+	return delay + time.Duration(h.jitterRandom()*h.cfg.RetryJitter*float64(delay))
+}
+
+// Parses the value of a Retry-After header, which is either a number of seconds
+// to wait or an HTTP-date after which to retry. Returns false if the value is
+// missing or cannot be parsed
+func parseRetryAfter(value string, now time.Time) (time.Duration, bool) {
+	if value == "" {
+		return 0, false
+	}
+
+	if seconds, err := strconv.Atoi(value); err == nil {
+		if seconds < 0 {
+			return 0, false
+		}
+		return time.Duration(seconds) * time.Second, true
+	}
+
+	if date, err := http.ParseTime(value); err == nil {
+		delay := date.Sub(now)
+		if delay < 0 {
+			delay = 0
+		}
+		return delay, true
+	}
+
+	return 0, false
+}
+
+// Encode the specified payload as json, either as a single array or as one
+// object per line when using ndjson
+func (h *humioClient) encodeBody(body interface{}) ([]byte, error) {
+	if h.cfg.IngestEncoding != ingestEncodingNDJSON {
+		return json.Marshal(body)
+	}
+
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	for _, group := range asEventGroups(body) {
+		// The encoder terminates each object with a newline
+		if err := enc.Encode(group); err != nil {
+			return nil, err
+		}
+	}
+	return buf.Bytes(), nil
+}
+
+// Get the elements of a payload, regardless of the type of events it holds
+func asEventGroups(evts interface{}) []eventGroup {
+	switch e := evts.(type) {
+	case []*HumioStructuredEvents:
+		groups := make([]eventGroup, len(e))
+		for i, group := range e {
+			groups[i] = group
+		}
+		return groups
+	case []*HumioUnstructuredEvents:
+		groups := make([]eventGroup, len(e))
+		for i, group := range e {
+			groups[i] = group
+		}
+		return groups
+	case []eventGroup:
+		return e
+	default:
+		return nil
+	}
+}
+
+// Compress the encoded payload using the configured compression algorithm
+func (h *humioClient) compressBody(body []byte) ([]byte, error) {
+	if h.cfg.getCompression() == compressionNone {
+		return body, nil
+	}
+
+	b := new(bytes.Buffer)
+	if err := h.compressTo(b, body); err != nil {
+		return nil, err
+	}
+	return b.Bytes(), nil
+}
+
+// Compress the encoded payload while the returned request body is read, such
+// that the compressed body is never held in memory as a whole. The compressed
+// size is recorded once the entire body has been read
+func (h *humioClient) streamBody(ctx context.Context, body []byte) io.ReadCloser {
+	r, w := io.Pipe()
+	go func() {
+		// Closing the reader, such as when the request fails, makes any
+		// further writes fail and stops the compression
+		counter := &countingWriter{w: w}
+		err := h.compressTo(counter, body)
+		if err == nil {
+			stats.Record(ctx, mBytesCompressed.M(counter.n))
+		}
+		w.CloseWithError(err)
+	}()
+	return r
+}
+
+// Write the compressed payload to the writer, using the configured compression algorithm
+func (h *humioClient) compressTo(w io.Writer, body []byte) error {
+	if h.cfg.getCompression() == compressionZstd {
+		return h.compressToZstd(w, body)
 	}
-	return h.compressBody(b)
+	return h.compressToGzip(w, body)
 }
 
-func (h *humioClient) compressBody(body []byte) (io.Reader, error) {
+func (h *humioClient) compressToGzip(w io.Writer, body []byte) error {
 	gzipper := h.gzipPool.Get().(*gzip.Writer)
 	defer h.gzipPool.Put(gzipper)
 
 	// Must reset writer because we reuse it
-	b := new(bytes.Buffer)
-	gzipper.Reset(b)
+	gzipper.Reset(w)
 
 	_, err := gzipper.Write(body)
 	if err != nil {
-		return nil, err
+		return err
 	}
 
-	err = gzipper.Close()
+	return gzipper.Close()
+}
+
+func (h *humioClient) compressToZstd(w io.Writer, body []byte) error {
+	encoder := h.zstdPool.Get().(*zstd.Encoder)
+	defer h.zstdPool.Put(encoder)
+
+	// Must reset encoder because we reuse it
+	encoder.Reset(w)
+
+	_, err := encoder.Write(body)
 	if err != nil {
-		return nil, err
+		return err
 	}
 
-	return b, nil
+	return encoder.Close()
+}
+
+// Counts the bytes written to the underlying writer
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
 }
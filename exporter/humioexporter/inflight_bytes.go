@@ -0,0 +1,89 @@
+// Copyright The OpenTelemetry Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package humioexporter
+
+import (
+	"context"
+	"errors"
+	"sync"
+)
+
+// The error returned for requests which are shed since too many bytes are in flight
+var errInFlightBytesExceeded = errors.New("not sending events to Humio, since the max_in_flight_bytes are already in flight")
+
+// Limits the total size of the request bodies that are in flight at the same
+// time, by either blocking or shedding requests which would exceed the limit
+type inflightBytesLimiter struct {
+	limit int64
+	shed  bool
+
+	mu   sync.Mutex
+	used int64
+
+	// Closed and replaced whenever bytes are released, waking up blocked requests
+	released chan struct{}
+}
+
+func newInflightBytesLimiter(limit int64, policy string) *inflightBytesLimiter {
+	return &inflightBytesLimiter{
+		limit:    limit,
+		shed:     policy == inflightBytesPolicyShed,
+		released: make(chan struct{}),
+	}
+}
+
+// Reserve the specified number of bytes, waiting for other requests to release
+// theirs or failing right away depending on the policy. A request larger than
+// the limit is only admitted while no other request is in flight, so that it
+// does not wait forever
+func (l *inflightBytesLimiter) acquire(ctx context.Context, size int64) error {
+	for {
+		l.mu.Lock()
+		if l.used == 0 || l.used+size <= l.limit {
+			l.used += size
+			l.mu.Unlock()
+			return nil
+		}
+		released := l.released
+		l.mu.Unlock()
+
+		if l.shed {
+			return errInFlightBytesExceeded
+		}
+
+		select {
+		case <-released:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// Release the bytes of a request that is no longer in flight
+func (l *inflightBytesLimiter) release(size int64) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.used -= size
+	close(l.released)
+	l.released = make(chan struct{})
+}
+
+// Get the number of bytes currently in flight
+func (l *inflightBytesLimiter) inflight() int64 {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.used
+}
@@ -0,0 +1,105 @@
+// Copyright The OpenTelemetry Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package humioexporter
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestInflightBytesLimiterWithinLimit(t *testing.T) {
+	// Arrange
+	limiter := newInflightBytesLimiter(100, inflightBytesPolicyBlock)
+
+	// Act
+	err1 := limiter.acquire(context.Background(), 60)
+	err2 := limiter.acquire(context.Background(), 40)
+
+	// Assert
+	require.NoError(t, err1)
+	require.NoError(t, err2)
+	assert.Equal(t, int64(100), limiter.inflight())
+
+	limiter.release(60)
+	limiter.release(40)
+	assert.Equal(t, int64(0), limiter.inflight())
+}
+
+func TestInflightBytesLimiterBlocks(t *testing.T) {
+	// Arrange
+	limiter := newInflightBytesLimiter(100, inflightBytesPolicyBlock)
+	require.NoError(t, limiter.acquire(context.Background(), 80))
+
+	// Act
+	acquired := make(chan error, 1)
+	go func() {
+		acquired <- limiter.acquire(context.Background(), 40)
+	}()
+
+	// Assert
+	select {
+	case <-acquired:
+		assert.Fail(t, "the bytes were acquired beyond the limit")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	limiter.release(80)
+	require.NoError(t, <-acquired)
+	assert.Equal(t, int64(40), limiter.inflight())
+}
+
+func TestInflightBytesLimiterCanceled(t *testing.T) {
+	// Arrange
+	limiter := newInflightBytesLimiter(100, inflightBytesPolicyBlock)
+	require.NoError(t, limiter.acquire(context.Background(), 80))
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	// Act
+	err := limiter.acquire(ctx, 40)
+
+	// Assert
+	assert.Equal(t, context.DeadlineExceeded, err)
+	assert.Equal(t, int64(80), limiter.inflight())
+}
+
+func TestInflightBytesLimiterShed(t *testing.T) {
+	// Arrange
+	limiter := newInflightBytesLimiter(100, inflightBytesPolicyShed)
+	require.NoError(t, limiter.acquire(context.Background(), 80))
+
+	// Act
+	err := limiter.acquire(context.Background(), 40)
+
+	// Assert
+	assert.Equal(t, errInFlightBytesExceeded, err)
+	assert.Equal(t, int64(80), limiter.inflight())
+}
+
+func TestInflightBytesLimiterOversized(t *testing.T) {
+	// Arrange
+	limiter := newInflightBytesLimiter(100, inflightBytesPolicyShed)
+
+	// Act
+	err := limiter.acquire(context.Background(), 150)
+
+	// Assert
+	require.NoError(t, err)
+	assert.Equal(t, errInFlightBytesExceeded, limiter.acquire(context.Background(), 1))
+}
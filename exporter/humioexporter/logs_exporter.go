@@ -0,0 +1,611 @@
+// Copyright The OpenTelemetry Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package humioexporter
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"go.opencensus.io/stats"
+	"go.opencensus.io/tag"
+	"go.opentelemetry.io/collector/component"
+	"go.opentelemetry.io/collector/config"
+	"go.opentelemetry.io/collector/consumer/consumererror"
+	"go.opentelemetry.io/collector/consumer/pdata"
+	tracetranslator "go.opentelemetry.io/collector/translator/trace"
+	"go.uber.org/zap"
+)
+
+const (
+	// The default name of the field holding the body of a log record
+	defaultBodyField = "message"
+
+	// The default name of the field holding the normalized severity of a log record
+	defaultSeverityField = "severity"
+
+	// The default name of the field holding the event name of a log record
+	defaultEventNameField = "event_name"
+
+	// The name of the field holding the numeric severity of a log record
+	severityNumberField = "severity_number"
+
+	// The default names of the fields holding the trace context of a log record
+	defaultLogTraceIDField = "trace_id"
+	defaultLogSpanIDField  = "span_id"
+
+	// The name of the field holding the attributes which are not promoted
+	logAttributesField = "attributes"
+)
+
+// Supported formats for ingesting logs into Humio
+const (
+	ingestFormatStructured   = "structured"
+	ingestFormatUnstructured = "unstructured"
+)
+
+// Supported ways of handling newlines in string bodies
+const (
+	bodyNewlinesKeep    = "keep"
+	bodyNewlinesEscape  = "escape"
+	bodyNewlinesReplace = "replace"
+)
+
+// Supported ways of handling log records without a timestamp
+const (
+	timestampFallbackNow      = "now"
+	timestampFallbackReject   = "reject"
+	timestampFallbackObserved = "observed"
+)
+
+type humioLogsExporter struct {
+	cfg    *Config
+	logger *zap.Logger
+	client exporterClient
+
+	// Requests that are currently being sent, which are drained on shutdown
+	inflight *inflightTracker
+	queue    *queueTracker
+
+	// Guards against creating too many distinct data sources in Humio
+	tags *tagCardinalityLimiter
+
+	// The attributes kept at the top level of events when the remaining
+	// attributes are nested, or nil when attributes are not nested
+	promoted map[string]bool
+
+	// The time used for log records without a timestamp
+	now func() time.Time
+}
+
+func newLogsExporter(cfg *Config, logger *zap.Logger, client exporterClient) *humioLogsExporter {
+	return &humioLogsExporter{
+		cfg:      cfg,
+		logger:   logger,
+		client:   client,
+		inflight: newInflightTracker(logger),
+		queue:    newQueueTracker(cfg),
+		tags:     newTagCardinalityLimiter(cfg.MaxTagCardinality, cfg.TagCardinalityWindow, logger),
+		promoted: promotedLogAttributes(cfg, logger),
+		now:      time.Now,
+	}
+}
+
+// Determine the attributes to promote to top-level fields. Attributes colliding
+// with a field set by the exporter are not promoted, which is only logged once,
+// since the fields are known up front
+func promotedLogAttributes(cfg *Config, logger *zap.Logger) map[string]bool {
+	if len(cfg.Logs.PromoteAttributes) == 0 {
+		return nil
+	}
+
+	reserved := map[string]bool{
+		logAttributesField:           true,
+		cfg.Logs.getBodyField():      true,
+		"severity_text":              true,
+		severityNumberField:          true,
+		cfg.Logs.getSeverityField():  true,
+		cfg.Logs.getEventNameField(): true,
+		cfg.Logs.getTraceIDField():   true,
+		cfg.Logs.getSpanIDField():    true,
+		droppedAttributesCountField:  true,
+		cfg.getScopeNameKey():        true,
+		cfg.getScopeVersionKey():     true,
+	}
+	if cfg.Logs.TimestampField != "" {
+		reserved[cfg.Logs.TimestampField] = true
+	}
+	if cfg.IngestTimestampFromEvent {
+		reserved[ingestTimestampField] = true
+	}
+
+	promoted := make(map[string]bool, len(cfg.Logs.PromoteAttributes))
+	for _, name := range cfg.Logs.PromoteAttributes {
+		if reserved[name] {
+			logger.Warn("Not promoting the log attribute, since it collides with a field of the event",
+				zap.String("attribute", name))
+			continue
+		}
+		promoted[name] = true
+	}
+	return promoted
+}
+
+// Nest all attributes which are not promoted under a single field
+func (e *humioLogsExporter) nestAttributes(attrs map[string]interface{}) map[string]interface{} {
+	result := make(map[string]interface{}, len(e.promoted)+1)
+	for name := range e.promoted {
+		if v, ok := attrs[name]; ok {
+			result[name] = v
+			delete(attrs, name)
+		}
+	}
+	result[logAttributesField] = attrs
+	return result
+}
+
+func (e *humioLogsExporter) pushLogsData(ctx context.Context, ld pdata.Logs) error {
+	e.queue.dequeue(ctx)
+	ctx, finish := e.inflight.begin(ctx)
+
+	err := e.sendLogs(ctx, ld)
+	var failed consumererror.Logs
+	switch {
+	case err == nil:
+		finish(ld.LogRecordCount(), 0)
+	case consumererror.AsLogs(err, &failed):
+		dropped := failed.GetLogs().LogRecordCount()
+		finish(ld.LogRecordCount()-dropped, dropped)
+	default:
+		finish(0, ld.LogRecordCount())
+	}
+	return err
+}
+
+func (e *humioLogsExporter) sendLogs(ctx context.Context, ld pdata.Logs) error {
+	if e.cfg.Logs.PassthroughOTLPJSON {
+		return e.sendPassthroughLogs(ctx, ld)
+	}
+
+	groups, recordPositions, rejected := e.groupLogs(ld)
+	if rejected > 0 {
+		mCtx, _ := tag.New(ctx, tag.Upsert(tagExporterKey, e.cfg.Name()))
+		stats.Record(mCtx, mEventsDropped.M(int64(rejected)))
+		e.logger.Warn("Dropping log records without a timestamp",
+			zap.Int("dropped", rejected))
+	}
+	if len(groups) == 0 {
+		return nil
+	}
+
+	var err error
+	if e.cfg.Logs.IngestFormat == ingestFormatUnstructured {
+		err = e.client.sendUnstructuredEvents(ctx, e.toUnstructuredEvents(groups))
+	} else {
+		evts, order := arrangeStructuredEvents(e.cfg, e.toStructuredEvents(groups))
+		recordPositions = reorderPositions(recordPositions, order)
+		transformEvents(e.cfg, evts)
+		applyRawStrings(evts, e.cfg.Logs.RawStringMode)
+		evts, recordPositions = e.limitEventSizes(ctx, evts, recordPositions)
+		if len(evts) == 0 {
+			return nil
+		}
+		err = e.client.sendStructuredEvents(ctx, evts)
+	}
+
+	// Only the log records rejected by Humio should be retried
+	var partial *partialFailureError
+	if errors.As(err, &partial) {
+		failed := make([]int, len(partial.failed))
+		for i, pos := range partial.failed {
+			failed[i] = recordPositions[pos]
+		}
+		return consumererror.NewLogs(err, filterLogs(ld, failed))
+	}
+	return err
+}
+
+// Keeps structured events within the max_event_size, where dropped events are
+// counted and reported, but not retried since they would never be accepted
+func (e *humioLogsExporter) limitEventSizes(ctx context.Context, evts []*HumioStructuredEvents, positions []int) ([]*HumioStructuredEvents, []int) {
+	if e.cfg.Logs.MaxEventSize == 0 {
+		return evts, positions
+	}
+
+	result := limitEventSizes(evts, positions, e.cfg.Logs.MaxEventSize, e.cfg.Logs.getOversizedEventStrategy())
+	if result.truncated > 0 {
+		e.logger.Debug("Truncated log records exceeding the max_event_size",
+			zap.Int("truncated", result.truncated))
+	}
+	if result.dropped > 0 {
+		mCtx, _ := tag.New(ctx, tag.Upsert(tagExporterKey, e.cfg.Name()))
+		stats.Record(mCtx, mEventsDropped.M(int64(result.dropped)))
+		e.logger.Warn("Dropping log records exceeding the max_event_size",
+			zap.Int("dropped", result.dropped),
+			zap.Int("max_event_size", e.cfg.Logs.MaxEventSize))
+	}
+	return result.groups, result.positions
+}
+
+// A log record along with the instrumentation library that produced it
+type logRef struct {
+	rec pdata.LogRecord
+	lib pdata.InstrumentationLibrary
+}
+
+// The log records from the same resource that should be handled by the same parser
+type logGroup struct {
+	res    pdata.Resource
+	parser string
+	logs   []logRef
+}
+
+// Groups log records by their resource and parser, where the groups of a
+// resource are kept in the order their parser is first encountered. Also
+// returns the position of each log record across all groups, since grouping
+// by parser may reorder the records, and the number of rejected records
+func (e *humioLogsExporter) groupLogs(ld pdata.Logs) ([]*logGroup, []int, int) {
+	var results []*logGroup
+	var recordPositions []int
+	pos := 0
+	rejected := 0
+
+	// Unstructured events do not carry a timestamp, so every record can be sent
+	reject := e.cfg.Logs.IngestFormat != ingestFormatUnstructured &&
+		e.cfg.Logs.getTimestampFallback() == timestampFallbackReject
+
+	resLogs := ld.ResourceLogs()
+	for i := 0; i < resLogs.Len(); i++ {
+		resLog := resLogs.At(i)
+		res := resLog.Resource()
+
+		var groups []*logGroup
+		byParser := make(map[string]*logGroup)
+		positions := make(map[string][]int)
+
+		instLogs := resLog.InstrumentationLibraryLogs()
+		for j := 0; j < instLogs.Len(); j++ {
+			lib := instLogs.At(j).InstrumentationLibrary()
+			logs := instLogs.At(j).Logs()
+			for k := 0; k < logs.Len(); k++ {
+				rec := logs.At(k)
+				if reject && rec.Timestamp() == 0 {
+					rejected++
+					pos++
+					continue
+				}
+				parser := e.resolveParser(rec, res)
+
+				group, ok := byParser[parser]
+				if !ok {
+					group = &logGroup{res: res, parser: parser}
+					byParser[parser] = group
+					groups = append(groups, group)
+				}
+
+				group.logs = append(group.logs, logRef{rec: rec, lib: lib})
+				positions[parser] = append(positions[parser], pos)
+				pos++
+			}
+		}
+
+		for _, group := range groups {
+			results = append(results, group)
+			recordPositions = append(recordPositions, positions[group.parser]...)
+		}
+	}
+
+	return results, recordPositions, rejected
+}
+
+// Converts grouped logs into structured Humio events, where each log record
+// becomes a single event. Events in the same group share the same set of tags
+func (e *humioLogsExporter) toStructuredEvents(groups []*logGroup) []*HumioStructuredEvents {
+	results := make([]*HumioStructuredEvents, len(groups))
+	for i, group := range groups {
+		evts := make([]*HumioStructuredEvent, len(group.logs))
+		for j, ref := range group.logs {
+			evts[j] = e.logRecordToHumioEvent(ref.rec, ref.lib, group.res)
+		}
+
+		results[i] = &HumioStructuredEvents{
+			Tags:         e.tags.limit(buildTags(e.cfg, config.LogsDataType, group.res, group.parser)),
+			Events:       evts,
+			routingValue: getRoutingValue(e.cfg, group.res),
+		}
+	}
+	return results
+}
+
+// Converts grouped logs into unstructured Humio events, where the body of each
+// log record becomes a message. Humio extracts fields from the messages using
+// the parser of the group, while the resource attributes are sent as fields
+func (e *humioLogsExporter) toUnstructuredEvents(groups []*logGroup) []*HumioUnstructuredEvents {
+	results := make([]*HumioUnstructuredEvents, len(groups))
+	for i, group := range groups {
+		msgs := make([]string, len(group.logs))
+		for j, ref := range group.logs {
+			msgs[j] = escapeBody(&e.cfg.Logs, bodyToMessage(ref.rec.Body()))
+		}
+
+		namespace := scopeNamespace(e.cfg, resourceNamespace)
+		fields := make(map[string]string, group.res.Attributes().Len())
+		group.res.Attributes().Range(func(k string, v pdata.AttributeValue) bool {
+			if !isDroppedResourceAttribute(e.cfg, k) {
+				fields[namespace+k] = tracetranslator.AttributeValueToString(v, false)
+			}
+			return true
+		})
+
+		results[i] = &HumioUnstructuredEvents{
+			Fields:       fields,
+			Tags:         e.tags.limit(buildTags(e.cfg, config.LogsDataType, group.res, "")),
+			Type:         group.parser,
+			Messages:     msgs,
+			routingValue: getRoutingValue(e.cfg, group.res),
+		}
+	}
+	return results
+}
+
+// Converts the body of a log record into an unstructured message, where bodies
+// other than strings are encoded as JSON
+func bodyToMessage(body pdata.AttributeValue) string {
+	if body.Type() == pdata.AttributeValueSTRING {
+		return body.StringVal()
+	}
+
+	// Values converted from attributes can always be encoded
+	b, _ := json.Marshal(attributeValueToInterface(body))
+	return string(b)
+}
+
+// Determine the parser for a log record, preferring the parser attribute of the
+// record over that of its resource, and falling back to the configured parser
+func (e *humioLogsExporter) resolveParser(rec pdata.LogRecord, res pdata.Resource) string {
+	if attr := e.cfg.Logs.LogParserAttribute; attr != "" {
+		for _, attrs := range []pdata.AttributeMap{rec.Attributes(), res.Attributes()} {
+			if v, ok := attrs.Get(attr); ok {
+				if parser := tracetranslator.AttributeValueToString(v, false); parser != "" {
+					return parser
+				}
+			}
+		}
+	}
+	return e.cfg.Logs.LogParser
+}
+
+// Get the timestamp of a log record, falling back to the current time for
+// records without one, which are only sent when not rejected up front
+func (e *humioLogsExporter) recordTimestamp(rec pdata.LogRecord) time.Time {
+	if rec.Timestamp() == 0 {
+		return e.now()
+	}
+	return rec.Timestamp().AsTime()
+}
+
+func (e *humioLogsExporter) logRecordToHumioEvent(rec pdata.LogRecord, lib pdata.InstrumentationLibrary, res pdata.Resource) *HumioStructuredEvent {
+	timestamp := e.recordTimestamp(rec)
+	attrs := attributeMapToMap(res.Attributes())
+	dropResourceAttributes(e.cfg, attrs)
+	stripAttributeKeyPrefixes(e.cfg, e.logger, attrs)
+	attrs = namespaceAttributes(e.cfg, attrs, resourceNamespace)
+	recAttrs := attributeMapToMap(rec.Attributes())
+	stripAttributeKeyPrefixes(e.cfg, e.logger, recAttrs)
+	recAttrs = namespaceAttributes(e.cfg, recAttrs, recordNamespace)
+	mergeAttributes(e.cfg, e.logger, attrs, recAttrs, recordScope)
+	limitAttributeValues(e.cfg, attrs)
+
+	if e.cfg.Logs.FlattenAttributes {
+		attrs = flattenAttributes(attrs, e.cfg.Logs.MaxFlattenDepth)
+	}
+	if e.promoted != nil {
+		attrs = e.nestAttributes(attrs)
+	}
+
+	addScopeFields(e.cfg, attrs, lib)
+	attrs[e.cfg.Logs.getBodyField()] = e.formatBody(rec.Body())
+	if rec.SeverityText() != "" {
+		attrs["severity_text"] = rec.SeverityText()
+	}
+	if rec.SeverityNumber() != pdata.SeverityNumberUNDEFINED {
+		attrs[severityNumberField] = int32(rec.SeverityNumber())
+		attrs[e.cfg.Logs.getSeverityField()] = normalizeSeverity(rec.SeverityNumber())
+	}
+	if rec.Name() != "" {
+		attrs[e.cfg.Logs.getEventNameField()] = rec.Name()
+	}
+	if e.cfg.Logs.TimestampField != "" {
+		attrs[e.cfg.Logs.TimestampField] = formatTimestampUnit(timestamp, e.cfg.Logs.getTimestampUnit())
+	}
+	addDroppedAttributesCount(attrs, rec.DroppedAttributesCount())
+
+	// Records without a trace context should not carry empty ids
+	if !rec.TraceID().IsEmpty() {
+		attrs[e.cfg.Logs.getTraceIDField()] = rec.TraceID().HexString()
+	}
+	if !rec.SpanID().IsEmpty() {
+		attrs[e.cfg.Logs.getSpanIDField()] = rec.SpanID().HexString()
+	}
+
+	addStaticFields(attrs, e.cfg.StaticFields)
+	if e.cfg.SanitizeFieldKeys {
+		attrs = sanitizeFieldKeys(attrs, e.cfg.getFieldKeyReplacement())
+	}
+	omitEmptyAttributes(e.cfg, attrs)
+	addIngestTimestamp(e.cfg, attrs, timestamp)
+
+	precision := timestampUnitPrecision(e.cfg.Logs.getTimestampUnit())
+	evt := &HumioStructuredEvent{
+		Timestamp:  timestamp,
+		AsUnix:     precision > 0,
+		Precision:  precision,
+		Attributes: attrs,
+	}
+	if usesRawString(e.cfg.Logs.RawStringMode) {
+		evt.RawString = escapeBody(&e.cfg.Logs, bodyToMessage(rec.Body()))
+	}
+	return evt
+}
+
+// Converts the body of a log record into its native representation. Map and
+// array bodies are encoded as a JSON string when a raw string body is configured
+func (e *humioLogsExporter) formatBody(body pdata.AttributeValue) interface{} {
+	if e.cfg.Logs.EscapeStructuredBodies && body.Type() == pdata.AttributeValueSTRING {
+		return escapeBody(&e.cfg.Logs, body.StringVal())
+	}
+
+	value := attributeValueToInterface(body)
+	if !e.cfg.Logs.RawStringBody {
+		return value
+	}
+
+	switch body.Type() {
+	case pdata.AttributeValueMAP, pdata.AttributeValueARRAY:
+		// Values converted from attributes can always be encoded
+		b, _ := json.Marshal(value)
+		return string(b)
+	default:
+		return value
+	}
+}
+
+// Escapes or replaces the newlines of a body, along with the other control
+// characters when configured, such that a multiline body becomes a single line.
+// A carriage return followed by a line feed counts as a single newline. When
+// anything is escaped, backslashes are escaped as well, such that an escaped
+// newline can be told apart from a literal \n in the body
+func escapeBody(cfg *LogsConfig, body string) string {
+	newlines := cfg.BodyNewlines
+	if (newlines == "" || newlines == bodyNewlinesKeep) && !cfg.EscapeControlCharacters {
+		return body
+	}
+	escaping := newlines == bodyNewlinesEscape || cfg.EscapeControlCharacters
+
+	var sb strings.Builder
+	sb.Grow(len(body))
+	for i := 0; i < len(body); i++ {
+		c := body[i]
+		switch {
+		case c == '\\' && escaping:
+			sb.WriteString(`\\`)
+		case (c == '\n' || c == '\r') && newlines == bodyNewlinesEscape:
+			if c == '\n' {
+				sb.WriteString(`\n`)
+			} else {
+				sb.WriteString(`\r`)
+			}
+		case (c == '\n' || c == '\r') && newlines == bodyNewlinesReplace:
+			if c == '\r' && i+1 < len(body) && body[i+1] == '\n' {
+				i++
+			}
+			sb.WriteString(cfg.BodyNewlineReplacement)
+		case c == '\n' || c == '\r':
+			sb.WriteByte(c)
+		case c == '\t' && cfg.EscapeControlCharacters:
+			sb.WriteString(`\t`)
+		case (c < 0x20 || c == 0x7f) && cfg.EscapeControlCharacters:
+			fmt.Fprintf(&sb, `\u%04x`, c)
+		default:
+			sb.WriteByte(c)
+		}
+	}
+	return sb.String()
+}
+
+// Maps a severity number onto its canonical short name, ignoring the finer
+// grained levels within each range, such that both INFO2 and INFO4 become INFO
+func normalizeSeverity(sev pdata.SeverityNumber) string {
+	switch {
+	case sev >= pdata.SeverityNumberFATAL:
+		return "FATAL"
+	case sev >= pdata.SeverityNumberERROR:
+		return "ERROR"
+	case sev >= pdata.SeverityNumberWARN:
+		return "WARN"
+	case sev >= pdata.SeverityNumberINFO:
+		return "INFO"
+	case sev >= pdata.SeverityNumberDEBUG:
+		return "DEBUG"
+	default:
+		return "TRACE"
+	}
+}
+
+// Creates a copy of the logs containing only the log records at the specified
+// positions, counted across all resources in the order they are exported
+func filterLogs(ld pdata.Logs, positions []int) pdata.Logs {
+	keep := make(map[int]bool, len(positions))
+	for _, pos := range positions {
+		keep[pos] = true
+	}
+
+	result := pdata.NewLogs()
+	pos := 0
+
+	resLogs := ld.ResourceLogs()
+	for i := 0; i < resLogs.Len(); i++ {
+		resLog := resLogs.At(i)
+		filteredRes := pdata.NewResourceLogs()
+		resLog.Resource().CopyTo(filteredRes.Resource())
+
+		instLogs := resLog.InstrumentationLibraryLogs()
+		for j := 0; j < instLogs.Len(); j++ {
+			instLog := instLogs.At(j)
+			filteredInst := pdata.NewInstrumentationLibraryLogs()
+			instLog.InstrumentationLibrary().CopyTo(filteredInst.InstrumentationLibrary())
+
+			logs := instLog.Logs()
+			for k := 0; k < logs.Len(); k++ {
+				if keep[pos] {
+					rec := pdata.NewLogRecord()
+					logs.At(k).CopyTo(rec)
+					filteredInst.Logs().Append(rec)
+				}
+				pos++
+			}
+
+			if filteredInst.Logs().Len() > 0 {
+				filteredRes.InstrumentationLibraryLogs().Append(filteredInst)
+			}
+		}
+
+		if filteredRes.InstrumentationLibraryLogs().Len() > 0 {
+			result.ResourceLogs().Append(filteredRes)
+		}
+	}
+
+	return result
+}
+
+// Start the client, and verify the endpoint before any data is exported, if configured
+func (e *humioLogsExporter) start(ctx context.Context, host component.Host) error {
+	if err := e.client.start(ctx); err != nil {
+		return err
+	}
+
+	if !e.cfg.CheckEndpointOnStart {
+		return nil
+	}
+	return e.client.checkEndpoint(ctx)
+}
+
+func (e *humioLogsExporter) shutdown(ctx context.Context) error {
+	e.inflight.wait()
+	return e.client.shutdown(ctx)
+}
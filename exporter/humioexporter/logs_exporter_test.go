@@ -0,0 +1,1853 @@
+// Copyright The OpenTelemetry Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package humioexporter
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opencensus.io/stats/view"
+	"go.opentelemetry.io/collector/config"
+	"go.opentelemetry.io/collector/consumer/consumererror"
+	"go.opentelemetry.io/collector/consumer/pdata"
+	"go.opentelemetry.io/collector/translator/conventions"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+func makeLogs(t time.Time) pdata.Logs {
+	ld := pdata.NewLogs()
+	ld.ResourceLogs().Resize(1)
+	rl := ld.ResourceLogs().At(0)
+	rl.Resource().Attributes().InsertString(conventions.AttributeServiceName, "myservice")
+	rl.Resource().Attributes().InsertString("shared", "resource")
+
+	rl.InstrumentationLibraryLogs().Resize(1)
+	logs := rl.InstrumentationLibraryLogs().At(0).Logs()
+	logs.Resize(2)
+
+	rec := logs.At(0)
+	rec.SetTimestamp(pdata.TimestampFromTime(t))
+	rec.Body().SetStringVal("hello world")
+	rec.SetSeverityText("INFO")
+	rec.SetSeverityNumber(pdata.SeverityNumberINFO2)
+	rec.Attributes().InsertString("shared", "record")
+	http := pdata.NewAttributeValueMap()
+	http.MapVal().InsertString("method", "GET")
+	rec.Attributes().Insert("http", http)
+
+	logs.At(1).SetTimestamp(pdata.TimestampFromTime(t))
+	logs.At(1).Body().SetStringVal("second")
+
+	return ld
+}
+
+func TestPushLogsData(t *testing.T) {
+	// Arrange
+	client := &mockClient{}
+	cfg := &Config{
+		ExporterSettings: config.NewExporterSettings(typeStr),
+		ServiceTagKey:    "service",
+		Logs: LogsConfig{
+			LogParser: "custom-parser",
+		},
+	}
+	exp := newLogsExporter(cfg, zap.NewNop(), client)
+	ts := time.Date(2021, 3, 28, 12, 30, 15, 0, time.UTC)
+
+	// Act
+	err := exp.pushLogsData(context.Background(), makeLogs(ts))
+
+	// Assert
+	require.NoError(t, err)
+	require.Len(t, client.structured, 1)
+	assert.Equal(t, map[string]string{
+		"service": "myservice",
+		"type":    "custom-parser",
+	}, client.structured[0].Tags)
+
+	evts := client.structured[0].Events
+	require.Len(t, evts, 2)
+	assert.Equal(t, ts, evts[0].Timestamp)
+	assert.Equal(t, map[string]interface{}{
+		conventions.AttributeServiceName: "myservice",
+		"shared":                         "record",
+		"http":                           map[string]interface{}{"method": "GET"},
+		"message":                        "hello world",
+		"severity_text":                  "INFO",
+		"severity_number":                int32(pdata.SeverityNumberINFO2),
+		"severity":                       "INFO",
+	}, evts[0].Attributes)
+	assert.NotContains(t, evts[1].Attributes, "severity_text")
+	assert.NotContains(t, evts[1].Attributes, "severity_number")
+	assert.NotContains(t, evts[1].Attributes, "severity")
+}
+
+func TestPushLogsDataFlattened(t *testing.T) {
+	// Arrange
+	client := &mockClient{}
+	cfg := &Config{
+		ExporterSettings: config.NewExporterSettings(typeStr),
+		ServiceTagKey:    "service",
+		Logs: LogsConfig{
+			FlattenAttributes: true,
+			MaxFlattenDepth:   defaultMaxFlattenDepth,
+		},
+	}
+	exp := newLogsExporter(cfg, zap.NewNop(), client)
+
+	// Act
+	err := exp.pushLogsData(context.Background(), makeLogs(time.Now()))
+
+	// Assert
+	require.NoError(t, err)
+	require.Len(t, client.structured, 1)
+	attrs := client.structured[0].Events[0].Attributes.(map[string]interface{})
+	assert.Equal(t, "GET", attrs["http.method"])
+	assert.NotContains(t, attrs, "http")
+}
+
+func TestPushLogsDataPromoteAttributes(t *testing.T) {
+	// Arrange
+	ts := time.Date(2021, 3, 28, 12, 30, 15, 0, time.UTC)
+	testCases := []struct {
+		desc     string
+		logs     LogsConfig
+		expected map[string]interface{}
+	}{
+		{
+			desc: "Promoted and nested attributes",
+			logs: LogsConfig{PromoteAttributes: []string{"http.status_code", "missing"}},
+			expected: map[string]interface{}{
+				"http.status_code": int64(200),
+				"attributes": map[string]interface{}{
+					conventions.AttributeServiceName: "myservice",
+					"shared":                         "record",
+					"http":                           map[string]interface{}{"method": "GET"},
+				},
+				"message":         "hello world",
+				"severity_text":   "INFO",
+				"severity_number": int32(pdata.SeverityNumberINFO2),
+				"severity":        "INFO",
+			},
+		},
+		{
+			desc: "Flattened attributes",
+			logs: LogsConfig{
+				FlattenAttributes: true,
+				MaxFlattenDepth:   defaultMaxFlattenDepth,
+				PromoteAttributes: []string{"http.method", conventions.AttributeServiceName},
+			},
+			expected: map[string]interface{}{
+				"http.method":                    "GET",
+				conventions.AttributeServiceName: "myservice",
+				"attributes": map[string]interface{}{
+					"shared":           "record",
+					"http.status_code": int64(200),
+				},
+				"message":         "hello world",
+				"severity_text":   "INFO",
+				"severity_number": int32(pdata.SeverityNumberINFO2),
+				"severity":        "INFO",
+			},
+		},
+		{
+			desc: "Every attribute nested",
+			logs: LogsConfig{PromoteAttributes: []string{"missing"}},
+			expected: map[string]interface{}{
+				"attributes": map[string]interface{}{
+					conventions.AttributeServiceName: "myservice",
+					"shared":                         "record",
+					"http":                           map[string]interface{}{"method": "GET"},
+					"http.status_code":               int64(200),
+				},
+				"message":         "hello world",
+				"severity_text":   "INFO",
+				"severity_number": int32(pdata.SeverityNumberINFO2),
+				"severity":        "INFO",
+			},
+		},
+	}
+
+	// Act / Assert
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			client := &mockClient{}
+			cfg := &Config{
+				ExporterSettings: config.NewExporterSettings(typeStr),
+				ServiceTagKey:    "service",
+				Logs:             tC.logs,
+			}
+			exp := newLogsExporter(cfg, zap.NewNop(), client)
+			ld := makeLogs(ts)
+			ld.ResourceLogs().At(0).InstrumentationLibraryLogs().At(0).Logs().At(0).Attributes().InsertInt("http.status_code", 200)
+
+			err := exp.pushLogsData(context.Background(), ld)
+
+			require.NoError(t, err)
+			require.Len(t, client.structured, 1)
+			assert.Equal(t, tC.expected, client.structured[0].Events[0].Attributes)
+		})
+	}
+}
+
+func TestPushLogsDataPromoteAttributesCollision(t *testing.T) {
+	// Arrange
+	client := &mockClient{}
+	cfg := &Config{
+		ExporterSettings: config.NewExporterSettings(typeStr),
+		ServiceTagKey:    "service",
+		Logs: LogsConfig{
+			SeverityField:     "level",
+			PromoteAttributes: []string{"message", "level", "attributes", "shared"},
+		},
+	}
+	core, logs := observer.New(zapcore.WarnLevel)
+	exp := newLogsExporter(cfg, zap.New(core), client)
+	ld := makeLogs(time.Now())
+	rec := ld.ResourceLogs().At(0).InstrumentationLibraryLogs().At(0).Logs().At(0)
+	rec.Attributes().InsertString("message", "attribute")
+	rec.Attributes().InsertString("level", "attribute")
+	rec.Attributes().InsertString("attributes", "attribute")
+
+	// Act
+	err := exp.pushLogsData(context.Background(), ld)
+	require.NoError(t, err)
+	err = exp.pushLogsData(context.Background(), ld)
+
+	// Assert
+	require.NoError(t, err)
+	require.Len(t, client.structured, 2)
+
+	attrs := client.structured[0].Events[0].Attributes.(map[string]interface{})
+	assert.Equal(t, "hello world", attrs["message"])
+	assert.Equal(t, "INFO", attrs["level"])
+	assert.Equal(t, "record", attrs["shared"])
+
+	// Colliding attributes are kept nested rather than overwriting the fields
+	nested := attrs["attributes"].(map[string]interface{})
+	assert.Equal(t, "attribute", nested["message"])
+	assert.Equal(t, "attribute", nested["level"])
+	assert.Equal(t, "attribute", nested["attributes"])
+	assert.NotContains(t, nested, "shared")
+
+	// Each collision is only logged once, regardless of the number of records
+	require.Equal(t, 3, logs.Len())
+	var collisions []string
+	for _, entry := range logs.All() {
+		collisions = append(collisions, entry.ContextMap()["attribute"].(string))
+	}
+	assert.ElementsMatch(t, []string{"message", "level", "attributes"}, collisions)
+}
+
+func TestPushLogsDataSanitizedKeys(t *testing.T) {
+	// Arrange
+	client := &mockClient{}
+	cfg := &Config{
+		ExporterSettings:  config.NewExporterSettings(typeStr),
+		ServiceTagKey:     "service",
+		SanitizeFieldKeys: true,
+	}
+	exp := newLogsExporter(cfg, zap.NewNop(), client)
+	ld := makeLogs(time.Now())
+	rec := ld.ResourceLogs().At(0).InstrumentationLibraryLogs().At(0).Logs().At(0)
+	rec.Attributes().InsertString("user name", "alice")
+
+	// Act
+	err := exp.pushLogsData(context.Background(), ld)
+
+	// Assert
+	require.NoError(t, err)
+	require.Len(t, client.structured, 1)
+	attrs := client.structured[0].Events[0].Attributes.(map[string]interface{})
+	assert.Equal(t, "alice", attrs["user_name"])
+	assert.NotContains(t, attrs, "user name")
+	assert.Equal(t, "hello world", attrs[defaultBodyField])
+}
+
+func TestPushLogsDataScope(t *testing.T) {
+	// Arrange
+	client := &mockClient{}
+	cfg := &Config{
+		ExporterSettings: config.NewExporterSettings(typeStr),
+		ServiceTagKey:    "service",
+		ScopeNameKey:     "library",
+	}
+	exp := newLogsExporter(cfg, zap.NewNop(), client)
+	ld := makeLogs(time.Now())
+	lib := ld.ResourceLogs().At(0).InstrumentationLibraryLogs().At(0).InstrumentationLibrary()
+	lib.SetName("io.opentelemetry.contrib.custom")
+	lib.SetVersion("1.2.0")
+
+	// Act
+	err := exp.pushLogsData(context.Background(), ld)
+
+	// Assert
+	require.NoError(t, err)
+	require.Len(t, client.structured, 1)
+	for _, evt := range client.structured[0].Events {
+		attrs := evt.Attributes.(map[string]interface{})
+		assert.Equal(t, "io.opentelemetry.contrib.custom", attrs["library"])
+		assert.Equal(t, "1.2.0", attrs["scope.version"])
+		assert.NotContains(t, attrs, "scope.name")
+	}
+}
+
+func TestPushLogsDataNamespaceByScope(t *testing.T) {
+	// Arrange
+	ts := time.Date(2021, 3, 28, 12, 30, 15, 0, time.UTC)
+	ld := makeLogs(ts)
+	lib := ld.ResourceLogs().At(0).InstrumentationLibraryLogs().At(0).InstrumentationLibrary()
+	lib.SetName("io.opentelemetry.contrib.custom")
+	lib.SetVersion("1.2.0")
+	rec := ld.ResourceLogs().At(0).InstrumentationLibraryLogs().At(0).Logs().At(0)
+	rec.Attributes().InsertString("scope.name", "record")
+
+	testCases := []struct {
+		desc     string
+		flatten  bool
+		expected map[string]interface{}
+	}{
+		{
+			desc: "Nested attributes",
+			expected: map[string]interface{}{
+				"resource.service.name": "myservice",
+				"resource.shared":       "resource",
+				"record.shared":         "record",
+				"record.http":           map[string]interface{}{"method": "GET"},
+				"record.scope.name":     "record",
+				"scope.name":            "io.opentelemetry.contrib.custom",
+				"scope.version":         "1.2.0",
+				"message":               "hello world",
+				"severity_text":         "INFO",
+				"severity_number":       int32(pdata.SeverityNumberINFO2),
+				"severity":              "INFO",
+			},
+		},
+		{
+			desc:    "Flattened attributes",
+			flatten: true,
+			expected: map[string]interface{}{
+				"resource.service.name": "myservice",
+				"resource.shared":       "resource",
+				"record.shared":         "record",
+				"record.http.method":    "GET",
+				"record.scope.name":     "record",
+				"scope.name":            "io.opentelemetry.contrib.custom",
+				"scope.version":         "1.2.0",
+				"message":               "hello world",
+				"severity_text":         "INFO",
+				"severity_number":       int32(pdata.SeverityNumberINFO2),
+				"severity":              "INFO",
+			},
+		},
+	}
+
+	// Act / Assert
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			client := &mockClient{}
+			cfg := &Config{
+				ExporterSettings: config.NewExporterSettings(typeStr),
+				ServiceTagKey:    "service",
+				NamespaceByScope: true,
+				Logs: LogsConfig{
+					FlattenAttributes: tC.flatten,
+					MaxFlattenDepth:   defaultMaxFlattenDepth,
+				},
+			}
+			exp := newLogsExporter(cfg, zap.NewNop(), client)
+
+			err := exp.pushLogsData(context.Background(), ld)
+
+			require.NoError(t, err)
+			require.Len(t, client.structured, 1)
+			assert.Equal(t, tC.expected, client.structured[0].Events[0].Attributes)
+		})
+	}
+}
+
+func TestPushLogsDataNamespaceByScopeUnstructured(t *testing.T) {
+	// Arrange
+	client := &mockClient{}
+	cfg := &Config{
+		ExporterSettings: config.NewExporterSettings(typeStr),
+		ServiceTagKey:    "service",
+		NamespaceByScope: true,
+		Logs: LogsConfig{
+			IngestFormat: ingestFormatUnstructured,
+		},
+	}
+	exp := newLogsExporter(cfg, zap.NewNop(), client)
+
+	// Act
+	err := exp.pushLogsData(context.Background(), makeLogs(time.Now()))
+
+	// Assert
+	require.NoError(t, err)
+	require.Len(t, client.unstructured, 1)
+	assert.Equal(t, map[string]string{
+		"resource.service.name": "myservice",
+		"resource.shared":       "resource",
+	}, client.unstructured[0].Fields)
+}
+
+func TestPushLogsDataDuplicateKeyStrategy(t *testing.T) {
+	// Arrange
+	testCases := []struct {
+		desc     string
+		strategy string
+		expected map[string]interface{}
+	}{
+		{
+			desc:     "Default",
+			expected: map[string]interface{}{"shared": "record"},
+		},
+		{
+			desc:     "Record wins",
+			strategy: duplicateKeyRecordWins,
+			expected: map[string]interface{}{"shared": "record"},
+		},
+		{
+			desc:     "Resource wins",
+			strategy: duplicateKeyResourceWins,
+			expected: map[string]interface{}{"shared": "resource"},
+		},
+		{
+			desc:     "Suffix",
+			strategy: duplicateKeySuffix,
+			expected: map[string]interface{}{
+				"shared.resource": "resource",
+				"shared.record":   "record",
+			},
+		},
+	}
+
+	// Act / Assert
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			core, logs := observer.New(zapcore.DebugLevel)
+			client := &mockClient{}
+			cfg := &Config{
+				ExporterSettings:     config.NewExporterSettings(typeStr),
+				ServiceTagKey:        "service",
+				DuplicateKeyStrategy: tC.strategy,
+			}
+			exp := newLogsExporter(cfg, zap.New(core), client)
+
+			err := exp.pushLogsData(context.Background(), makeLogs(time.Now()))
+
+			require.NoError(t, err)
+			require.Len(t, client.structured, 1)
+			attrs := client.structured[0].Events[0].Attributes.(map[string]interface{})
+			for _, k := range []string{"shared", "shared.resource", "shared.record"} {
+				if v, ok := tC.expected[k]; ok {
+					assert.Equal(t, v, attrs[k], k)
+				} else {
+					assert.NotContains(t, attrs, k)
+				}
+			}
+			assert.Equal(t, "myservice", attrs[conventions.AttributeServiceName])
+
+			// Only the first record has an attribute colliding with the resource
+			resolved := logs.FilterMessage("Resolved a duplicate attribute key").All()
+			require.Len(t, resolved, 1)
+			assert.Equal(t, "shared", resolved[0].ContextMap()["key"])
+			assert.Equal(t, recordScope, resolved[0].ContextMap()["scope"])
+
+			// The second record only has the resource attribute
+			assert.Equal(t, "resource", client.structured[0].Events[1].Attributes.(map[string]interface{})["shared"])
+		})
+	}
+}
+
+func TestPushLogsDataDroppedAttributesCount(t *testing.T) {
+	// Arrange
+	client := &mockClient{}
+	exp := newLogsExporter(&Config{ExporterSettings: config.NewExporterSettings(typeStr)}, zap.NewNop(), client)
+	ld := makeLogs(time.Now())
+	ld.ResourceLogs().At(0).InstrumentationLibraryLogs().At(0).Logs().At(0).SetDroppedAttributesCount(3)
+
+	// Act
+	err := exp.pushLogsData(context.Background(), ld)
+
+	// Assert
+	require.NoError(t, err)
+	require.Len(t, client.structured, 1)
+	evts := client.structured[0].Events
+	require.Len(t, evts, 2)
+	assert.Equal(t, uint32(3), evts[0].Attributes.(map[string]interface{})["dropped_attributes_count"])
+	assert.NotContains(t, evts[1].Attributes, "dropped_attributes_count")
+}
+
+func TestPushLogsDataStripAttributeKeyPrefix(t *testing.T) {
+	// Arrange
+	client := &mockClient{}
+	cfg := &Config{
+		ExporterSettings:          config.NewExporterSettings(typeStr),
+		ServiceTagKey:             "service",
+		TagFromResourceAttributes: []string{"com.ourcompany.team"},
+		StripAttributeKeyPrefix:   []string{"com.ourcompany."},
+	}
+	exp := newLogsExporter(cfg, zap.NewNop(), client)
+	ld := makeLogs(time.Now())
+	ld.ResourceLogs().At(0).Resource().Attributes().InsertString("com.ourcompany.team", "payments")
+	ld.ResourceLogs().At(0).InstrumentationLibraryLogs().At(0).Logs().At(0).Attributes().InsertString("com.ourcompany.shared", "stripped")
+
+	// Act
+	err := exp.pushLogsData(context.Background(), ld)
+
+	// Assert
+	require.NoError(t, err)
+	require.Len(t, client.structured, 1)
+	assert.Equal(t, "payments", client.structured[0].Tags["com.ourcompany.team"])
+
+	attrs := client.structured[0].Events[0].Attributes.(map[string]interface{})
+	assert.Equal(t, "payments", attrs["team"])
+	assert.NotContains(t, attrs, "com.ourcompany.team")
+
+	// The record already has a shared attribute, so the prefixed one is kept
+	assert.Equal(t, "record", attrs["shared"])
+	assert.Equal(t, "stripped", attrs["com.ourcompany.shared"])
+}
+
+func TestPushLogsDataTimestampField(t *testing.T) {
+	// Arrange
+	testCases := []struct {
+		desc  string
+		field string
+	}{
+		{
+			desc:  "Disabled by default",
+			field: "",
+		},
+		{
+			desc:  "Renamed field",
+			field: "@rawtimestamp",
+		},
+	}
+
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			client := &mockClient{}
+			cfg := &Config{
+				ExporterSettings: config.NewExporterSettings(typeStr),
+				Logs:             LogsConfig{TimestampField: tC.field},
+			}
+			exp := newLogsExporter(cfg, zap.NewNop(), client)
+			ts := time.Date(2021, 3, 28, 12, 30, 15, 0, time.UTC)
+
+			// Act
+			err := exp.pushLogsData(context.Background(), makeLogs(ts))
+
+			// Assert
+			require.NoError(t, err)
+			evt := client.structured[0].Events[0]
+			assert.Equal(t, ts, evt.Timestamp)
+
+			attrs := evt.Attributes.(map[string]interface{})
+			if tC.field == "" {
+				assert.NotContains(t, attrs, "@rawtimestamp")
+				return
+			}
+			assert.Equal(t, ts, attrs[tC.field])
+
+			// The field must be serialized in the same way as the native timestamp
+			b, err := json.Marshal(evt)
+			require.NoError(t, err)
+			assert.Contains(t, string(b), `"@rawtimestamp":"2021-03-28T12:30:15Z"`)
+			assert.Contains(t, string(b), `"timestamp":"2021-03-28T12:30:15Z"`)
+		})
+	}
+}
+
+func TestPushLogsDataTimestampUnit(t *testing.T) {
+	// Arrange
+	ts := time.Date(2021, 3, 28, 12, 30, 15, 123456789, time.UTC)
+	testCases := []struct {
+		desc     string
+		unit     string
+		expected string
+	}{
+		{desc: "Default", expected: `"2021-03-28T12:30:15.123456789Z"`},
+		{desc: "Seconds", unit: timestampUnitSeconds, expected: `1616934615`},
+		{desc: "Milliseconds", unit: timestampUnitMilliseconds, expected: `1616934615123`},
+		{desc: "Nanoseconds", unit: timestampUnitNanoseconds, expected: `1616934615123456789`},
+		{desc: "ISO 8601", unit: timestampUnitISO8601, expected: `"2021-03-28T12:30:15.123456789Z"`},
+	}
+
+	// Act / Assert
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			client := &mockClient{}
+			cfg := &Config{
+				ExporterSettings: config.NewExporterSettings(typeStr),
+				Logs:             LogsConfig{TimestampField: "event_time", TimestampUnit: tC.unit},
+			}
+			exp := newLogsExporter(cfg, zap.NewNop(), client)
+
+			err := exp.pushLogsData(context.Background(), makeLogs(ts))
+
+			require.NoError(t, err)
+			b, err := json.Marshal(client.structured[0].Events[0])
+			require.NoError(t, err)
+			var actual struct {
+				Timestamp  json.RawMessage `json:"timestamp"`
+				Attributes struct {
+					EventTime json.RawMessage `json:"event_time"`
+				} `json:"attributes"`
+			}
+			require.NoError(t, json.Unmarshal(b, &actual))
+			assert.Equal(t, tC.expected, string(actual.Timestamp))
+			assert.Equal(t, tC.expected, string(actual.Attributes.EventTime))
+		})
+	}
+}
+
+func TestPushLogsDataDeterministicOutput(t *testing.T) {
+	// Arrange
+	ts := time.Date(2021, 3, 28, 12, 30, 15, 0, time.UTC)
+	ld := makeLogs(ts)
+	attrs := ld.ResourceLogs().At(0).InstrumentationLibraryLogs().At(0).Logs().At(0).Attributes()
+	for i := 0; i < 50; i++ {
+		attrs.InsertInt("attr"+strconv.Itoa(i), int64(i))
+	}
+
+	marshal := func(encoding string) []byte {
+		client := &mockClient{}
+		cfg := &Config{
+			ExporterSettings: config.NewExporterSettings(typeStr),
+			ServiceTagKey:    "service",
+			IngestEncoding:   encoding,
+			Tags:             map[string]string{"a": "1", "b": "2", "c": "3"},
+		}
+		exp := newLogsExporter(cfg, zap.NewNop(), client)
+		require.NoError(t, exp.pushLogsData(context.Background(), ld))
+
+		humio := &humioClient{cfg: cfg}
+		b, err := humio.encodeBody(client.structured)
+		require.NoError(t, err)
+		return b
+	}
+
+	for _, encoding := range []string{ingestEncodingJSONArray, ingestEncodingNDJSON} {
+		// Act
+		first := marshal(encoding)
+		second := marshal(encoding)
+
+		// Assert
+		assert.Equal(t, string(first), string(second), encoding)
+	}
+}
+
+func TestPushLogsDataTimestampFallback(t *testing.T) {
+	// Arrange
+	ts := time.Date(2021, 3, 28, 12, 30, 15, 0, time.UTC)
+	now := time.Date(2021, 3, 29, 8, 0, 0, 0, time.UTC)
+
+	testCases := []struct {
+		desc       string
+		fallback   string
+		format     string
+		expected   []time.Time
+		wantDrop   float64
+		wantRecord []string
+	}{
+		{
+			desc:       "Current time by default",
+			expected:   []time.Time{ts, now},
+			wantRecord: []string{"hello world", "second"},
+		},
+		{
+			desc:       "Current time",
+			fallback:   "now",
+			expected:   []time.Time{ts, now},
+			wantRecord: []string{"hello world", "second"},
+		},
+		{
+			desc:       "Rejected",
+			fallback:   "reject",
+			expected:   []time.Time{ts},
+			wantDrop:   1,
+			wantRecord: []string{"hello world"},
+		},
+		{
+			desc:       "Rejected with unstructured logs",
+			fallback:   "reject",
+			format:     "unstructured",
+			wantRecord: []string{"hello world", "second"},
+		},
+	}
+
+	// Act / Assert
+	view.Register(MetricViews()...)
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			client := &mockClient{}
+			cfg := &Config{
+				ExporterSettings: config.NewExporterSettings(typeStr),
+				Logs: LogsConfig{
+					IngestFormat:      tC.format,
+					TimestampFallback: tC.fallback,
+					TimestampField:    "@rawtimestamp",
+				},
+			}
+			cfg.SetName("humio/timestamp_fallback/" + tC.desc)
+			exp := newLogsExporter(cfg, zap.NewNop(), client)
+			exp.now = func() time.Time { return now }
+
+			ld := makeLogs(ts)
+			ld.ResourceLogs().At(0).InstrumentationLibraryLogs().At(0).Logs().At(1).SetTimestamp(0)
+
+			err := exp.pushLogsData(context.Background(), ld)
+
+			require.NoError(t, err)
+			assert.Equal(t, tC.wantDrop, viewValue(t, "humio_events_dropped", cfg.Name()))
+			if tC.format == "unstructured" {
+				require.Len(t, client.unstructured, 1)
+				assert.Equal(t, tC.wantRecord, client.unstructured[0].Messages)
+				return
+			}
+
+			require.Len(t, client.structured, 1)
+			evts := client.structured[0].Events
+			require.Len(t, evts, len(tC.expected))
+			for i, evt := range evts {
+				attrs := evt.Attributes.(map[string]interface{})
+				assert.Equal(t, tC.expected[i], evt.Timestamp)
+				assert.Equal(t, tC.expected[i], attrs["@rawtimestamp"])
+				assert.Equal(t, tC.wantRecord[i], attrs["message"])
+			}
+		})
+	}
+}
+
+func TestPushLogsDataTimestampFallbackRejectAll(t *testing.T) {
+	// Arrange
+	client := &mockClient{}
+	cfg := &Config{
+		ExporterSettings: config.NewExporterSettings(typeStr),
+		Logs:             LogsConfig{TimestampFallback: "reject"},
+	}
+	exp := newLogsExporter(cfg, zap.NewNop(), client)
+
+	// Act
+	err := exp.pushLogsData(context.Background(), makeLogs(time.Unix(0, 0)))
+
+	// Assert
+	require.NoError(t, err)
+	assert.Empty(t, client.structured)
+}
+
+func TestPushLogsDataTimestampFallbackPartialFailure(t *testing.T) {
+	// Arrange
+	// The rejected record precedes the failed one, which must still be retried
+	client := &mockClient{err: &partialFailureError{err: errors.New("rejected"), failed: []int{0}}}
+	cfg := &Config{
+		ExporterSettings: config.NewExporterSettings(typeStr),
+		Logs:             LogsConfig{TimestampFallback: "reject"},
+	}
+	exp := newLogsExporter(cfg, zap.NewNop(), client)
+	ld := makeLogs(time.Now())
+	ld.ResourceLogs().At(0).InstrumentationLibraryLogs().At(0).Logs().At(0).SetTimestamp(0)
+
+	// Act
+	err := exp.pushLogsData(context.Background(), ld)
+
+	// Assert
+	var failed consumererror.Logs
+	require.True(t, consumererror.AsLogs(err, &failed))
+	logs := failed.GetLogs()
+	require.Equal(t, 1, logs.LogRecordCount())
+	assert.Equal(t, "second", logs.ResourceLogs().At(0).InstrumentationLibraryLogs().At(0).Logs().At(0).Body().StringVal())
+}
+
+func TestPushLogsDataRawString(t *testing.T) {
+	// Arrange
+	ts := time.Date(2021, 3, 28, 12, 30, 15, 0, time.UTC)
+	testCases := []struct {
+		desc     string
+		mode     string
+		expected []string
+	}{
+		{
+			desc: "Disabled",
+			mode: "none",
+			expected: []string{
+				`{"timestamp":1616934615000,"timezone":"UTC","attributes":{"message":"hello world"}}`,
+				`{"timestamp":1616934615000,"timezone":"UTC","attributes":{"level":"debug","message":"{\"k\":\"v\"}"}}`,
+			},
+		},
+		{
+			desc: "Rawstring only",
+			mode: "only",
+			expected: []string{
+				`{"timestamp":1616934615000,"timezone":"UTC","rawstring":"hello world"}`,
+				`{"timestamp":1616934615000,"timezone":"UTC","rawstring":"{\"k\":\"v\"}"}`,
+			},
+		},
+		{
+			desc: "Rawstring alongside attributes",
+			mode: "alongside",
+			expected: []string{
+				`{"timestamp":1616934615000,"timezone":"UTC","attributes":{"message":"hello world"},"rawstring":"hello world"}`,
+				`{"timestamp":1616934615000,"timezone":"UTC","attributes":{"level":"debug","message":"{\"k\":\"v\"}"},"rawstring":"{\"k\":\"v\"}"}`,
+			},
+		},
+	}
+
+	// Act / Assert
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			client := &mockClient{}
+			cfg := &Config{
+				ExporterSettings: config.NewExporterSettings(typeStr),
+				Logs: LogsConfig{
+					TimestampUnit: "milliseconds",
+					RawStringBody: true,
+					RawStringMode: tC.mode,
+				},
+			}
+			exp := newLogsExporter(cfg, zap.NewNop(), client)
+
+			ld := pdata.NewLogs()
+			ld.ResourceLogs().Resize(1)
+			ld.ResourceLogs().At(0).InstrumentationLibraryLogs().Resize(1)
+			logs := ld.ResourceLogs().At(0).InstrumentationLibraryLogs().At(0).Logs()
+			logs.Resize(2)
+			logs.At(0).SetTimestamp(pdata.TimestampFromTime(ts))
+			logs.At(0).Body().SetStringVal("hello world")
+			logs.At(1).SetTimestamp(pdata.TimestampFromTime(ts))
+			body := pdata.NewAttributeValueMap()
+			body.MapVal().InsertString("k", "v")
+			body.CopyTo(logs.At(1).Body())
+			logs.At(1).Attributes().InsertString("level", "debug")
+
+			err := exp.pushLogsData(context.Background(), ld)
+
+			require.NoError(t, err)
+			require.Len(t, client.structured, 1)
+			evts := client.structured[0].Events
+			require.Len(t, evts, len(tC.expected))
+			for i, evt := range evts {
+				b, err := json.Marshal(evt)
+				require.NoError(t, err)
+				assert.Equal(t, tC.expected[i], string(b))
+			}
+		})
+	}
+}
+
+func TestPushLogsDataMaxEventSize(t *testing.T) {
+	// Arrange
+	testCases := []struct {
+		desc       string
+		strategy   string
+		wantDrop   float64
+		wantRecord []string
+	}{
+		{
+			desc:       "Dropped by default",
+			wantDrop:   1,
+			wantRecord: []string{"second"},
+		},
+		{
+			desc:       "Dropped",
+			strategy:   "drop",
+			wantDrop:   1,
+			wantRecord: []string{"second"},
+		},
+		{
+			desc:       "Truncated",
+			strategy:   "truncate",
+			wantRecord: []string{"x", "second"},
+		},
+	}
+
+	// Act / Assert
+	view.Register(MetricViews()...)
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			core, logs := observer.New(zapcore.WarnLevel)
+			client := &mockClient{}
+			cfg := &Config{
+				ExporterSettings: config.NewExporterSettings(typeStr),
+				Logs: LogsConfig{
+					MaxEventSize:           300,
+					OversizedEventStrategy: tC.strategy,
+				},
+			}
+			cfg.SetName("humio/max_event_size/" + tC.desc)
+			exp := newLogsExporter(cfg, zap.New(core), client)
+
+			ld := makeLogs(time.Now())
+			ld.ResourceLogs().At(0).InstrumentationLibraryLogs().At(0).Logs().At(0).Body().SetStringVal(strings.Repeat("x", 1000))
+
+			err := exp.pushLogsData(context.Background(), ld)
+
+			require.NoError(t, err)
+			assert.Equal(t, tC.wantDrop, viewValue(t, "humio_events_dropped", cfg.Name()))
+			assert.Equal(t, int(tC.wantDrop), logs.FilterMessage("Dropping log records exceeding the max_event_size").Len())
+
+			require.Len(t, client.structured, 1)
+			evts := client.structured[0].Events
+			require.Len(t, evts, len(tC.wantRecord))
+			for i, evt := range evts {
+				b, err := json.Marshal(evt)
+				require.NoError(t, err)
+				assert.LessOrEqual(t, len(b), 300)
+				assert.True(t, strings.HasPrefix(evt.Attributes.(map[string]interface{})["message"].(string), tC.wantRecord[i]))
+			}
+			if tC.strategy == "truncate" {
+				assert.True(t, strings.HasSuffix(evts[0].Attributes.(map[string]interface{})["message"].(string), truncationMarker))
+			}
+		})
+	}
+}
+
+func TestPushLogsDataMaxEventSizePartialFailure(t *testing.T) {
+	// Arrange
+	// The dropped record precedes the failed one, which must still be retried
+	client := &mockClient{err: &partialFailureError{err: errors.New("rejected"), failed: []int{0}}}
+	cfg := &Config{
+		ExporterSettings: config.NewExporterSettings(typeStr),
+		Logs:             LogsConfig{MaxEventSize: 300},
+	}
+	exp := newLogsExporter(cfg, zap.NewNop(), client)
+	ld := makeLogs(time.Now())
+	ld.ResourceLogs().At(0).InstrumentationLibraryLogs().At(0).Logs().At(0).Body().SetStringVal(strings.Repeat("x", 1000))
+
+	// Act
+	err := exp.pushLogsData(context.Background(), ld)
+
+	// Assert
+	var failed consumererror.Logs
+	require.True(t, consumererror.AsLogs(err, &failed))
+	logs := failed.GetLogs()
+	require.Equal(t, 1, logs.LogRecordCount())
+	assert.Equal(t, "second", logs.ResourceLogs().At(0).InstrumentationLibraryLogs().At(0).Logs().At(0).Body().StringVal())
+}
+
+func TestPushLogsDataIngestTimestampFromEvent(t *testing.T) {
+	// Arrange
+	client := &mockClient{}
+	cfg := &Config{
+		ExporterSettings:         config.NewExporterSettings(typeStr),
+		IngestTimestampFromEvent: true,
+		SanitizeFieldKeys:        true,
+	}
+	exp := newLogsExporter(cfg, zap.NewNop(), client)
+	ts := time.Date(2015, 6, 1, 8, 0, 0, 0, time.UTC)
+
+	// Act
+	err := exp.pushLogsData(context.Background(), makeLogs(ts))
+
+	// Assert
+	require.NoError(t, err)
+	for _, evt := range client.structured[0].Events {
+		b, err := json.Marshal(evt)
+		require.NoError(t, err)
+		assert.Contains(t, string(b), `"timestamp":"2015-06-01T08:00:00Z"`)
+
+		// The reserved field name must not be sanitized
+		assert.Contains(t, string(b), `"@ingesttimestamp":1433145600000`)
+	}
+}
+
+func TestPushLogsDataOmitEmptyAttributes(t *testing.T) {
+	// Arrange
+	ts := time.Date(2015, 6, 1, 8, 0, 0, 0, time.UTC)
+	marshal := func(omit bool) string {
+		ld := makeLogs(ts)
+		rec := ld.ResourceLogs().At(0).InstrumentationLibraryLogs().At(0).Logs().At(1)
+		rec.Attributes().Insert("empty", pdata.NewAttributeValueMap())
+		rec.Attributes().Insert("list", pdata.NewAttributeValueArray())
+
+		client := &mockClient{}
+		cfg := &Config{
+			ExporterSettings:    config.NewExporterSettings(typeStr),
+			OmitEmptyAttributes: omit,
+		}
+		exp := newLogsExporter(cfg, zap.NewNop(), client)
+		require.NoError(t, exp.pushLogsData(context.Background(), ld))
+
+		b, err := json.Marshal(client.structured[0].Events[1])
+		require.NoError(t, err)
+		return string(b)
+	}
+
+	// Act
+	kept := marshal(false)
+	omitted := marshal(true)
+
+	// Assert
+	assert.Contains(t, kept, `"empty":{},"list":[],`)
+	assert.Equal(t, strings.Replace(kept, `"empty":{},"list":[],`, "", 1), omitted)
+	assert.Contains(t, omitted, `"timestamp":"2015-06-01T08:00:00Z"`)
+}
+
+func TestPushLogsDataTraceContext(t *testing.T) {
+	// Arrange
+	traceID := pdata.NewTraceID([16]byte{0x0a, 0x0b, 0x0c, 0x0d, 0x0e, 0x0f, 0x10, 0x11, 0x12, 0x13, 0x14, 0x15, 0x16, 0x17, 0x18, 0xff})
+	spanID := pdata.NewSpanID([8]byte{0xab, 0xcd, 0xef, 0x01, 0x02, 0x03, 0x04, 0x05})
+
+	testCases := []struct {
+		desc     string
+		logs     LogsConfig
+		traceID  pdata.TraceID
+		spanID   pdata.SpanID
+		expected map[string]interface{}
+	}{
+		{
+			desc:    "Default fields",
+			traceID: traceID,
+			spanID:  spanID,
+			expected: map[string]interface{}{
+				"trace_id": "0a0b0c0d0e0f101112131415161718ff",
+				"span_id":  "abcdef0102030405",
+			},
+		},
+		{
+			desc: "Renamed fields",
+			logs: LogsConfig{
+				TraceIDField: "traceId",
+				SpanIDField:  "spanId",
+			},
+			traceID: traceID,
+			spanID:  spanID,
+			expected: map[string]interface{}{
+				"traceId": "0a0b0c0d0e0f101112131415161718ff",
+				"spanId":  "abcdef0102030405",
+			},
+		},
+		{
+			desc:     "Only trace id",
+			traceID:  traceID,
+			spanID:   pdata.NewSpanID([8]byte{}),
+			expected: map[string]interface{}{"trace_id": "0a0b0c0d0e0f101112131415161718ff"},
+		},
+		{
+			desc:     "No trace context",
+			traceID:  pdata.NewTraceID([16]byte{}),
+			spanID:   pdata.NewSpanID([8]byte{}),
+			expected: map[string]interface{}{},
+		},
+	}
+
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			client := &mockClient{}
+			cfg := &Config{
+				ExporterSettings: config.NewExporterSettings(typeStr),
+				Logs:             tC.logs,
+			}
+			exp := newLogsExporter(cfg, zap.NewNop(), client)
+
+			ld := makeLogs(time.Now())
+			rec := ld.ResourceLogs().At(0).InstrumentationLibraryLogs().At(0).Logs().At(0)
+			rec.SetTraceID(tC.traceID)
+			rec.SetSpanID(tC.spanID)
+
+			// Act
+			err := exp.pushLogsData(context.Background(), ld)
+
+			// Assert
+			require.NoError(t, err)
+			attrs := client.structured[0].Events[0].Attributes.(map[string]interface{})
+			for _, field := range []string{"trace_id", "span_id", "traceId", "spanId"} {
+				if value, ok := tC.expected[field]; ok {
+					assert.Equal(t, value, attrs[field])
+				} else {
+					assert.NotContains(t, attrs, field)
+				}
+			}
+		})
+	}
+}
+
+func TestPushLogsDataDropResourceAttributes(t *testing.T) {
+	// Arrange
+	testCases := []struct {
+		desc   string
+		format string
+	}{
+		{
+			desc:   "Structured",
+			format: ingestFormatStructured,
+		},
+		{
+			desc:   "Unstructured",
+			format: ingestFormatUnstructured,
+		},
+	}
+
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			client := &mockClient{}
+			cfg := &Config{
+				ExporterSettings:          config.NewExporterSettings(typeStr),
+				ServiceTagKey:             "service",
+				TagFromResourceAttributes: []string{"cloud.region"},
+				DropResourceAttributes:    []string{"cloud.*", "shared"},
+				Logs: LogsConfig{
+					IngestFormat: tC.format,
+				},
+			}
+			exp := newLogsExporter(cfg, zap.NewNop(), client)
+			ld := makeLogs(time.Now())
+			res := ld.ResourceLogs().At(0).Resource()
+			res.Attributes().InsertString("cloud.region", "eu-west-1")
+			res.Attributes().InsertString("cloud.account.id", "1234")
+
+			// Act
+			err := exp.pushLogsData(context.Background(), ld)
+
+			// Assert
+			require.NoError(t, err)
+			expectedTags := map[string]string{
+				"service":      "myservice",
+				"cloud.region": "eu-west-1",
+			}
+
+			if tC.format == ingestFormatUnstructured {
+				require.Len(t, client.unstructured, 1)
+				assert.Equal(t, expectedTags, client.unstructured[0].Tags)
+				assert.Equal(t, map[string]string{conventions.AttributeServiceName: "myservice"}, client.unstructured[0].Fields)
+				return
+			}
+
+			require.Len(t, client.structured, 1)
+			assert.Equal(t, expectedTags, client.structured[0].Tags)
+			evts := client.structured[0].Events
+			first := evts[0].Attributes.(map[string]interface{})
+			assert.NotContains(t, first, "cloud.region")
+			assert.NotContains(t, first, "cloud.account.id")
+			assert.Equal(t, "myservice", first[conventions.AttributeServiceName])
+
+			// Attributes of the log record itself are never dropped
+			assert.Equal(t, "record", first["shared"])
+			assert.NotContains(t, evts[1].Attributes.(map[string]interface{}), "shared")
+		})
+	}
+}
+
+func TestPushLogsDataMaxTagCardinality(t *testing.T) {
+	// Arrange
+	client := &mockClient{}
+	cfg := &Config{
+		ExporterSettings:          config.NewExporterSettings(typeStr),
+		ServiceTagKey:             "service",
+		TagFromResourceAttributes: []string{"k8s.pod.name"},
+		MaxTagCardinality:         5,
+		TagCardinalityWindow:      time.Hour,
+	}
+	exp := newLogsExporter(cfg, zap.NewNop(), client)
+
+	ld := pdata.NewLogs()
+	ld.ResourceLogs().Resize(50)
+	for i := 0; i < 50; i++ {
+		rl := ld.ResourceLogs().At(i)
+		rl.Resource().Attributes().InsertString(conventions.AttributeServiceName, "myservice")
+		rl.Resource().Attributes().InsertString("k8s.pod.name", "pod-"+strconv.Itoa(i))
+		rl.InstrumentationLibraryLogs().Resize(1)
+		rl.InstrumentationLibraryLogs().At(0).Logs().Resize(2)
+	}
+
+	// Act
+	err := exp.pushLogsData(context.Background(), ld)
+
+	// Assert
+	require.NoError(t, err)
+
+	// Events beyond the limit are coalesced under the tags that remain
+	require.Len(t, client.structured, 6)
+	total := 0
+	for _, group := range client.structured {
+		total += len(group.Events)
+	}
+	assert.Equal(t, 100, total)
+	assert.Equal(t, map[string]string{"service": "myservice"}, client.structured[5].Tags)
+	assert.Len(t, client.structured[5].Events, 90)
+}
+
+func TestPushLogsDataStaticFields(t *testing.T) {
+	// Arrange
+	client := &mockClient{}
+	cfg := &Config{
+		ExporterSettings: config.NewExporterSettings(typeStr),
+		ServiceTagKey:    "service",
+		StaticFields: map[string]string{
+			"shared":  "static",
+			"version": "1.2.0",
+		},
+	}
+	exp := newLogsExporter(cfg, zap.NewNop(), client)
+
+	// Act
+	err := exp.pushLogsData(context.Background(), makeLogs(time.Now()))
+
+	// Assert
+	require.NoError(t, err)
+	require.Len(t, client.structured, 1)
+	evts := client.structured[0].Events
+	require.Len(t, evts, 2)
+	for _, evt := range evts {
+		assert.Equal(t, "1.2.0", evt.Attributes.(map[string]interface{})["version"])
+	}
+
+	// Attributes of the record and resource take precedence over static fields
+	assert.Equal(t, "record", evts[0].Attributes.(map[string]interface{})["shared"])
+	assert.Equal(t, "resource", evts[1].Attributes.(map[string]interface{})["shared"])
+}
+
+// Creates logs with a record per body, where records with a non-empty parser
+// have the parser attribute set
+func makeParserLogs(resParser string, parsers ...string) pdata.Logs {
+	ld := pdata.NewLogs()
+	ld.ResourceLogs().Resize(1)
+	rl := ld.ResourceLogs().At(0)
+	if resParser != "" {
+		rl.Resource().Attributes().InsertString("parser", resParser)
+	}
+
+	rl.InstrumentationLibraryLogs().Resize(1)
+	logs := rl.InstrumentationLibraryLogs().At(0).Logs()
+	logs.Resize(len(parsers))
+	for i, parser := range parsers {
+		logs.At(i).Body().SetStringVal(strconv.Itoa(i))
+		if parser != "" {
+			logs.At(i).Attributes().InsertString("parser", parser)
+		}
+	}
+
+	return ld
+}
+
+func TestPushLogsDataParserAttribute(t *testing.T) {
+	// Arrange
+	testCases := []struct {
+		desc      string
+		attribute string
+		ld        pdata.Logs
+		expected  map[string][]string
+	}{
+		{
+			desc:      "Record attribute overrides configured parser",
+			attribute: "parser",
+			ld:        makeParserLogs("", "json", "", "json"),
+			expected: map[string][]string{
+				"json":    {"0", "2"},
+				"default": {"1"},
+			},
+		},
+		{
+			desc:      "Record attribute overrides resource attribute",
+			attribute: "parser",
+			ld:        makeParserLogs("kv", "json", "", ""),
+			expected: map[string][]string{
+				"json": {"0"},
+				"kv":   {"1", "2"},
+			},
+		},
+		{
+			desc:      "Fallback without attribute",
+			attribute: "missing",
+			ld:        makeParserLogs("kv", "json", ""),
+			expected: map[string][]string{
+				"default": {"0", "1"},
+			},
+		},
+		{
+			desc:      "Attribute not configured",
+			attribute: "",
+			ld:        makeParserLogs("kv", "json", ""),
+			expected: map[string][]string{
+				"default": {"0", "1"},
+			},
+		},
+	}
+
+	// Act / Assert
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			client := &mockClient{}
+			cfg := &Config{
+				ExporterSettings: config.NewExporterSettings(typeStr),
+				Logs: LogsConfig{
+					LogParser:          "default",
+					LogParserAttribute: tC.attribute,
+				},
+			}
+			exp := newLogsExporter(cfg, zap.NewNop(), client)
+
+			err := exp.pushLogsData(context.Background(), tC.ld)
+
+			require.NoError(t, err)
+			actual := make(map[string][]string)
+			for _, group := range client.structured {
+				for _, evt := range group.Events {
+					parser := group.Tags[parserTagKey]
+					actual[parser] = append(actual[parser], evt.Attributes.(map[string]interface{})[defaultBodyField].(string))
+				}
+			}
+			assert.Equal(t, tC.expected, actual)
+		})
+	}
+}
+
+func TestPushLogsDataParserAttributePartialFailure(t *testing.T) {
+	// Arrange
+	client := &mockClient{err: &partialFailureError{err: errors.New("rejected"), failed: []int{1}}}
+	cfg := &Config{
+		ExporterSettings: config.NewExporterSettings(typeStr),
+		Logs: LogsConfig{
+			LogParserAttribute: "parser",
+		},
+	}
+	exp := newLogsExporter(cfg, zap.NewNop(), client)
+
+	// Act
+	err := exp.pushLogsData(context.Background(), makeParserLogs("", "json", "", "json"))
+
+	// Assert
+	var logsErr consumererror.Logs
+	require.True(t, consumererror.AsLogs(err, &logsErr))
+
+	// The second event in the payload belongs to the third log record
+	failed := logsErr.GetLogs()
+	require.Equal(t, 1, failed.LogRecordCount())
+	assert.Equal(t, "2", failed.ResourceLogs().At(0).InstrumentationLibraryLogs().At(0).Logs().At(0).Body().StringVal())
+}
+
+func TestPushLogsDataUnstructured(t *testing.T) {
+	// Arrange
+	client := &mockClient{}
+	cfg := &Config{
+		ExporterSettings: config.NewExporterSettings(typeStr),
+		ServiceTagKey:    "service",
+		Logs: LogsConfig{
+			LogParser:    "kv",
+			IngestFormat: ingestFormatUnstructured,
+		},
+	}
+	exp := newLogsExporter(cfg, zap.NewNop(), client)
+	ld := makeLogs(time.Now())
+	body := ld.ResourceLogs().At(0).InstrumentationLibraryLogs().At(0).Logs().At(1).Body()
+	pdata.NewAttributeValueMap().CopyTo(body)
+	body.MapVal().InsertString("key", "value")
+
+	// Act
+	err := exp.pushLogsData(context.Background(), ld)
+
+	// Assert
+	require.NoError(t, err)
+	assert.Empty(t, client.structured)
+	require.Len(t, client.unstructured, 1)
+
+	evts := client.unstructured[0]
+	assert.Equal(t, "kv", evts.Type)
+	assert.Equal(t, map[string]string{"service": "myservice"}, evts.Tags)
+	assert.Equal(t, map[string]string{
+		conventions.AttributeServiceName: "myservice",
+		"shared":                         "resource",
+	}, evts.Fields)
+	assert.Equal(t, []string{"hello world", `{"key":"value"}`}, evts.Messages)
+}
+
+func TestPushLogsDataUnstructuredBodyNewlines(t *testing.T) {
+	// Arrange
+	stackTrace := "java.lang.IllegalStateException: failed\r\n\tat com.example.Main.run(Main.java:12)\n\tat com.example.Main.main(Main.java:5)\x1b"
+	testCases := []struct {
+		desc     string
+		logs     LogsConfig
+		expected string
+	}{
+		{
+			desc:     "Kept by default",
+			expected: stackTrace,
+		},
+		{
+			desc:     "Escaped",
+			logs:     LogsConfig{BodyNewlines: bodyNewlinesEscape},
+			expected: `java.lang.IllegalStateException: failed\r\n` + "\t" + `at com.example.Main.run(Main.java:12)\n` + "\t" + `at com.example.Main.main(Main.java:5)` + "\x1b",
+		},
+		{
+			desc:     "Replaced",
+			logs:     LogsConfig{BodyNewlines: bodyNewlinesReplace, BodyNewlineReplacement: " | "},
+			expected: "java.lang.IllegalStateException: failed | \tat com.example.Main.run(Main.java:12) | \tat com.example.Main.main(Main.java:5)\x1b",
+		},
+		{
+			desc:     "Removed",
+			logs:     LogsConfig{BodyNewlines: bodyNewlinesReplace},
+			expected: "java.lang.IllegalStateException: failed\tat com.example.Main.run(Main.java:12)\tat com.example.Main.main(Main.java:5)\x1b",
+		},
+		{
+			desc:     "Escaped with control characters",
+			logs:     LogsConfig{BodyNewlines: bodyNewlinesEscape, EscapeControlCharacters: true},
+			expected: `java.lang.IllegalStateException: failed\r\n\tat com.example.Main.run(Main.java:12)\n\tat com.example.Main.main(Main.java:5)\u001b`,
+		},
+		{
+			desc:     "Control characters with newlines kept",
+			logs:     LogsConfig{EscapeControlCharacters: true},
+			expected: "java.lang.IllegalStateException: failed\r\n" + `\tat com.example.Main.run(Main.java:12)` + "\n" + `\tat com.example.Main.main(Main.java:5)\u001b`,
+		},
+	}
+
+	// Act / Assert
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			client := &mockClient{}
+			tC.logs.IngestFormat = ingestFormatUnstructured
+			cfg := &Config{ExporterSettings: config.NewExporterSettings(typeStr), Logs: tC.logs}
+			exp := newLogsExporter(cfg, zap.NewNop(), client)
+			ld := makeLogs(time.Now())
+			ld.ResourceLogs().At(0).InstrumentationLibraryLogs().At(0).Logs().At(0).Body().SetStringVal(stackTrace)
+
+			err := exp.pushLogsData(context.Background(), ld)
+
+			require.NoError(t, err)
+			require.Len(t, client.unstructured, 1)
+			assert.Equal(t, []string{tC.expected, "second"}, client.unstructured[0].Messages)
+		})
+	}
+}
+
+func TestPushLogsDataUnstructuredBodyBackslashes(t *testing.T) {
+	// Arrange
+	// A literal \n next to a real newline, which must remain distinguishable once escaped
+	body := `literal \n` + "\n" + `real`
+	testCases := []struct {
+		desc     string
+		logs     LogsConfig
+		expected string
+	}{
+		{
+			desc:     "Kept by default",
+			expected: body,
+		},
+		{
+			desc:     "Escaped newlines",
+			logs:     LogsConfig{BodyNewlines: bodyNewlinesEscape},
+			expected: `literal \\n\nreal`,
+		},
+		{
+			desc:     "Escaped control characters",
+			logs:     LogsConfig{EscapeControlCharacters: true},
+			expected: `literal \\n` + "\n" + `real`,
+		},
+		{
+			desc:     "Replaced newlines",
+			logs:     LogsConfig{BodyNewlines: bodyNewlinesReplace, BodyNewlineReplacement: " | "},
+			expected: `literal \n | real`,
+		},
+	}
+
+	// Act / Assert
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			client := &mockClient{}
+			tC.logs.IngestFormat = ingestFormatUnstructured
+			cfg := &Config{ExporterSettings: config.NewExporterSettings(typeStr), Logs: tC.logs}
+			exp := newLogsExporter(cfg, zap.NewNop(), client)
+			ld := makeLogs(time.Now())
+			ld.ResourceLogs().At(0).InstrumentationLibraryLogs().At(0).Logs().At(0).Body().SetStringVal(body)
+
+			err := exp.pushLogsData(context.Background(), ld)
+
+			require.NoError(t, err)
+			require.Len(t, client.unstructured, 1)
+			assert.Equal(t, tC.expected, client.unstructured[0].Messages[0])
+		})
+	}
+}
+
+func TestPushLogsDataStructuredBodyNewlines(t *testing.T) {
+	// Arrange
+	testCases := []struct {
+		desc     string
+		escape   bool
+		expected string
+	}{
+		{
+			desc:     "Unaffected by default",
+			expected: "line one\nline two",
+		},
+		{
+			desc:     "Opted in",
+			escape:   true,
+			expected: `line one\nline two`,
+		},
+	}
+
+	// Act / Assert
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			client := &mockClient{}
+			cfg := &Config{
+				ExporterSettings: config.NewExporterSettings(typeStr),
+				Logs: LogsConfig{
+					BodyNewlines:           bodyNewlinesEscape,
+					EscapeStructuredBodies: tC.escape,
+				},
+			}
+			exp := newLogsExporter(cfg, zap.NewNop(), client)
+			ld := makeLogs(time.Now())
+			ld.ResourceLogs().At(0).InstrumentationLibraryLogs().At(0).Logs().At(0).Body().SetStringVal("line one\nline two")
+
+			err := exp.pushLogsData(context.Background(), ld)
+
+			require.NoError(t, err)
+			require.Len(t, client.structured, 1)
+			assert.Equal(t, tC.expected, client.structured[0].Events[0].Attributes.(map[string]interface{})["message"])
+		})
+	}
+}
+
+func TestPushLogsDataUnstructuredPartialFailure(t *testing.T) {
+	// Arrange
+	client := &mockClient{err: &partialFailureError{err: errors.New("rejected"), failed: []int{0}}}
+	cfg := &Config{
+		ExporterSettings: config.NewExporterSettings(typeStr),
+		Logs: LogsConfig{
+			IngestFormat:       ingestFormatUnstructured,
+			LogParserAttribute: "parser",
+		},
+	}
+	exp := newLogsExporter(cfg, zap.NewNop(), client)
+
+	// Act
+	err := exp.pushLogsData(context.Background(), makeParserLogs("", "", "json"))
+
+	// Assert
+	var logsErr consumererror.Logs
+	require.True(t, consumererror.AsLogs(err, &logsErr))
+	require.Len(t, client.unstructured, 2)
+	assert.Equal(t, []string{"0"}, client.unstructured[0].Messages)
+	assert.Equal(t, "json", client.unstructured[1].Type)
+
+	failed := logsErr.GetLogs()
+	require.Equal(t, 1, failed.LogRecordCount())
+	assert.Equal(t, "0", failed.ResourceLogs().At(0).InstrumentationLibraryLogs().At(0).Logs().At(0).Body().StringVal())
+}
+
+func TestPushLogsDataCustomSeverityField(t *testing.T) {
+	// Arrange
+	client := &mockClient{}
+	cfg := &Config{
+		ExporterSettings: config.NewExporterSettings(typeStr),
+		ServiceTagKey:    "service",
+		Logs: LogsConfig{
+			SeverityField: "level",
+		},
+	}
+	exp := newLogsExporter(cfg, zap.NewNop(), client)
+
+	// Act
+	err := exp.pushLogsData(context.Background(), makeLogs(time.Now()))
+
+	// Assert
+	require.NoError(t, err)
+	require.Len(t, client.structured, 1)
+	attrs := client.structured[0].Events[0].Attributes.(map[string]interface{})
+	assert.Equal(t, "INFO", attrs["level"])
+	assert.NotContains(t, attrs, "severity")
+}
+
+func TestPushLogsDataEventName(t *testing.T) {
+	// Arrange
+	testCases := []struct {
+		desc     string
+		field    string
+		name     string
+		expected map[string]interface{}
+	}{
+		{
+			desc:     "Default field",
+			name:     "checkout.completed",
+			expected: map[string]interface{}{"event_name": "checkout.completed"},
+		},
+		{
+			desc:     "Custom field",
+			field:    "event",
+			name:     "checkout.completed",
+			expected: map[string]interface{}{"event": "checkout.completed"},
+		},
+		{
+			desc:     "Empty event name",
+			expected: map[string]interface{}{},
+		},
+	}
+
+	// Act / Assert
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			client := &mockClient{}
+			cfg := &Config{
+				ExporterSettings: config.NewExporterSettings(typeStr),
+				Logs:             LogsConfig{EventNameField: tC.field},
+			}
+			exp := newLogsExporter(cfg, zap.NewNop(), client)
+			ld := makeLogs(time.Now())
+			ld.ResourceLogs().At(0).InstrumentationLibraryLogs().At(0).Logs().At(0).SetName(tC.name)
+
+			err := exp.pushLogsData(context.Background(), ld)
+
+			require.NoError(t, err)
+			require.Len(t, client.structured, 1)
+			attrs := client.structured[0].Events[0].Attributes.(map[string]interface{})
+			actual := map[string]interface{}{}
+			for _, key := range []string{"event_name", "event"} {
+				if v, ok := attrs[key]; ok {
+					actual[key] = v
+				}
+			}
+			assert.Equal(t, tC.expected, actual)
+		})
+	}
+}
+
+func TestPushLogsDataBody(t *testing.T) {
+	// Arrange
+	mapBody := pdata.NewAttributeValueMap()
+	mapBody.MapVal().InsertString("method", "GET")
+	mapBody.MapVal().InsertInt("status", 200)
+
+	testCases := []struct {
+		desc     string
+		body     pdata.AttributeValue
+		raw      bool
+		expected interface{}
+	}{
+		{
+			desc:     "String body",
+			body:     pdata.NewAttributeValueString("hello"),
+			raw:      true,
+			expected: "hello",
+		},
+		{
+			desc:     "Int body",
+			body:     pdata.NewAttributeValueInt(42),
+			raw:      true,
+			expected: int64(42),
+		},
+		{
+			desc:     "Bool body",
+			body:     pdata.NewAttributeValueBool(true),
+			raw:      true,
+			expected: true,
+		},
+		{
+			desc:     "Nested map body",
+			body:     mapBody,
+			raw:      false,
+			expected: map[string]interface{}{"method": "GET", "status": int64(200)},
+		},
+		{
+			desc:     "Raw string map body",
+			body:     mapBody,
+			raw:      true,
+			expected: `{"method":"GET","status":200}`,
+		},
+	}
+
+	// Act / Assert
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			client := &mockClient{}
+			cfg := &Config{
+				ExporterSettings: config.NewExporterSettings(typeStr),
+				Logs: LogsConfig{
+					BodyField:     "rawstring",
+					RawStringBody: tC.raw,
+				},
+			}
+			exp := newLogsExporter(cfg, zap.NewNop(), client)
+
+			ld := makeLogs(time.Now())
+			tC.body.CopyTo(ld.ResourceLogs().At(0).InstrumentationLibraryLogs().At(0).Logs().At(0).Body())
+
+			require.NoError(t, exp.pushLogsData(context.Background(), ld))
+			attrs := client.structured[0].Events[0].Attributes.(map[string]interface{})
+
+			assert.Equal(t, tC.expected, attrs["rawstring"])
+			assert.NotContains(t, attrs, "message")
+		})
+	}
+}
+
+func TestNormalizeSeverity(t *testing.T) {
+	// Arrange
+	testCases := []struct {
+		severity pdata.SeverityNumber
+		expected string
+	}{
+		{pdata.SeverityNumberTRACE, "TRACE"},
+		{pdata.SeverityNumberTRACE4, "TRACE"},
+		{pdata.SeverityNumberDEBUG, "DEBUG"},
+		{pdata.SeverityNumberDEBUG3, "DEBUG"},
+		{pdata.SeverityNumberINFO, "INFO"},
+		{pdata.SeverityNumberINFO4, "INFO"},
+		{pdata.SeverityNumberWARN2, "WARN"},
+		{pdata.SeverityNumberERROR, "ERROR"},
+		{pdata.SeverityNumberERROR4, "ERROR"},
+		{pdata.SeverityNumberFATAL, "FATAL"},
+		{pdata.SeverityNumberFATAL4, "FATAL"},
+	}
+
+	// Act / Assert
+	for _, tC := range testCases {
+		t.Run(tC.expected+"/"+tC.severity.String(), func(t *testing.T) {
+			assert.Equal(t, tC.expected, normalizeSeverity(tC.severity))
+		})
+	}
+}
+
+func TestPushLogsDataEmpty(t *testing.T) {
+	// Arrange
+	client := &mockClient{}
+	exp := newLogsExporter(&Config{ExporterSettings: config.NewExporterSettings(typeStr)}, zap.NewNop(), client)
+
+	// Act
+	err := exp.pushLogsData(context.Background(), pdata.NewLogs())
+
+	// Assert
+	require.NoError(t, err)
+	assert.Empty(t, client.structured)
+}
+
+func TestPushLogsDataClientError(t *testing.T) {
+	// Arrange
+	client := &mockClient{err: errors.New("fail")}
+	exp := newLogsExporter(&Config{ExporterSettings: config.NewExporterSettings(typeStr)}, zap.NewNop(), client)
+
+	// Act
+	err := exp.pushLogsData(context.Background(), makeLogs(time.Now()))
+
+	// Assert
+	require.Error(t, err)
+}
+
+func TestPushLogsDataPartialFailure(t *testing.T) {
+	// Arrange
+	client := &mockClient{err: &partialFailureError{err: errors.New("rejected"), failed: []int{1}}}
+	exp := newLogsExporter(&Config{ExporterSettings: config.NewExporterSettings(typeStr)}, zap.NewNop(), client)
+
+	// Act
+	err := exp.pushLogsData(context.Background(), makeLogs(time.Now()))
+
+	// Assert
+	require.Error(t, err)
+	assert.False(t, consumererror.IsPermanent(err))
+	var logsErr consumererror.Logs
+	require.True(t, consumererror.AsLogs(err, &logsErr))
+
+	failed := logsErr.GetLogs()
+	require.Equal(t, 1, failed.LogRecordCount())
+	rl := failed.ResourceLogs().At(0)
+	service, _ := rl.Resource().Attributes().Get(conventions.AttributeServiceName)
+	assert.Equal(t, "myservice", service.StringVal())
+	assert.Equal(t, "second", rl.InstrumentationLibraryLogs().At(0).Logs().At(0).Body().StringVal())
+}
+
+func TestPushLogsDataSortEventsByTimestamp(t *testing.T) {
+	// Arrange
+	ts := time.Date(2021, 3, 28, 12, 30, 15, 0, time.UTC)
+	ld := makeLogs(ts.Add(time.Second))
+	ld.ResourceLogs().At(0).InstrumentationLibraryLogs().At(0).Logs().At(1).SetTimestamp(pdata.TimestampFromTime(ts))
+
+	testCases := []struct {
+		desc     string
+		sort     bool
+		expected []string
+	}{
+		{
+			desc:     "Original order",
+			sort:     false,
+			expected: []string{"hello world", "second"},
+		},
+		{
+			desc:     "Sorted by timestamp",
+			sort:     true,
+			expected: []string{"second", "hello world"},
+		},
+	}
+
+	// Act / Assert
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			client := &mockClient{}
+			cfg := &Config{
+				ExporterSettings:      config.NewExporterSettings(typeStr),
+				SortEventsByTimestamp: tC.sort,
+			}
+			exp := newLogsExporter(cfg, zap.NewNop(), client)
+
+			err := exp.pushLogsData(context.Background(), ld)
+
+			require.NoError(t, err)
+			require.Len(t, client.structured, 1)
+			var bodies []string
+			for _, evt := range client.structured[0].Events {
+				bodies = append(bodies, evt.Attributes.(map[string]interface{})["message"].(string))
+			}
+			assert.Equal(t, tC.expected, bodies)
+		})
+	}
+}
+
+func TestPushLogsDataSortedPartialFailure(t *testing.T) {
+	// Arrange
+	ts := time.Date(2021, 3, 28, 12, 30, 15, 0, time.UTC)
+	ld := makeLogs(ts.Add(time.Second))
+	ld.ResourceLogs().At(0).InstrumentationLibraryLogs().At(0).Logs().At(1).SetTimestamp(pdata.TimestampFromTime(ts))
+
+	client := &mockClient{err: &partialFailureError{err: errors.New("rejected"), failed: []int{0}}}
+	cfg := &Config{
+		ExporterSettings:      config.NewExporterSettings(typeStr),
+		SortEventsByTimestamp: true,
+	}
+	exp := newLogsExporter(cfg, zap.NewNop(), client)
+
+	// Act
+	err := exp.pushLogsData(context.Background(), ld)
+
+	// Assert
+	var logsErr consumererror.Logs
+	require.True(t, consumererror.AsLogs(err, &logsErr))
+	failed := logsErr.GetLogs()
+	require.Equal(t, 1, failed.LogRecordCount())
+	assert.Equal(t, "second", failed.ResourceLogs().At(0).InstrumentationLibraryLogs().At(0).Logs().At(0).Body().StringVal())
+}
+
+func TestLogsShutdown(t *testing.T) {
+	// Arrange
+	client := &mockClient{}
+	exp := newLogsExporter(&Config{ExporterSettings: config.NewExporterSettings(typeStr)}, zap.NewNop(), client)
+
+	// Act
+	err := exp.shutdown(context.Background())
+
+	// Assert
+	require.NoError(t, err)
+	assert.True(t, client.closed)
+}
@@ -0,0 +1,158 @@
+// Copyright The OpenTelemetry Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package humioexporter
+
+import (
+	"sync"
+
+	"go.opencensus.io/stats"
+	"go.opencensus.io/stats/view"
+	"go.opencensus.io/tag"
+)
+
+var (
+	tagExporterKey = tag.MustNewKey("exporter")
+	tagSuccessKey  = tag.MustNewKey("success")
+
+	// Tags describing failed attempts to send a request, to see which kinds of failures drive retries
+	tagDataTypeKey   = tag.MustNewKey("data_type")
+	tagStatusCodeKey = tag.MustNewKey("status_code")
+
+	mEventsSent        = stats.Int64("humio_events_sent", "Number of events accepted by Humio", stats.UnitDimensionless)
+	mEventsDropped     = stats.Int64("humio_events_dropped", "Number of events dropped without being accepted by Humio", stats.UnitDimensionless)
+	mBytesUncompressed = stats.Int64("humio_request_bytes_uncompressed", "Size of request bodies sent to Humio before compression", stats.UnitBytes)
+	mBytesCompressed   = stats.Int64("humio_request_bytes_compressed", "Size of request bodies sent to Humio after compression", stats.UnitBytes)
+	mRequestLatency    = stats.Int64("humio_request_latency", "Response latency in ms for requests to Humio", stats.UnitMilliseconds)
+	mRetries           = stats.Int64("humio_request_retries", "Number of failed requests to Humio which are eligible for retrying", stats.UnitDimensionless)
+	mQueueLength       = stats.Int64("humio_queue_length", "Number of requests waiting in the sending queue", stats.UnitDimensionless)
+	mQueueCapacity     = stats.Int64("humio_queue_capacity", "Maximum number of requests in the sending queue", stats.UnitDimensionless)
+	mQueueRejections   = stats.Int64("humio_queue_rejections", "Number of requests dropped since the sending queue was full", stats.UnitDimensionless)
+
+	mRetryBudgetExhausted = stats.Int64("humio_retry_budget_exhausted", "Number of events dropped since they could not be sent within the max total retry duration", stats.UnitDimensionless)
+	mFailedAttempts       = stats.Int64("humio_request_failed_attempts", "Number of attempts to send a request to Humio which failed with an unsuccessful status code", stats.UnitDimensionless)
+	mNetworkErrors        = stats.Int64("humio_request_network_errors", "Number of attempts to send a request to Humio which failed without receiving a response", stats.UnitDimensionless)
+)
+
+var (
+	registerViewsOnce sync.Once
+	registerViewsErr  error
+)
+
+// Registers the views for the internal telemetry of the exporter the first
+// time it is called, and returns the result of that registration thereafter
+func registerMetricViews() error {
+	registerViewsOnce.Do(func() {
+		registerViewsErr = view.Register(MetricViews()...)
+	})
+	return registerViewsErr
+}
+
+// MetricViews returns the views for the internal telemetry of the exporter.
+// The compression ratio can be derived from the two request size views
+func MetricViews() []*view.View {
+	return []*view.View{
+		{
+			Name:        mEventsSent.Name(),
+			Measure:     mEventsSent,
+			Description: mEventsSent.Description(),
+			Aggregation: view.Sum(),
+			TagKeys:     []tag.Key{tagExporterKey},
+		},
+		{
+			Name:        mEventsDropped.Name(),
+			Measure:     mEventsDropped,
+			Description: mEventsDropped.Description(),
+			Aggregation: view.Sum(),
+			TagKeys:     []tag.Key{tagExporterKey},
+		},
+		{
+			Name:        mBytesUncompressed.Name(),
+			Measure:     mBytesUncompressed,
+			Description: mBytesUncompressed.Description(),
+			Aggregation: view.Sum(),
+			TagKeys:     []tag.Key{tagExporterKey},
+		},
+		{
+			Name:        mBytesCompressed.Name(),
+			Measure:     mBytesCompressed,
+			Description: mBytesCompressed.Description(),
+			Aggregation: view.Sum(),
+			TagKeys:     []tag.Key{tagExporterKey},
+		},
+		{
+			Name:        mRequestLatency.Name(),
+			Measure:     mRequestLatency,
+			Description: mRequestLatency.Description(),
+			Aggregation: view.Distribution(0, 5, 10, 20, 50, 100, 200, 500, 1000, 2000, 5000),
+			TagKeys:     []tag.Key{tagExporterKey},
+		},
+		{
+			Name:        "humio_requests",
+			Measure:     mRequestLatency,
+			Description: "Number of successful and failed requests to Humio",
+			Aggregation: view.Count(),
+			TagKeys:     []tag.Key{tagExporterKey, tagSuccessKey},
+		},
+		{
+			Name:        mRetries.Name(),
+			Measure:     mRetries,
+			Description: mRetries.Description(),
+			Aggregation: view.Sum(),
+			TagKeys:     []tag.Key{tagExporterKey},
+		},
+		{
+			Name:        mQueueLength.Name(),
+			Measure:     mQueueLength,
+			Description: mQueueLength.Description(),
+			Aggregation: view.LastValue(),
+			TagKeys:     []tag.Key{tagExporterKey},
+		},
+		{
+			Name:        mQueueCapacity.Name(),
+			Measure:     mQueueCapacity,
+			Description: mQueueCapacity.Description(),
+			Aggregation: view.LastValue(),
+			TagKeys:     []tag.Key{tagExporterKey},
+		},
+		{
+			Name:        mQueueRejections.Name(),
+			Measure:     mQueueRejections,
+			Description: mQueueRejections.Description(),
+			Aggregation: view.Sum(),
+			TagKeys:     []tag.Key{tagExporterKey},
+		},
+		{
+			Name:        mRetryBudgetExhausted.Name(),
+			Measure:     mRetryBudgetExhausted,
+			Description: mRetryBudgetExhausted.Description(),
+			Aggregation: view.Sum(),
+			TagKeys:     []tag.Key{tagExporterKey},
+		},
+		{
+			Name:        mFailedAttempts.Name(),
+			Measure:     mFailedAttempts,
+			Description: mFailedAttempts.Description(),
+			Aggregation: view.Sum(),
+			TagKeys:     []tag.Key{tagExporterKey, tagDataTypeKey, tagStatusCodeKey},
+		},
+		{
+			Name:        mNetworkErrors.Name(),
+			Measure:     mNetworkErrors,
+			Description: mNetworkErrors.Description(),
+			Aggregation: view.Sum(),
+			TagKeys:     []tag.Key{tagExporterKey, tagDataTypeKey},
+		},
+	}
+}
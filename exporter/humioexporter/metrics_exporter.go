@@ -0,0 +1,506 @@
+// Copyright The OpenTelemetry Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package humioexporter
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"time"
+
+	"go.opentelemetry.io/collector/component"
+	"go.opentelemetry.io/collector/config"
+	"go.opentelemetry.io/collector/consumer/consumererror"
+	"go.opentelemetry.io/collector/consumer/pdata"
+	"go.uber.org/zap"
+)
+
+type humioMetricsExporter struct {
+	cfg    *Config
+	logger *zap.Logger
+	client exporterClient
+
+	// Requests that are currently being sent, which are drained on shutdown
+	inflight *inflightTracker
+	queue    *queueTracker
+
+	// Guards against creating too many distinct data sources in Humio
+	tags *tagCardinalityLimiter
+}
+
+func newMetricsExporter(cfg *Config, logger *zap.Logger, client exporterClient) *humioMetricsExporter {
+	return &humioMetricsExporter{
+		cfg:      cfg,
+		logger:   logger,
+		client:   client,
+		inflight: newInflightTracker(logger),
+		queue:    newQueueTracker(cfg),
+		tags:     newTagCardinalityLimiter(cfg.MaxTagCardinality, cfg.TagCardinalityWindow, logger),
+	}
+}
+
+func (e *humioMetricsExporter) pushMetricsData(ctx context.Context, md pdata.Metrics) error {
+	e.queue.dequeue(ctx)
+	ctx, finish := e.inflight.begin(ctx)
+
+	evts, pointPositions := e.metricsToHumioEvents(md)
+	if len(evts) == 0 {
+		finish(0, 0)
+		return nil
+	}
+
+	transformEvents(e.cfg, evts)
+	_, points := md.MetricAndDataPointCount()
+	err := e.client.sendStructuredEvents(ctx, evts)
+
+	// Only the data points behind the events rejected by Humio should be retried
+	var partial *partialFailureError
+	if errors.As(err, &partial) {
+		failed := make([]int, len(partial.failed))
+		for i, pos := range partial.failed {
+			failed[i] = pointPositions[pos]
+		}
+		failedMd := filterMetrics(md, failed)
+		_, dropped := failedMd.MetricAndDataPointCount()
+		finish(points-dropped, dropped)
+		return consumererror.NewMetrics(err, failedMd)
+	}
+
+	if err != nil {
+		finish(0, points)
+	} else {
+		finish(points, 0)
+	}
+	return err
+}
+
+// Converts metrics into structured Humio events, where each data point becomes
+// a single event. Events from resources with the same set of tags are grouped
+// together. The position of the originating data point is returned for each
+// event, in order
+func (e *humioMetricsExporter) metricsToHumioEvents(md pdata.Metrics) ([]*HumioStructuredEvents, []int) {
+	results := make([]*HumioStructuredEvents, 0, md.ResourceMetrics().Len())
+	var pointPositions []int
+	pos := 0
+
+	resMetrics := md.ResourceMetrics()
+	for i := 0; i < resMetrics.Len(); i++ {
+		resMetric := resMetrics.At(i)
+		evts := make([]*HumioStructuredEvent, 0)
+
+		instMetrics := resMetric.InstrumentationLibraryMetrics()
+		for j := 0; j < instMetrics.Len(); j++ {
+			metrics := instMetrics.At(j).Metrics()
+			for k := 0; k < metrics.Len(); k++ {
+				// Each data point of a supported metric becomes exactly one event
+				metricEvts := e.metricToHumioEvents(metrics.At(k), resMetric.Resource())
+				evts = append(evts, metricEvts...)
+				for range metricEvts {
+					pointPositions = append(pointPositions, pos)
+					pos++
+				}
+			}
+		}
+
+		if len(evts) == 0 {
+			continue
+		}
+
+		results = append(results, &HumioStructuredEvents{
+			Tags:         e.tags.limit(buildTags(e.cfg, config.MetricsDataType, resMetric.Resource(), e.cfg.Metrics.MetricParser)),
+			Events:       evts,
+			routingValue: getRoutingValue(e.cfg, resMetric.Resource()),
+		})
+	}
+
+	results, order := arrangeStructuredEvents(e.cfg, results)
+	return results, reorderPositions(pointPositions, order)
+}
+
+// Creates a copy of the metrics containing only the data points at the
+// specified positions, counted across all metrics in the order they are exported
+func filterMetrics(md pdata.Metrics, positions []int) pdata.Metrics {
+	keep := make(map[int]bool, len(positions))
+	for _, pos := range positions {
+		keep[pos] = true
+	}
+
+	result := pdata.NewMetrics()
+	pos := 0
+
+	resMetrics := md.ResourceMetrics()
+	for i := 0; i < resMetrics.Len(); i++ {
+		resMetric := resMetrics.At(i)
+		filteredRes := pdata.NewResourceMetrics()
+		resMetric.Resource().CopyTo(filteredRes.Resource())
+
+		instMetrics := resMetric.InstrumentationLibraryMetrics()
+		for j := 0; j < instMetrics.Len(); j++ {
+			instMetric := instMetrics.At(j)
+			filteredInst := pdata.NewInstrumentationLibraryMetrics()
+			instMetric.InstrumentationLibrary().CopyTo(filteredInst.InstrumentationLibrary())
+
+			metrics := instMetric.Metrics()
+			for k := 0; k < metrics.Len(); k++ {
+				if metric, ok := filterDataPoints(metrics.At(k), keep, &pos); ok {
+					filteredInst.Metrics().Append(metric)
+				}
+			}
+
+			if filteredInst.Metrics().Len() > 0 {
+				filteredRes.InstrumentationLibraryMetrics().Append(filteredInst)
+			}
+		}
+
+		if filteredRes.InstrumentationLibraryMetrics().Len() > 0 {
+			result.ResourceMetrics().Append(filteredRes)
+		}
+	}
+
+	return result
+}
+
+// Creates a copy of a metric containing only the data points to keep, along
+// with the properties of the metric itself. The position is advanced past every
+// data point of the metric, and the copy is only returned if any are kept
+func filterDataPoints(metric pdata.Metric, keep map[int]bool, pos *int) (pdata.Metric, bool) {
+	result := pdata.NewMetric()
+	result.SetName(metric.Name())
+	result.SetDescription(metric.Description())
+	result.SetUnit(metric.Unit())
+	result.SetDataType(metric.DataType())
+
+	kept := 0
+	next := func() bool {
+		k := keep[*pos]
+		*pos++
+		if k {
+			kept++
+		}
+		return k
+	}
+
+	switch metric.DataType() {
+	case pdata.MetricDataTypeIntGauge:
+		dps := metric.IntGauge().DataPoints()
+		for i := 0; i < dps.Len(); i++ {
+			if next() {
+				dp := pdata.NewIntDataPoint()
+				dps.At(i).CopyTo(dp)
+				result.IntGauge().DataPoints().Append(dp)
+			}
+		}
+
+	case pdata.MetricDataTypeDoubleGauge:
+		dps := metric.DoubleGauge().DataPoints()
+		for i := 0; i < dps.Len(); i++ {
+			if next() {
+				dp := pdata.NewDoubleDataPoint()
+				dps.At(i).CopyTo(dp)
+				result.DoubleGauge().DataPoints().Append(dp)
+			}
+		}
+
+	case pdata.MetricDataTypeIntSum:
+		sum := metric.IntSum()
+		result.IntSum().SetIsMonotonic(sum.IsMonotonic())
+		result.IntSum().SetAggregationTemporality(sum.AggregationTemporality())
+		dps := sum.DataPoints()
+		for i := 0; i < dps.Len(); i++ {
+			if next() {
+				dp := pdata.NewIntDataPoint()
+				dps.At(i).CopyTo(dp)
+				result.IntSum().DataPoints().Append(dp)
+			}
+		}
+
+	case pdata.MetricDataTypeDoubleSum:
+		sum := metric.DoubleSum()
+		result.DoubleSum().SetIsMonotonic(sum.IsMonotonic())
+		result.DoubleSum().SetAggregationTemporality(sum.AggregationTemporality())
+		dps := sum.DataPoints()
+		for i := 0; i < dps.Len(); i++ {
+			if next() {
+				dp := pdata.NewDoubleDataPoint()
+				dps.At(i).CopyTo(dp)
+				result.DoubleSum().DataPoints().Append(dp)
+			}
+		}
+
+	case pdata.MetricDataTypeIntHistogram:
+		hist := metric.IntHistogram()
+		result.IntHistogram().SetAggregationTemporality(hist.AggregationTemporality())
+		dps := hist.DataPoints()
+		for i := 0; i < dps.Len(); i++ {
+			if next() {
+				dp := pdata.NewIntHistogramDataPoint()
+				dps.At(i).CopyTo(dp)
+				result.IntHistogram().DataPoints().Append(dp)
+			}
+		}
+
+	case pdata.MetricDataTypeHistogram:
+		hist := metric.Histogram()
+		result.Histogram().SetAggregationTemporality(hist.AggregationTemporality())
+		dps := hist.DataPoints()
+		for i := 0; i < dps.Len(); i++ {
+			if next() {
+				dp := pdata.NewHistogramDataPoint()
+				dps.At(i).CopyTo(dp)
+				result.Histogram().DataPoints().Append(dp)
+			}
+		}
+
+	case pdata.MetricDataTypeSummary:
+		dps := metric.Summary().DataPoints()
+		for i := 0; i < dps.Len(); i++ {
+			if next() {
+				dp := pdata.NewSummaryDataPoint()
+				dps.At(i).CopyTo(dp)
+				result.Summary().DataPoints().Append(dp)
+			}
+		}
+	}
+
+	return result, kept > 0
+}
+
+// Converts each data point of a single metric into a structured Humio event
+func (e *humioMetricsExporter) metricToHumioEvents(metric pdata.Metric, res pdata.Resource) []*HumioStructuredEvent {
+	var evts []*HumioStructuredEvent
+
+	switch metric.DataType() {
+	case pdata.MetricDataTypeIntGauge:
+		dps := metric.IntGauge().DataPoints()
+		for i := 0; i < dps.Len(); i++ {
+			dp := dps.At(i)
+			attrs := e.newMetricAttributes(metric, res, "gauge", dp.LabelsMap())
+			attrs["value"] = dp.Value()
+			e.addExemplars(attrs, dp.Exemplars())
+			evts = append(evts, e.newMetricEvent(dp.Timestamp(), attrs))
+		}
+
+	case pdata.MetricDataTypeDoubleGauge:
+		dps := metric.DoubleGauge().DataPoints()
+		for i := 0; i < dps.Len(); i++ {
+			dp := dps.At(i)
+			attrs := e.newMetricAttributes(metric, res, "gauge", dp.LabelsMap())
+			attrs["value"] = dp.Value()
+			e.addExemplars(attrs, dp.Exemplars())
+			evts = append(evts, e.newMetricEvent(dp.Timestamp(), attrs))
+		}
+
+	case pdata.MetricDataTypeIntSum:
+		sum := metric.IntSum()
+		dps := sum.DataPoints()
+		for i := 0; i < dps.Len(); i++ {
+			dp := dps.At(i)
+			attrs := e.newMetricAttributes(metric, res, "sum", dp.LabelsMap())
+			attrs["value"] = dp.Value()
+			attrs["monotonic"] = sum.IsMonotonic()
+			attrs["temporality"] = sum.AggregationTemporality().String()
+			e.addExemplars(attrs, dp.Exemplars())
+			evts = append(evts, e.newMetricEvent(dp.Timestamp(), attrs))
+		}
+
+	case pdata.MetricDataTypeDoubleSum:
+		sum := metric.DoubleSum()
+		dps := sum.DataPoints()
+		for i := 0; i < dps.Len(); i++ {
+			dp := dps.At(i)
+			attrs := e.newMetricAttributes(metric, res, "sum", dp.LabelsMap())
+			attrs["value"] = dp.Value()
+			attrs["monotonic"] = sum.IsMonotonic()
+			attrs["temporality"] = sum.AggregationTemporality().String()
+			e.addExemplars(attrs, dp.Exemplars())
+			evts = append(evts, e.newMetricEvent(dp.Timestamp(), attrs))
+		}
+
+	case pdata.MetricDataTypeIntHistogram:
+		hist := metric.IntHistogram()
+		dps := hist.DataPoints()
+		for i := 0; i < dps.Len(); i++ {
+			dp := dps.At(i)
+			attrs := e.newMetricAttributes(metric, res, "histogram", dp.LabelsMap())
+			attrs["count"] = dp.Count()
+			attrs["sum"] = dp.Sum()
+			attrs["temporality"] = hist.AggregationTemporality().String()
+			addHistogramBuckets(attrs, dp.BucketCounts(), dp.ExplicitBounds())
+			e.addExemplars(attrs, dp.Exemplars())
+			evts = append(evts, e.newMetricEvent(dp.Timestamp(), attrs))
+		}
+
+	case pdata.MetricDataTypeHistogram:
+		hist := metric.Histogram()
+		dps := hist.DataPoints()
+		for i := 0; i < dps.Len(); i++ {
+			dp := dps.At(i)
+			attrs := e.newMetricAttributes(metric, res, "histogram", dp.LabelsMap())
+			attrs["count"] = dp.Count()
+			attrs["sum"] = dp.Sum()
+			attrs["temporality"] = hist.AggregationTemporality().String()
+			addHistogramBuckets(attrs, dp.BucketCounts(), dp.ExplicitBounds())
+			e.addExemplars(attrs, dp.Exemplars())
+			evts = append(evts, e.newMetricEvent(dp.Timestamp(), attrs))
+		}
+
+	case pdata.MetricDataTypeSummary:
+		dps := metric.Summary().DataPoints()
+		for i := 0; i < dps.Len(); i++ {
+			dp := dps.At(i)
+			attrs := e.newMetricAttributes(metric, res, "summary", dp.LabelsMap())
+			attrs["count"] = dp.Count()
+			attrs["sum"] = dp.Sum()
+			addSummaryQuantiles(attrs, dp.QuantileValues())
+			evts = append(evts, e.newMetricEvent(dp.Timestamp(), attrs))
+		}
+
+	default:
+		e.logger.Debug("Skipping metric with unsupported data type",
+			zap.String("name", metric.Name()),
+			zap.String("type", metric.DataType().String()))
+	}
+
+	return evts
+}
+
+// Creates the attributes common to all data points of a metric, which start
+// from the attributes of its resource in the same way as for logs and spans.
+// The fields describing the metric take precedence over resource attributes
+func (e *humioMetricsExporter) newMetricAttributes(metric pdata.Metric, res pdata.Resource, kind string, labels pdata.StringMap) map[string]interface{} {
+	attrs := attributeMapToMap(res.Attributes())
+	dropResourceAttributes(e.cfg, attrs)
+	stripAttributeKeyPrefixes(e.cfg, e.logger, attrs)
+	attrs = namespaceAttributes(e.cfg, attrs, resourceNamespace)
+	limitAttributeValues(e.cfg, attrs)
+
+	attrs["name"] = metric.Name()
+	attrs["kind"] = kind
+
+	if metric.Unit() != "" {
+		attrs["unit"] = metric.Unit()
+	}
+
+	if labels.Len() > 0 {
+		l := make(map[string]string, labels.Len())
+		labels.Range(func(k string, v string) bool {
+			l[k] = v
+			return true
+		})
+		limitLabelValues(e.cfg, l)
+		attrs["labels"] = l
+	}
+
+	return attrs
+}
+
+func (e *humioMetricsExporter) newMetricEvent(ts pdata.Timestamp, attrs map[string]interface{}) *HumioStructuredEvent {
+	addStaticFields(attrs, e.cfg.StaticFields)
+	if e.cfg.SanitizeFieldKeys {
+		attrs = sanitizeFieldKeys(attrs, e.cfg.getFieldKeyReplacement())
+	}
+	omitEmptyAttributes(e.cfg, attrs)
+	addIngestTimestamp(e.cfg, attrs, ts.AsTime())
+
+	return &HumioStructuredEvent{
+		Timestamp:  ts.AsTime(),
+		AsUnix:     e.cfg.Metrics.UnixTimestamps,
+		Attributes: attrs,
+	}
+}
+
+// Adds the exemplars of a data point as an array of objects, if configured. The
+// exemplars of data points with integer values are converted to the same form
+func (e *humioMetricsExporter) addExemplars(attrs map[string]interface{}, exemplars interface{}) {
+	if !e.cfg.Metrics.IncludeExemplars {
+		return
+	}
+
+	var result []map[string]interface{}
+	switch ex := exemplars.(type) {
+	case pdata.ExemplarSlice:
+		for i := 0; i < ex.Len(); i++ {
+			result = append(result, e.newExemplar(ex.At(i).Value(), ex.At(i).Timestamp(), ex.At(i).FilteredLabels()))
+		}
+	case pdata.IntExemplarSlice:
+		for i := 0; i < ex.Len(); i++ {
+			result = append(result, e.newExemplar(ex.At(i).Value(), ex.At(i).Timestamp(), ex.At(i).FilteredLabels()))
+		}
+	}
+
+	if len(result) > 0 {
+		attrs["exemplars"] = result
+	}
+}
+
+func (e *humioMetricsExporter) newExemplar(value interface{}, ts pdata.Timestamp, labels pdata.StringMap) map[string]interface{} {
+	exemplar := map[string]interface{}{
+		"value": value,
+	}
+	if e.cfg.Metrics.UnixTimestamps {
+		exemplar["timestamp"] = ts.AsTime().UnixNano() / int64(time.Millisecond)
+	} else {
+		exemplar["timestamp"] = ts.AsTime()
+	}
+
+	if labels.Len() > 0 {
+		l := make(map[string]string, labels.Len())
+		labels.Range(func(k string, v string) bool {
+			l[k] = v
+			return true
+		})
+		limitLabelValues(e.cfg, l)
+		exemplar["filtered_labels"] = l
+	}
+	return exemplar
+}
+
+// Flattens histogram buckets into numbered fields, such that bucket_i holds the
+// count for the bucket with upper bound bound_i. The final bucket is unbounded
+func addHistogramBuckets(attrs map[string]interface{}, counts []uint64, bounds []float64) {
+	for i, count := range counts {
+		attrs["bucket_"+strconv.Itoa(i)] = count
+	}
+
+	for i, bound := range bounds {
+		attrs["bound_"+strconv.Itoa(i)] = bound
+	}
+}
+
+// Flattens the quantiles of a summary into fields named after each quantile,
+// such that quantile_0.99 holds the value of the 99th percentile
+func addSummaryQuantiles(attrs map[string]interface{}, quantiles pdata.ValueAtQuantileSlice) {
+	for i := 0; i < quantiles.Len(); i++ {
+		q := quantiles.At(i)
+		attrs["quantile_"+strconv.FormatFloat(q.Quantile(), 'f', -1, 64)] = q.Value()
+	}
+}
+
+// Start the client, and verify the endpoint before any data is exported, if configured
+func (e *humioMetricsExporter) start(ctx context.Context, host component.Host) error {
+	if err := e.client.start(ctx); err != nil {
+		return err
+	}
+
+	if !e.cfg.CheckEndpointOnStart {
+		return nil
+	}
+	return e.client.checkEndpoint(ctx)
+}
+
+func (e *humioMetricsExporter) shutdown(ctx context.Context) error {
+	e.inflight.wait()
+	return e.client.shutdown(ctx)
+}
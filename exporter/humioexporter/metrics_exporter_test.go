@@ -0,0 +1,450 @@
+// Copyright The OpenTelemetry Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package humioexporter
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/collector/config"
+	"go.opentelemetry.io/collector/consumer/consumererror"
+	"go.opentelemetry.io/collector/consumer/pdata"
+	"go.opentelemetry.io/collector/translator/conventions"
+	"go.uber.org/zap"
+)
+
+func makeMetrics(t time.Time) pdata.Metrics {
+	md := pdata.NewMetrics()
+	md.ResourceMetrics().Resize(1)
+	rm := md.ResourceMetrics().At(0)
+	rm.Resource().Attributes().InsertString(conventions.AttributeServiceName, "myservice")
+
+	rm.InstrumentationLibraryMetrics().Resize(1)
+	metrics := rm.InstrumentationLibraryMetrics().At(0).Metrics()
+	metrics.Resize(3)
+
+	gauge := metrics.At(0)
+	gauge.SetName("gauge")
+	gauge.SetUnit("1")
+	gauge.SetDataType(pdata.MetricDataTypeDoubleGauge)
+	gauge.DoubleGauge().DataPoints().Resize(1)
+	gdp := gauge.DoubleGauge().DataPoints().At(0)
+	gdp.SetTimestamp(pdata.TimestampFromTime(t))
+	gdp.SetValue(1.5)
+	gdp.LabelsMap().Insert("label", "value")
+
+	sum := metrics.At(1)
+	sum.SetName("sum")
+	sum.SetDataType(pdata.MetricDataTypeIntSum)
+	sum.IntSum().SetIsMonotonic(true)
+	sum.IntSum().SetAggregationTemporality(pdata.AggregationTemporalityCumulative)
+	sum.IntSum().DataPoints().Resize(2)
+	sum.IntSum().DataPoints().At(0).SetTimestamp(pdata.TimestampFromTime(t))
+	sum.IntSum().DataPoints().At(0).SetValue(10)
+	sum.IntSum().DataPoints().At(1).SetTimestamp(pdata.TimestampFromTime(t))
+	sum.IntSum().DataPoints().At(1).SetValue(20)
+
+	hist := metrics.At(2)
+	hist.SetName("histogram")
+	hist.SetUnit("ms")
+	hist.SetDataType(pdata.MetricDataTypeHistogram)
+	hist.Histogram().SetAggregationTemporality(pdata.AggregationTemporalityDelta)
+	hist.Histogram().DataPoints().Resize(1)
+	hdp := hist.Histogram().DataPoints().At(0)
+	hdp.SetTimestamp(pdata.TimestampFromTime(t))
+	hdp.SetCount(6)
+	hdp.SetSum(42.5)
+	hdp.SetBucketCounts([]uint64{1, 2, 3})
+	hdp.SetExplicitBounds([]float64{5, 10})
+
+	return md
+}
+
+func TestPushMetricsData(t *testing.T) {
+	// Arrange
+	client := &mockClient{}
+	cfg := &Config{
+		ExporterSettings: config.NewExporterSettings(typeStr),
+		ServiceTagKey:    "service",
+		Metrics: MetricsConfig{
+			MetricParser:   "metrics-parser",
+			UnixTimestamps: true,
+		},
+	}
+	exp := newMetricsExporter(cfg, zap.NewNop(), client)
+	ts := time.Date(2021, 3, 28, 12, 30, 15, 0, time.UTC)
+
+	// Act
+	err := exp.pushMetricsData(context.Background(), makeMetrics(ts))
+
+	// Assert
+	require.NoError(t, err)
+	require.Len(t, client.structured, 1)
+	assert.Equal(t, map[string]string{
+		"service": "myservice",
+		"type":    "metrics-parser",
+	}, client.structured[0].Tags)
+
+	evts := client.structured[0].Events
+	require.Len(t, evts, 4)
+	for _, evt := range evts {
+		assert.Equal(t, ts, evt.Timestamp)
+		assert.True(t, evt.AsUnix)
+	}
+
+	assert.Equal(t, map[string]interface{}{
+		"service.name": "myservice",
+		"name":         "gauge",
+		"kind":         "gauge",
+		"unit":         "1",
+		"value":        1.5,
+		"labels":       map[string]string{"label": "value"},
+	}, evts[0].Attributes)
+
+	assert.Equal(t, map[string]interface{}{
+		"service.name": "myservice",
+		"name":         "sum",
+		"kind":         "sum",
+		"value":        int64(20),
+		"monotonic":    true,
+		"temporality":  "AGGREGATION_TEMPORALITY_CUMULATIVE",
+	}, evts[2].Attributes)
+
+	assert.Equal(t, map[string]interface{}{
+		"service.name": "myservice",
+		"name":         "histogram",
+		"kind":         "histogram",
+		"unit":         "ms",
+		"count":        uint64(6),
+		"sum":          42.5,
+		"temporality":  "AGGREGATION_TEMPORALITY_DELTA",
+		"bucket_0":     uint64(1),
+		"bucket_1":     uint64(2),
+		"bucket_2":     uint64(3),
+		"bound_0":      float64(5),
+		"bound_1":      float64(10),
+	}, evts[3].Attributes)
+}
+
+func TestPushMetricsDataResourceAttributes(t *testing.T) {
+	// Arrange
+	testCases := []struct {
+		desc     string
+		cfg      *Config
+		expected map[string]interface{}
+	}{
+		{
+			desc: "Metric fields take precedence",
+			cfg:  &Config{ExporterSettings: config.NewExporterSettings(typeStr)},
+			expected: map[string]interface{}{
+				"service.name": "myservice",
+				"host.name":    "web-1",
+				"name":         "gauge",
+			},
+		},
+		{
+			desc: "Dropped resource attributes",
+			cfg: &Config{
+				ExporterSettings:       config.NewExporterSettings(typeStr),
+				DropResourceAttributes: []string{"host.*"},
+			},
+			expected: map[string]interface{}{
+				"service.name": "myservice",
+				"name":         "gauge",
+			},
+		},
+		{
+			desc: "Namespaced by scope",
+			cfg: &Config{
+				ExporterSettings: config.NewExporterSettings(typeStr),
+				NamespaceByScope: true,
+			},
+			expected: map[string]interface{}{
+				"resource.service.name": "myservice",
+				"resource.host.name":    "web-1",
+				"resource.name":         "resource",
+				"name":                  "gauge",
+			},
+		},
+	}
+
+	// Act / Assert
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			client := &mockClient{}
+			exp := newMetricsExporter(tC.cfg, zap.NewNop(), client)
+			md := makeMetrics(time.Now())
+			res := md.ResourceMetrics().At(0).Resource()
+			res.Attributes().InsertString(conventions.AttributeHostName, "web-1")
+			res.Attributes().InsertString("name", "resource")
+
+			err := exp.pushMetricsData(context.Background(), md)
+
+			require.NoError(t, err)
+			attrs := client.structured[0].Events[0].Attributes.(map[string]interface{})
+			for _, k := range []string{"kind", "unit", "value", "labels"} {
+				delete(attrs, k)
+			}
+			assert.Equal(t, tC.expected, attrs)
+		})
+	}
+}
+
+func TestPushMetricsDataExemplars(t *testing.T) {
+	// Arrange
+	ts := time.Date(2021, 3, 28, 12, 30, 15, 0, time.UTC)
+	md := makeMetrics(ts)
+	metrics := md.ResourceMetrics().At(0).InstrumentationLibraryMetrics().At(0).Metrics()
+
+	histExemplars := metrics.At(2).Histogram().DataPoints().At(0).Exemplars()
+	histExemplars.Resize(2)
+	histExemplars.At(0).SetValue(7.5)
+	histExemplars.At(0).SetTimestamp(pdata.TimestampFromTime(ts))
+	histExemplars.At(0).FilteredLabels().Insert("user", "alice")
+	histExemplars.At(1).SetValue(12)
+	histExemplars.At(1).SetTimestamp(pdata.TimestampFromTime(ts.Add(time.Second)))
+
+	sumExemplars := metrics.At(1).IntSum().DataPoints().At(1).Exemplars()
+	sumExemplars.Resize(1)
+	sumExemplars.At(0).SetValue(3)
+	sumExemplars.At(0).SetTimestamp(pdata.TimestampFromTime(ts))
+
+	testCases := []struct {
+		desc    string
+		enabled bool
+		unix    bool
+	}{
+		{desc: "Disabled", enabled: false},
+		{desc: "ISO 8601 timestamps", enabled: true},
+		{desc: "Unix timestamps", enabled: true, unix: true},
+	}
+
+	// Act / Assert
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			client := &mockClient{}
+			cfg := &Config{
+				ExporterSettings: config.NewExporterSettings(typeStr),
+				Metrics: MetricsConfig{
+					UnixTimestamps:   tC.unix,
+					IncludeExemplars: tC.enabled,
+				},
+			}
+			exp := newMetricsExporter(cfg, zap.NewNop(), client)
+
+			err := exp.pushMetricsData(context.Background(), md)
+
+			require.NoError(t, err)
+			require.Len(t, client.structured, 1)
+			evts := client.structured[0].Events
+			require.Len(t, evts, 4)
+			assert.NotContains(t, evts[0].Attributes, "exemplars")
+			assert.NotContains(t, evts[1].Attributes, "exemplars")
+			if !tC.enabled {
+				assert.NotContains(t, evts[2].Attributes, "exemplars")
+				assert.NotContains(t, evts[3].Attributes, "exemplars")
+				return
+			}
+
+			timestamp := func(t time.Time) interface{} {
+				if tC.unix {
+					return t.UnixNano() / int64(time.Millisecond)
+				}
+				return t
+			}
+			assert.Equal(t, []map[string]interface{}{
+				{"value": int64(3), "timestamp": timestamp(ts)},
+			}, evts[2].Attributes.(map[string]interface{})["exemplars"])
+			assert.Equal(t, []map[string]interface{}{
+				{
+					"value":           7.5,
+					"timestamp":       timestamp(ts),
+					"filtered_labels": map[string]string{"user": "alice"},
+				},
+				{"value": float64(12), "timestamp": timestamp(ts.Add(time.Second))},
+			}, evts[3].Attributes.(map[string]interface{})["exemplars"])
+		})
+	}
+}
+
+func TestPushMetricsDataSummary(t *testing.T) {
+	// Arrange
+	client := &mockClient{}
+	exp := newMetricsExporter(&Config{ExporterSettings: config.NewExporterSettings(typeStr)}, zap.NewNop(), client)
+	ts := time.Date(2021, 3, 28, 12, 30, 15, 0, time.UTC)
+
+	md := pdata.NewMetrics()
+	md.ResourceMetrics().Resize(1)
+	md.ResourceMetrics().At(0).InstrumentationLibraryMetrics().Resize(1)
+	metrics := md.ResourceMetrics().At(0).InstrumentationLibraryMetrics().At(0).Metrics()
+	metrics.Resize(1)
+	summary := metrics.At(0)
+	summary.SetName("latency")
+	summary.SetUnit("ms")
+	summary.SetDataType(pdata.MetricDataTypeSummary)
+	summary.Summary().DataPoints().Resize(1)
+	dp := summary.Summary().DataPoints().At(0)
+	dp.SetTimestamp(pdata.TimestampFromTime(ts))
+	dp.SetCount(100)
+	dp.SetSum(2500)
+	dp.LabelsMap().Insert("route", "/checkout")
+	dp.QuantileValues().Resize(2)
+	dp.QuantileValues().At(0).SetQuantile(0.5)
+	dp.QuantileValues().At(0).SetValue(20)
+	dp.QuantileValues().At(1).SetQuantile(0.99)
+	dp.QuantileValues().At(1).SetValue(95.5)
+
+	// Act
+	err := exp.pushMetricsData(context.Background(), md)
+
+	// Assert
+	require.NoError(t, err)
+	require.Len(t, client.structured, 1)
+	evts := client.structured[0].Events
+	require.Len(t, evts, 1)
+	assert.Equal(t, ts, evts[0].Timestamp)
+	assert.Equal(t, map[string]interface{}{
+		"name":          "latency",
+		"kind":          "summary",
+		"unit":          "ms",
+		"labels":        map[string]string{"route": "/checkout"},
+		"count":         uint64(100),
+		"sum":           float64(2500),
+		"quantile_0.5":  float64(20),
+		"quantile_0.99": 95.5,
+	}, evts[0].Attributes)
+}
+
+func TestPushMetricsDataEmpty(t *testing.T) {
+	// Arrange
+	client := &mockClient{}
+	exp := newMetricsExporter(&Config{ExporterSettings: config.NewExporterSettings(typeStr)}, zap.NewNop(), client)
+
+	// Act
+	err := exp.pushMetricsData(context.Background(), pdata.NewMetrics())
+
+	// Assert
+	require.NoError(t, err)
+	assert.Empty(t, client.structured)
+}
+
+func TestPushMetricsDataClientError(t *testing.T) {
+	// Arrange
+	client := &mockClient{err: errors.New("fail")}
+	exp := newMetricsExporter(&Config{ExporterSettings: config.NewExporterSettings(typeStr)}, zap.NewNop(), client)
+
+	// Act
+	err := exp.pushMetricsData(context.Background(), makeMetrics(time.Now()))
+
+	// Assert
+	require.Error(t, err)
+}
+
+func TestPushMetricsDataPartialFailure(t *testing.T) {
+	// Arrange
+	client := &mockClient{err: &partialFailureError{err: errors.New("rejected"), failed: []int{2}}}
+	exp := newMetricsExporter(&Config{ExporterSettings: config.NewExporterSettings(typeStr)}, zap.NewNop(), client)
+
+	// Act
+	err := exp.pushMetricsData(context.Background(), makeMetrics(time.Now()))
+
+	// Assert
+	require.Error(t, err)
+	var metricsErr consumererror.Metrics
+	require.True(t, consumererror.AsMetrics(err, &metricsErr))
+
+	// Rejecting a single data point must retry only that data point
+	failed := metricsErr.GetMetrics()
+	metrics, points := failed.MetricAndDataPointCount()
+	require.Equal(t, 1, metrics)
+	assert.Equal(t, 1, points)
+
+	rm := failed.ResourceMetrics().At(0)
+	service, _ := rm.Resource().Attributes().Get(conventions.AttributeServiceName)
+	assert.Equal(t, "myservice", service.StringVal())
+
+	sum := rm.InstrumentationLibraryMetrics().At(0).Metrics().At(0)
+	assert.Equal(t, "sum", sum.Name())
+	require.Equal(t, pdata.MetricDataTypeIntSum, sum.DataType())
+	assert.True(t, sum.IntSum().IsMonotonic())
+	assert.Equal(t, pdata.AggregationTemporalityCumulative, sum.IntSum().AggregationTemporality())
+	assert.Equal(t, int64(20), sum.IntSum().DataPoints().At(0).Value())
+}
+
+func TestPushMetricsDataPartialFailureGauge(t *testing.T) {
+	// Arrange
+	client := &mockClient{err: &partialFailureError{err: errors.New("rejected"), failed: []int{1}}}
+	exp := newMetricsExporter(&Config{ExporterSettings: config.NewExporterSettings(typeStr)}, zap.NewNop(), client)
+	md := makeMetrics(time.Now())
+	metrics := md.ResourceMetrics().At(0).InstrumentationLibraryMetrics().At(0).Metrics()
+	metrics.Resize(1)
+	dps := metrics.At(0).DoubleGauge().DataPoints()
+	dps.Resize(2)
+	dps.At(1).SetTimestamp(dps.At(0).Timestamp())
+	dps.At(1).SetValue(2.5)
+
+	// Act
+	err := exp.pushMetricsData(context.Background(), md)
+
+	// Assert
+	var metricsErr consumererror.Metrics
+	require.True(t, consumererror.AsMetrics(err, &metricsErr))
+
+	// The data point which was accepted must not be sent again
+	failed := metricsErr.GetMetrics()
+	_, points := failed.MetricAndDataPointCount()
+	require.Equal(t, 1, points)
+
+	gauge := failed.ResourceMetrics().At(0).InstrumentationLibraryMetrics().At(0).Metrics().At(0)
+	assert.Equal(t, "gauge", gauge.Name())
+	assert.Equal(t, "1", gauge.Unit())
+	require.Equal(t, pdata.MetricDataTypeDoubleGauge, gauge.DataType())
+	assert.Equal(t, 2.5, gauge.DoubleGauge().DataPoints().At(0).Value())
+}
+
+func TestMetricsStart(t *testing.T) {
+	// Arrange
+	client := &mockClient{checkErr: errors.New("rejected")}
+	cfg := &Config{
+		ExporterSettings:     config.NewExporterSettings(typeStr),
+		CheckEndpointOnStart: true,
+	}
+	exp := newMetricsExporter(cfg, zap.NewNop(), client)
+
+	// Act
+	err := exp.start(context.Background(), nil)
+
+	// Assert
+	require.Error(t, err)
+	assert.True(t, client.started)
+	assert.True(t, client.checked)
+}
+
+func TestMetricsShutdown(t *testing.T) {
+	// Arrange
+	client := &mockClient{}
+	exp := newMetricsExporter(&Config{ExporterSettings: config.NewExporterSettings(typeStr)}, zap.NewNop(), client)
+
+	// Act
+	err := exp.shutdown(context.Background())
+
+	// Assert
+	require.NoError(t, err)
+	assert.True(t, client.closed)
+}
@@ -0,0 +1,59 @@
+// Copyright The OpenTelemetry Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package humioexporter
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opencensus.io/stats/view"
+)
+
+func TestMetricViews(t *testing.T) {
+	expectedViewNames := []string{
+		"humio_events_sent",
+		"humio_events_dropped",
+		"humio_request_bytes_uncompressed",
+		"humio_request_bytes_compressed",
+		"humio_request_latency",
+		"humio_requests",
+		"humio_request_retries",
+		"humio_queue_length",
+		"humio_queue_capacity",
+		"humio_queue_rejections",
+		"humio_retry_budget_exhausted",
+		"humio_request_failed_attempts",
+		"humio_request_network_errors",
+	}
+
+	views := MetricViews()
+	for i, viewName := range expectedViewNames {
+		assert.Equal(t, viewName, views[i].Name)
+	}
+}
+
+func TestRegisterMetricViews(t *testing.T) {
+	// Act
+	first := registerMetricViews()
+	second := registerMetricViews()
+
+	// Assert
+	require.NoError(t, first)
+	require.NoError(t, second)
+	for _, v := range MetricViews() {
+		assert.NotNil(t, view.Find(v.Name), v.Name)
+	}
+}
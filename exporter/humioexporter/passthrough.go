@@ -0,0 +1,145 @@
+// Copyright The OpenTelemetry Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package humioexporter
+
+import (
+	"context"
+	"errors"
+
+	"go.opentelemetry.io/collector/config"
+	"go.opentelemetry.io/collector/consumer/consumererror"
+	"go.opentelemetry.io/collector/consumer/pdata"
+	collectorlogs "go.opentelemetry.io/proto/otlp/collector/logs/v1"
+	collectortrace "go.opentelemetry.io/proto/otlp/collector/trace/v1"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+)
+
+// Sends the log records of each resource unchanged as a single OTLP JSON
+// message to the unstructured API, such that they are parsed by the
+// passthrough_parser. Only the resources of rejected messages are retried
+func (e *humioLogsExporter) sendPassthroughLogs(ctx context.Context, ld pdata.Logs) error {
+	resLogs := ld.ResourceLogs()
+	evts := make([]*HumioUnstructuredEvents, 0, resLogs.Len())
+	var resPositions []int
+
+	for i := 0; i < resLogs.Len(); i++ {
+		single := pdata.NewLogs()
+		single.ResourceLogs().Resize(1)
+		resLogs.At(i).CopyTo(single.ResourceLogs().At(0))
+		if single.LogRecordCount() == 0 {
+			continue
+		}
+
+		b, err := single.ToOtlpProtoBytes()
+		if err != nil {
+			return consumererror.Permanent(err)
+		}
+		msg, err := otlpProtoToJSON(b, &collectorlogs.ExportLogsServiceRequest{})
+		if err != nil {
+			return consumererror.Permanent(err)
+		}
+
+		res := resLogs.At(i).Resource()
+		evts = append(evts, newPassthroughEvents(e.cfg, e.tags, config.LogsDataType, res, e.cfg.Logs.PassthroughParser, msg))
+		resPositions = append(resPositions, i)
+	}
+
+	if len(evts) == 0 {
+		return nil
+	}
+	err := e.client.sendUnstructuredEvents(ctx, evts)
+
+	var partial *partialFailureError
+	if errors.As(err, &partial) {
+		failed := pdata.NewLogs()
+		failed.ResourceLogs().Resize(len(partial.failed))
+		for i, pos := range partial.failed {
+			resLogs.At(resPositions[pos]).CopyTo(failed.ResourceLogs().At(i))
+		}
+		return consumererror.NewLogs(err, failed)
+	}
+	return err
+}
+
+// Sends the spans of each resource unchanged as a single OTLP JSON message to
+// the unstructured API, such that they are parsed by the passthrough_parser.
+// Only the resources of rejected messages are retried
+func (e *humioTracesExporter) sendPassthroughTraces(ctx context.Context, td pdata.Traces) error {
+	resSpans := td.ResourceSpans()
+	evts := make([]*HumioUnstructuredEvents, 0, resSpans.Len())
+	var resPositions []int
+
+	for i := 0; i < resSpans.Len(); i++ {
+		single := pdata.NewTraces()
+		single.ResourceSpans().Resize(1)
+		resSpans.At(i).CopyTo(single.ResourceSpans().At(0))
+		if single.SpanCount() == 0 {
+			continue
+		}
+
+		b, err := single.ToOtlpProtoBytes()
+		if err != nil {
+			return consumererror.Permanent(err)
+		}
+		msg, err := otlpProtoToJSON(b, &collectortrace.ExportTraceServiceRequest{})
+		if err != nil {
+			return consumererror.Permanent(err)
+		}
+
+		res := resSpans.At(i).Resource()
+		evts = append(evts, newPassthroughEvents(e.cfg, e.tags, config.TracesDataType, res, e.cfg.Traces.PassthroughParser, msg))
+		resPositions = append(resPositions, i)
+	}
+
+	if len(evts) == 0 {
+		return nil
+	}
+	err := e.client.sendUnstructuredEvents(ctx, evts)
+
+	var partial *partialFailureError
+	if errors.As(err, &partial) {
+		failed := pdata.NewTraces()
+		failed.ResourceSpans().Resize(len(partial.failed))
+		for i, pos := range partial.failed {
+			resSpans.At(resPositions[pos]).CopyTo(failed.ResourceSpans().At(i))
+		}
+		return consumererror.NewTraces(err, failed)
+	}
+	return err
+}
+
+// Creates the unstructured events holding the OTLP JSON message of a single
+// resource, tagged in the same way as any other events of the resource
+func newPassthroughEvents(cfg *Config, tags *tagCardinalityLimiter, dataType config.DataType, res pdata.Resource, parser string, msg string) *HumioUnstructuredEvents {
+	return &HumioUnstructuredEvents{
+		Tags:         tags.limit(buildTags(cfg, dataType, res, "")),
+		Type:         parser,
+		Messages:     []string{msg},
+		routingValue: getRoutingValue(cfg, res),
+	}
+}
+
+// Re-encodes the OTLP protobuf encoding of an export request as OTLP JSON
+func otlpProtoToJSON(b []byte, req proto.Message) (string, error) {
+	if err := proto.Unmarshal(b, req); err != nil {
+		return "", err
+	}
+	out, err := protojson.Marshal(req)
+	if err != nil {
+		return "", err
+	}
+	return string(out), nil
+}
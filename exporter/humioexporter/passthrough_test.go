@@ -0,0 +1,173 @@
+// Copyright The OpenTelemetry Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package humioexporter
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/collector/config"
+	"go.opentelemetry.io/collector/consumer/consumererror"
+	"go.opentelemetry.io/collector/consumer/pdata"
+	"go.opentelemetry.io/collector/translator/conventions"
+	collectorlogs "go.opentelemetry.io/proto/otlp/collector/logs/v1"
+	collectortrace "go.opentelemetry.io/proto/otlp/collector/trace/v1"
+	"go.uber.org/zap"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+)
+
+// Creates logs with a second resource, which holds a copy of the log records of the first
+func makePassthroughLogs(t time.Time) pdata.Logs {
+	ld := makeLogs(t)
+	ld.ResourceLogs().Resize(2)
+	ld.ResourceLogs().At(0).CopyTo(ld.ResourceLogs().At(1))
+	ld.ResourceLogs().At(1).Resource().Attributes().UpsertString(conventions.AttributeServiceName, "otherservice")
+	return ld
+}
+
+// Decodes an OTLP JSON message back into logs, to compare it with the logs it was created from
+func passthroughMessageToLogs(t *testing.T, msg string) pdata.Logs {
+	var req collectorlogs.ExportLogsServiceRequest
+	require.NoError(t, protojson.Unmarshal([]byte(msg), &req))
+	b, err := proto.Marshal(&req)
+	require.NoError(t, err)
+	ld, err := pdata.LogsFromOtlpProtoBytes(b)
+	require.NoError(t, err)
+	return ld
+}
+
+func passthroughMessageToTraces(t *testing.T, msg string) pdata.Traces {
+	var req collectortrace.ExportTraceServiceRequest
+	require.NoError(t, protojson.Unmarshal([]byte(msg), &req))
+	b, err := proto.Marshal(&req)
+	require.NoError(t, err)
+	td, err := pdata.TracesFromOtlpProtoBytes(b)
+	require.NoError(t, err)
+	return td
+}
+
+func TestPushLogsDataPassthrough(t *testing.T) {
+	// Arrange
+	client := &mockClient{}
+	cfg := &Config{
+		ExporterSettings: config.NewExporterSettings(typeStr),
+		ServiceTagKey:    "service",
+		Logs: LogsConfig{
+			PassthroughOTLPJSON: true,
+			PassthroughParser:   "otlp-json",
+		},
+	}
+	exp := newLogsExporter(cfg, zap.NewNop(), client)
+	ld := makePassthroughLogs(time.Now())
+
+	// Act
+	err := exp.pushLogsData(context.Background(), ld)
+
+	// Assert
+	require.NoError(t, err)
+	assert.Empty(t, client.structured)
+	require.Len(t, client.unstructured, 2)
+
+	for i, evts := range client.unstructured {
+		assert.Equal(t, "otlp-json", evts.Type)
+		require.Len(t, evts.Messages, 1)
+		assert.Contains(t, evts.Messages[0], `"resourceLogs"`)
+
+		expected := pdata.NewLogs()
+		expected.ResourceLogs().Resize(1)
+		ld.ResourceLogs().At(i).CopyTo(expected.ResourceLogs().At(0))
+		assert.Equal(t, expected, passthroughMessageToLogs(t, evts.Messages[0]))
+	}
+	assert.Equal(t, "myservice", client.unstructured[0].Tags["service"])
+	assert.Equal(t, "otherservice", client.unstructured[1].Tags["service"])
+}
+
+func TestPushLogsDataPassthroughPartialFailure(t *testing.T) {
+	// Arrange
+	client := &mockClient{err: &partialFailureError{err: errors.New("rejected"), failed: []int{1}}}
+	cfg := &Config{
+		ExporterSettings: config.NewExporterSettings(typeStr),
+		Logs: LogsConfig{
+			PassthroughOTLPJSON: true,
+			PassthroughParser:   "otlp-json",
+		},
+	}
+	exp := newLogsExporter(cfg, zap.NewNop(), client)
+
+	// Act
+	err := exp.pushLogsData(context.Background(), makePassthroughLogs(time.Now()))
+
+	// Assert
+	var logsErr consumererror.Logs
+	require.True(t, consumererror.AsLogs(err, &logsErr))
+
+	// Rejecting a message must retry only the resource it holds
+	failed := logsErr.GetLogs()
+	require.Equal(t, 1, failed.ResourceLogs().Len())
+	assert.Equal(t, 2, failed.LogRecordCount())
+	service, _ := failed.ResourceLogs().At(0).Resource().Attributes().Get(conventions.AttributeServiceName)
+	assert.Equal(t, "otherservice", service.StringVal())
+}
+
+func TestPushTraceDataPassthrough(t *testing.T) {
+	// Arrange
+	client := &mockClient{}
+	cfg := &Config{
+		ExporterSettings: config.NewExporterSettings(typeStr),
+		Traces: TracesConfig{
+			PassthroughOTLPJSON: true,
+			PassthroughParser:   "otlp-json",
+		},
+	}
+	exp := newTracesExporter(cfg, zap.NewNop(), client)
+	td := makeTraces(time.Now())
+
+	// Act
+	err := exp.pushTraceData(context.Background(), td)
+
+	// Assert
+	require.NoError(t, err)
+	assert.Empty(t, client.structured)
+	require.Len(t, client.unstructured, 1)
+	assert.Equal(t, "otlp-json", client.unstructured[0].Type)
+	require.Len(t, client.unstructured[0].Messages, 1)
+	assert.Contains(t, client.unstructured[0].Messages[0], `"resourceSpans"`)
+	assert.Equal(t, td, passthroughMessageToTraces(t, client.unstructured[0].Messages[0]))
+}
+
+func TestPushTraceDataPassthroughEmpty(t *testing.T) {
+	// Arrange
+	client := &mockClient{}
+	cfg := &Config{
+		ExporterSettings: config.NewExporterSettings(typeStr),
+		Traces: TracesConfig{
+			PassthroughOTLPJSON: true,
+			PassthroughParser:   "otlp-json",
+		},
+	}
+	exp := newTracesExporter(cfg, zap.NewNop(), client)
+
+	// Act
+	err := exp.pushTraceData(context.Background(), pdata.NewTraces())
+
+	// Assert
+	require.NoError(t, err)
+	assert.Empty(t, client.unstructured)
+}
@@ -0,0 +1,146 @@
+// Copyright The OpenTelemetry Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package humioexporter
+
+import (
+	"context"
+	"sync/atomic"
+
+	"go.opencensus.io/stats"
+	"go.opencensus.io/tag"
+	"go.opentelemetry.io/collector/component"
+	"go.opentelemetry.io/collector/consumer/pdata"
+)
+
+// Keeps track of the requests waiting in the sending queue of the exporter
+// helper, which does not report its capacity or the requests it rejects
+type queueTracker struct {
+	enabled  bool
+	capacity int
+
+	// The context tagged with the name of the exporter, under which metrics are recorded
+	ctx context.Context
+
+	length int64
+}
+
+// Marks a request handed to the exporter helper, until it is either rejected
+// or taken from the queue by the first attempt to push it
+type queueMarker struct {
+	done int32
+}
+
+// Clears the marker, returning whether it was still set
+func (m *queueMarker) take() bool {
+	return atomic.CompareAndSwapInt32(&m.done, 0, 1)
+}
+
+type queueMarkerKey struct{}
+
+func newQueueTracker(cfg *Config) *queueTracker {
+	ctx, _ := tag.New(context.Background(), tag.Upsert(tagExporterKey, cfg.Name()))
+	return &queueTracker{
+		enabled:  cfg.QueueSettings.Enabled,
+		capacity: cfg.QueueSettings.QueueSize,
+		ctx:      ctx,
+	}
+}
+
+// Reports the capacity of the queue, which is fixed once the exporter starts
+func (q *queueTracker) start() {
+	if q.enabled {
+		stats.Record(q.ctx, mQueueCapacity.M(int64(q.capacity)), mQueueLength.M(atomic.LoadInt64(&q.length)))
+	}
+}
+
+// Hands a request to the exporter helper through the send function. The
+// helper only fails to enqueue a request when the queue is full, so any error
+// for a request that has not been pushed yet counts as a rejection
+func (q *queueTracker) enqueue(ctx context.Context, send func(context.Context) error) error {
+	if !q.enabled {
+		return send(ctx)
+	}
+
+	// Counted beforehand, since the request may be pushed before send returns
+	marker := &queueMarker{}
+	q.add(1)
+
+	err := send(context.WithValue(ctx, queueMarkerKey{}, marker))
+	if err != nil && marker.take() {
+		q.add(-1)
+		stats.Record(q.ctx, mQueueRejections.M(1))
+	}
+	return err
+}
+
+// Marks the request as taken from the queue. Retries of the same request are
+// pushed with the same context, and are only counted once
+func (q *queueTracker) dequeue(ctx context.Context) {
+	if marker, ok := ctx.Value(queueMarkerKey{}).(*queueMarker); ok && marker.take() {
+		q.add(-1)
+	}
+}
+
+func (q *queueTracker) add(delta int64) {
+	stats.Record(q.ctx, mQueueLength.M(atomic.AddInt64(&q.length, delta)))
+}
+
+type queuedTracesExporter struct {
+	component.TracesExporter
+	queue *queueTracker
+}
+
+func (e *queuedTracesExporter) Start(ctx context.Context, host component.Host) error {
+	e.queue.start()
+	return e.TracesExporter.Start(ctx, host)
+}
+
+func (e *queuedTracesExporter) ConsumeTraces(ctx context.Context, td pdata.Traces) error {
+	return e.queue.enqueue(withRetryStart(ctx), func(ctx context.Context) error {
+		return e.TracesExporter.ConsumeTraces(ctx, td)
+	})
+}
+
+type queuedMetricsExporter struct {
+	component.MetricsExporter
+	queue *queueTracker
+}
+
+func (e *queuedMetricsExporter) Start(ctx context.Context, host component.Host) error {
+	e.queue.start()
+	return e.MetricsExporter.Start(ctx, host)
+}
+
+func (e *queuedMetricsExporter) ConsumeMetrics(ctx context.Context, md pdata.Metrics) error {
+	return e.queue.enqueue(withRetryStart(ctx), func(ctx context.Context) error {
+		return e.MetricsExporter.ConsumeMetrics(ctx, md)
+	})
+}
+
+type queuedLogsExporter struct {
+	component.LogsExporter
+	queue *queueTracker
+}
+
+func (e *queuedLogsExporter) Start(ctx context.Context, host component.Host) error {
+	e.queue.start()
+	return e.LogsExporter.Start(ctx, host)
+}
+
+func (e *queuedLogsExporter) ConsumeLogs(ctx context.Context, ld pdata.Logs) error {
+	return e.queue.enqueue(withRetryStart(ctx), func(ctx context.Context) error {
+		return e.LogsExporter.ConsumeLogs(ctx, ld)
+	})
+}
@@ -0,0 +1,151 @@
+// Copyright The OpenTelemetry Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package humioexporter
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opencensus.io/stats/view"
+	"go.opentelemetry.io/collector/component"
+	"go.opentelemetry.io/collector/component/componenttest"
+	"go.opentelemetry.io/collector/config"
+	"go.opentelemetry.io/collector/exporter/exporterhelper"
+	"go.uber.org/zap"
+)
+
+func TestQueueTrackerLength(t *testing.T) {
+	// Arrange
+	view.Register(MetricViews()...)
+	cfg := &Config{
+		ExporterSettings: config.NewExporterSettings(typeStr),
+		QueueSettings:    exporterhelper.QueueSettings{Enabled: true, QueueSize: 10},
+	}
+	cfg.SetName("humio/queue_length")
+	q := newQueueTracker(cfg)
+	q.start()
+
+	// Act
+	var queued []context.Context
+	for i := 0; i < 3; i++ {
+		require.NoError(t, q.enqueue(context.Background(), func(ctx context.Context) error {
+			queued = append(queued, ctx)
+			return nil
+		}))
+	}
+	enqueued := atomic.LoadInt64(&q.length)
+
+	// Retries of a request are pushed with the same context
+	q.dequeue(queued[0])
+	q.dequeue(queued[0])
+
+	// Assert
+	assert.Equal(t, int64(3), enqueued)
+	assert.Equal(t, int64(2), atomic.LoadInt64(&q.length))
+	assert.Equal(t, float64(2), viewValue(t, "humio_queue_length", "humio/queue_length"))
+	assert.Equal(t, float64(10), viewValue(t, "humio_queue_capacity", "humio/queue_length"))
+	assert.Equal(t, float64(0), viewValue(t, "humio_queue_rejections", "humio/queue_length"))
+}
+
+func TestQueueTrackerPushedBeforeReturning(t *testing.T) {
+	// Arrange
+	cfg := &Config{
+		ExporterSettings: config.NewExporterSettings(typeStr),
+		QueueSettings:    exporterhelper.QueueSettings{Enabled: true, QueueSize: 10},
+	}
+	q := newQueueTracker(cfg)
+
+	// Act
+	err := q.enqueue(context.Background(), func(ctx context.Context) error {
+		q.dequeue(ctx)
+		return errors.New("export failed")
+	})
+
+	// Assert
+	require.Error(t, err)
+	assert.Equal(t, int64(0), atomic.LoadInt64(&q.length))
+}
+
+func TestQueueTrackerDisabled(t *testing.T) {
+	// Arrange
+	q := newQueueTracker(&Config{ExporterSettings: config.NewExporterSettings(typeStr)})
+
+	// Act
+	err := q.enqueue(context.Background(), func(ctx context.Context) error {
+		q.dequeue(ctx)
+		return errors.New("export failed")
+	})
+
+	// Assert
+	require.Error(t, err)
+	assert.Equal(t, int64(0), atomic.LoadInt64(&q.length))
+}
+
+func TestExporterQueueRejections(t *testing.T) {
+	// Arrange
+	view.Register(MetricViews()...)
+
+	received := make(chan struct{}, 1)
+	release := make(chan struct{})
+	s := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		received <- struct{}{}
+		<-release
+	}))
+	defer s.Close()
+
+	cfg := createDefaultConfig().(*Config)
+	cfg.SetName("humio/queue_rejections")
+	cfg.Endpoint = s.URL
+	cfg.IngestToken = "token"
+	cfg.QueueSettings.NumConsumers = 1
+	cfg.QueueSettings.QueueSize = 1
+	cfg.ShutdownFlushTimeout = 0
+
+	exp, err := createTracesExporter(
+		context.Background(),
+		component.ExporterCreateParams{Logger: zap.NewNop()},
+		cfg,
+	)
+	require.NoError(t, err)
+	require.NoError(t, exp.Start(context.Background(), componenttest.NewNopHost()))
+	defer exp.Shutdown(context.Background())
+
+	rejected := viewValue(t, "humio_queue_rejections", "humio/queue_rejections")
+
+	// Act
+	// The first request is taken from the queue by the only consumer, which
+	// blocks while sending it, such that the second request fills the queue
+	require.NoError(t, exp.ConsumeTraces(context.Background(), makeTraces(time.Now())))
+	select {
+	case <-received:
+	case <-time.After(5 * time.Second):
+		t.Fatal("the first request was not sent")
+	}
+	require.NoError(t, exp.ConsumeTraces(context.Background(), makeTraces(time.Now())))
+	err = exp.ConsumeTraces(context.Background(), makeTraces(time.Now()))
+	close(release)
+
+	// Assert
+	require.Error(t, err)
+	assert.Equal(t, rejected+1, viewValue(t, "humio_queue_rejections", "humio/queue_rejections"))
+	assert.Equal(t, float64(1), viewValue(t, "humio_queue_capacity", "humio/queue_rejections"))
+}
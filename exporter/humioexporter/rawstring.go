@@ -0,0 +1,53 @@
+// Copyright The OpenTelemetry Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package humioexporter
+
+import "encoding/json"
+
+// Supported ways of sending the rawstring of structured events
+const (
+	rawStringModeNone      = "none"
+	rawStringModeAlongside = "alongside"
+	rawStringModeOnly      = "only"
+)
+
+// Whether events carry a rawstring in the specified mode
+func usesRawString(mode string) bool {
+	return mode == rawStringModeAlongside || mode == rawStringModeOnly
+}
+
+// Prepares the rawstring of every event in the groups, after any transforms
+// have been applied. Events without a rawstring of their own, such as spans or
+// log records without a body, carry their attributes encoded as JSON. Only
+// the rawstring is sent when the attributes are left out by the mode
+func applyRawStrings(groups []*HumioStructuredEvents, mode string) {
+	if !usesRawString(mode) {
+		return
+	}
+
+	for _, group := range groups {
+		for _, evt := range group.Events {
+			if evt.RawString == "" && evt.Attributes != nil {
+				// Attributes that cannot be encoded fail the request when sent
+				if b, err := json.Marshal(evt.Attributes); err == nil {
+					evt.RawString = string(b)
+				}
+			}
+			if mode == rawStringModeOnly && evt.RawString != "" {
+				evt.Attributes = nil
+			}
+		}
+	}
+}
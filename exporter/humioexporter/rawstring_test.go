@@ -0,0 +1,77 @@
+// Copyright The OpenTelemetry Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package humioexporter
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestApplyRawStrings(t *testing.T) {
+	// Arrange
+	testCases := []struct {
+		desc          string
+		mode          string
+		evt           *HumioStructuredEvent
+		wantAttrs     interface{}
+		wantRawString string
+	}{
+		{
+			desc:      "Disabled",
+			mode:      "none",
+			evt:       &HumioStructuredEvent{Attributes: map[string]interface{}{"k": "v"}},
+			wantAttrs: map[string]interface{}{"k": "v"},
+		},
+		{
+			desc:          "Keeps the rawstring of the event",
+			mode:          "alongside",
+			evt:           &HumioStructuredEvent{Attributes: map[string]interface{}{"k": "v"}, RawString: "raw"},
+			wantAttrs:     map[string]interface{}{"k": "v"},
+			wantRawString: "raw",
+		},
+		{
+			desc:          "Encodes the attributes alongside",
+			mode:          "alongside",
+			evt:           &HumioStructuredEvent{Attributes: map[string]interface{}{"k": "v"}},
+			wantAttrs:     map[string]interface{}{"k": "v"},
+			wantRawString: `{"k":"v"}`,
+		},
+		{
+			desc:          "Encodes the attributes only",
+			mode:          "only",
+			evt:           &HumioStructuredEvent{Attributes: map[string]interface{}{"k": "v"}},
+			wantRawString: `{"k":"v"}`,
+		},
+		{
+			desc:      "Keeps attributes that cannot be encoded",
+			mode:      "only",
+			evt:       &HumioStructuredEvent{Attributes: problematicStruct{}},
+			wantAttrs: problematicStruct{},
+		},
+	}
+
+	// Act / Assert
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			tC.evt.Timestamp = time.Now()
+			applyRawStrings([]*HumioStructuredEvents{{Events: []*HumioStructuredEvent{tC.evt}}}, tC.mode)
+
+			assert.Equal(t, tC.wantAttrs, tC.evt.Attributes)
+			assert.Equal(t, tC.wantRawString, tC.evt.RawString)
+		})
+	}
+}
@@ -0,0 +1,142 @@
+// Copyright The OpenTelemetry Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package humioexporter
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"go.opencensus.io/stats"
+	"go.opencensus.io/tag"
+	"go.opentelemetry.io/collector/consumer/consumererror"
+)
+
+var errRetryBudgetExhausted = errors.New("the max_total_retry_duration was exhausted")
+
+// Bounds the time from the first attempt to send a request until it either
+// succeeds or is dropped, including the backoffs between its retries
+type retryBudget struct {
+	max time.Duration
+	now func() time.Time
+
+	// The context tagged with the name of the exporter, under which metrics are recorded
+	ctx context.Context
+}
+
+// The time at which the first attempt to send a request started, along with
+// the number of its failed attempts through each client, which are shared by
+// all of its retries
+type retryStart struct {
+	once sync.Once
+	at   time.Time
+
+	mu       sync.Mutex
+	failures map[interface{}]int
+}
+
+type retryStartKey struct{}
+
+func newRetryBudget(cfg *Config) *retryBudget {
+	ctx, _ := tag.New(context.Background(), tag.Upsert(tagExporterKey, cfg.Name()))
+	return &retryBudget{
+		max: cfg.MaxTotalRetryDuration,
+		now: time.Now,
+		ctx: ctx,
+	}
+}
+
+// Marks a request handed to the exporter helper. Retries of the same request
+// are pushed with the same context, and therefore draw from the same budget
+func withRetryStart(ctx context.Context) context.Context {
+	return context.WithValue(ctx, retryStartKey{}, &retryStart{})
+}
+
+// Removes the marker of a request, such that it is sent without a budget
+func withoutRetryStart(ctx context.Context) context.Context {
+	return context.WithValue(ctx, retryStartKey{}, nil)
+}
+
+// Get the remaining budget of the request, starting it on the first attempt.
+// Requests which were not marked have an unlimited budget
+func (b *retryBudget) remaining(ctx context.Context) (time.Duration, bool) {
+	start, ok := ctx.Value(retryStartKey{}).(*retryStart)
+	if !ok {
+		return 0, false
+	}
+
+	now := b.now()
+	start.once.Do(func() {
+		start.at = now
+	})
+	return start.at.Add(b.max).Sub(now), true
+}
+
+// Counts a failed attempt to send a request through the client, returning the
+// number of its attempts through the client which failed before. Requests which
+// were not marked are treated as failing for the first time
+func countFailedAttempt(ctx context.Context, client interface{}) int {
+	start, ok := ctx.Value(retryStartKey{}).(*retryStart)
+	if !ok {
+		return 0
+	}
+
+	start.mu.Lock()
+	defer start.mu.Unlock()
+	if start.failures == nil {
+		start.failures = make(map[interface{}]int)
+	}
+	failed := start.failures[client]
+	start.failures[client]++
+	return failed
+}
+
+// Sends a request through the send function, which is only given the remaining
+// budget to complete. The request fails permanently if it cannot be sent or
+// retried within the budget
+func (b *retryBudget) send(ctx context.Context, total int, send func(context.Context) error) error {
+	remaining, ok := b.remaining(ctx)
+	if !ok {
+		return send(ctx)
+	}
+	if remaining <= 0 {
+		return b.exhausted(total, nil)
+	}
+
+	bCtx, cancel := context.WithTimeout(ctx, remaining)
+	defer cancel()
+
+	err := send(bCtx)
+	if err == nil || consumererror.IsPermanent(err) {
+		return err
+	}
+
+	// Waiting for the next retry would only exceed the budget
+	if remaining, _ = b.remaining(ctx); remaining <= 0 {
+		return b.exhausted(total, err)
+	}
+	return err
+}
+
+// Counts the events of a request dropped when its budget is exhausted
+func (b *retryBudget) exhausted(total int, cause error) error {
+	stats.Record(b.ctx, mRetryBudgetExhausted.M(int64(total)), mEventsDropped.M(int64(total)))
+	if cause == nil {
+		return consumererror.Permanent(errRetryBudgetExhausted)
+	}
+	return consumererror.Permanent(fmt.Errorf("%w, last error: %v", errRetryBudgetExhausted, cause))
+}
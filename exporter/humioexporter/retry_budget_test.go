@@ -0,0 +1,187 @@
+// Copyright The OpenTelemetry Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package humioexporter
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opencensus.io/stats/view"
+	"go.opentelemetry.io/collector/config"
+	"go.opentelemetry.io/collector/consumer/consumererror"
+)
+
+func makeRetryBudget(max time.Duration) (*retryBudget, *fakeClock) {
+	clock := &fakeClock{now: time.Date(2021, 3, 28, 12, 30, 15, 0, time.UTC)}
+	cfg := &Config{
+		ExporterSettings:      config.NewExporterSettings(typeStr),
+		MaxTotalRetryDuration: max,
+	}
+	cfg.SetName("humio/retry_budget")
+	budget := newRetryBudget(cfg)
+	budget.now = clock.Now
+	return budget, clock
+}
+
+func TestRetryBudgetUnmarked(t *testing.T) {
+	// Arrange
+	budget, _ := makeRetryBudget(time.Minute)
+
+	// Act
+	var hasDeadline bool
+	err := budget.send(context.Background(), 1, func(ctx context.Context) error {
+		_, hasDeadline = ctx.Deadline()
+		return nil
+	})
+
+	// Assert
+	require.NoError(t, err)
+	assert.False(t, hasDeadline)
+}
+
+func TestRetryBudgetRemaining(t *testing.T) {
+	// Arrange
+	budget, clock := makeRetryBudget(time.Minute)
+	ctx := withRetryStart(context.Background())
+
+	// Act
+	first, _ := budget.remaining(ctx)
+	clock.Advance(40 * time.Second)
+	later, _ := budget.remaining(ctx)
+	clock.Advance(20 * time.Second)
+	exhausted, _ := budget.remaining(ctx)
+
+	// Assert
+	assert.Equal(t, time.Minute, first)
+	assert.Equal(t, 20*time.Second, later)
+	assert.Equal(t, time.Duration(0), exhausted)
+}
+
+func TestRetryBudgetSend(t *testing.T) {
+	// Arrange
+	cause := errors.New("unavailable")
+	testCases := []struct {
+		desc          string
+		before        time.Duration
+		during        time.Duration
+		err           error
+		wantSent      bool
+		wantPermanent bool
+		wantExhausted bool
+	}{
+		{
+			desc:     "Successful within the budget",
+			before:   59 * time.Second,
+			wantSent: true,
+		},
+		{
+			desc:     "Retryable failure with budget left",
+			during:   59 * time.Second,
+			err:      cause,
+			wantSent: true,
+		},
+		{
+			desc:          "Retryable failure exhausting the budget",
+			during:        time.Minute,
+			err:           cause,
+			wantSent:      true,
+			wantPermanent: true,
+			wantExhausted: true,
+		},
+		{
+			desc:          "Permanent failure",
+			during:        time.Minute,
+			err:           consumererror.Permanent(cause),
+			wantSent:      true,
+			wantPermanent: true,
+		},
+		{
+			desc:          "Attempt after the budget",
+			before:        time.Minute,
+			wantPermanent: true,
+			wantExhausted: true,
+		},
+	}
+
+	// Act / Assert
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			budget, clock := makeRetryBudget(time.Minute)
+			ctx := withRetryStart(context.Background())
+			budget.remaining(ctx)
+			clock.Advance(tC.before)
+
+			sent := false
+			err := budget.send(ctx, 1, func(ctx context.Context) error {
+				sent = true
+				clock.Advance(tC.during)
+				return tC.err
+			})
+
+			assert.Equal(t, tC.wantSent, sent)
+			assert.Equal(t, tC.wantPermanent, consumererror.IsPermanent(err))
+			if tC.wantExhausted {
+				assert.Contains(t, err.Error(), errRetryBudgetExhausted.Error())
+			} else if tC.err != nil {
+				assert.Contains(t, err.Error(), cause.Error())
+			}
+		})
+	}
+}
+
+func TestRetryBudgetAttemptDeadline(t *testing.T) {
+	// Arrange
+	budget, clock := makeRetryBudget(time.Minute)
+	ctx := withRetryStart(context.Background())
+	budget.remaining(ctx)
+	clock.Advance(40 * time.Second)
+
+	// Act
+	var deadline time.Time
+	var hasDeadline bool
+	before := time.Now()
+	err := budget.send(ctx, 1, func(ctx context.Context) error {
+		deadline, hasDeadline = ctx.Deadline()
+		return nil
+	})
+
+	// Assert
+	require.NoError(t, err)
+	require.True(t, hasDeadline)
+	assert.WithinDuration(t, before.Add(20*time.Second), deadline, time.Second)
+}
+
+func TestRetryBudgetExhaustedTelemetry(t *testing.T) {
+	// Arrange
+	view.Register(MetricViews()...)
+	budget, clock := makeRetryBudget(time.Minute)
+	ctx := withRetryStart(context.Background())
+	budget.remaining(ctx)
+	clock.Advance(time.Minute)
+	before := viewValue(t, "humio_retry_budget_exhausted", "humio/retry_budget")
+
+	// Act
+	err := budget.send(ctx, 5, func(ctx context.Context) error {
+		return nil
+	})
+
+	// Assert
+	require.Error(t, err)
+	assert.Equal(t, before+5, viewValue(t, "humio_retry_budget_exhausted", "humio/retry_budget"))
+}
@@ -0,0 +1,273 @@
+// Copyright The OpenTelemetry Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package humioexporter
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"go.opencensus.io/stats"
+	"go.opencensus.io/tag"
+	"go.opentelemetry.io/collector/config"
+	"go.opentelemetry.io/collector/consumer/consumererror"
+	"go.opentelemetry.io/collector/consumer/pdata"
+	tracetranslator "go.opentelemetry.io/collector/translator/trace"
+	"go.uber.org/zap"
+)
+
+// Get the value of the routing attribute on the specified resource, which is
+// empty if routing is disabled or the attribute is missing
+func getRoutingValue(cfg *Config, res pdata.Resource) string {
+	if cfg.RoutingAttribute == "" {
+		return ""
+	}
+
+	if attr, ok := res.Attributes().Get(cfg.RoutingAttribute); ok {
+		return tracetranslator.AttributeValueToString(attr, false)
+	}
+	return ""
+}
+
+// A client which routes events to different Humio repositories, based on the
+// value of a resource attribute. Each repository is identified by its own
+// ingest token
+type routingClient struct {
+	cfg    *Config
+	routes map[string]exporterClient
+
+	// The client for events without a matching route, or nil if such events are dropped
+	fallback exporterClient
+
+	logger *zap.Logger
+}
+
+// The subset of a payload which should be sent to the same repository
+type route struct {
+	client exporterClient
+
+	// The indices of the groups in the payload which belong to this route
+	indices []int
+
+	// The positions of the events in this route across all events in the payload
+	positions []int
+}
+
+func newRoutingClient(cfg *Config, dataType config.DataType, token *tokenReloader, logger *zap.Logger) (*routingClient, error) {
+	routes := make(map[string]exporterClient, len(cfg.RoutingTokens))
+	for value, token := range cfg.RoutingTokens {
+		headers := make(map[string]string, len(cfg.Headers))
+		for k, v := range cfg.Headers {
+			headers[k] = v
+		}
+		headers["authorization"] = "Bearer " + token
+
+		client, err := newRepositoryClient(cfg, dataType, headers, nil, logger)
+		if err != nil {
+			return nil, err
+		}
+		routes[value] = client
+	}
+
+	// Events without a matching route are sent using the ingest token, if any
+	var fallback exporterClient
+	if _, ok := cfg.Headers["authorization"]; ok {
+		client, err := newRepositoryClient(cfg, dataType, cfg.Headers, token, logger)
+		if err != nil {
+			return nil, err
+		}
+		fallback = client
+	}
+
+	return &routingClient{
+		cfg:      cfg,
+		routes:   routes,
+		fallback: fallback,
+		logger:   logger,
+	}, nil
+}
+
+// Start the clients of every repository
+func (r *routingClient) start(ctx context.Context) error {
+	for _, client := range r.routes {
+		if err := client.start(ctx); err != nil {
+			return err
+		}
+	}
+	if r.fallback != nil {
+		return r.fallback.start(ctx)
+	}
+	return nil
+}
+
+// Shut down the clients of every repository
+func (r *routingClient) shutdown(ctx context.Context) error {
+	for _, client := range r.routes {
+		if err := client.shutdown(ctx); err != nil {
+			return err
+		}
+	}
+	if r.fallback != nil {
+		return r.fallback.shutdown(ctx)
+	}
+	return nil
+}
+
+// Verify the endpoint with the token of every repository
+func (r *routingClient) checkEndpoint(ctx context.Context) error {
+	for value, client := range r.routes {
+		if err := client.checkEndpoint(ctx); err != nil {
+			return fmt.Errorf("unable to verify the route for %q: %w", value, err)
+		}
+	}
+	if r.fallback != nil {
+		return r.fallback.checkEndpoint(ctx)
+	}
+	return nil
+}
+
+// Send a payload of unstructured events, routing each group to its repository
+func (r *routingClient) sendUnstructuredEvents(ctx context.Context, evts []*HumioUnstructuredEvents) error {
+	groups := make([]eventGroup, len(evts))
+	values := make([]string, len(evts))
+	for i, evt := range evts {
+		groups[i] = evt
+		values[i] = evt.routingValue
+	}
+
+	return r.sendRoutes(ctx, groups, values, func(rt *route) error {
+		subset := make([]*HumioUnstructuredEvents, len(rt.indices))
+		for i, idx := range rt.indices {
+			subset[i] = evts[idx]
+		}
+		return rt.client.sendUnstructuredEvents(ctx, subset)
+	})
+}
+
+// Send a payload of structured events, routing each group to its repository
+func (r *routingClient) sendStructuredEvents(ctx context.Context, evts []*HumioStructuredEvents) error {
+	groups := make([]eventGroup, len(evts))
+	values := make([]string, len(evts))
+	for i, evt := range evts {
+		groups[i] = evt
+		values[i] = evt.routingValue
+	}
+
+	return r.sendRoutes(ctx, groups, values, func(rt *route) error {
+		subset := make([]*HumioStructuredEvents, len(rt.indices))
+		for i, idx := range rt.indices {
+			subset[i] = evts[idx]
+		}
+		return rt.client.sendStructuredEvents(ctx, subset)
+	})
+}
+
+// Partition the groups by their route, and send each route in turn. If a
+// route fails after others have been attempted, a partial failure is returned
+// covering the events that should be sent again
+func (r *routingClient) sendRoutes(ctx context.Context, groups []eventGroup, values []string, send func(*route) error) error {
+	routes := r.partition(ctx, groups, values)
+
+	for i, rt := range routes {
+		// The exporter helper does not retry a cancelled request, so there is
+		// no point in sending the remaining routes
+		if i > 0 && ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		err := send(rt)
+		if err == nil {
+			continue
+		}
+
+		var failed []int
+		var partial *partialFailureError
+		switch {
+		case errors.As(err, &partial):
+			for _, idx := range partial.failed {
+				failed = append(failed, rt.positions[idx])
+			}
+			err = partial.err
+		case consumererror.IsPermanent(err):
+			// Events rejected permanently must not be sent again
+		default:
+			// Nothing has been sent yet, so the entire payload can be retried
+			if i == 0 {
+				return err
+			}
+			failed = append(failed, rt.positions...)
+		}
+
+		// No other routes have been sent yet
+		for _, remaining := range routes[i+1:] {
+			failed = append(failed, remaining.positions...)
+		}
+
+		if len(failed) == 0 {
+			return err
+		}
+		return &partialFailureError{err: err, failed: failed}
+	}
+
+	return nil
+}
+
+// Partition the groups by their route, preserving the order in which routes
+// first appear. Groups without a matching route are dropped if there is no
+// fallback repository
+func (r *routingClient) partition(ctx context.Context, groups []eventGroup, values []string) []*route {
+	var routes []*route
+	byClient := make(map[exporterClient]*route)
+	dropped := 0
+	pos := 0
+
+	for i, group := range groups {
+		count := group.count()
+
+		client, ok := r.routes[values[i]]
+		if !ok {
+			client = r.fallback
+		}
+
+		if client == nil {
+			dropped += count
+			pos += count
+			continue
+		}
+
+		rt, ok := byClient[client]
+		if !ok {
+			rt = &route{client: client}
+			byClient[client] = rt
+			routes = append(routes, rt)
+		}
+
+		rt.indices = append(rt.indices, i)
+		for j := 0; j < count; j++ {
+			rt.positions = append(rt.positions, pos+j)
+		}
+		pos += count
+	}
+
+	if dropped > 0 {
+		mCtx, _ := tag.New(ctx, tag.Upsert(tagExporterKey, r.cfg.Name()))
+		stats.Record(mCtx, mEventsDropped.M(int64(dropped)))
+		r.logger.Warn("Dropping events without a matching route",
+			zap.Int("dropped", dropped),
+			zap.String("routing_attribute", r.cfg.RoutingAttribute))
+	}
+
+	return routes
+}
@@ -0,0 +1,248 @@
+// Copyright The OpenTelemetry Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package humioexporter
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/collector/config"
+	"go.opentelemetry.io/collector/config/confighttp"
+	"go.opentelemetry.io/collector/consumer/consumererror"
+	"go.uber.org/zap"
+)
+
+// A request received by the routing test server
+type routedRequest struct {
+	authorization string
+	groups        int
+}
+
+// Helper method to start a server recording the requests it receives, which
+// responds to requests with the specified tokens using the given status codes
+func makeRoutingServer(t *testing.T, statuses map[string]int) (*httptest.Server, *[]routedRequest) {
+	var mu sync.Mutex
+	var requests []routedRequest
+
+	s := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		body, err := ioutil.ReadAll(r.Body)
+		require.NoError(t, err)
+
+		var groups []json.RawMessage
+		require.NoError(t, json.Unmarshal(body, &groups))
+
+		mu.Lock()
+		requests = append(requests, routedRequest{
+			authorization: r.Header.Get("authorization"),
+			groups:        len(groups),
+		})
+		mu.Unlock()
+
+		if status, ok := statuses[r.Header.Get("authorization")]; ok {
+			rw.WriteHeader(status)
+		}
+	}))
+	return s, &requests
+}
+
+// Helper method to create a routing client for the specified server
+func makeRoutingClient(t *testing.T, endpoint string, defaultToken string) exporterClient {
+	cfg := &Config{
+		ExporterSettings:   config.NewExporterSettings(typeStr),
+		AllowInsecure:      true,
+		ServiceTagKey:      "service",
+		IngestToken:        defaultToken,
+		DisableCompression: true,
+		RoutingAttribute:   "tenant",
+		RoutingTokens: map[string]string{
+			"a": "token-a",
+			"b": "token-b",
+		},
+		HTTPClientSettings: confighttp.HTTPClientSettings{
+			Endpoint: endpoint,
+		},
+	}
+	require.NoError(t, cfg.Validate())
+	require.NoError(t, cfg.sanitize())
+
+	client, err := newHumioClient(cfg, config.TracesDataType, zap.NewNop())
+	require.NoError(t, err)
+	return client
+}
+
+// Helper method to create groups of structured events with the specified routing values
+func makeRoutedEvents(values ...string) []*HumioStructuredEvents {
+	evts := make([]*HumioStructuredEvents, len(values))
+	for i, value := range values {
+		evts[i] = &HumioStructuredEvents{
+			Events: []*HumioStructuredEvent{
+				{Timestamp: time.Date(2021, 3, 28, 12, 30, 15, 0, time.UTC)},
+				{Timestamp: time.Date(2021, 3, 28, 12, 30, 15, 0, time.UTC)},
+			},
+			routingValue: value,
+		}
+	}
+	return evts
+}
+
+func TestGetRoutingValue(t *testing.T) {
+	// Arrange
+	res := makeResource(map[string]string{"tenant": "a"})
+	testCases := []struct {
+		desc     string
+		cfg      *Config
+		expected string
+	}{
+		{
+			desc:     "Routing disabled",
+			cfg:      &Config{},
+			expected: "",
+		},
+		{
+			desc:     "Attribute present",
+			cfg:      &Config{RoutingAttribute: "tenant"},
+			expected: "a",
+		},
+		{
+			desc:     "Attribute missing",
+			cfg:      &Config{RoutingAttribute: "missing"},
+			expected: "",
+		},
+	}
+
+	// Act / Assert
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			assert.Equal(t, tC.expected, getRoutingValue(tC.cfg, res))
+		})
+	}
+}
+
+func TestRoutingClientSendsToRepositories(t *testing.T) {
+	// Arrange
+	s, requests := makeRoutingServer(t, nil)
+	defer s.Close()
+	client := makeRoutingClient(t, s.URL, "default")
+
+	// Act
+	err := client.sendStructuredEvents(context.Background(), makeRoutedEvents("a", "b", "a", "c", ""))
+
+	// Assert
+	require.NoError(t, err)
+	assert.Equal(t, []routedRequest{
+		{authorization: "Bearer token-a", groups: 2},
+		{authorization: "Bearer token-b", groups: 1},
+		{authorization: "Bearer default", groups: 2},
+	}, *requests)
+}
+
+func TestRoutingClientDropsUnmatched(t *testing.T) {
+	// Arrange
+	s, requests := makeRoutingServer(t, nil)
+	defer s.Close()
+	client := makeRoutingClient(t, s.URL, "")
+
+	// Act
+	err := client.sendStructuredEvents(context.Background(), makeRoutedEvents("c", "b"))
+
+	// Assert
+	require.NoError(t, err)
+	assert.Equal(t, []routedRequest{
+		{authorization: "Bearer token-b", groups: 1},
+	}, *requests)
+}
+
+func TestRoutingClientFailures(t *testing.T) {
+	// Arrange
+	testCases := []struct {
+		desc          string
+		statuses      map[string]int
+		wantPartial   bool
+		wantFailed    []int
+		wantPermanent bool
+	}{
+		{
+			desc:        "First route fails",
+			statuses:    map[string]int{"Bearer token-a": http.StatusInternalServerError},
+			wantPartial: false,
+		},
+		{
+			desc:          "First route rejected permanently",
+			statuses:      map[string]int{"Bearer token-a": http.StatusBadRequest},
+			wantPartial:   true,
+			wantFailed:    []int{2, 3, 6, 7},
+			wantPermanent: false,
+		},
+		{
+			desc:        "Later route fails",
+			statuses:    map[string]int{"Bearer token-b": http.StatusInternalServerError},
+			wantPartial: true,
+			wantFailed:  []int{2, 3, 6, 7},
+		},
+		{
+			desc:          "Last route rejected permanently",
+			statuses:      map[string]int{"Bearer default": http.StatusBadRequest},
+			wantPartial:   false,
+			wantPermanent: true,
+		},
+	}
+
+	// Act
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			s, _ := makeRoutingServer(t, tC.statuses)
+			defer s.Close()
+			client := makeRoutingClient(t, s.URL, "default")
+
+			err := client.sendStructuredEvents(context.Background(), makeRoutedEvents("a", "b", "a", "c"))
+
+			// Assert
+			require.Error(t, err)
+			assert.Equal(t, tC.wantPermanent, consumererror.IsPermanent(err))
+
+			var partial *partialFailureError
+			require.Equal(t, tC.wantPartial, errors.As(err, &partial))
+			if tC.wantPartial {
+				assert.Equal(t, tC.wantFailed, partial.failed)
+			}
+		})
+	}
+}
+
+func TestRoutingCheckEndpoint(t *testing.T) {
+	// Arrange
+	s, requests := makeRoutingServer(t, map[string]int{"Bearer token-b": http.StatusUnauthorized})
+	defer s.Close()
+	client := makeRoutingClient(t, s.URL, "")
+
+	// Act
+	err := client.checkEndpoint(context.Background())
+
+	// Assert
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), `"b"`)
+	for _, req := range *requests {
+		assert.Equal(t, 0, req.groups)
+	}
+}
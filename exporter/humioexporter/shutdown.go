@@ -0,0 +1,185 @@
+// Copyright The OpenTelemetry Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package humioexporter
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/collector/component"
+	"go.uber.org/zap"
+)
+
+// Keeps track of the requests that are currently being sent to Humio, such
+// that they can be given a chance to complete when the exporter shuts down
+type inflightTracker struct {
+	logger *zap.Logger
+
+	wg      sync.WaitGroup
+	mu      sync.Mutex
+	cancels map[int]context.CancelFunc
+	nextID  int
+
+	// Set once shutdown has begun, after which the outcome of requests is counted
+	draining bool
+
+	// Set once the flush timeout has elapsed, after which requests are canceled
+	expired bool
+	timer   *time.Timer
+
+	flushed int
+	dropped int
+}
+
+func newInflightTracker(logger *zap.Logger) *inflightTracker {
+	return &inflightTracker{
+		logger:  logger,
+		cancels: map[int]context.CancelFunc{},
+	}
+}
+
+// Registers a new request, returning the context under which it should be sent
+// along with a function to call with the number of sent and dropped events once
+// the request has completed
+func (t *inflightTracker) begin(ctx context.Context) (context.Context, func(sent, dropped int)) {
+	ctx, cancel := context.WithCancel(ctx)
+
+	t.mu.Lock()
+	id := t.nextID
+	t.nextID++
+	t.cancels[id] = cancel
+	if t.expired {
+		cancel()
+	}
+	t.wg.Add(1)
+	t.mu.Unlock()
+
+	return ctx, func(sent, dropped int) {
+		t.mu.Lock()
+		delete(t.cancels, id)
+		if t.draining {
+			t.flushed += sent
+			t.dropped += dropped
+		}
+		t.mu.Unlock()
+
+		cancel()
+		t.wg.Done()
+	}
+}
+
+// Marks the beginning of shutdown, after which in-flight requests are given
+// the specified amount of time to complete before being canceled
+func (t *inflightTracker) drain(timeout time.Duration) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.draining {
+		return
+	}
+	t.draining = true
+	t.timer = time.AfterFunc(timeout, t.expire)
+}
+
+// Cancels all requests that are still in flight
+func (t *inflightTracker) expire() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.expired = true
+	for _, cancel := range t.cancels {
+		cancel()
+	}
+}
+
+// Waits for all in-flight requests to complete, and reports how many events
+// were flushed or dropped while draining
+func (t *inflightTracker) wait() {
+	t.wg.Wait()
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.timer != nil {
+		t.timer.Stop()
+	}
+	if !t.draining {
+		return
+	}
+
+	fields := []zap.Field{
+		zap.Int("flushed", t.flushed),
+		zap.Int("dropped", t.dropped),
+	}
+	if t.dropped > 0 {
+		t.logger.Warn("Dropped in-flight events during shutdown", fields...)
+	} else {
+		t.logger.Info("Flushed in-flight events during shutdown", fields...)
+	}
+}
+
+// Implemented by clients which hold back events, such that they are sent as
+// soon as shutdown begins rather than only once the queue has been emptied
+type drainingClient interface {
+	drain()
+}
+
+func drainClient(client exporterClient) {
+	if c, ok := client.(drainingClient); ok {
+		c.drain()
+	}
+}
+
+// Wrappers around the exporters created by the exporter helper, which start
+// draining in-flight requests as soon as shutdown begins
+type drainingTracesExporter struct {
+	component.TracesExporter
+	inflight *inflightTracker
+	client   exporterClient
+	timeout  time.Duration
+}
+
+func (e *drainingTracesExporter) Shutdown(ctx context.Context) error {
+	e.inflight.drain(e.timeout)
+	drainClient(e.client)
+	return e.TracesExporter.Shutdown(ctx)
+}
+
+type drainingMetricsExporter struct {
+	component.MetricsExporter
+	inflight *inflightTracker
+	client   exporterClient
+	timeout  time.Duration
+}
+
+func (e *drainingMetricsExporter) Shutdown(ctx context.Context) error {
+	e.inflight.drain(e.timeout)
+	drainClient(e.client)
+	return e.MetricsExporter.Shutdown(ctx)
+}
+
+type drainingLogsExporter struct {
+	component.LogsExporter
+	inflight *inflightTracker
+	client   exporterClient
+	timeout  time.Duration
+}
+
+func (e *drainingLogsExporter) Shutdown(ctx context.Context) error {
+	e.inflight.drain(e.timeout)
+	drainClient(e.client)
+	return e.LogsExporter.Shutdown(ctx)
+}
@@ -0,0 +1,161 @@
+// Copyright The OpenTelemetry Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package humioexporter
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/collector/component"
+	"go.opentelemetry.io/collector/component/componenttest"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+func TestShutdownFlushTimeout(t *testing.T) {
+	// Arrange
+	testCases := []struct {
+		desc         string
+		timeout      time.Duration
+		releaseAfter time.Duration
+		wantErr      bool
+		message      string
+		flushed      int64
+		dropped      int64
+	}{
+		{
+			desc:         "Generous timeout",
+			timeout:      time.Minute,
+			releaseAfter: 50 * time.Millisecond,
+			wantErr:      false,
+			message:      "Flushed in-flight events during shutdown",
+			flushed:      2,
+			dropped:      0,
+		},
+		{
+			desc:         "Short timeout",
+			timeout:      10 * time.Millisecond,
+			releaseAfter: time.Minute,
+			wantErr:      true,
+			message:      "Dropped in-flight events during shutdown",
+			flushed:      0,
+			dropped:      2,
+		},
+	}
+
+	// Act / Assert
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			received := make(chan struct{})
+			s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				_, _ = io.Copy(ioutil.Discard, r.Body)
+				close(received)
+				select {
+				case <-time.After(tC.releaseAfter):
+					w.WriteHeader(http.StatusOK)
+				case <-r.Context().Done():
+				}
+			}))
+			defer s.Close()
+
+			cfg := createDefaultConfig().(*Config)
+			cfg.Endpoint = s.URL
+			cfg.IngestToken = "token"
+			cfg.QueueSettings.Enabled = false
+			cfg.RetrySettings.Enabled = false
+			cfg.ShutdownFlushTimeout = tC.timeout
+
+			core, logs := observer.New(zapcore.InfoLevel)
+			exp, err := createTracesExporter(
+				context.Background(),
+				component.ExporterCreateParams{Logger: zap.New(core)},
+				cfg,
+			)
+			require.NoError(t, err)
+			require.NoError(t, exp.Start(context.Background(), componenttest.NewNopHost()))
+
+			pushErr := make(chan error)
+			go func() {
+				pushErr <- exp.ConsumeTraces(context.Background(), makeTraces(time.Now()))
+			}()
+			<-received
+
+			require.NoError(t, exp.Shutdown(context.Background()))
+			if tC.wantErr {
+				assert.Error(t, <-pushErr)
+			} else {
+				assert.NoError(t, <-pushErr)
+			}
+
+			entries := logs.FilterMessage(tC.message).All()
+			require.Len(t, entries, 1)
+			assert.Equal(t, tC.flushed, entries[0].ContextMap()["flushed"])
+			assert.Equal(t, tC.dropped, entries[0].ContextMap()["dropped"])
+		})
+	}
+}
+
+func TestInflightTrackerCountsOnlyWhileDraining(t *testing.T) {
+	// Arrange
+	core, logs := observer.New(zapcore.InfoLevel)
+	tracker := newInflightTracker(zap.New(core))
+
+	// Act
+	_, finish := tracker.begin(context.Background())
+	finish(5, 0)
+
+	tracker.drain(time.Minute)
+	_, finish = tracker.begin(context.Background())
+	finish(2, 1)
+	tracker.wait()
+
+	// Assert
+	entries := logs.All()
+	require.Len(t, entries, 1)
+	assert.Equal(t, zapcore.WarnLevel, entries[0].Level)
+	assert.Equal(t, int64(2), entries[0].ContextMap()["flushed"])
+	assert.Equal(t, int64(1), entries[0].ContextMap()["dropped"])
+}
+
+func TestInflightTrackerCancelsAfterTimeout(t *testing.T) {
+	// Arrange
+	tracker := newInflightTracker(zap.NewNop())
+	ctx, finish := tracker.begin(context.Background())
+
+	// Act
+	tracker.drain(0)
+
+	// Assert
+	select {
+	case <-ctx.Done():
+	case <-time.After(5 * time.Second):
+		t.Fatal("In-flight request was not canceled")
+	}
+	finish(0, 1)
+
+	// Requests started after the timeout are canceled immediately
+	late, finish := tracker.begin(context.Background())
+	assert.Error(t, late.Err())
+	finish(0, 1)
+	tracker.wait()
+}
@@ -0,0 +1,35 @@
+// Copyright The OpenTelemetry Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package humioexporter
+
+// RequestSigner is called with the compressed body of every request before it
+// is sent to Humio, and returns the headers to add to the request, such as a
+// signature of the body required by an API gateway in front of Humio
+type RequestSigner func(body []byte) map[string]string
+
+// WithRequestSigner registers a signer whose headers are added to every request
+func WithRequestSigner(signer RequestSigner) FactoryOption {
+	return func(o *factoryOptions) {
+		o.signer = signer
+	}
+}
+
+// Get the headers of the registered signer for the compressed body, if any
+func signBody(cfg *Config, body []byte) map[string]string {
+	if cfg.signer == nil {
+		return nil
+	}
+	return cfg.signer(body)
+}
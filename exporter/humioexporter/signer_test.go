@@ -0,0 +1,62 @@
+// Copyright The OpenTelemetry Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package humioexporter
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWithRequestSigner(t *testing.T) {
+	// Arrange
+	var o factoryOptions
+
+	// Act
+	WithRequestSigner(func(body []byte) map[string]string {
+		return map[string]string{"x-length": string(rune('0' + len(body)))}
+	})(&o)
+
+	// Assert
+	if assert.NotNil(t, o.signer) {
+		assert.Equal(t, map[string]string{"x-length": "3"}, o.signer([]byte("abc")))
+	}
+}
+
+func TestSignBody(t *testing.T) {
+	// Arrange
+	var signed []byte
+	cfg := &Config{
+		signer: func(body []byte) map[string]string {
+			signed = body
+			return map[string]string{"x-signature": "signed"}
+		},
+	}
+
+	// Act
+	headers := signBody(cfg, []byte("body"))
+
+	// Assert
+	assert.Equal(t, map[string]string{"x-signature": "signed"}, headers)
+	assert.Equal(t, []byte("body"), signed)
+}
+
+func TestSignBodyWithoutSigner(t *testing.T) {
+	// Act
+	headers := signBody(&Config{}, []byte("body"))
+
+	// Assert
+	assert.Nil(t, headers)
+}
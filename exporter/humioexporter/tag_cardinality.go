@@ -0,0 +1,154 @@
+// Copyright The OpenTelemetry Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package humioexporter
+
+import (
+	"encoding/json"
+	"sort"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// Limits the number of distinct tag combinations, and thus data sources in
+// Humio, created within a window of time. Once the limit has been reached,
+// tags with the most distinct values are dropped from new combinations, such
+// that their events are still sent without creating additional data sources
+type tagCardinalityLimiter struct {
+	max    int
+	window time.Duration
+	logger *zap.Logger
+
+	// The current time, replaceable for testing
+	now func() time.Time
+
+	mu          sync.Mutex
+	windowStart time.Time
+	seen        map[string]bool
+	values      map[string]map[string]bool
+	warned      bool
+}
+
+// Creates a limiter allowing at most max distinct tag combinations within
+// each window. A max of zero disables the limit
+func newTagCardinalityLimiter(max int, window time.Duration, logger *zap.Logger) *tagCardinalityLimiter {
+	return &tagCardinalityLimiter{
+		max:    max,
+		window: window,
+		logger: logger,
+		now:    time.Now,
+	}
+}
+
+// Get the tags to send for events with the specified tags, which are the same
+// tags unless they would exceed the limit of distinct combinations
+func (l *tagCardinalityLimiter) limit(tags map[string]string) map[string]string {
+	if l.max == 0 {
+		return tags
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if now := l.now(); l.seen == nil || now.Sub(l.windowStart) >= l.window {
+		l.windowStart = now
+		l.seen = map[string]bool{}
+		l.values = map[string]map[string]bool{}
+		l.warned = false
+	}
+	l.observe(tags)
+
+	key := tagSetKey(tags)
+	if l.seen[key] || len(l.seen) < l.max {
+		l.seen[key] = true
+		return tags
+	}
+
+	reduced := make(map[string]string, len(tags))
+	for k, v := range tags {
+		reduced[k] = v
+	}
+
+	var dropped []string
+	for {
+		name := l.highestCardinalityTag(reduced)
+		if name == "" {
+			break
+		}
+		delete(reduced, name)
+		dropped = append(dropped, name)
+
+		key = tagSetKey(reduced)
+		if l.seen[key] || len(l.seen) < l.max {
+			break
+		}
+	}
+
+	// Once the remaining tags have only ever had a single value, dropping them
+	// would not prevent further combinations, so these are allowed regardless
+	l.seen[key] = true
+
+	if !l.warned {
+		l.warned = true
+		l.logger.Warn("Dropping high-cardinality tags, since the maximum number of distinct tag combinations has been reached",
+			zap.Int("max_tag_cardinality", l.max),
+			zap.Duration("tag_cardinality_window", l.window),
+			zap.Strings("dropped_tags", dropped))
+	}
+	return reduced
+}
+
+// Keep track of the distinct values of each tag. Counting stops beyond the
+// limit, which is enough to tell which tags have the most distinct values
+func (l *tagCardinalityLimiter) observe(tags map[string]string) {
+	for k, v := range tags {
+		values, ok := l.values[k]
+		if !ok {
+			values = map[string]bool{}
+			l.values[k] = values
+		}
+		if len(values) <= l.max {
+			values[v] = true
+		}
+	}
+}
+
+// Get the name of the tag with the most distinct values, or an empty string if
+// no tag has had more than a single value. The parser tag is always kept, since
+// Humio requires it to parse the events
+func (l *tagCardinalityLimiter) highestCardinalityTag(tags map[string]string) string {
+	names := make([]string, 0, len(tags))
+	for k := range tags {
+		if k != parserTagKey {
+			names = append(names, k)
+		}
+	}
+	sort.Strings(names)
+
+	result := ""
+	for _, name := range names {
+		if len(l.values[name]) > 1 && (result == "" || len(l.values[name]) > len(l.values[result])) {
+			result = name
+		}
+	}
+	return result
+}
+
+func tagSetKey(tags map[string]string) string {
+	// Encoding a map of strings never fails, and sorts its keys
+	b, _ := json.Marshal(tags)
+	return string(b)
+}
@@ -0,0 +1,134 @@
+// Copyright The OpenTelemetry Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package humioexporter
+
+import (
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+func makeTagLimiter(max int, window time.Duration) (*tagCardinalityLimiter, *fakeClock, *observer.ObservedLogs) {
+	core, logs := observer.New(zapcore.WarnLevel)
+	clock := &fakeClock{now: time.Date(2021, 3, 28, 12, 30, 15, 0, time.UTC)}
+	limiter := newTagCardinalityLimiter(max, window, zap.New(core))
+	limiter.now = clock.Now
+	return limiter, clock, logs
+}
+
+func makeRequestTags(id int) map[string]string {
+	return map[string]string{
+		"service":    "myservice",
+		"type":       "parser",
+		"request_id": strconv.Itoa(id),
+	}
+}
+
+func TestTagCardinalityLimiterDisabled(t *testing.T) {
+	// Arrange
+	limiter, _, logs := makeTagLimiter(0, time.Hour)
+
+	// Act / Assert
+	for i := 0; i < 100; i++ {
+		assert.Equal(t, makeRequestTags(i), limiter.limit(makeRequestTags(i)))
+	}
+	assert.Equal(t, 0, logs.Len())
+}
+
+func TestTagCardinalityLimiterDropsHighCardinalityTags(t *testing.T) {
+	// Arrange
+	limiter, _, logs := makeTagLimiter(3, time.Hour)
+
+	// Act
+	results := make([]map[string]string, 100)
+	for i := range results {
+		results[i] = limiter.limit(makeRequestTags(i))
+	}
+
+	// Assert
+	distinct := map[string]bool{}
+	for i, tags := range results {
+		distinct[tagSetKey(tags)] = true
+		if i < 3 {
+			assert.Equal(t, makeRequestTags(i), tags)
+		} else {
+			assert.Equal(t, map[string]string{"service": "myservice", "type": "parser"}, tags)
+		}
+	}
+	assert.Len(t, distinct, 4)
+
+	entries := logs.All()
+	require.Len(t, entries, 1)
+	assert.Equal(t, []interface{}{"request_id"}, entries[0].ContextMap()["dropped_tags"])
+}
+
+func TestTagCardinalityLimiterPrefersKnownCombinations(t *testing.T) {
+	// Arrange
+	limiter, _, _ := makeTagLimiter(3, time.Hour)
+	zone := map[string]string{"zone": "a"}
+	limiter.limit(zone)
+	limiter.limit(map[string]string{"zone": "a", "pod": "1"})
+	limiter.limit(map[string]string{"zone": "a", "pod": "2"})
+
+	// Act
+	known := limiter.limit(map[string]string{"zone": "a", "pod": "1"})
+	reduced := limiter.limit(map[string]string{"zone": "a", "pod": "3"})
+
+	// Assert
+	assert.Equal(t, map[string]string{"zone": "a", "pod": "1"}, known)
+	assert.Equal(t, zone, reduced)
+}
+
+func TestTagCardinalityLimiterKeepsParserTag(t *testing.T) {
+	// Arrange
+	limiter, _, _ := makeTagLimiter(1, time.Hour)
+	limiter.limit(map[string]string{"type": "a", "pod": "1"})
+
+	// Act
+	result := limiter.limit(map[string]string{"type": "b", "pod": "2"})
+
+	// Assert
+	assert.Equal(t, map[string]string{"type": "b"}, result)
+}
+
+func TestTagCardinalityLimiterWindow(t *testing.T) {
+	// Arrange
+	limiter, clock, logs := makeTagLimiter(2, time.Hour)
+	for i := 0; i < 5; i++ {
+		limiter.limit(makeRequestTags(i))
+	}
+
+	// Act
+	clock.Advance(time.Hour)
+	results := []map[string]string{
+		limiter.limit(makeRequestTags(10)),
+		limiter.limit(makeRequestTags(11)),
+		limiter.limit(makeRequestTags(12)),
+	}
+
+	// Assert
+	assert.Equal(t, makeRequestTags(10), results[0])
+	assert.Equal(t, makeRequestTags(11), results[1])
+	assert.NotContains(t, results[2], "request_id")
+
+	// The warning is logged again once per window
+	assert.Equal(t, 2, logs.Len())
+}
@@ -0,0 +1,76 @@
+// Copyright The OpenTelemetry Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package humioexporter
+
+import (
+	"go.opentelemetry.io/collector/config"
+	"go.opentelemetry.io/collector/consumer/pdata"
+	"go.opentelemetry.io/collector/translator/conventions"
+	tracetranslator "go.opentelemetry.io/collector/translator/trace"
+)
+
+const (
+	// The default tag key used when automatically tagging events with the service name
+	serviceTagKey = "service"
+
+	// The default tag key used when automatically tagging events with the hostname of the collector
+	hostTagKey = "host"
+
+	// The tag key used to associate events with a specific parser inside Humio
+	parserTagKey = "type"
+)
+
+// Builds the set of tags to associate with all events originating from the
+// specified resource, based on the configured tagging strategy of the signal. The tags are
+// merged in layers, where each layer overrides the tags of the previous ones
+// when their keys collide:
+//
+//  1. The service tag
+//  2. The tags promoted from resource attributes
+//  3. The host tag
+//  4. The parser tag
+//  5. The static tags from the configuration
+func buildTags(cfg *Config, dataType config.DataType, res pdata.Resource, parser string) map[string]string {
+	tags := make(map[string]string, len(cfg.Tags)+len(cfg.TagFromResourceAttributes)+3)
+
+	// Resource-derived tags
+	if !cfg.serviceTagDisabled(dataType) {
+		if service, ok := res.Attributes().Get(conventions.AttributeServiceName); ok && service.StringVal() != "" {
+			tags[cfg.ServiceTagKey] = service.StringVal()
+		}
+	}
+
+	for _, name := range cfg.TagFromResourceAttributes {
+		if attr, ok := res.Attributes().Get(name); ok {
+			tags[name] = tracetranslator.AttributeValueToString(attr, false)
+		}
+	}
+
+	// Tags describing the collector and the exporter
+	if cfg.AddHostTag && cfg.hostname != "" {
+		tags[cfg.HostTagKey] = cfg.hostname
+	}
+
+	if parser != "" {
+		tags[parserTagKey] = parser
+	}
+
+	// User-provided tags take precedence over automatically generated ones
+	for k, v := range cfg.Tags {
+		tags[k] = v
+	}
+
+	return tags
+}
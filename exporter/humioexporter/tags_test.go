@@ -0,0 +1,275 @@
+// Copyright The OpenTelemetry Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package humioexporter
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/collector/config"
+	"go.opentelemetry.io/collector/consumer/pdata"
+	"go.opentelemetry.io/collector/translator/conventions"
+	"go.uber.org/zap"
+)
+
+func TestServiceTagPerSignal(t *testing.T) {
+	// Arrange
+	enabled, disabled := false, true
+	cfg := &Config{
+		ExporterSettings: config.NewExporterSettings(typeStr),
+		ServiceTagKey:    "service",
+		Tags:             map[string]string{"operation": "checkout"},
+		Logs:             LogsConfig{DisableServiceTag: &enabled},
+		Traces:           TracesConfig{DisableServiceTag: &disabled},
+	}
+	logsClient, tracesClient := &mockClient{}, &mockClient{}
+	logs := newLogsExporter(cfg, zap.NewNop(), logsClient)
+	traces := newTracesExporter(cfg, zap.NewNop(), tracesClient)
+
+	// Act
+	errLogs := logs.pushLogsData(context.Background(), makeLogs(time.Now()))
+	errTraces := traces.pushTraceData(context.Background(), makeTraces(time.Now()))
+
+	// Assert
+	require.NoError(t, errLogs)
+	require.NoError(t, errTraces)
+	require.Len(t, logsClient.structured, 1)
+	require.Len(t, tracesClient.structured, 1)
+	assert.Equal(t, map[string]string{"service": "myservice", "operation": "checkout"}, logsClient.structured[0].Tags)
+	assert.Equal(t, map[string]string{"operation": "checkout"}, tracesClient.structured[0].Tags)
+}
+
+func makeResource(attrs map[string]string) pdata.Resource {
+	res := pdata.NewResource()
+	for k, v := range attrs {
+		res.Attributes().InsertString(k, v)
+	}
+	return res
+}
+
+func TestBuildTags(t *testing.T) {
+	// Arrange
+	enabled, disabled := false, true
+	testCases := []struct {
+		desc     string
+		cfg      *Config
+		dataType config.DataType
+		res      pdata.Resource
+		parser   string
+		expected map[string]string
+	}{
+		{
+			desc:     "Service tag",
+			cfg:      &Config{ServiceTagKey: "service"},
+			res:      makeResource(map[string]string{conventions.AttributeServiceName: "myservice"}),
+			expected: map[string]string{"service": "myservice"},
+		},
+		{
+			desc:     "Missing service name",
+			cfg:      &Config{ServiceTagKey: "service"},
+			res:      makeResource(nil),
+			expected: map[string]string{},
+		},
+		{
+			desc: "Service tag disabled for traces",
+			cfg: &Config{
+				ServiceTagKey: "service",
+				Traces:        TracesConfig{DisableServiceTag: &disabled},
+			},
+			dataType: config.TracesDataType,
+			res:      makeResource(map[string]string{conventions.AttributeServiceName: "myservice"}),
+			expected: map[string]string{},
+		},
+		{
+			desc: "Service tag enabled for logs",
+			cfg: &Config{
+				ServiceTagKey:     "service",
+				DisableServiceTag: true,
+				Logs:              LogsConfig{DisableServiceTag: &enabled},
+			},
+			dataType: config.LogsDataType,
+			res:      makeResource(map[string]string{conventions.AttributeServiceName: "myservice"}),
+			expected: map[string]string{"service": "myservice"},
+		},
+		{
+			desc: "Metrics use the top-level setting",
+			cfg: &Config{
+				ServiceTagKey: "service",
+				Logs:          LogsConfig{DisableServiceTag: &disabled},
+				Traces:        TracesConfig{DisableServiceTag: &disabled},
+			},
+			dataType: config.MetricsDataType,
+			res:      makeResource(map[string]string{conventions.AttributeServiceName: "myservice"}),
+			expected: map[string]string{"service": "myservice"},
+		},
+		{
+			desc:     "Custom service tag key",
+			cfg:      &Config{ServiceTagKey: "serviceName"},
+			res:      makeResource(map[string]string{conventions.AttributeServiceName: "myservice"}),
+			expected: map[string]string{"serviceName": "myservice"},
+		},
+		{
+			desc: "Disabled service tag",
+			cfg: &Config{
+				DisableServiceTag: true,
+				Tags:              map[string]string{"k": "v"},
+			},
+			res:      makeResource(map[string]string{conventions.AttributeServiceName: "myservice"}),
+			expected: map[string]string{"k": "v"},
+		},
+		{
+			desc: "Host tag",
+			cfg: &Config{
+				ServiceTagKey: "service",
+				AddHostTag:    true,
+				HostTagKey:    "collector",
+				hostname:      "collector-1",
+			},
+			res: makeResource(map[string]string{conventions.AttributeServiceName: "myservice"}),
+			expected: map[string]string{
+				"service":   "myservice",
+				"collector": "collector-1",
+			},
+		},
+		{
+			desc:     "Parser tag",
+			cfg:      &Config{ServiceTagKey: "service"},
+			res:      makeResource(nil),
+			parser:   "custom-parser",
+			expected: map[string]string{"type": "custom-parser"},
+		},
+		{
+			desc: "Tags from resource attributes",
+			cfg: &Config{
+				ServiceTagKey:             "service",
+				TagFromResourceAttributes: []string{"deployment.environment", "k8s.namespace.name", "missing"},
+			},
+			res: makeResource(map[string]string{
+				conventions.AttributeServiceName:           "myservice",
+				conventions.AttributeDeploymentEnvironment: "production",
+				conventions.AttributeK8sNamespace:          "default",
+				"unused":                                   "value",
+			}),
+			expected: map[string]string{
+				"service":                "myservice",
+				"deployment.environment": "production",
+				"k8s.namespace.name":     "default",
+			},
+		},
+		{
+			desc: "Static tags take precedence over resource attributes",
+			cfg: &Config{
+				Tags:                      map[string]string{"deployment.environment": "staging"},
+				TagFromResourceAttributes: []string{"deployment.environment"},
+			},
+			res:      makeResource(map[string]string{conventions.AttributeDeploymentEnvironment: "production"}),
+			expected: map[string]string{"deployment.environment": "staging"},
+		},
+		{
+			desc: "Resource attributes take precedence over the service tag",
+			cfg: &Config{
+				ServiceTagKey:             "service",
+				TagFromResourceAttributes: []string{"service"},
+			},
+			res: makeResource(map[string]string{
+				conventions.AttributeServiceName: "myservice",
+				"service":                        "attribute",
+			}),
+			expected: map[string]string{"service": "attribute"},
+		},
+		{
+			desc: "Host tag takes precedence over resource attributes",
+			cfg: &Config{
+				ServiceTagKey:             "host",
+				AddHostTag:                true,
+				HostTagKey:                "host",
+				hostname:                  "collector-1",
+				TagFromResourceAttributes: []string{"host"},
+			},
+			res: makeResource(map[string]string{
+				conventions.AttributeServiceName: "myservice",
+				"host":                           "attribute",
+			}),
+			expected: map[string]string{"host": "collector-1"},
+		},
+		{
+			desc: "Parser tag takes precedence over the host tag",
+			cfg: &Config{
+				AddHostTag: true,
+				HostTagKey: "type",
+				hostname:   "collector-1",
+			},
+			res:      makeResource(nil),
+			parser:   "custom-parser",
+			expected: map[string]string{"type": "custom-parser"},
+		},
+		{
+			desc: "Static tags take precedence over the host tag",
+			cfg: &Config{
+				AddHostTag: true,
+				HostTagKey: "host",
+				hostname:   "collector-1",
+				Tags:       map[string]string{"host": "static"},
+			},
+			res:      makeResource(nil),
+			expected: map[string]string{"host": "static"},
+		},
+		{
+			desc: "Static tags take precedence over the parser tag",
+			cfg: &Config{
+				Tags: map[string]string{"type": "static"},
+			},
+			res:      makeResource(nil),
+			parser:   "custom-parser",
+			expected: map[string]string{"type": "static"},
+		},
+		{
+			desc: "Every layer collides",
+			cfg: &Config{
+				ServiceTagKey:             "k",
+				TagFromResourceAttributes: []string{"k", "a"},
+				AddHostTag:                true,
+				HostTagKey:                "k",
+				hostname:                  "collector-1",
+				Tags:                      map[string]string{"k": "static"},
+			},
+			res: makeResource(map[string]string{
+				conventions.AttributeServiceName: "myservice",
+				"k":                              "attribute",
+				"a":                              "kept",
+			}),
+			expected: map[string]string{"k": "static", "a": "kept"},
+		},
+		{
+			desc: "Static tags take precedence",
+			cfg: &Config{
+				ServiceTagKey: "service",
+				Tags:          map[string]string{"service": "override"},
+			},
+			res:      makeResource(map[string]string{conventions.AttributeServiceName: "myservice"}),
+			expected: map[string]string{"service": "override"},
+		},
+	}
+
+	// Act / Assert
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			assert.Equal(t, tC.expected, buildTags(tC.cfg, tC.dataType, tC.res, tC.parser))
+		})
+	}
+}
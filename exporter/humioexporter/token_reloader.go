@@ -0,0 +1,94 @@
+// Copyright The OpenTelemetry Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package humioexporter
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// Periodically re-reads the ingest token file, such that the token can be
+// rotated without restarting the collector
+type tokenReloader struct {
+	file     string
+	interval time.Duration
+	logger   *zap.Logger
+
+	// The current value of the authorization header, safe for concurrent access
+	header atomic.Value
+
+	done     chan struct{}
+	stopOnce sync.Once
+	wg       sync.WaitGroup
+}
+
+// Creates a reloader for the ingest token file, starting from the initial
+// authorization header. The file is not read until the reloader is started
+func newTokenReloader(file string, interval time.Duration, header string, logger *zap.Logger) *tokenReloader {
+	r := &tokenReloader{
+		file:     file,
+		interval: interval,
+		logger:   logger,
+		done:     make(chan struct{}),
+	}
+	r.header.Store(header)
+	return r
+}
+
+// Get the most recently read authorization header
+func (r *tokenReloader) authorization() string {
+	return r.header.Load().(string)
+}
+
+// Start re-reading the token file in the background on every interval
+func (r *tokenReloader) start() {
+	r.wg.Add(1)
+	go func() {
+		defer r.wg.Done()
+
+		ticker := time.NewTicker(r.interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				r.reload()
+			case <-r.done:
+				return
+			}
+		}
+	}()
+}
+
+// Read the token file once, keeping the previous token if it cannot be read
+func (r *tokenReloader) reload() {
+	token, err := readIngestToken(r.file)
+	if err != nil {
+		r.logger.Warn("Unable to reload the ingest token, keeping the previous token", zap.Error(err))
+		return
+	}
+	r.header.Store("Bearer " + token)
+}
+
+// Stop reloading the token file, waiting for the background goroutine to exit
+func (r *tokenReloader) stop() {
+	r.stopOnce.Do(func() {
+		close(r.done)
+	})
+	r.wg.Wait()
+}
@@ -0,0 +1,74 @@
+// Copyright The OpenTelemetry Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package humioexporter
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+func TestTokenReloaderReload(t *testing.T) {
+	// Arrange
+	file := writeTokenFile(t, "first\n")
+	reloader := newTokenReloader(file, time.Hour, "Bearer first", zap.NewNop())
+	require.NoError(t, ioutil.WriteFile(file, []byte("second\n"), 0600))
+
+	// Act
+	reloader.reload()
+
+	// Assert
+	assert.Equal(t, "Bearer second", reloader.authorization())
+}
+
+func TestTokenReloaderKeepsTokenOnError(t *testing.T) {
+	// Arrange
+	file := writeTokenFile(t, "first\n")
+	core, logs := observer.New(zap.WarnLevel)
+	reloader := newTokenReloader(file, time.Hour, "Bearer first", zap.New(core))
+	require.NoError(t, os.Remove(file))
+
+	// Act
+	reloader.reload()
+
+	// Assert
+	assert.Equal(t, "Bearer first", reloader.authorization())
+	assert.Equal(t, 1, logs.FilterMessage("Unable to reload the ingest token, keeping the previous token").Len())
+}
+
+func TestTokenReloaderBackground(t *testing.T) {
+	// Arrange
+	file := writeTokenFile(t, "first\n")
+	reloader := newTokenReloader(file, 10*time.Millisecond, "Bearer first", zap.NewNop())
+
+	// Act
+	reloader.start()
+	require.NoError(t, ioutil.WriteFile(file, []byte("second\n"), 0600))
+
+	// Assert
+	assert.Eventually(t, func() bool {
+		return reloader.authorization() == "Bearer second"
+	}, 5*time.Second, 10*time.Millisecond)
+
+	// Stopping more than once must not block or panic
+	reloader.stop()
+	reloader.stop()
+}
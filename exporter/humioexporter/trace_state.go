@@ -0,0 +1,112 @@
+// Copyright The OpenTelemetry Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package humioexporter
+
+import (
+	"fmt"
+	"strings"
+)
+
+const (
+	// The name of the field holding the trace state of a span or link
+	traceStateField = "trace_state"
+
+	// The maximum number of list members in a trace state, as defined by W3C Trace Context
+	maxTraceStateMembers = 32
+)
+
+// Parses a W3C trace state into its list members, such as congo=t61rcWkgMzE,rojo=00f067aa0ba902b7
+func parseTraceState(traceState string) (map[string]string, error) {
+	members := strings.Split(traceState, ",")
+	result := make(map[string]string, len(members))
+	for _, member := range members {
+		// Empty list members are allowed, and surrounding whitespace is optional
+		member = strings.Trim(member, " \t")
+		if member == "" {
+			continue
+		}
+
+		idx := strings.IndexByte(member, '=')
+		if idx < 0 {
+			return nil, fmt.Errorf("the list member %q is missing a value", member)
+		}
+		key, value := member[:idx], member[idx+1:]
+		if !isValidTraceStateKey(key) {
+			return nil, fmt.Errorf("the list member %q has an invalid key", member)
+		}
+		if !isValidTraceStateValue(value) {
+			return nil, fmt.Errorf("the list member %q has an invalid value", member)
+		}
+		if _, ok := result[key]; ok {
+			return nil, fmt.Errorf("the key %q is used by multiple list members", key)
+		}
+		result[key] = value
+	}
+
+	if len(result) > maxTraceStateMembers {
+		return nil, fmt.Errorf("the trace state has %d list members, at most %d are allowed", len(result), maxTraceStateMembers)
+	}
+	return result, nil
+}
+
+// Whether a key is either a simple key, or a multi-tenant key of the form tenant@system
+func isValidTraceStateKey(key string) bool {
+	if len(key) == 0 || len(key) > 256 {
+		return false
+	}
+
+	at := strings.IndexByte(key, '@')
+	if at < 0 {
+		return isLowerAlpha(key[0]) && isTraceStateKeyChars(key[1:])
+	}
+
+	tenant, system := key[:at], key[at+1:]
+	return len(tenant) > 0 && len(tenant) <= 241 && len(system) > 0 && len(system) <= 14 &&
+		(isLowerAlpha(tenant[0]) || isDigit(tenant[0])) && isTraceStateKeyChars(tenant[1:]) &&
+		isLowerAlpha(system[0]) && isTraceStateKeyChars(system[1:])
+}
+
+func isTraceStateKeyChars(s string) bool {
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if !isLowerAlpha(c) && !isDigit(c) && c != '_' && c != '-' && c != '*' && c != '/' {
+			return false
+		}
+	}
+	return true
+}
+
+// Whether a value consists of printable ASCII characters other than comma and
+// equals sign, and does not end with a space
+func isValidTraceStateValue(value string) bool {
+	if len(value) == 0 || len(value) > 256 || value[len(value)-1] == ' ' {
+		return false
+	}
+	for i := 0; i < len(value); i++ {
+		c := value[i]
+		if c < 0x20 || c > 0x7e || c == ',' || c == '=' {
+			return false
+		}
+	}
+	return true
+}
+
+func isLowerAlpha(c byte) bool {
+	return c >= 'a' && c <= 'z'
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
@@ -0,0 +1,110 @@
+// Copyright The OpenTelemetry Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package humioexporter
+
+import (
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseTraceState(t *testing.T) {
+	// Arrange
+	testCases := []struct {
+		desc       string
+		traceState string
+		expected   map[string]string
+	}{
+		{
+			desc:       "Single member",
+			traceState: "rojo=00f067aa0ba902b7",
+			expected:   map[string]string{"rojo": "00f067aa0ba902b7"},
+		},
+		{
+			desc:       "Multiple members with whitespace",
+			traceState: "congo=t61rcWkgMzE, rojo=00f067aa0ba902b7 ,\tsampling=p:8",
+			expected: map[string]string{
+				"congo":    "t61rcWkgMzE",
+				"rojo":     "00f067aa0ba902b7",
+				"sampling": "p:8",
+			},
+		},
+		{
+			desc:       "Empty members",
+			traceState: "a=1,,b=2,",
+			expected:   map[string]string{"a": "1", "b": "2"},
+		},
+		{
+			desc:       "Multi-tenant key",
+			traceState: "fw529a3039@dt=FW4;0;0;0;0;0;0;ab",
+			expected:   map[string]string{"fw529a3039@dt": "FW4;0;0;0;0;0;0;ab"},
+		},
+		{
+			desc:       "Key with special characters",
+			traceState: "my_vendor-1*/x=v a",
+			expected:   map[string]string{"my_vendor-1*/x": "v a"},
+		},
+	}
+
+	// Act / Assert
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			actual, err := parseTraceState(tC.traceState)
+
+			require.NoError(t, err)
+			assert.Equal(t, tC.expected, actual)
+		})
+	}
+}
+
+func TestParseTraceStateMalformed(t *testing.T) {
+	// Arrange
+	tooMany := make([]string, maxTraceStateMembers+1)
+	for i := range tooMany {
+		tooMany[i] = "k" + strconv.Itoa(i) + "=v"
+	}
+
+	testCases := []struct {
+		desc       string
+		traceState string
+	}{
+		{desc: "Missing value", traceState: "rojo"},
+		{desc: "Empty value", traceState: "rojo="},
+		{desc: "Uppercase key", traceState: "Rojo=1"},
+		{desc: "Key starting with a digit", traceState: "1rojo=1"},
+		{desc: "Empty key", traceState: "=1"},
+		{desc: "Empty tenant", traceState: "@dt=1"},
+		{desc: "Empty system", traceState: "fw@=1"},
+		{desc: "System starting with a digit", traceState: "fw@1dt=1"},
+		{desc: "Value with an equals sign", traceState: "rojo=a=b"},
+		{desc: "Value with a control character", traceState: "rojo=a\x01b"},
+		{desc: "Duplicate key", traceState: "rojo=1,congo=2,rojo=3"},
+		{desc: "Key too long", traceState: strings.Repeat("a", 257) + "=1"},
+		{desc: "Too many members", traceState: strings.Join(tooMany, ",")},
+	}
+
+	// Act / Assert
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			actual, err := parseTraceState(tC.traceState)
+
+			require.Error(t, err)
+			assert.Nil(t, actual)
+		})
+	}
+}
@@ -16,40 +16,475 @@ package humioexporter
 
 import (
 	"context"
+	"encoding/base64"
+	"encoding/hex"
 	"errors"
-	"sync"
+	"time"
 
+	"go.opentelemetry.io/collector/component"
+	"go.opentelemetry.io/collector/config"
 	"go.opentelemetry.io/collector/consumer/consumererror"
 	"go.opentelemetry.io/collector/consumer/pdata"
 	"go.uber.org/zap"
 )
 
+const (
+	// The default name of the field holding the duration of a span in milliseconds
+	defaultDurationField = "duration_ms"
+
+	// The name of the field holding the duration of a span in nanoseconds
+	durationNanosField = "duration_ns"
+
+	// The default names of the fields holding the status of a span
+	defaultStatusCodeField    = "status_code"
+	defaultStatusMessageField = "status_message"
+)
+
+// Supported presets for renaming the fields of spans
+const (
+	fieldMappingPresetNone = "none"
+	fieldMappingPresetCIM  = "cim"
+)
+
 type humioTracesExporter struct {
 	cfg    *Config
 	logger *zap.Logger
 	client exporterClient
-	wg     sync.WaitGroup
+
+	// Requests that are currently being sent, which are drained on shutdown
+	inflight *inflightTracker
+	queue    *queueTracker
+
+	// Guards against creating too many distinct data sources in Humio
+	tags *tagCardinalityLimiter
+
+	// The names to rename the fields of spans to, if any
+	fieldMapping map[string]string
 }
 
 func newTracesExporter(cfg *Config, logger *zap.Logger, client exporterClient) *humioTracesExporter {
 	return &humioTracesExporter{
-		cfg:    cfg,
-		logger: logger,
-		client: client,
+		cfg:          cfg,
+		logger:       logger,
+		client:       client,
+		inflight:     newInflightTracker(logger),
+		queue:        newQueueTracker(cfg),
+		tags:         newTagCardinalityLimiter(cfg.MaxTagCardinality, cfg.TagCardinalityWindow, logger),
+		fieldMapping: cfg.getSpanFieldMapping(),
 	}
 }
 
 func (e *humioTracesExporter) pushTraceData(ctx context.Context, td pdata.Traces) error {
-	e.wg.Add(1)
-	defer e.wg.Done()
+	e.queue.dequeue(ctx)
+	ctx, finish := e.inflight.begin(ctx)
+
+	err := e.sendTraces(ctx, td)
+	var failed consumererror.Traces
+	switch {
+	case err == nil:
+		finish(td.SpanCount(), 0)
+	case consumererror.AsTraces(err, &failed):
+		dropped := failed.GetTraces().SpanCount()
+		finish(td.SpanCount()-dropped, dropped)
+	default:
+		finish(0, td.SpanCount())
+	}
+	return err
+}
+
+func (e *humioTracesExporter) sendTraces(ctx context.Context, td pdata.Traces) error {
+	if e.cfg.Traces.PassthroughOTLPJSON {
+		return e.sendPassthroughTraces(ctx, td)
+	}
+
+	evts, spanPositions := e.tracesToHumioEvents(td)
+	if len(evts) == 0 {
+		return nil
+	}
+
+	transformEvents(e.cfg, evts)
+	applyRawStrings(evts, e.cfg.Traces.RawStringMode)
+	err := e.client.sendStructuredEvents(ctx, evts)
+
+	// Only the spans behind the events rejected by Humio should be retried
+	var partial *partialFailureError
+	if errors.As(err, &partial) {
+		failed := make([]int, len(partial.failed))
+		for i, pos := range partial.failed {
+			failed[i] = spanPositions[pos]
+		}
+		return consumererror.NewTraces(err, filterTraces(td, failed))
+	}
+	return err
+}
+
+// Converts traces into structured Humio events, where each span becomes a
+// single event, optionally followed by separate events for its span events.
+// Events from resources with the same set of tags are grouped together. The
+// position of the originating span is returned for each event, in order
+func (e *humioTracesExporter) tracesToHumioEvents(td pdata.Traces) ([]*HumioStructuredEvents, []int) {
+	results := make([]*HumioStructuredEvents, 0, td.ResourceSpans().Len())
+	var spanPositions []int
+	pos := 0
+
+	resSpans := td.ResourceSpans()
+	for i := 0; i < resSpans.Len(); i++ {
+		resSpan := resSpans.At(i)
+		res := resSpan.Resource()
+		evts := make([]*HumioStructuredEvent, 0)
+
+		instSpans := resSpan.InstrumentationLibrarySpans()
+		for j := 0; j < instSpans.Len(); j++ {
+			lib := instSpans.At(j).InstrumentationLibrary()
+			spans := instSpans.At(j).Spans()
+			for k := 0; k < spans.Len(); k++ {
+				span := spans.At(k)
+				evts = append(evts, e.spanToHumioEvent(span, lib, res))
+				spanPositions = append(spanPositions, pos)
+
+				if e.cfg.Traces.SeparateSpanEvents {
+					for l := 0; l < span.Events().Len(); l++ {
+						evts = append(evts, e.spanEventToHumioEvent(span, span.Events().At(l), lib))
+						spanPositions = append(spanPositions, pos)
+					}
+				}
+				pos++
+			}
+		}
+
+		if len(evts) == 0 {
+			continue
+		}
+
+		results = append(results, &HumioStructuredEvents{
+			Tags:         e.tags.limit(buildTags(e.cfg, config.TracesDataType, res, "")),
+			Events:       evts,
+			routingValue: getRoutingValue(e.cfg, res),
+		})
+	}
+
+	results, order := arrangeStructuredEvents(e.cfg, results)
+	return results, reorderPositions(spanPositions, order)
+}
+
+// Adds the trace state of a span or link in the configured representation. A
+// trace state which cannot be parsed is added as a raw string regardless
+func (e *humioTracesExporter) addTraceState(attrs map[string]interface{}, traceState pdata.TraceState) {
+	if traceState == pdata.TraceStateEmpty {
+		return
+	}
+
+	format := e.cfg.Traces.TraceStateFormat
+	if format == traceStateFormatFields || format == traceStateFormatBoth {
+		members, err := parseTraceState(string(traceState))
+		if err != nil {
+			e.logger.Warn("Unable to parse the trace state, sending it as a raw string",
+				zap.String("trace_state", string(traceState)),
+				zap.Error(err))
+			format = traceStateFormatRaw
+		}
+		for k, v := range members {
+			attrs[traceStateField+"."+k] = v
+		}
+	}
+
+	if format != traceStateFormatFields {
+		attrs[traceStateField] = string(traceState)
+	}
+}
+
+// Converts a single span into a structured Humio event. Resource and span
+// attributes are merged after applying the configured prefixes, with span
+// attributes taking precedence
+func (e *humioTracesExporter) spanToHumioEvent(span pdata.Span, lib pdata.InstrumentationLibrary, res pdata.Resource) *HumioStructuredEvent {
+	resPrefix, spanPrefix := e.cfg.getSpanAttributePrefixes()
+	attrs := make(map[string]interface{}, res.Attributes().Len()+span.Attributes().Len())
+	resAttrs := attributeMapToMap(res.Attributes())
+	dropResourceAttributes(e.cfg, resAttrs)
+	stripAttributeKeyPrefixes(e.cfg, e.logger, resAttrs)
+	for k, v := range resAttrs {
+		attrs[resPrefix+k] = v
+	}
+	spanAttrs := attributeMapToMap(span.Attributes())
+	stripAttributeKeyPrefixes(e.cfg, e.logger, spanAttrs)
+	prefixed := make(map[string]interface{}, len(spanAttrs))
+	for k, v := range spanAttrs {
+		prefixed[spanPrefix+k] = v
+	}
+	mergeAttributes(e.cfg, e.logger, attrs, prefixed, spanScope)
+	limitAttributeValues(e.cfg, attrs)
+
+	attrs["trace_id"] = e.formatTraceID(span.TraceID())
+	attrs["span_id"] = e.formatSpanID(span.SpanID())
+	if !span.ParentSpanID().IsEmpty() {
+		attrs["parent_span_id"] = e.formatSpanID(span.ParentSpanID())
+	}
+	e.addTraceState(attrs, span.TraceState())
+	attrs["name"] = span.Name()
+	attrs["kind"] = int32(span.Kind())
+	if e.cfg.Traces.SpanKindField != "" {
+		attrs[e.cfg.Traces.SpanKindField] = spanKindToString(span.Kind())
+	}
+	e.addDurationFields(attrs, span)
+	e.addStatusFields(attrs, span.Status())
+	addDroppedAttributesCount(attrs, span.DroppedAttributesCount())
+	addScopeFields(e.cfg, attrs, lib)
+
+	if !e.cfg.Traces.SeparateSpanEvents && span.Events().Len() > 0 {
+		events := make([]map[string]interface{}, span.Events().Len())
+		for i := 0; i < span.Events().Len(); i++ {
+			event := span.Events().At(i)
+			eventAttrs := attributeMapToMap(event.Attributes())
+			stripAttributeKeyPrefixes(e.cfg, e.logger, eventAttrs)
+			limitAttributeValues(e.cfg, eventAttrs)
+			events[i] = map[string]interface{}{
+				"name":       event.Name(),
+				"timestamp":  e.formatTimestamp(event.Timestamp().AsTime()),
+				"attributes": eventAttrs,
+			}
+		}
+		attrs["events"] = events
+	}
+
+	if e.cfg.Traces.IncludeLinks && span.Links().Len() > 0 {
+		links := make([]map[string]interface{}, span.Links().Len())
+		for i := 0; i < span.Links().Len(); i++ {
+			link := span.Links().At(i)
+			linkAttrs := attributeMapToMap(link.Attributes())
+			stripAttributeKeyPrefixes(e.cfg, e.logger, linkAttrs)
+			limitAttributeValues(e.cfg, linkAttrs)
+			links[i] = map[string]interface{}{
+				"trace_id":   e.formatTraceID(link.TraceID()),
+				"span_id":    e.formatSpanID(link.SpanID()),
+				"attributes": linkAttrs,
+			}
+			e.addTraceState(links[i], link.TraceState())
+		}
+		attrs["links"] = links
+	}
+
+	if e.cfg.Traces.TimestampField != "" {
+		attrs[e.cfg.Traces.TimestampField] = e.formatTimestamp(span.StartTimestamp().AsTime())
+	}
+
+	attrs = renameFields(attrs, e.fieldMapping)
+	addStaticFields(attrs, e.cfg.StaticFields)
+	if e.cfg.SanitizeFieldKeys {
+		attrs = sanitizeFieldKeys(attrs, e.cfg.getFieldKeyReplacement())
+	}
+	omitEmptyAttributes(e.cfg, attrs)
+	addIngestTimestamp(e.cfg, attrs, span.StartTimestamp().AsTime())
+
+	precision := timestampUnitPrecision(e.cfg.Traces.getTimestampUnit())
+	return &HumioStructuredEvent{
+		Timestamp:  span.StartTimestamp().AsTime(),
+		AsUnix:     precision > 0,
+		Precision:  precision,
+		Attributes: attrs,
+	}
+}
 
-	// TODO: Transform to Humio event structure
-	// TODO: Send events to Humio
+// Adds the duration of the span, which saves queries in Humio from computing it
+// from the timestamps. Spans that have not ended yet are left without a duration
+func (e *humioTracesExporter) addDurationFields(attrs map[string]interface{}, span pdata.Span) {
+	start, end := span.StartTimestamp(), span.EndTimestamp()
+	if end == 0 || end < start {
+		return
+	}
+
+	duration := time.Duration(end - start)
+	attrs[e.cfg.Traces.getDurationField()] = float64(duration) / float64(time.Millisecond)
+	// The CIM preset holds the duration in nanoseconds
+	if e.cfg.Traces.IncludeDurationNanos || e.cfg.Traces.FieldMappingPreset == fieldMappingPresetCIM {
+		attrs[durationNanosField] = int64(duration)
+	}
+}
+
+// Renames the fields of an event according to the mapping, where renamed fields
+// take precedence over other fields which already have the new name
+func renameFields(attrs map[string]interface{}, mapping map[string]string) map[string]interface{} {
+	if len(mapping) == 0 {
+		return attrs
+	}
+
+	result := make(map[string]interface{}, len(attrs))
+	for k, v := range attrs {
+		if _, ok := mapping[k]; !ok {
+			result[k] = v
+		}
+	}
+	for k, v := range attrs {
+		if name, ok := mapping[k]; ok {
+			result[name] = v
+		}
+	}
+	return result
+}
 
-	return consumererror.Permanent(errors.New("Not implemented yet"))
+// Adds the status of the span, with the code in the same readable form as used
+// by the OpenTelemetry APIs. Spans without a status message are left without one
+func (e *humioTracesExporter) addStatusFields(attrs map[string]interface{}, status pdata.SpanStatus) {
+	attrs[e.cfg.Traces.getStatusCodeField()] = statusCodeToString(status.Code())
+	if status.Message() != "" {
+		attrs[e.cfg.Traces.getStatusMessageField()] = status.Message()
+	}
+}
+
+// Get the readable name of a status code. Unknown codes are treated as unset
+func statusCodeToString(code pdata.StatusCode) string {
+	switch code {
+	case pdata.StatusCodeOk:
+		return "Ok"
+	case pdata.StatusCodeError:
+		return "Error"
+	default:
+		return "Unset"
+	}
+}
+
+// Get the readable name of a span kind. Unknown kinds are treated as unspecified
+func spanKindToString(kind pdata.SpanKind) string {
+	switch kind {
+	case pdata.SpanKindINTERNAL:
+		return "Internal"
+	case pdata.SpanKindSERVER:
+		return "Server"
+	case pdata.SpanKindCLIENT:
+		return "Client"
+	case pdata.SpanKindPRODUCER:
+		return "Producer"
+	case pdata.SpanKindCONSUMER:
+		return "Consumer"
+	default:
+		return "Unspecified"
+	}
+}
+
+// Converts a span event into a separate structured Humio event, which is
+// linked to the span through the trace and span ids
+func (e *humioTracesExporter) spanEventToHumioEvent(span pdata.Span, event pdata.SpanEvent, lib pdata.InstrumentationLibrary) *HumioStructuredEvent {
+	attrs := attributeMapToMap(event.Attributes())
+	stripAttributeKeyPrefixes(e.cfg, e.logger, attrs)
+	limitAttributeValues(e.cfg, attrs)
+	attrs["trace_id"] = e.formatTraceID(span.TraceID())
+	attrs["span_id"] = e.formatSpanID(span.SpanID())
+	attrs["name"] = event.Name()
+	addScopeFields(e.cfg, attrs, lib)
+	if e.cfg.Traces.TimestampField != "" {
+		attrs[e.cfg.Traces.TimestampField] = e.formatTimestamp(event.Timestamp().AsTime())
+	}
+
+	attrs = renameFields(attrs, e.fieldMapping)
+	addStaticFields(attrs, e.cfg.StaticFields)
+	if e.cfg.SanitizeFieldKeys {
+		attrs = sanitizeFieldKeys(attrs, e.cfg.getFieldKeyReplacement())
+	}
+	omitEmptyAttributes(e.cfg, attrs)
+	addIngestTimestamp(e.cfg, attrs, event.Timestamp().AsTime())
+
+	precision := timestampUnitPrecision(e.cfg.Traces.getTimestampUnit())
+	return &HumioStructuredEvent{
+		Timestamp:  event.Timestamp().AsTime(),
+		AsUnix:     precision > 0,
+		Precision:  precision,
+		Attributes: attrs,
+	}
+}
+
+// Formats a timestamp nested within the attributes of an event, using the
+// same representation as the timestamp of the event itself
+func (e *humioTracesExporter) formatTimestamp(t time.Time) interface{} {
+	return formatTimestampUnit(t, e.cfg.Traces.getTimestampUnit())
+}
+
+// Creates a copy of the traces containing only the spans at the specified
+// positions, counted across all resources in the order they are exported
+func filterTraces(td pdata.Traces, positions []int) pdata.Traces {
+	keep := make(map[int]bool, len(positions))
+	for _, pos := range positions {
+		keep[pos] = true
+	}
+
+	result := pdata.NewTraces()
+	pos := 0
+
+	resSpans := td.ResourceSpans()
+	for i := 0; i < resSpans.Len(); i++ {
+		resSpan := resSpans.At(i)
+		filteredRes := pdata.NewResourceSpans()
+		resSpan.Resource().CopyTo(filteredRes.Resource())
+
+		instSpans := resSpan.InstrumentationLibrarySpans()
+		for j := 0; j < instSpans.Len(); j++ {
+			instSpan := instSpans.At(j)
+			filteredInst := pdata.NewInstrumentationLibrarySpans()
+			instSpan.InstrumentationLibrary().CopyTo(filteredInst.InstrumentationLibrary())
+
+			spans := instSpan.Spans()
+			for k := 0; k < spans.Len(); k++ {
+				if keep[pos] {
+					span := pdata.NewSpan()
+					spans.At(k).CopyTo(span)
+					filteredInst.Spans().Append(span)
+				}
+				pos++
+			}
+
+			if filteredInst.Spans().Len() > 0 {
+				filteredRes.InstrumentationLibrarySpans().Append(filteredInst)
+			}
+		}
+
+		if filteredRes.InstrumentationLibrarySpans().Len() > 0 {
+			result.ResourceSpans().Append(filteredRes)
+		}
+	}
+
+	return result
+}
+
+// Encode a trace id in the configured format, where an empty id is encoded
+// as an empty string rather than zeros
+func (e *humioTracesExporter) formatTraceID(id pdata.TraceID) string {
+	if id.IsEmpty() {
+		return ""
+	}
+
+	b := id.Bytes()
+	return e.formatID(b[:])
+}
+
+// Encode a span id in the configured format, where an empty id is encoded
+// as an empty string rather than zeros
+func (e *humioTracesExporter) formatSpanID(id pdata.SpanID) string {
+	if id.IsEmpty() {
+		return ""
+	}
+
+	b := id.Bytes()
+	return e.formatID(b[:])
+}
+
+func (e *humioTracesExporter) formatID(b []byte) string {
+	if e.cfg.Traces.IDFormat == idFormatBase64 {
+		return base64.StdEncoding.EncodeToString(b)
+	}
+	return hex.EncodeToString(b)
+}
+
+// Start the client, and verify the endpoint before any data is exported, if configured
+func (e *humioTracesExporter) start(ctx context.Context, host component.Host) error {
+	if err := e.client.start(ctx); err != nil {
+		return err
+	}
+
+	if !e.cfg.CheckEndpointOnStart {
+		return nil
+	}
+	return e.client.checkEndpoint(ctx)
 }
 
-func (e *humioTracesExporter) shutdown(context.Context) error {
-	e.wg.Wait()
-	return nil
+func (e *humioTracesExporter) shutdown(ctx context.Context) error {
+	e.inflight.wait()
+	return e.client.shutdown(ctx)
 }
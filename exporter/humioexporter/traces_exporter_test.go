@@ -16,34 +16,1502 @@ package humioexporter
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
+	"strconv"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	"go.opentelemetry.io/collector/config"
 	"go.opentelemetry.io/collector/consumer/consumererror"
 	"go.opentelemetry.io/collector/consumer/pdata"
+	"go.opentelemetry.io/collector/translator/conventions"
 	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
 )
 
+func makeTraces(start time.Time) pdata.Traces {
+	td := pdata.NewTraces()
+	td.ResourceSpans().Resize(1)
+	rs := td.ResourceSpans().At(0)
+	rs.Resource().Attributes().InsertString(conventions.AttributeServiceName, "myservice")
+	rs.Resource().Attributes().InsertString("shared", "resource")
+
+	rs.InstrumentationLibrarySpans().Resize(1)
+	spans := rs.InstrumentationLibrarySpans().At(0).Spans()
+	spans.Resize(2)
+
+	root := spans.At(0)
+	root.SetTraceID(pdata.NewTraceID([16]byte{0x01, 0x02, 0x03, 0x04, 0x05, 0x06, 0x07, 0x08, 0x09, 0x0a, 0x0b, 0x0c, 0x0d, 0x0e, 0x0f, 0x10}))
+	root.SetSpanID(pdata.NewSpanID([8]byte{0x0a, 0x0b, 0x0c, 0x0d, 0x0e, 0x0f, 0x10, 0x11}))
+	root.SetName("root")
+	root.SetKind(pdata.SpanKindSERVER)
+	root.SetStartTimestamp(pdata.TimestampFromTime(start))
+	root.SetEndTimestamp(pdata.TimestampFromTime(start.Add(time.Second)))
+	root.Attributes().InsertString("shared", "span")
+	root.Attributes().InsertInt("count", 5)
+
+	child := spans.At(1)
+	child.SetTraceID(root.TraceID())
+	child.SetSpanID(pdata.NewSpanID([8]byte{0x1a, 0x1b, 0x1c, 0x1d, 0x1e, 0x1f, 0x20, 0x21}))
+	child.SetParentSpanID(root.SpanID())
+	child.SetTraceState("key=value")
+	child.SetName("child")
+	child.SetKind(pdata.SpanKindCLIENT)
+	child.SetStartTimestamp(pdata.TimestampFromTime(start.Add(time.Microsecond)))
+	child.SetEndTimestamp(pdata.TimestampFromTime(start.Add(time.Millisecond)))
+
+	return td
+}
+
 func TestPushTraceData(t *testing.T) {
 	// Arrange
-	exp := newTracesExporter(&Config{ExporterSettings: config.NewExporterSettings(typeStr)}, zap.NewNop(), nil)
+	client := &mockClient{}
+	cfg := &Config{
+		ExporterSettings: config.NewExporterSettings(typeStr),
+		ServiceTagKey:    "service",
+		Traces: TracesConfig{
+			UnixTimestamps:     true,
+			TimestampPrecision: "nanoseconds",
+		},
+	}
+	exp := newTracesExporter(cfg, zap.NewNop(), client)
+	start := time.Date(2021, 3, 28, 12, 30, 15, 0, time.UTC)
+
+	// Act
+	err := exp.pushTraceData(context.Background(), makeTraces(start))
+
+	// Assert
+	require.NoError(t, err)
+	require.Len(t, client.structured, 1)
+	assert.Equal(t, map[string]string{"service": "myservice"}, client.structured[0].Tags)
+
+	evts := client.structured[0].Events
+	require.Len(t, evts, 2)
+	assert.Equal(t, start, evts[0].Timestamp)
+	assert.True(t, evts[0].AsUnix)
+	assert.Equal(t, time.Nanosecond, evts[0].Precision)
+	assert.Equal(t, map[string]interface{}{
+		"service.name": "myservice",
+		"shared":       "span",
+		"count":        int64(5),
+		"trace_id":     "0102030405060708090a0b0c0d0e0f10",
+		"span_id":      "0a0b0c0d0e0f1011",
+		"name":         "root",
+		"kind":         int32(pdata.SpanKindSERVER),
+		"duration_ms":  float64(1000),
+		"status_code":  "Unset",
+	}, evts[0].Attributes)
+
+	assert.Equal(t, start.Add(time.Microsecond), evts[1].Timestamp)
+	assert.Equal(t, map[string]interface{}{
+		"service.name":   "myservice",
+		"shared":         "resource",
+		"trace_id":       "0102030405060708090a0b0c0d0e0f10",
+		"span_id":        "1a1b1c1d1e1f2021",
+		"parent_span_id": "0a0b0c0d0e0f1011",
+		"trace_state":    "key=value",
+		"name":           "child",
+		"kind":           int32(pdata.SpanKindCLIENT),
+		"duration_ms":    0.999,
+		"status_code":    "Unset",
+	}, evts[1].Attributes)
+}
+
+// Helper method to add span events to the root span created by makeTraces
+func addSpanEvents(td pdata.Traces, start time.Time) {
+	root := td.ResourceSpans().At(0).InstrumentationLibrarySpans().At(0).Spans().At(0)
+	root.Events().Resize(2)
+
+	first := root.Events().At(0)
+	first.SetName("cache miss")
+	first.SetTimestamp(pdata.TimestampFromTime(start.Add(time.Millisecond)))
+	first.Attributes().InsertString("key", "user:1")
+
+	second := root.Events().At(1)
+	second.SetName("retry")
+	second.SetTimestamp(pdata.TimestampFromTime(start.Add(2 * time.Millisecond)))
+}
+
+func TestPushTraceDataSpanEvents(t *testing.T) {
+	// Arrange
+	client := &mockClient{}
+	cfg := &Config{
+		ExporterSettings: config.NewExporterSettings(typeStr),
+		Traces: TracesConfig{
+			UnixTimestamps: true,
+		},
+	}
+	exp := newTracesExporter(cfg, zap.NewNop(), client)
+	start := time.Date(2021, 3, 28, 12, 30, 15, 0, time.UTC)
+	td := makeTraces(start)
+	addSpanEvents(td, start)
+
+	// Act
+	err := exp.pushTraceData(context.Background(), td)
+
+	// Assert
+	require.NoError(t, err)
+	evts := client.structured[0].Events
+	require.Len(t, evts, 2)
+	assert.Equal(t, []map[string]interface{}{
+		{
+			"name":       "cache miss",
+			"timestamp":  start.Add(time.Millisecond).UnixNano() / int64(time.Millisecond),
+			"attributes": map[string]interface{}{"key": "user:1"},
+		},
+		{
+			"name":       "retry",
+			"timestamp":  start.Add(2*time.Millisecond).UnixNano() / int64(time.Millisecond),
+			"attributes": map[string]interface{}{},
+		},
+	}, evts[0].Attributes.(map[string]interface{})["events"])
+
+	// Spans without span events must not carry an empty array
+	assert.NotContains(t, evts[1].Attributes, "events")
+}
+
+func TestPushTraceDataSeparateSpanEvents(t *testing.T) {
+	// Arrange
+	client := &mockClient{}
+	cfg := &Config{
+		ExporterSettings: config.NewExporterSettings(typeStr),
+		Traces: TracesConfig{
+			SeparateSpanEvents: true,
+		},
+	}
+	exp := newTracesExporter(cfg, zap.NewNop(), client)
+	start := time.Date(2021, 3, 28, 12, 30, 15, 0, time.UTC)
+	td := makeTraces(start)
+	addSpanEvents(td, start)
+
+	// Act
+	err := exp.pushTraceData(context.Background(), td)
+
+	// Assert
+	require.NoError(t, err)
+	evts := client.structured[0].Events
+	require.Len(t, evts, 4)
+	assert.NotContains(t, evts[0].Attributes, "events")
+
+	assert.Equal(t, start.Add(time.Millisecond), evts[1].Timestamp)
+	assert.Equal(t, map[string]interface{}{
+		"trace_id": "0102030405060708090a0b0c0d0e0f10",
+		"span_id":  "0a0b0c0d0e0f1011",
+		"name":     "cache miss",
+		"key":      "user:1",
+	}, evts[1].Attributes)
+	assert.Equal(t, "retry", evts[2].Attributes.(map[string]interface{})["name"])
+	assert.Equal(t, "child", evts[3].Attributes.(map[string]interface{})["name"])
+}
+
+func TestPushTraceDataScope(t *testing.T) {
+	// Arrange
+	testCases := []struct {
+		desc     string
+		cfg      *Config
+		name     string
+		version  string
+		expected map[string]interface{}
+	}{
+		{
+			desc:    "Name and version",
+			cfg:     &Config{},
+			name:    "io.opentelemetry.contrib.custom",
+			version: "1.2.0",
+			expected: map[string]interface{}{
+				"scope.name":    "io.opentelemetry.contrib.custom",
+				"scope.version": "1.2.0",
+			},
+		},
+		{
+			desc:     "Name without version",
+			cfg:      &Config{},
+			name:     "io.opentelemetry.contrib.custom",
+			expected: map[string]interface{}{"scope.name": "io.opentelemetry.contrib.custom"},
+		},
+		{
+			desc:     "Empty name",
+			cfg:      &Config{},
+			version:  "1.2.0",
+			expected: map[string]interface{}{},
+		},
+		{
+			desc:    "Custom keys",
+			cfg:     &Config{ScopeNameKey: "library", ScopeVersionKey: "library_version"},
+			name:    "io.opentelemetry.contrib.custom",
+			version: "1.2.0",
+			expected: map[string]interface{}{
+				"library":         "io.opentelemetry.contrib.custom",
+				"library_version": "1.2.0",
+			},
+		},
+	}
+
+	// Act / Assert
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			client := &mockClient{}
+			tC.cfg.ExporterSettings = config.NewExporterSettings(typeStr)
+			tC.cfg.Traces.SeparateSpanEvents = true
+			exp := newTracesExporter(tC.cfg, zap.NewNop(), client)
+			start := time.Now()
+			td := makeTraces(start)
+			addSpanEvents(td, start)
+			lib := td.ResourceSpans().At(0).InstrumentationLibrarySpans().At(0).InstrumentationLibrary()
+			lib.SetName(tC.name)
+			lib.SetVersion(tC.version)
+
+			err := exp.pushTraceData(context.Background(), td)
+
+			require.NoError(t, err)
+			require.Len(t, client.structured, 1)
+			for _, evt := range client.structured[0].Events {
+				attrs := evt.Attributes.(map[string]interface{})
+				for _, key := range []string{"scope.name", "scope.version", "library", "library_version"} {
+					if expected, ok := tC.expected[key]; ok {
+						assert.Equal(t, expected, attrs[key])
+					} else {
+						assert.NotContains(t, attrs, key)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestPushTraceDataDroppedAttributesCount(t *testing.T) {
+	// Arrange
+	client := &mockClient{}
+	exp := newTracesExporter(&Config{ExporterSettings: config.NewExporterSettings(typeStr)}, zap.NewNop(), client)
+	td := makeTraces(time.Now())
+	td.ResourceSpans().At(0).InstrumentationLibrarySpans().At(0).Spans().At(1).SetDroppedAttributesCount(2)
+
+	// Act
+	err := exp.pushTraceData(context.Background(), td)
+
+	// Assert
+	require.NoError(t, err)
+	require.Len(t, client.structured, 1)
+	evts := client.structured[0].Events
+	require.Len(t, evts, 2)
+	assert.NotContains(t, evts[0].Attributes, "dropped_attributes_count")
+	assert.Equal(t, uint32(2), evts[1].Attributes.(map[string]interface{})["dropped_attributes_count"])
+}
+
+func TestSpanKindToString(t *testing.T) {
+	// Arrange
+	testCases := []struct {
+		desc     string
+		kind     pdata.SpanKind
+		expected string
+	}{
+		{desc: "Unspecified", kind: pdata.SpanKindUNSPECIFIED, expected: "Unspecified"},
+		{desc: "Internal", kind: pdata.SpanKindINTERNAL, expected: "Internal"},
+		{desc: "Server", kind: pdata.SpanKindSERVER, expected: "Server"},
+		{desc: "Client", kind: pdata.SpanKindCLIENT, expected: "Client"},
+		{desc: "Producer", kind: pdata.SpanKindPRODUCER, expected: "Producer"},
+		{desc: "Consumer", kind: pdata.SpanKindCONSUMER, expected: "Consumer"},
+		{desc: "Unknown", kind: pdata.SpanKind(42), expected: "Unspecified"},
+	}
+
+	// Act / Assert
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			assert.Equal(t, tC.expected, spanKindToString(tC.kind))
+		})
+	}
+}
+
+func TestPushTraceDataSpanKindField(t *testing.T) {
+	// Arrange
+	testCases := []struct {
+		desc  string
+		field string
+	}{
+		{desc: "Disabled", field: ""},
+		{desc: "Custom field", field: "kind_name"},
+	}
+
+	// Act / Assert
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			client := &mockClient{}
+			cfg := &Config{
+				ExporterSettings: config.NewExporterSettings(typeStr),
+				Traces:           TracesConfig{SpanKindField: tC.field},
+			}
+			exp := newTracesExporter(cfg, zap.NewNop(), client)
+
+			require.NoError(t, exp.pushTraceData(context.Background(), makeTraces(time.Now())))
+			evts := client.structured[0].Events
+			require.Len(t, evts, 2)
+
+			root := evts[0].Attributes.(map[string]interface{})
+			child := evts[1].Attributes.(map[string]interface{})
+			assert.Equal(t, int32(pdata.SpanKindSERVER), root["kind"])
+			assert.Equal(t, int32(pdata.SpanKindCLIENT), child["kind"])
+			if tC.field == "" {
+				assert.NotContains(t, root, "kind_name")
+				return
+			}
+			assert.Equal(t, "Server", root[tC.field])
+			assert.Equal(t, "Client", child[tC.field])
+		})
+	}
+}
+
+func TestPushTraceDataTraceStateFormat(t *testing.T) {
+	// Arrange
+	testCases := []struct {
+		desc       string
+		format     string
+		traceState pdata.TraceState
+		expected   map[string]interface{}
+		wantWarn   bool
+	}{
+		{
+			desc:       "Raw by default",
+			traceState: "rojo=00f067aa0ba902b7,congo=t61rcWkgMzE",
+			expected:   map[string]interface{}{"trace_state": "rojo=00f067aa0ba902b7,congo=t61rcWkgMzE"},
+		},
+		{
+			desc:       "Fields",
+			format:     "fields",
+			traceState: "rojo=00f067aa0ba902b7,congo=t61rcWkgMzE",
+			expected: map[string]interface{}{
+				"trace_state.rojo":  "00f067aa0ba902b7",
+				"trace_state.congo": "t61rcWkgMzE",
+			},
+		},
+		{
+			desc:       "Both",
+			format:     "both",
+			traceState: "rojo=00f067aa0ba902b7,congo=t61rcWkgMzE",
+			expected: map[string]interface{}{
+				"trace_state":       "rojo=00f067aa0ba902b7,congo=t61rcWkgMzE",
+				"trace_state.rojo":  "00f067aa0ba902b7",
+				"trace_state.congo": "t61rcWkgMzE",
+			},
+		},
+		{
+			desc:       "Malformed fields",
+			format:     "fields",
+			traceState: "rojo=00f067aa0ba902b7,Congo",
+			expected:   map[string]interface{}{"trace_state": "rojo=00f067aa0ba902b7,Congo"},
+			wantWarn:   true,
+		},
+		{
+			desc:       "Malformed with both",
+			format:     "both",
+			traceState: "rojo=1,rojo=2",
+			expected:   map[string]interface{}{"trace_state": "rojo=1,rojo=2"},
+			wantWarn:   true,
+		},
+	}
+
+	// Act / Assert
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			td := makeTraces(time.Now())
+			root := td.ResourceSpans().At(0).InstrumentationLibrarySpans().At(0).Spans().At(0)
+			root.SetTraceState(tC.traceState)
+			root.Links().Resize(1)
+			root.Links().At(0).SetTraceState(tC.traceState)
+
+			client := &mockClient{}
+			cfg := &Config{
+				ExporterSettings: config.NewExporterSettings(typeStr),
+				Traces: TracesConfig{
+					TraceStateFormat: tC.format,
+					IncludeLinks:     true,
+				},
+			}
+			core, logs := observer.New(zapcore.WarnLevel)
+			exp := newTracesExporter(cfg, zap.New(core), client)
+
+			require.NoError(t, exp.pushTraceData(context.Background(), td))
+			attrs := client.structured[0].Events[0].Attributes.(map[string]interface{})
+			link := attrs["links"].([]map[string]interface{})[0]
+
+			for _, fields := range []map[string]interface{}{attrs, link} {
+				actual := make(map[string]interface{})
+				for k, v := range fields {
+					if strings.HasPrefix(k, "trace_state") {
+						actual[k] = v
+					}
+				}
+				assert.Equal(t, tC.expected, actual)
+			}
+
+			if tC.wantWarn {
+				assert.Equal(t, 2, logs.Len())
+			} else {
+				assert.Zero(t, logs.Len())
+			}
+		})
+	}
+}
+
+func TestPushTraceDataLinks(t *testing.T) {
+	// Arrange
+	td := makeTraces(time.Now())
+	root := td.ResourceSpans().At(0).InstrumentationLibrarySpans().At(0).Spans().At(0)
+	root.Links().Resize(1)
+	link := root.Links().At(0)
+	link.SetTraceID(pdata.NewTraceID([16]byte{0xf0, 0xe1, 0xd2, 0xc3, 0xb4, 0xa5, 0x96, 0x87, 0x78, 0x69, 0x5a, 0x4b, 0x3c, 0x2d, 0x1e, 0x0f}))
+	link.SetSpanID(pdata.NewSpanID([8]byte{0xff, 0xee, 0xdd, 0xcc, 0xbb, 0xaa, 0x99, 0x88}))
+	link.SetTraceState("vendor=value")
+	link.Attributes().InsertString("reason", "batch")
+
+	testCases := []struct {
+		desc      string
+		include   bool
+		wantLinks interface{}
+	}{
+		{
+			desc:    "Links included",
+			include: true,
+			wantLinks: []map[string]interface{}{
+				{
+					"trace_id":    "f0e1d2c3b4a5968778695a4b3c2d1e0f",
+					"span_id":     "ffeeddccbbaa9988",
+					"trace_state": "vendor=value",
+					"attributes":  map[string]interface{}{"reason": "batch"},
+				},
+			},
+		},
+		{
+			desc:      "Links disabled",
+			include:   false,
+			wantLinks: nil,
+		},
+	}
+
+	// Act / Assert
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			client := &mockClient{}
+			cfg := &Config{
+				ExporterSettings: config.NewExporterSettings(typeStr),
+				Traces:           TracesConfig{IncludeLinks: tC.include},
+			}
+			exp := newTracesExporter(cfg, zap.NewNop(), client)
+
+			require.NoError(t, exp.pushTraceData(context.Background(), td))
+			evts := client.structured[0].Events
+
+			assert.Equal(t, tC.wantLinks, evts[0].Attributes.(map[string]interface{})["links"])
+			assert.NotContains(t, evts[1].Attributes, "links")
+		})
+	}
+}
+
+func TestPushTraceDataAttributePrefixes(t *testing.T) {
+	// Arrange
+	testCases := []struct {
+		desc      string
+		traces    TracesConfig
+		strip     []string
+		namespace bool
+		expected  map[string]interface{}
+	}{
+		{
+			desc:   "Both prefixes",
+			traces: TracesConfig{SpanAttributePrefix: "span.", ResourceAttributePrefix: "resource."},
+			expected: map[string]interface{}{
+				"resource.service.name": "myservice",
+				"resource.shared":       "resource",
+				"span.shared":           "span",
+				"span.count":            int64(5),
+			},
+		},
+		{
+			desc:   "Span prefix only",
+			traces: TracesConfig{SpanAttributePrefix: "span."},
+			expected: map[string]interface{}{
+				"service.name": "myservice",
+				"shared":       "resource",
+				"span.shared":  "span",
+				"span.count":   int64(5),
+			},
+		},
+		{
+			desc:   "Colliding prefixes",
+			traces: TracesConfig{SpanAttributePrefix: "attr.", ResourceAttributePrefix: "attr."},
+			expected: map[string]interface{}{
+				"attr.service.name": "myservice",
+				"attr.shared":       "span",
+				"attr.count":        int64(5),
+			},
+		},
+		{
+			desc:   "Prefixes added after stripping",
+			traces: TracesConfig{ResourceAttributePrefix: "resource."},
+			strip:  []string{"service."},
+			expected: map[string]interface{}{
+				"resource.name":   "myservice",
+				"resource.shared": "resource",
+				"shared":          "span",
+				"count":           int64(5),
+			},
+		},
+		{
+			desc:      "Namespaced by scope",
+			namespace: true,
+			expected: map[string]interface{}{
+				"resource.service.name": "myservice",
+				"resource.shared":       "resource",
+				"span.shared":           "span",
+				"span.count":            int64(5),
+			},
+		},
+		{
+			desc:      "Namespace takes precedence over prefixes",
+			traces:    TracesConfig{SpanAttributePrefix: "attr.", ResourceAttributePrefix: "attr."},
+			namespace: true,
+			expected: map[string]interface{}{
+				"resource.service.name": "myservice",
+				"resource.shared":       "resource",
+				"span.shared":           "span",
+				"span.count":            int64(5),
+			},
+		},
+	}
+
+	// Act / Assert
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			client := &mockClient{}
+			cfg := &Config{
+				ExporterSettings:        config.NewExporterSettings(typeStr),
+				Traces:                  tC.traces,
+				StripAttributeKeyPrefix: tC.strip,
+				NamespaceByScope:        tC.namespace,
+			}
+			exp := newTracesExporter(cfg, zap.NewNop(), client)
+
+			require.NoError(t, exp.pushTraceData(context.Background(), makeTraces(time.Now())))
+			attrs := client.structured[0].Events[0].Attributes.(map[string]interface{})
+
+			for k, v := range tC.expected {
+				assert.Equal(t, v, attrs[k], k)
+			}
+			assert.Len(t, attrs, len(tC.expected)+6)
+			assert.Equal(t, "root", attrs["name"])
+		})
+	}
+}
+
+func TestPushTraceDataDuplicateKeyStrategy(t *testing.T) {
+	// Arrange
+	testCases := []struct {
+		desc     string
+		strategy string
+		traces   TracesConfig
+		expected map[string]interface{}
+	}{
+		{
+			desc:     "Record wins",
+			strategy: duplicateKeyRecordWins,
+			expected: map[string]interface{}{"shared": "span"},
+		},
+		{
+			desc:     "Resource wins",
+			strategy: duplicateKeyResourceWins,
+			expected: map[string]interface{}{"shared": "resource"},
+		},
+		{
+			desc:     "Suffix",
+			strategy: duplicateKeySuffix,
+			expected: map[string]interface{}{
+				"shared.resource": "resource",
+				"shared.span":     "span",
+			},
+		},
+		{
+			desc:     "Suffix with colliding prefixes",
+			strategy: duplicateKeySuffix,
+			traces:   TracesConfig{SpanAttributePrefix: "attr.", ResourceAttributePrefix: "attr."},
+			expected: map[string]interface{}{
+				"attr.shared.resource": "resource",
+				"attr.shared.span":     "span",
+			},
+		},
+	}
+
+	// Act / Assert
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			core, logs := observer.New(zapcore.DebugLevel)
+			client := &mockClient{}
+			cfg := &Config{
+				ExporterSettings:     config.NewExporterSettings(typeStr),
+				Traces:               tC.traces,
+				DuplicateKeyStrategy: tC.strategy,
+			}
+			exp := newTracesExporter(cfg, zap.New(core), client)
+
+			require.NoError(t, exp.pushTraceData(context.Background(), makeTraces(time.Now())))
+			attrs := client.structured[0].Events[0].Attributes.(map[string]interface{})
+
+			for k, v := range tC.expected {
+				assert.Equal(t, v, attrs[k], k)
+			}
+			assert.Len(t, attrs, len(tC.expected)+8)
+
+			resolved := logs.FilterMessage("Resolved a duplicate attribute key").All()
+			require.Len(t, resolved, 1)
+			assert.Equal(t, spanScope, resolved[0].ContextMap()["scope"])
+		})
+	}
+}
+
+func TestPushTraceDataIDFormat(t *testing.T) {
+	// Arrange
+	testCases := []struct {
+		desc     string
+		format   string
+		expected map[string]interface{}
+	}{
+		{
+			desc:   "Default",
+			format: "",
+			expected: map[string]interface{}{
+				"trace_id":       "0102030405060708090a0b0c0d0e0f10",
+				"span_id":        "1a1b1c1d1e1f2021",
+				"parent_span_id": "0a0b0c0d0e0f1011",
+			},
+		},
+		{
+			desc:   "Hex",
+			format: idFormatHex,
+			expected: map[string]interface{}{
+				"trace_id":       "0102030405060708090a0b0c0d0e0f10",
+				"span_id":        "1a1b1c1d1e1f2021",
+				"parent_span_id": "0a0b0c0d0e0f1011",
+			},
+		},
+		{
+			desc:   "Base64",
+			format: idFormatBase64,
+			expected: map[string]interface{}{
+				"trace_id":       "AQIDBAUGBwgJCgsMDQ4PEA==",
+				"span_id":        "GhscHR4fICE=",
+				"parent_span_id": "CgsMDQ4PEBE=",
+			},
+		},
+	}
+
+	// Act / Assert
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			client := &mockClient{}
+			cfg := &Config{
+				ExporterSettings: config.NewExporterSettings(typeStr),
+				Traces: TracesConfig{
+					IDFormat: tC.format,
+				},
+			}
+			exp := newTracesExporter(cfg, zap.NewNop(), client)
+
+			err := exp.pushTraceData(context.Background(), makeTraces(time.Now()))
+
+			require.NoError(t, err)
+			attrs := client.structured[0].Events[1].Attributes.(map[string]interface{})
+			for k, v := range tC.expected {
+				assert.Equal(t, v, attrs[k])
+			}
+		})
+	}
+}
+
+func TestPushTraceDataEmptyIDs(t *testing.T) {
+	// Arrange
+	client := &mockClient{}
+	cfg := &Config{
+		ExporterSettings: config.NewExporterSettings(typeStr),
+		Traces: TracesConfig{
+			IDFormat: idFormatBase64,
+		},
+	}
+	exp := newTracesExporter(cfg, zap.NewNop(), client)
+	td := makeTraces(time.Now())
+	root := td.ResourceSpans().At(0).InstrumentationLibrarySpans().At(0).Spans().At(0)
+	root.SetTraceID(pdata.InvalidTraceID())
+	root.SetSpanID(pdata.InvalidSpanID())
+
+	// Act
+	err := exp.pushTraceData(context.Background(), td)
+
+	// Assert
+	require.NoError(t, err)
+	attrs := client.structured[0].Events[0].Attributes.(map[string]interface{})
+	assert.Equal(t, "", attrs["trace_id"])
+	assert.Equal(t, "", attrs["span_id"])
+	assert.NotContains(t, attrs, "parent_span_id")
+}
+
+func TestPushTraceDataTimestampField(t *testing.T) {
+	// Arrange
+	start := time.Date(2021, 3, 28, 12, 30, 15, 0, time.UTC)
+	testCases := []struct {
+		desc           string
+		traces         TracesConfig
+		expectedSpan   interface{}
+		expectedEvents []interface{}
+	}{
+		{
+			desc:           "Disabled by default",
+			traces:         TracesConfig{SeparateSpanEvents: true},
+			expectedSpan:   nil,
+			expectedEvents: []interface{}{nil, nil},
+		},
+		{
+			desc:           "ISO 8601 timestamps",
+			traces:         TracesConfig{SeparateSpanEvents: true, TimestampField: "event_time"},
+			expectedSpan:   start,
+			expectedEvents: []interface{}{start.Add(time.Millisecond), start.Add(2 * time.Millisecond)},
+		},
+		{
+			desc: "Unix timestamps",
+			traces: TracesConfig{
+				SeparateSpanEvents: true,
+				TimestampField:     "event_time",
+				UnixTimestamps:     true,
+			},
+			expectedSpan:   start.UnixNano() / int64(time.Millisecond),
+			expectedEvents: []interface{}{start.UnixNano()/int64(time.Millisecond) + 1, start.UnixNano()/int64(time.Millisecond) + 2},
+		},
+	}
+
+	// Act / Assert
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			client := &mockClient{}
+			cfg := &Config{ExporterSettings: config.NewExporterSettings(typeStr), Traces: tC.traces}
+			exp := newTracesExporter(cfg, zap.NewNop(), client)
+			td := makeTraces(start)
+			addSpanEvents(td, start)
+
+			require.NoError(t, exp.pushTraceData(context.Background(), td))
+			evts := client.structured[0].Events
+			require.Len(t, evts, 4)
+
+			assert.Equal(t, tC.expectedSpan, evts[0].Attributes.(map[string]interface{})["event_time"])
+			for i, expected := range tC.expectedEvents {
+				assert.Equal(t, expected, evts[i+1].Attributes.(map[string]interface{})["event_time"])
+			}
+		})
+	}
+}
+
+func TestPushTraceDataTimestampUnit(t *testing.T) {
+	// Arrange
+	start := time.Date(2021, 3, 28, 12, 30, 15, 123456789, time.UTC)
+	testCases := []struct {
+		desc     string
+		traces   TracesConfig
+		expected string
+	}{
+		{
+			desc:     "Default",
+			expected: `"2021-03-28T12:30:15.123456789Z"`,
+		},
+		{
+			desc:     "Seconds",
+			traces:   TracesConfig{TimestampUnit: timestampUnitSeconds},
+			expected: `1616934615`,
+		},
+		{
+			desc:     "Milliseconds",
+			traces:   TracesConfig{TimestampUnit: timestampUnitMilliseconds},
+			expected: `1616934615123`,
+		},
+		{
+			desc:     "Nanoseconds",
+			traces:   TracesConfig{TimestampUnit: timestampUnitNanoseconds},
+			expected: `1616934615123456789`,
+		},
+		{
+			desc:     "ISO 8601",
+			traces:   TracesConfig{TimestampUnit: timestampUnitISO8601},
+			expected: `"2021-03-28T12:30:15.123456789Z"`,
+		},
+		{
+			desc:     "Unix timestamps alias",
+			traces:   TracesConfig{UnixTimestamps: true},
+			expected: `1616934615123`,
+		},
+		{
+			desc:     "Unix timestamps alias with nanosecond precision",
+			traces:   TracesConfig{UnixTimestamps: true, TimestampPrecision: precisionNanoseconds},
+			expected: `1616934615123456789`,
+		},
+		{
+			desc:     "Unit takes precedence over the alias",
+			traces:   TracesConfig{UnixTimestamps: true, TimestampUnit: timestampUnitSeconds},
+			expected: `1616934615`,
+		},
+	}
+
+	// Act / Assert
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			client := &mockClient{}
+			tC.traces.TimestampField = "event_time"
+			cfg := &Config{ExporterSettings: config.NewExporterSettings(typeStr), Traces: tC.traces}
+			exp := newTracesExporter(cfg, zap.NewNop(), client)
+
+			require.NoError(t, exp.pushTraceData(context.Background(), makeTraces(start)))
+			b, err := json.Marshal(client.structured[0].Events[0])
+			require.NoError(t, err)
+			var actual struct {
+				Timestamp  json.RawMessage `json:"timestamp"`
+				Attributes struct {
+					EventTime json.RawMessage `json:"event_time"`
+				} `json:"attributes"`
+			}
+			require.NoError(t, json.Unmarshal(b, &actual))
+			assert.Equal(t, tC.expected, string(actual.Timestamp))
+			assert.Equal(t, tC.expected, string(actual.Attributes.EventTime))
+		})
+	}
+}
+
+func TestPushTraceDataIngestTimestampFromEvent(t *testing.T) {
+	// Arrange
+	client := &mockClient{}
+	cfg := &Config{
+		ExporterSettings:         config.NewExporterSettings(typeStr),
+		IngestTimestampFromEvent: true,
+		Traces: TracesConfig{
+			UnixTimestamps:     true,
+			SeparateSpanEvents: true,
+		},
+	}
+	exp := newTracesExporter(cfg, zap.NewNop(), client)
+	start := time.Date(2015, 6, 1, 8, 0, 0, 0, time.UTC)
+	td := makeTraces(start)
+	addSpanEvents(td, start)
+
+	// Act
+	err := exp.pushTraceData(context.Background(), td)
+
+	// Assert
+	require.NoError(t, err)
+	evts := client.structured[0].Events
+	require.Len(t, evts, 4)
+
+	expected := []int64{1433145600000, 1433145600001, 1433145600002}
+	for i, millis := range expected {
+		b, err := json.Marshal(evts[i])
+		require.NoError(t, err)
+		assert.Contains(t, string(b), `"timestamp":`+strconv.FormatInt(millis, 10))
+		assert.Contains(t, string(b), `"@ingesttimestamp":`+strconv.FormatInt(millis, 10))
+	}
+}
+
+func TestPushTraceDataOmitEmptyAttributes(t *testing.T) {
+	// Arrange
+	start := time.Date(2015, 6, 1, 8, 0, 0, 0, time.UTC)
+	marshal := func(omit bool) string {
+		td := makeTraces(start)
+		addSpanEvents(td, start)
+
+		client := &mockClient{}
+		cfg := &Config{
+			ExporterSettings:    config.NewExporterSettings(typeStr),
+			OmitEmptyAttributes: omit,
+			Traces: TracesConfig{
+				UnixTimestamps: true,
+			},
+		}
+		exp := newTracesExporter(cfg, zap.NewNop(), client)
+		require.NoError(t, exp.pushTraceData(context.Background(), td))
+
+		b, err := json.Marshal(client.structured[0].Events[0])
+		require.NoError(t, err)
+		return string(b)
+	}
+
+	// Act
+	kept := marshal(false)
+	omitted := marshal(true)
+
+	// Assert
+	// The second span event has no attributes of its own
+	assert.Contains(t, kept, `{"attributes":{},"name":"retry"`)
+	assert.Equal(t, strings.Replace(kept, `{"attributes":{},"name":"retry"`, `{"name":"retry"`, 1), omitted)
+	assert.Contains(t, omitted, `"timestamp":1433145600000`)
+}
+
+func TestPushTraceDataStaticFields(t *testing.T) {
+	// Arrange
+	client := &mockClient{}
+	cfg := &Config{
+		ExporterSettings: config.NewExporterSettings(typeStr),
+		StaticFields: map[string]string{
+			"name":    "static",
+			"version": "1.2.0",
+		},
+		Traces: TracesConfig{
+			SeparateSpanEvents: true,
+		},
+	}
+	exp := newTracesExporter(cfg, zap.NewNop(), client)
+	start := time.Now()
+	td := makeTraces(start)
+	addSpanEvents(td, start)
+
+	// Act
+	err := exp.pushTraceData(context.Background(), td)
+
+	// Assert
+	require.NoError(t, err)
+	evts := client.structured[0].Events
+	require.Len(t, evts, 4)
+	for _, evt := range evts {
+		attrs := evt.Attributes.(map[string]interface{})
+		assert.Equal(t, "1.2.0", attrs["version"])
+		assert.NotEqual(t, "static", attrs["name"])
+	}
+}
+
+func TestPushTraceDataDropResourceAttributes(t *testing.T) {
+	// Arrange
+	client := &mockClient{}
+	cfg := &Config{
+		ExporterSettings:          config.NewExporterSettings(typeStr),
+		ServiceTagKey:             "service",
+		TagFromResourceAttributes: []string{"cloud.region"},
+		DropResourceAttributes:    []string{"cloud.*"},
+		Traces: TracesConfig{
+			ResourceAttributePrefix: "resource.",
+		},
+	}
+	exp := newTracesExporter(cfg, zap.NewNop(), client)
+	td := makeTraces(time.Now())
+	res := td.ResourceSpans().At(0).Resource()
+	res.Attributes().InsertString("cloud.region", "eu-west-1")
+	res.Attributes().InsertString("cloud.account.id", "1234")
+
+	// Act
+	err := exp.pushTraceData(context.Background(), td)
+
+	// Assert
+	require.NoError(t, err)
+	require.Len(t, client.structured, 1)
+	assert.Equal(t, "eu-west-1", client.structured[0].Tags["cloud.region"])
+	for _, evt := range client.structured[0].Events {
+		attrs := evt.Attributes.(map[string]interface{})
+		assert.NotContains(t, attrs, "resource.cloud.region")
+		assert.NotContains(t, attrs, "resource.cloud.account.id")
+		assert.Equal(t, "resource", attrs["resource.shared"])
+	}
+}
+
+func TestPushTraceDataMaxAttributeValueLength(t *testing.T) {
+	// Arrange
+	client := &mockClient{}
+	cfg := &Config{
+		ExporterSettings:        config.NewExporterSettings(typeStr),
+		MaxAttributeValueLength: 4,
+		StaticFields:            map[string]string{"version": "1.2.0"},
+		Traces: TracesConfig{
+			SeparateSpanEvents: true,
+		},
+	}
+	exp := newTracesExporter(cfg, zap.NewNop(), client)
+	start := time.Now()
+	td := makeTraces(start)
+	addSpanEvents(td, start)
+	root := td.ResourceSpans().At(0).InstrumentationLibrarySpans().At(0).Spans().At(0)
+	root.Events().At(0).Attributes().InsertString("exception.stacktrace", "panic: at main.go:42")
+
+	// Act
+	err := exp.pushTraceData(context.Background(), td)
+
+	// Assert
+	require.NoError(t, err)
+	evts := client.structured[0].Events
+	require.Len(t, evts, 4)
+
+	span := evts[0].Attributes.(map[string]interface{})
+	assert.Equal(t, "m...", span["service.name"])
+	assert.Equal(t, "span", span["shared"])
+	assert.Equal(t, int64(5), span["count"])
+	assert.Equal(t, "1.2.0", span["version"])
+	assert.Equal(t, "0102030405060708090a0b0c0d0e0f10", span["trace_id"])
+
+	event := evts[1].Attributes.(map[string]interface{})
+	assert.Equal(t, "p...", event["exception.stacktrace"])
+	assert.Equal(t, "0a0b0c0d0e0f1011", event["span_id"])
+
+	assertMaxValueLength(t, span["service.name"], 4)
+	assertMaxValueLength(t, event["exception.stacktrace"], 4)
+}
+
+func TestPushTraceDataDropLongAttributeValues(t *testing.T) {
+	// Arrange
+	client := &mockClient{}
+	cfg := &Config{
+		ExporterSettings:        config.NewExporterSettings(typeStr),
+		MaxAttributeValueLength: 4,
+		DropLongAttributeValues: true,
+	}
+	exp := newTracesExporter(cfg, zap.NewNop(), client)
+
+	// Act
+	err := exp.pushTraceData(context.Background(), makeTraces(time.Now()))
+
+	// Assert
+	require.NoError(t, err)
+	attrs := client.structured[0].Events[0].Attributes.(map[string]interface{})
+	assert.NotContains(t, attrs, "service.name")
+	assert.Equal(t, "span", attrs["shared"])
+	assert.Equal(t, int64(5), attrs["count"])
+}
+
+func TestPushTraceDataEmpty(t *testing.T) {
+	// Arrange
+	client := &mockClient{}
+	exp := newTracesExporter(&Config{ExporterSettings: config.NewExporterSettings(typeStr)}, zap.NewNop(), client)
 
 	// Act
 	err := exp.pushTraceData(context.Background(), pdata.NewTraces())
 
 	// Assert
-	assert.True(t, consumererror.IsPermanent(err))
+	require.NoError(t, err)
+	assert.Empty(t, client.structured)
+}
+
+func TestPushTraceDataClientError(t *testing.T) {
+	// Arrange
+	client := &mockClient{err: errors.New("fail")}
+	exp := newTracesExporter(&Config{ExporterSettings: config.NewExporterSettings(typeStr)}, zap.NewNop(), client)
+
+	// Act
+	err := exp.pushTraceData(context.Background(), makeTraces(time.Now()))
+
+	// Assert
+	require.Error(t, err)
+}
+
+func TestSpanTimestampsDistinct(t *testing.T) {
+	// Arrange
+	start := time.Date(2021, 3, 28, 12, 30, 15, 0, time.UTC)
+	testCases := []struct {
+		desc   string
+		traces TracesConfig
+	}{
+		{
+			desc:   "ISO 8601 timestamps",
+			traces: TracesConfig{UnixTimestamps: false},
+		},
+		{
+			desc:   "Unix nanosecond timestamps",
+			traces: TracesConfig{UnixTimestamps: true, TimestampPrecision: "nanoseconds"},
+		},
+	}
+
+	// Act / Assert
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			client := &mockClient{}
+			cfg := &Config{ExporterSettings: config.NewExporterSettings(typeStr), Traces: tC.traces}
+			exp := newTracesExporter(cfg, zap.NewNop(), client)
+
+			require.NoError(t, exp.pushTraceData(context.Background(), makeTraces(start)))
+			evts := client.structured[0].Events
+
+			var first, second struct {
+				Timestamp json.RawMessage `json:"timestamp"`
+			}
+			b, err := json.Marshal(evts[0])
+			require.NoError(t, err)
+			require.NoError(t, json.Unmarshal(b, &first))
+			b, err = json.Marshal(evts[1])
+			require.NoError(t, err)
+			require.NoError(t, json.Unmarshal(b, &second))
+
+			assert.NotEqual(t, string(first.Timestamp), string(second.Timestamp))
+		})
+	}
 }
 
 func TestShutdown(t *testing.T) {
 	// Arrange
-	exp := newTracesExporter(&Config{ExporterSettings: config.NewExporterSettings(typeStr)}, zap.NewNop(), nil)
+	client := &mockClient{}
+	exp := newTracesExporter(&Config{ExporterSettings: config.NewExporterSettings(typeStr)}, zap.NewNop(), client)
 
 	// Act
 	err := exp.shutdown(context.Background())
 
 	// Assert
 	require.NoError(t, err)
+	assert.True(t, client.closed)
+}
+
+func TestPushTraceDataPartialFailure(t *testing.T) {
+	// Arrange
+	client := &mockClient{err: &partialFailureError{err: errors.New("rejected"), failed: []int{1}}}
+	exp := newTracesExporter(&Config{ExporterSettings: config.NewExporterSettings(typeStr)}, zap.NewNop(), client)
+
+	// Act
+	err := exp.pushTraceData(context.Background(), makeTraces(time.Now()))
+
+	// Assert
+	require.Error(t, err)
+	var tracesErr consumererror.Traces
+	require.True(t, consumererror.AsTraces(err, &tracesErr))
+
+	failed := tracesErr.GetTraces()
+	require.Equal(t, 1, failed.SpanCount())
+	rs := failed.ResourceSpans().At(0)
+	service, _ := rs.Resource().Attributes().Get(conventions.AttributeServiceName)
+	assert.Equal(t, "myservice", service.StringVal())
+	assert.Equal(t, "child", rs.InstrumentationLibrarySpans().At(0).Spans().At(0).Name())
+}
+
+func TestPushTraceDataPartialFailureSeparateSpanEvents(t *testing.T) {
+	// Arrange
+	client := &mockClient{err: &partialFailureError{err: errors.New("rejected"), failed: []int{1, 2}}}
+	cfg := &Config{
+		ExporterSettings: config.NewExporterSettings(typeStr),
+		Traces: TracesConfig{
+			SeparateSpanEvents: true,
+		},
+	}
+	exp := newTracesExporter(cfg, zap.NewNop(), client)
+	td := makeTraces(time.Now())
+	addSpanEvents(td, time.Now())
+
+	// Act
+	err := exp.pushTraceData(context.Background(), td)
+
+	// Assert
+	var tracesErr consumererror.Traces
+	require.True(t, consumererror.AsTraces(err, &tracesErr))
+
+	// Rejecting the span events must retry the span they belong to
+	failed := tracesErr.GetTraces()
+	require.Equal(t, 1, failed.SpanCount())
+	assert.Equal(t, "root", failed.ResourceSpans().At(0).InstrumentationLibrarySpans().At(0).Spans().At(0).Name())
+}
+
+func TestPushTraceDataDuration(t *testing.T) {
+	// Arrange
+	start := time.Date(2021, 3, 28, 12, 30, 15, 0, time.UTC)
+	testCases := []struct {
+		desc     string
+		traces   TracesConfig
+		end      pdata.Timestamp
+		expected map[string]interface{}
+	}{
+		{
+			desc:     "Completed span",
+			end:      pdata.TimestampFromTime(start.Add(1500 * time.Microsecond)),
+			expected: map[string]interface{}{"duration_ms": 1.5},
+		},
+		{
+			desc:   "Custom field with nanoseconds",
+			traces: TracesConfig{DurationField: "duration", IncludeDurationNanos: true},
+			end:    pdata.TimestampFromTime(start.Add(1500 * time.Microsecond)),
+			expected: map[string]interface{}{
+				"duration":    1.5,
+				"duration_ns": int64(1500000),
+			},
+		},
+		{
+			desc:   "Zero duration",
+			traces: TracesConfig{IncludeDurationNanos: true},
+			end:    pdata.TimestampFromTime(start),
+			expected: map[string]interface{}{
+				"duration_ms": float64(0),
+				"duration_ns": int64(0),
+			},
+		},
+		{
+			desc:     "Missing end time",
+			traces:   TracesConfig{IncludeDurationNanos: true},
+			end:      0,
+			expected: map[string]interface{}{},
+		},
+		{
+			desc:     "End time before start time",
+			end:      pdata.TimestampFromTime(start.Add(-time.Second)),
+			expected: map[string]interface{}{},
+		},
+	}
+
+	// Act / Assert
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			client := &mockClient{}
+			cfg := &Config{ExporterSettings: config.NewExporterSettings(typeStr), Traces: tC.traces}
+			exp := newTracesExporter(cfg, zap.NewNop(), client)
+
+			td := makeTraces(start)
+			root := td.ResourceSpans().At(0).InstrumentationLibrarySpans().At(0).Spans().At(0)
+			root.SetEndTimestamp(tC.end)
+
+			require.NoError(t, exp.pushTraceData(context.Background(), td))
+			attrs := client.structured[0].Events[0].Attributes.(map[string]interface{})
+
+			durations := map[string]interface{}{}
+			for _, k := range []string{"duration_ms", "duration_ns", "duration"} {
+				if v, ok := attrs[k]; ok {
+					durations[k] = v
+				}
+			}
+			assert.Equal(t, tC.expected, durations)
+		})
+	}
+}
+
+func TestPushTraceDataStatus(t *testing.T) {
+	// Arrange
+	testCases := []struct {
+		desc     string
+		traces   TracesConfig
+		code     pdata.StatusCode
+		message  string
+		expected map[string]interface{}
+	}{
+		{
+			desc:     "Unset",
+			code:     pdata.StatusCodeUnset,
+			expected: map[string]interface{}{"status_code": "Unset"},
+		},
+		{
+			desc:     "Ok",
+			code:     pdata.StatusCodeOk,
+			expected: map[string]interface{}{"status_code": "Ok"},
+		},
+		{
+			desc:    "Error with message",
+			code:    pdata.StatusCodeError,
+			message: "connection refused",
+			expected: map[string]interface{}{
+				"status_code":    "Error",
+				"status_message": "connection refused",
+			},
+		},
+		{
+			desc:     "Unknown code",
+			code:     pdata.StatusCode(42),
+			expected: map[string]interface{}{"status_code": "Unset"},
+		},
+		{
+			desc:    "Custom field names",
+			traces:  TracesConfig{StatusCodeField: "status.code", StatusMessageField: "status.message"},
+			code:    pdata.StatusCodeError,
+			message: "timeout",
+			expected: map[string]interface{}{
+				"status.code":    "Error",
+				"status.message": "timeout",
+			},
+		},
+	}
+
+	// Act / Assert
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			client := &mockClient{}
+			cfg := &Config{ExporterSettings: config.NewExporterSettings(typeStr), Traces: tC.traces}
+			exp := newTracesExporter(cfg, zap.NewNop(), client)
+
+			td := makeTraces(time.Now())
+			root := td.ResourceSpans().At(0).InstrumentationLibrarySpans().At(0).Spans().At(0)
+			root.Status().SetCode(tC.code)
+			root.Status().SetMessage(tC.message)
+
+			require.NoError(t, exp.pushTraceData(context.Background(), td))
+			attrs := client.structured[0].Events[0].Attributes.(map[string]interface{})
+
+			status := map[string]interface{}{}
+			for _, k := range []string{"status_code", "status_message", "status.code", "status.message"} {
+				if v, ok := attrs[k]; ok {
+					status[k] = v
+				}
+			}
+			assert.Equal(t, tC.expected, status)
+		})
+	}
+}
+
+func TestPushTraceDataFieldMapping(t *testing.T) {
+	// Arrange
+	testCases := []struct {
+		desc     string
+		traces   TracesConfig
+		expected map[string]interface{}
+	}{
+		{
+			desc:   "CIM preset",
+			traces: TracesConfig{FieldMappingPreset: fieldMappingPresetCIM},
+			expected: map[string]interface{}{
+				"source":           "myservice",
+				"shared":           "span",
+				"count":            int64(5),
+				"trace.id":         "0102030405060708090a0b0c0d0e0f10",
+				"span.id":          "0a0b0c0d0e0f1011",
+				"span.name":        "root",
+				"span.kind":        int32(pdata.SpanKindSERVER),
+				"duration_ms":      float64(1000),
+				"event.duration":   int64(time.Second),
+				"span.status.code": "Unset",
+			},
+		},
+		{
+			desc: "Custom mapping",
+			traces: TracesConfig{
+				FieldMapping: map[string]string{"name": "operation", "count": "shared"},
+			},
+			expected: map[string]interface{}{
+				"service.name": "myservice",
+				"shared":       int64(5),
+				"trace_id":     "0102030405060708090a0b0c0d0e0f10",
+				"span_id":      "0a0b0c0d0e0f1011",
+				"operation":    "root",
+				"kind":         int32(pdata.SpanKindSERVER),
+				"duration_ms":  float64(1000),
+				"status_code":  "Unset",
+			},
+		},
+		{
+			desc: "Custom mapping overrides the preset",
+			traces: TracesConfig{
+				FieldMappingPreset: fieldMappingPresetCIM,
+				FieldMapping:       map[string]string{"name": "operation", "duration_ms": "duration"},
+			},
+			expected: map[string]interface{}{
+				"source":           "myservice",
+				"shared":           "span",
+				"count":            int64(5),
+				"trace.id":         "0102030405060708090a0b0c0d0e0f10",
+				"span.id":          "0a0b0c0d0e0f1011",
+				"operation":        "root",
+				"span.kind":        int32(pdata.SpanKindSERVER),
+				"duration":         float64(1000),
+				"event.duration":   int64(time.Second),
+				"span.status.code": "Unset",
+			},
+		},
+	}
+
+	// Act / Assert
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			client := &mockClient{}
+			cfg := &Config{ExporterSettings: config.NewExporterSettings(typeStr), Traces: tC.traces}
+			exp := newTracesExporter(cfg, zap.NewNop(), client)
+			start := time.Date(2021, 3, 28, 12, 30, 15, 0, time.UTC)
+
+			err := exp.pushTraceData(context.Background(), makeTraces(start))
+
+			require.NoError(t, err)
+			require.Len(t, client.structured, 1)
+			evts := client.structured[0].Events
+			require.Len(t, evts, 2)
+			assert.Equal(t, start, evts[0].Timestamp)
+			assert.Equal(t, tC.expected, evts[0].Attributes)
+		})
+	}
+}
+
+func TestPushTraceDataRawString(t *testing.T) {
+	// Arrange
+	client := &mockClient{}
+	cfg := &Config{
+		ExporterSettings: config.NewExporterSettings(typeStr),
+		Traces:           TracesConfig{RawStringMode: "only"},
+	}
+	exp := newTracesExporter(cfg, zap.NewNop(), client)
+
+	// Act
+	err := exp.pushTraceData(context.Background(), makeTraces(time.Now()))
+
+	// Assert
+	require.NoError(t, err)
+	require.Len(t, client.structured, 1)
+	evts := client.structured[0].Events
+	require.Len(t, evts, 2)
+	assert.Nil(t, evts[0].Attributes)
+
+	var fields map[string]interface{}
+	require.NoError(t, json.Unmarshal([]byte(evts[0].RawString), &fields))
+	assert.Equal(t, "root", fields["name"])
+	assert.Equal(t, "0a0b0c0d0e0f1011", fields["span_id"])
+	assert.Equal(t, "myservice", fields["service.name"])
+}
+
+func TestPushTraceDataNestedAttributesMatchLogs(t *testing.T) {
+	// Arrange
+	nested := pdata.NewAttributeValueMap()
+	nested.MapVal().InsertString("name", "eu-west-1a")
+	zones := pdata.NewAttributeValueArray()
+	zones.ArrayVal().Append(nested)
+	zones.ArrayVal().Append(pdata.NewAttributeValueInt(2))
+
+	td := makeTraces(time.Now())
+	td.ResourceSpans().At(0).Resource().Attributes().Insert("zones", zones)
+	ld := makeLogs(time.Now())
+	ld.ResourceLogs().At(0).Resource().Attributes().Insert("zones", zones)
+
+	cfg := &Config{ExporterSettings: config.NewExporterSettings(typeStr)}
+	tracesClient, logsClient := &mockClient{}, &mockClient{}
+	traces := newTracesExporter(cfg, zap.NewNop(), tracesClient)
+	logs := newLogsExporter(cfg, zap.NewNop(), logsClient)
+
+	// Act
+	errTraces := traces.pushTraceData(context.Background(), td)
+	errLogs := logs.pushLogsData(context.Background(), ld)
+
+	// Assert
+	require.NoError(t, errTraces)
+	require.NoError(t, errLogs)
+	expected := []interface{}{map[string]interface{}{"name": "eu-west-1a"}, int64(2)}
+	assert.Equal(t, expected, tracesClient.structured[0].Events[0].Attributes.(map[string]interface{})["zones"])
+	assert.Equal(t, expected, logsClient.structured[0].Events[0].Attributes.(map[string]interface{})["zones"])
+}
+
+func TestPushTraceDataCoalescesEqualTags(t *testing.T) {
+	// Arrange
+	client := &mockClient{err: &partialFailureError{err: errors.New("rejected"), failed: []int{1}}}
+	exp := newTracesExporter(&Config{ExporterSettings: config.NewExporterSettings(typeStr), ServiceTagKey: "service"}, zap.NewNop(), client)
+
+	td := pdata.NewTraces()
+	td.ResourceSpans().Resize(3)
+	for i, service := range []string{"a", "b", "a"} {
+		rs := td.ResourceSpans().At(i)
+		rs.Resource().Attributes().InsertString(conventions.AttributeServiceName, service)
+		rs.InstrumentationLibrarySpans().Resize(1)
+		spans := rs.InstrumentationLibrarySpans().At(0).Spans()
+		spans.Resize(1)
+		spans.At(0).SetName("span-" + strconv.Itoa(i))
+	}
+
+	// Act
+	err := exp.pushTraceData(context.Background(), td)
+
+	// Assert
+	require.Len(t, client.structured, 2)
+	assert.Equal(t, map[string]string{"service": "a"}, client.structured[0].Tags)
+	require.Len(t, client.structured[0].Events, 2)
+	assert.Equal(t, "span-0", client.structured[0].Events[0].Attributes.(map[string]interface{})["name"])
+	assert.Equal(t, "span-2", client.structured[0].Events[1].Attributes.(map[string]interface{})["name"])
+	assert.Equal(t, map[string]string{"service": "b"}, client.structured[1].Tags)
+
+	// The rejected event must be traced back to the span it originated from
+	var tracesErr consumererror.Traces
+	require.True(t, consumererror.AsTraces(err, &tracesErr))
+	failed := tracesErr.GetTraces()
+	require.Equal(t, 1, failed.SpanCount())
+	assert.Equal(t, "span-2", failed.ResourceSpans().At(0).InstrumentationLibrarySpans().At(0).Spans().At(0).Name())
 }
@@ -0,0 +1,50 @@
+// Copyright The OpenTelemetry Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package humioexporter
+
+// EventTransform is called with every structured event before it is sent to
+// Humio, and may modify the event in place to add, remove, or rename fields.
+// The attributes of events created by this exporter are a map[string]interface{}
+type EventTransform func(evt *HumioStructuredEvent)
+
+// FactoryOption customizes the exporters created by the factory
+type FactoryOption func(*factoryOptions)
+
+type factoryOptions struct {
+	transform EventTransform
+	signer    RequestSigner
+}
+
+// WithEventTransform registers a transform applied to every structured event,
+// for enrichment that is not covered by the configuration options
+func WithEventTransform(transform EventTransform) FactoryOption {
+	return func(o *factoryOptions) {
+		o.transform = transform
+	}
+}
+
+// Applies the registered transform to every event in the groups, if any. Every
+// retry converts the data again, such that the events of a retry are freshly
+// converted and transformed once more
+func transformEvents(cfg *Config, groups []*HumioStructuredEvents) {
+	if cfg.transform == nil {
+		return
+	}
+	for _, group := range groups {
+		for _, evt := range group.Events {
+			cfg.transform(evt)
+		}
+	}
+}
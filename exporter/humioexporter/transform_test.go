@@ -0,0 +1,81 @@
+// Copyright The OpenTelemetry Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package humioexporter
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWithEventTransform(t *testing.T) {
+	// Arrange
+	var o factoryOptions
+	called := false
+
+	// Act
+	WithEventTransform(func(evt *HumioStructuredEvent) { called = true })(&o)
+
+	// Assert
+	if assert.NotNil(t, o.transform) {
+		o.transform(&HumioStructuredEvent{})
+		assert.True(t, called)
+	}
+}
+
+func TestTransformEvents(t *testing.T) {
+	// Arrange
+	cfg := &Config{
+		transform: func(evt *HumioStructuredEvent) {
+			attrs := evt.Attributes.(map[string]interface{})
+			attrs["renamed"] = attrs["original"]
+			delete(attrs, "original")
+			attrs["added"] = true
+		},
+	}
+	groups := []*HumioStructuredEvents{
+		{
+			Events: []*HumioStructuredEvent{
+				{Timestamp: time.Now(), Attributes: map[string]interface{}{"original": "a"}},
+				{Timestamp: time.Now(), Attributes: map[string]interface{}{"original": "b"}},
+			},
+		},
+	}
+
+	// Act
+	transformEvents(cfg, groups)
+
+	// Assert
+	assert.Equal(t, map[string]interface{}{"renamed": "a", "added": true}, groups[0].Events[0].Attributes)
+	assert.Equal(t, map[string]interface{}{"renamed": "b", "added": true}, groups[0].Events[1].Attributes)
+}
+
+func TestTransformEventsWithoutTransform(t *testing.T) {
+	// Arrange
+	groups := []*HumioStructuredEvents{
+		{
+			Events: []*HumioStructuredEvent{
+				{Timestamp: time.Now(), Attributes: map[string]interface{}{"original": "a"}},
+			},
+		},
+	}
+
+	// Act
+	transformEvents(&Config{}, groups)
+
+	// Assert
+	assert.Equal(t, map[string]interface{}{"original": "a"}, groups[0].Events[0].Attributes)
+}